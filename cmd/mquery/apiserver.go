@@ -30,7 +30,6 @@ import (
 	"mquery/rdb"
 	"net/http"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
@@ -46,7 +45,7 @@ import (
 type apiServer struct {
 	server       *http.Server
 	conf         *cnf.Conf
-	radapter     *rdb.Adapter
+	radapter     rdb.QueryProducer
 	infoProvider *infoload.Manatee
 	statusWriter rdb.StatusWriter
 }
@@ -73,20 +72,30 @@ func (api *apiServer) Start(ctx context.Context) {
 	engine.NoMethod(uniresp.NoMethodHandler)
 	engine.NoRoute(uniresp.NotFoundHandler)
 
-	protectedRouter := engine.Group("/tools")
+	// adminAccess applies to actions modifying server data
+	// (split corpora, saved subcorpora)
+	var adminAccess gin.HandlerFunc
 	if api.conf.Auth.IsDefined() {
 		if api.conf.Auth.ApplyToAdminActionsOnly {
-			protectedRouter.Use(AuthRequired(api.conf))
+			adminAccess = AuthRequired(api.conf)
 
+		} else {
+			// already applied to all the actions
+			adminAccess = func(ctx *gin.Context) {
+				ctx.Next()
+			}
 		}
+
 	} else {
-		protectedRouter.Use(func(ctx *gin.Context) {
+		adminAccess = func(ctx *gin.Context) {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		})
+		}
 	}
+	protectedRouter := engine.Group("/tools")
+	protectedRouter.Use(adminAccess)
 
 	ceActions := corpusActions.NewActions(
-		api.conf.CorporaSetup, api.radapter, api.infoProvider, api.conf.Locales)
+		api.conf.CorporaSetup, api.radapter, api.infoProvider, api.conf.Locales, api.conf.Auth)
 
 	engine.GET("/", mkServerInfo(api.conf))
 
@@ -116,18 +125,36 @@ func (api *apiServer) Start(ctx context.Context) {
 	protectedRouter.POST(
 		"/split/:corpusId", ceActions.SplitCorpus)
 
+	protectedRouter.GET(
+		"/split/:corpusId", ceActions.SplitStatus)
+
+	protectedRouter.POST(
+		"/split/:corpusId/precalc", ceActions.SplitPrecalc)
+
 	protectedRouter.DELETE(
 		"/split/:corpusId", ceActions.DeleteSplit)
 
 	engine.GET(
 		"/info/:corpusId", ceActions.CorpusInfo)
 
+	engine.POST(
+		"/subcorpora/:corpusId", adminAccess, ceActions.CreateSubcorpus)
+
+	engine.GET(
+		"/subcorpora/:corpusId", ceActions.SavedSubcorpora)
+
+	engine.DELETE(
+		"/subcorpora/:corpusId/:subcId", adminAccess, ceActions.DeleteSubcorpus)
+
 	engine.GET(
 		"/corplist", ceActions.Corplist)
 
 	engine.GET(
 		"/term-frequency/:corpusId", ceActions.TermFrequency)
 
+	engine.GET(
+		"/term-frequency2/:corpusId", ceActions.TermFrequencyParallel)
+
 	engine.GET(
 		"/freqs/:corpusId", ceActions.FreqDistrib)
 
@@ -158,6 +185,21 @@ func (api *apiServer) Start(ctx context.Context) {
 	engine.GET(
 		"/collocations/:corpusId", ceActions.Collocations)
 
+	engine.GET(
+		"/collocations2/:corpusId", ceActions.CollocationsParallel)
+
+	engine.GET(
+		"/word-sketch/:corpusId", ceActions.WordSketch)
+
+	engine.GET(
+		"/thesaurus/:corpusId", ceActions.Thesaurus)
+
+	engine.GET(
+		"/keywords/:corpusId", ceActions.Keywords)
+
+	engine.GET(
+		"/wordlist/:corpusId", ceActions.Wordlist)
+
 	engine.GET(
 		"/collocations-extended/:corpusId", ceActions.CollocationsExtended)
 
@@ -179,6 +221,15 @@ func (api *apiServer) Start(ctx context.Context) {
 	engine.GET(
 		"/sentences/:corpusId", ceActions.Sentences)
 
+	engine.POST(
+		"/jobs/:corpusId/:func", ceActions.SubmitJob)
+
+	engine.GET(
+		"/jobs/:jobId", ceActions.GetJob)
+
+	engine.DELETE(
+		"/jobs/:jobId", ceActions.DeleteJob)
+
 	if api.conf.CorporaSetup.AudioFilesDir != "" {
 		engine.GET(
 			"/audio/:corpusId", ceActions.Audio)
@@ -222,29 +273,11 @@ func runApiServer(
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	var statusWriter rdb.StatusWriter
-	var err error
-
-	if conf.Monitoring != nil {
-		statusWriter, err = monitoring.NewTimescaleDBWriter(
-			ctx,
-			conf.Monitoring.DB,
-			conf.TimezoneLocation(),
-			func(err error) {
-				// TODO
-			},
-		)
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to initialize status writer")
-			return
-		}
-		log.Warn().Str("host", conf.Monitoring.DB.Host).Msg("initialized status writer")
-
-	} else {
-		log.Warn().Msg("status writer not specified - NullStatusWriter will be used")
-		statusWriter = new(NullStatusWriter)
+	statusWriter, err := newStatusWriter(ctx, conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize status writer")
+		return
 	}
-
 	radapter := rdb.NewAdapter(conf.Redis, ctx, statusWriter)
 	err = radapter.TestConnection(redisConnectionTestTimeout)
 	if err != nil {
@@ -254,44 +287,36 @@ func runApiServer(
 	infoProvider := infoload.NewManatee(radapter, conf.CorporaSetup)
 	server := newAPIServer(conf, radapter, infoProvider, statusWriter)
 
-	services := []service{server}
-	for _, m := range services {
-		m.Start(ctx)
-	}
-	<-ctx.Done()
-	log.Warn().Msg("shutdown signal received")
-
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var wg sync.WaitGroup
-	for _, s := range services {
-		wg.Add(1)
-		go func(srv service) {
-			defer wg.Done()
-			if err := srv.Stop(shutdownCtx); err != nil {
-				log.Error().Err(err).Type("service", srv).Msg("Error shutting down service")
-			}
-		}(s)
-	}
+	reaper := rdb.NewOrphanedQueriesReaper(radapter)
 
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
+	runServices(ctx, []service{server, reaper})
+}
 
-	select {
-	case <-done:
-		log.Info().Msg("Graceful shutdown completed")
-	case <-shutdownCtx.Done():
-		log.Warn().Msg("Shutdown timed out")
+// newStatusWriter creates a status writer based on the monitoring
+// configuration. Without monitoring, NullStatusWriter is used.
+func newStatusWriter(ctx context.Context, conf *cnf.Conf) (rdb.StatusWriter, error) {
+	if conf.Monitoring == nil {
+		log.Warn().Msg("status writer not specified - NullStatusWriter will be used")
+		return new(NullStatusWriter), nil
+	}
+	statusWriter, err := monitoring.NewTimescaleDBWriter(
+		ctx,
+		conf.Monitoring.DB,
+		conf.TimezoneLocation(),
+		func(err error) {
+			// TODO
+		},
+	)
+	if err != nil {
+		return nil, err
 	}
+	log.Warn().Str("host", conf.Monitoring.DB.Host).Msg("initialized status writer")
+	return statusWriter, nil
 }
 
 func newAPIServer(
 	conf *cnf.Conf,
-	radapter *rdb.Adapter,
+	radapter rdb.QueryProducer,
 	infoProvider *infoload.Manatee,
 	statusWriter rdb.StatusWriter,
 ) *apiServer {
@@ -20,7 +20,6 @@ package main
 import (
 	"context"
 	"crypto/sha256"
-	"encoding/gob"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -30,11 +29,11 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/czcorpus/cnc-gokit/logging"
 	"github.com/czcorpus/cnc-gokit/uniresp"
-	"github.com/czcorpus/mquery-common/concordance"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 
@@ -42,8 +41,6 @@ import (
 	"mquery/cnf"
 	"mquery/corpus/handlers"
 	"mquery/general"
-	"mquery/merror"
-	"mquery/rdb"
 	"mquery/rdb/results"
 )
 
@@ -59,32 +56,7 @@ var (
 )
 
 func init() {
-	gob.Register(rdb.CorpusInfoArgs{})
-	gob.Register(rdb.FreqDistribArgs{})
-	gob.Register(rdb.CollocationsArgs{})
-	gob.Register(rdb.TermFrequencyArgs{})
-	gob.Register(rdb.ConcordanceArgs{})
-	gob.Register(rdb.CalcCollFreqDataArgs{})
-	gob.Register(rdb.TextTypeNormsArgs{})
-	gob.Register(rdb.TokenContextArgs{})
-	gob.Register(rdb.TextTypesAvailValuesArgs{})
-	gob.Register(results.CollFreqData{})
-	gob.Register(results.Collocations{})
-	gob.Register(results.ConcSize{})
-	gob.Register(results.Concordance{})
-	gob.Register(results.CorpusInfo{})
-	gob.Register(results.FreqDistrib{})
-	gob.Register(results.TextTypeNorms{})
-	gob.Register(results.TokenContext{})
-	gob.Register(results.TextTypesAvailValues{})
-	gob.Register(&concordance.Token{})
-	gob.Register(&concordance.Struct{})
-	gob.Register(&concordance.CloseStruct{})
-	gob.Register(merror.InputError{})
-	gob.Register(merror.InternalError{})
-	gob.Register(merror.RecoveredError{})
-	gob.Register(merror.TimeoutError{})
-	gob.Register(rdb.ErrorResult{})
+	results.RegisterResultTypes()
 }
 
 type service interface {
@@ -92,6 +64,44 @@ type service interface {
 	Stop(ctx context.Context) error
 }
 
+// runServices starts all the services and waits for the `ctx`
+// to be cancelled (typically by a signal). Then all the services
+// are stopped.
+func runServices(ctx context.Context, services []service) {
+	for _, m := range services {
+		m.Start(ctx)
+	}
+	<-ctx.Done()
+	log.Warn().Msg("shutdown signal received")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, s := range services {
+		wg.Add(1)
+		go func(srv service) {
+			defer wg.Done()
+			if err := srv.Stop(shutdownCtx); err != nil {
+				log.Error().Err(err).Type("service", srv).Msg("Error shutting down service")
+			}
+		}(s)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info().Msg("Graceful shutdown completed")
+	case <-shutdownCtx.Done():
+		log.Warn().Msg("Shutdown timed out")
+	}
+}
+
 func getEnv(name string) string {
 	for _, p := range os.Environ() {
 		items := strings.Split(p, "=")
@@ -253,6 +263,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "MQUERY - A specialized corpus querying server\n\n")
 		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] server [config.json]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] worker [config.json]\n\t", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] standalone [config.json]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "%s [options] version\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
 	}
@@ -293,6 +304,8 @@ func main() {
 		runApiServer(conf)
 	case "worker":
 		runWorker(conf)
+	case "standalone":
+		runStandalone(conf)
 	default:
 		log.Fatal().Msgf("Unknown action %s", action)
 	}
@@ -0,0 +1,52 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"mquery/cnf"
+	"mquery/corpus/infoload"
+	"mquery/rdb"
+	"mquery/worker"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// runStandalone runs both the API server and a worker within
+// a single process. Queries are passed via rdb.InProcBroker so
+// no Redis server is needed.
+func runStandalone(conf *cnf.Conf) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	statusWriter, err := newStatusWriter(ctx, conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize status writer")
+		return
+	}
+	broker := rdb.NewInProcBroker(conf.Redis, statusWriter)
+	log.Info().Msg("running in standalone mode with in-process job broker")
+
+	infoProvider := infoload.NewManatee(broker, conf.CorporaSetup)
+	server := newAPIServer(conf, broker, infoProvider, statusWriter)
+	wrk := worker.NewWorker(
+		getWorkerID(), broker, broker.Subscribe(), conf.Worker, conf.CorporaSetup)
+
+	runServices(ctx, []service{server, wrk})
+}
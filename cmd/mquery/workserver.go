@@ -25,9 +25,8 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
-	"sync"
+	"strings"
 	"syscall"
-	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -40,6 +39,18 @@ func getWorkerID() (workerID string) {
 	return
 }
 
+// getWorkerQueues returns names of queues the worker should
+// take queries from. An empty value means all the queues.
+func getWorkerQueues() []string {
+	ans := make([]string, 0, 5)
+	for _, v := range strings.Split(getEnv("WORKER_QUEUES"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ans = append(ans, v)
+		}
+	}
+	return ans
+}
+
 // -------
 
 type NullLogger struct{}
@@ -61,6 +72,15 @@ func runWorker(conf *cnf.Conf) {
 	defer stop()
 
 	radapter := rdb.NewAdapter(conf.Redis, ctx, &NullStatusWriter{})
+	if queues := getWorkerQueues(); len(queues) > 0 {
+		if err := radapter.SelectQueues(queues); err != nil {
+			log.Fatal().Err(err).Msg("failed to set worker queues")
+		}
+	}
+	log.Info().
+		Str("workerId", workerID).
+		Strs("queues", radapter.ConsumedQueues()).
+		Msg("worker queues set")
 
 	err := radapter.TestConnection(redisConnectionTestTimeout)
 	if err != nil {
@@ -68,39 +88,7 @@ func runWorker(conf *cnf.Conf) {
 	}
 
 	ch := radapter.Subscribe()
-	wrk := worker.NewWorker(workerID, radapter, ch)
+	wrk := worker.NewWorker(workerID, radapter, ch, conf.Worker, conf.CorporaSetup)
 
-	services := []service{wrk}
-	for _, m := range services {
-		m.Start(ctx)
-	}
-	<-ctx.Done()
-	log.Warn().Msg("shutdown signal received")
-
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var wg sync.WaitGroup
-	for _, s := range services {
-		wg.Add(1)
-		go func(srv service) {
-			defer wg.Done()
-			if err := srv.Stop(shutdownCtx); err != nil {
-				log.Error().Err(err).Type("service", srv).Msg("Error shutting down service")
-			}
-		}(s)
-	}
-
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-
-	select {
-	case <-done:
-		log.Info().Msg("Graceful shutdown completed")
-	case <-shutdownCtx.Done():
-		log.Warn().Msg("Shutdown timed out")
-	}
+	runServices(ctx, []service{wrk})
 }
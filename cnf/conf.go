@@ -24,6 +24,7 @@ import (
 	"mquery/corpus"
 	"mquery/monitoring"
 	"mquery/rdb"
+	"mquery/worker"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -129,6 +130,7 @@ type Conf struct {
 	TimeZone               string               `json:"timeZone"`
 	PrivacyPolicy          PrivacyPolicy        `json:"privacyPolicy"`
 
+	Worker     *worker.Conf     `json:"worker"`
 	Monitoring *monitoring.Conf `json:"monitoring"`
 	Auth       *AuthConf        `json:"auth"`
 	srcPath    string
@@ -235,6 +237,24 @@ func ValidateAndDefaults(conf *Conf) {
 	if err := conf.CorporaSetup.ValidateAndDefaults("corporaSetup"); err != nil {
 		log.Fatal().Err(err).Msg("invalid configuration")
 	}
+	if conf.Redis == nil {
+		conf.Redis = &rdb.Conf{} // e.g. the standalone mode needs no Redis
+	}
+	if err := conf.Redis.ValidateAndDefaults("redis"); err != nil {
+		log.Fatal().Err(err).Msg("invalid configuration")
+	}
+	if conf.Worker == nil {
+		conf.Worker = &worker.Conf{}
+	}
+	if conf.Worker.MaxNumConcurrentJobs == 0 {
+		conf.Worker.MaxNumConcurrentJobs = dfltMaxNumConcurrentJobs
+		log.Warn().
+			Int("value", conf.Worker.MaxNumConcurrentJobs).
+			Msg("`worker.maxNumConcurrentJobs` not set, using default")
+	}
+	if err := conf.Worker.ValidateAndDefaults("worker"); err != nil {
+		log.Fatal().Err(err).Msg("invalid configuration")
+	}
 	if conf.TimeZone == "" {
 		log.Warn().
 			Str("timeZone", dfltTimeZone).
@@ -19,6 +19,8 @@
 package corpus
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"mquery/rdb"
@@ -32,19 +34,107 @@ import (
 
 var (
 	ErrNotFound = errors.New("corpus not found or available")
+
+	// ErrSplitCorpusOutdated means that a split corpus
+	// does not match the corpus anymore
+	ErrSplitCorpusOutdated = errors.New("split corpus is outdated")
 )
 
 // ------------------ split corpus (into multiple subcorpora) -------------------------
 
+const (
+	// SplitManifestFile is a file stored along with chunks
+	// of a split corpus describing how the corpus was split
+	SplitManifestFile = "split.json"
+)
+
+// SplitChunk describes a chunk of a split corpus
+type SplitChunk struct {
+
+	// File is a name of the chunk subcorpus file
+	// (relative to the split corpus directory)
+	File string `json:"file"`
+
+	From int64 `json:"from"`
+
+	// To is the first position not included in the chunk
+	To int64 `json:"to"`
+}
+
+// SplitManifest records parameters of a split corpus so
+// it is possible to detect that the split does not match
+// the corpus anymore (e.g. after the corpus was updated).
+type SplitManifest struct {
+	CorpusSize int64 `json:"corpusSize"`
+	ChunkSize  int64 `json:"chunkSize"`
+
+	// AlignStruct is a structure (e.g. `doc`) chunk
+	// boundaries are aligned to. An empty value means
+	// the corpus was split into fixed position ranges.
+	AlignStruct string `json:"alignStruct,omitempty"`
+
+	Chunks  []SplitChunk `json:"chunks"`
+	Created time.Time    `json:"created"`
+}
+
+// Validate tests whether the manifest matches the current
+// corpus size and whether all the chunk files exist
+func (m *SplitManifest) Validate(splitDir string, corpusSize int64) error {
+	if m.CorpusSize != corpusSize {
+		return fmt.Errorf(
+			"%w (split for size %d, current corpus size %d), please create it again",
+			ErrSplitCorpusOutdated, m.CorpusSize, corpusSize)
+	}
+	if len(m.Chunks) == 0 {
+		return fmt.Errorf("%w - manifest contains no chunks", ErrSplitCorpusOutdated)
+	}
+	for _, chunk := range m.Chunks {
+		isFile, err := fs.IsFile(filepath.Join(splitDir, chunk.File))
+		if err != nil {
+			return fmt.Errorf("failed to test chunk %s: %w", chunk.File, err)
+		}
+		if !isFile {
+			return fmt.Errorf("%w - missing chunk %s", ErrSplitCorpusOutdated, chunk.File)
+		}
+	}
+	return nil
+}
+
+// LoadSplitManifest loads a manifest of a split corpus stored
+// in `splitDir`. For split corpora created without a manifest,
+// nil is returned along with no error.
+func LoadSplitManifest(splitDir string) (*SplitManifest, error) {
+	data, err := os.ReadFile(filepath.Join(splitDir, SplitManifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load split corpus manifest: %w", err)
+	}
+	var ans SplitManifest
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return nil, fmt.Errorf("failed to load split corpus manifest: %w", err)
+	}
+	return &ans, nil
+}
+
 type SplitCorpus struct {
 	CorpusPath string
 	Subcorpora []string
+
+	// Manifest describes the split. It is nil for
+	// split corpora created without a manifest.
+	Manifest *SplitManifest
 }
 
 func (sc *SplitCorpus) GetSubcorpora() []string {
 	return sc.Subcorpora
 }
 
+// OpenSplitCorpus opens a split corpus. In case the split corpus has
+// a manifest (see SplitManifest), it is validated against the current
+// corpus size and chunks are listed in the manifest order. Otherwise,
+// all the subcorpus files found in the split corpus directory are used.
 func OpenSplitCorpus(subcBaseDir, corpPath string) (*SplitCorpus, error) {
 	ans := &SplitCorpus{
 		CorpusPath: corpPath,
@@ -52,6 +142,24 @@ func OpenSplitCorpus(subcBaseDir, corpPath string) (*SplitCorpus, error) {
 	}
 	corpName := filepath.Base(corpPath)
 	p := filepath.Join(subcBaseDir, corpName)
+	manifest, err := LoadSplitManifest(p)
+	if err != nil {
+		return ans, fmt.Errorf("failed to open split corpus: %w", err)
+	}
+	if manifest != nil {
+		corpusSize, err := splitCorpusSizes.get(corpPath)
+		if err != nil {
+			return ans, fmt.Errorf("failed to open split corpus: %w", err)
+		}
+		if err := manifest.Validate(p, corpusSize); err != nil {
+			return ans, fmt.Errorf("failed to open split corpus: %w", err)
+		}
+		ans.Manifest = manifest
+		for _, chunk := range manifest.Chunks {
+			ans.Subcorpora = append(ans.Subcorpora, filepath.Join(p, chunk.File))
+		}
+		return ans, nil
+	}
 	files, err := os.ReadDir(p)
 	if err != nil {
 		return ans, fmt.Errorf("failed to open split corpus: %w", err)
@@ -67,14 +175,32 @@ func OpenSplitCorpus(subcBaseDir, corpPath string) (*SplitCorpus, error) {
 
 // --------------- saved subcorpus ----------------------------
 
+// CheckSavedSubcorpus returns a path to a saved subcorpus data file
+// and tests whether it exists. In case the subcorpus has metadata
+// (see SavedSubcorpus), it must also belong to the corpus `corp`.
 func CheckSavedSubcorpus(baseDir, corp, subcID string) (string, bool) {
-	path := filepath.Join(baseDir, subcID[:2], subcID, "data.subc")
+	if len(subcID) < 2 {
+		return subcID, false
+	}
+	path := SavedSubcorpusPath(baseDir, subcID)
 	isf, err := fs.IsFile(path)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to check saved subcorpus path")
 		return path, false
 	}
-	return path, isf
+	if !isf {
+		return path, false
+	}
+	meta, err := LoadSavedSubcorpus(baseDir, subcID)
+	if err == ErrSubcorpusNotFound {
+		// a subcorpus stored by other tools (i.e. with no metadata)
+		return path, true
+
+	} else if err != nil {
+		log.Error().Err(err).Str("subcorpus", subcID).Msg("failed to check saved subcorpus metadata")
+		return path, false
+	}
+	return path, meta.CorpusID == corp
 }
 
 // ------------------------------------------------------------
@@ -85,5 +211,6 @@ type QueryHandler interface {
 	// The workerTimeout value can be 0 (or even negative) in which case,
 	// default configured value is used instead. I.e. there is no way
 	// how to make a query with an infinite timeout.
-	PublishQuery(query rdb.Query, workerTimeout time.Duration) (<-chan rdb.WorkerResult, error)
+	// Cancelling the `ctx` cancels the query.
+	PublishQuery(ctx context.Context, query rdb.Query, workerTimeout time.Duration) (<-chan rdb.WorkerResult, error)
 }
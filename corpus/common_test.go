@@ -0,0 +1,63 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSplitManifestMissing(t *testing.T) {
+	manifest, err := LoadSplitManifest(t.TempDir())
+	assert.NoError(t, err)
+	assert.Nil(t, manifest)
+}
+
+func TestSplitManifestValidate(t *testing.T) {
+	dir := t.TempDir()
+	manifest := SplitManifest{
+		CorpusSize:  1000,
+		ChunkSize:   500,
+		AlignStruct: "doc",
+		Chunks: []SplitChunk{
+			{File: "chunk_00.subc", From: 0, To: 480},
+			{File: "chunk_01.subc", From: 480, To: 1000},
+		},
+	}
+	data, err := json.Marshal(manifest)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, SplitManifestFile), data, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "chunk_00.subc"), []byte{}, 0644))
+
+	loaded, err := LoadSplitManifest(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "doc", loaded.AlignStruct)
+	assert.Len(t, loaded.Chunks, 2)
+	err = loaded.Validate(dir, 1000)
+	assert.ErrorIs(t, err, ErrSplitCorpusOutdated)
+	assert.ErrorContains(t, err, "missing chunk chunk_01.subc")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "chunk_01.subc"), []byte{}, 0644))
+	assert.NoError(t, loaded.Validate(dir, 1000))
+	assert.ErrorIs(t, loaded.Validate(dir, 1200), ErrSplitCorpusOutdated)
+}
@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/czcorpus/cnc-gokit/fs"
+	"github.com/czcorpus/rexplorer/parser"
 	"github.com/rs/zerolog/log"
 )
 
@@ -33,6 +34,7 @@ const (
 	DfltPosAttrDelimiter          = 47
 	DfltMaximumRecords            = 50
 	DfltMaximumTokenContextWindow = 50
+	DfltDocStructure              = "doc"
 )
 
 type PosAttrDelimiter int
@@ -69,6 +71,10 @@ type CorporaSetup struct {
 	// I.e. the value only affects newly created splits.
 	MultiprocChunkSize int64 `json:"multiprocChunkSize"`
 
+	// SplitChunkRetries specifies how many times a failed
+	// calculation of a split corpus chunk is retried
+	SplitChunkRetries int `json:"splitChunkRetries"`
+
 	MktokencovPath string `json:"mktokencovPath"`
 
 	ConfFilesDir       string    `json:"confFilesDir"`
@@ -77,6 +83,17 @@ type CorporaSetup struct {
 	AudioFilesDir      string    `json:"audioFilesDir"`
 	ZeroConfCorpora    bool      `json:"zeroConfCorpora"`
 
+	// WordSketchDefsDir is a directory containing sketch grammars
+	// (see GenWSDefFilename). If empty, the `WSDEF` registry value
+	// of a corpus is used.
+	WordSketchDefsDir string `json:"wordSketchDefsDir"`
+
+	// WordSketchDataDir is a directory containing word sketch
+	// and thesaurus data precompiled by Manatee (see GenWSBaseFilename
+	// and GenWSThesFilename). If empty or if the data are missing
+	// for a corpus, word sketches are calculated on the fly.
+	WordSketchDataDir string `json:"wordSketchDataDir"`
+
 	autoConfCache map[string]*MQCorpusSetup
 }
 
@@ -155,6 +172,37 @@ func (cs *CorporaSetup) GetRegistryPath(corpusID string) string {
 	return filepath.Join(cs.RegistryDir, corpusID)
 }
 
+// HasStructure tests whether the registry file of a corpus
+// defines a structure `name`.
+func (cs *CorporaSetup) HasStructure(corpusID, name string) (bool, error) {
+	tmp, err := os.ReadFile(cs.GetRegistryPath(corpusID))
+	if err != nil {
+		return false, fmt.Errorf("failed to read registry of %s: %w", corpusID, err)
+	}
+	reg, err := parser.ParseRegistryBytes(corpusID, tmp)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse registry of %s: %w", corpusID, err)
+	}
+	return reg.GetStructure(name) != nil, nil
+}
+
+// DocStructure returns a structure representing documents
+// of a corpus (the DOCSTRUCTURE registry value, `doc` by default)
+func (cs *CorporaSetup) DocStructure(corpusID string) (string, error) {
+	tmp, err := os.ReadFile(cs.GetRegistryPath(corpusID))
+	if err != nil {
+		return "", fmt.Errorf("failed to read registry of %s: %w", corpusID, err)
+	}
+	reg, err := parser.ParseRegistryBytes(corpusID, tmp)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse registry of %s: %w", corpusID, err)
+	}
+	if v := reg.Entries.Get("DOCSTRUCTURE").Value(); v != "" {
+		return v, nil
+	}
+	return DfltDocStructure, nil
+}
+
 func (cs *CorporaSetup) ValidateAndDefaults(confContext string) error {
 	if cs == nil {
 		return fmt.Errorf("missing configuration section `%s`", confContext)
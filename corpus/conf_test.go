@@ -0,0 +1,87 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/corp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasStructure(t *testing.T) {
+	dir := t.TempDir()
+	reg := `PATH "/corpora/data/testcorp/"
+ATTRIBUTE word
+ATTRIBUTE lemma
+STRUCTURE doc {
+	ATTRIBUTE id
+}
+STRUCTURE s
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "testcorp"), []byte(reg), 0644))
+	cs := &CorporaSetup{RegistryDir: dir}
+
+	ok, err := cs.HasStructure("testcorp", "s")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = cs.HasStructure("testcorp", "doc")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = cs.HasStructure("testcorp", "p")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = cs.HasStructure("missing", "s")
+	assert.Error(t, err)
+}
+
+func TestDocStructure(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(
+		filepath.Join(dir, "corp1"), []byte("ATTRIBUTE word\nDOCSTRUCTURE \"text\"\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "corp2"), []byte("ATTRIBUTE word\n"), 0644))
+	cs := &CorporaSetup{RegistryDir: dir}
+
+	v, err := cs.DocStructure("corp1")
+	assert.NoError(t, err)
+	assert.Equal(t, "text", v)
+	v, err = cs.DocStructure("corp2")
+	assert.NoError(t, err)
+	assert.Equal(t, DfltDocStructure, v)
+	_, err = cs.DocStructure("missing")
+	assert.Error(t, err)
+}
+
+func TestSyntaxDeprelAttr(t *testing.T) {
+	cs := &MQCorpusSetup{
+		CorpusSetup: corp.CorpusSetup{
+			FullName: map[string]string{"en": "Test corpus"},
+			PosAttrs: corp.PosAttrList{{Name: "word"}, {Name: "afun"}},
+		},
+	}
+	assert.Equal(t, DfltSyntaxDeprelAttr, cs.DeprelAttr())
+	cs.SyntaxDeprelAttr = "afun"
+	assert.Equal(t, "afun", cs.DeprelAttr())
+	assert.NoError(t, cs.ValidateAndDefaults())
+	cs.SyntaxDeprelAttr = "deprel"
+	assert.Error(t, cs.ValidateAndDefaults())
+}
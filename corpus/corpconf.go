@@ -24,6 +24,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/czcorpus/mquery-common/corp"
@@ -34,9 +35,18 @@ import (
 // Single corpus configuration types
 // ----------------------------------------
 
+// DfltSyntaxDeprelAttr is a positional attribute with a dependency
+// relation type used in case SyntaxDeprelAttr is not configured
+const DfltSyntaxDeprelAttr = "deprel"
+
 type MQCorpusSetup struct {
 	corp.CorpusSetup
-	IsDisabled             bool `json:"isDisabled"`
+	IsDisabled bool `json:"isDisabled"`
+
+	// SyntaxDeprelAttr is a positional attribute containing a dependency
+	// relation type (e.g. `deprel` in UD corpora). It complements
+	// `syntaxConcordance.parentAttr` (see DeprelAttr).
+	SyntaxDeprelAttr       string `json:"syntaxDeprelAttr"`
 	fullConcTextPropsAttrs []string
 }
 
@@ -44,6 +54,16 @@ func (cs *MQCorpusSetup) FullConcTextPropsAttrs() []string {
 	return cs.fullConcTextPropsAttrs
 }
 
+// DeprelAttr returns a positional attribute containing a dependency
+// relation type. In case none is configured, DfltSyntaxDeprelAttr
+// is returned.
+func (cs *MQCorpusSetup) DeprelAttr() string {
+	if cs.SyntaxDeprelAttr != "" {
+		return cs.SyntaxDeprelAttr
+	}
+	return DfltSyntaxDeprelAttr
+}
+
 func (cs *MQCorpusSetup) ValidateAndDefaults() error {
 	if cs.CorpusSetup.IsDynamic() {
 		for _, variant := range cs.CorpusSetup.Variants {
@@ -75,6 +95,9 @@ func (cs *MQCorpusSetup) ValidateAndDefaults() error {
 			return fmt.Errorf("invalid text property %s", prop)
 		}
 	}
+	if cs.SyntaxDeprelAttr != "" && !slices.Contains(cs.CorpusSetup.PosAttrs.GetIDs(), cs.SyntaxDeprelAttr) {
+		return fmt.Errorf("`syntaxDeprelAttr` %s is not among `posAttrs`", cs.SyntaxDeprelAttr)
+	}
 	if cs.CorpusSetup.MaximumTokenContextWindow == 0 {
 		log.Warn().
 			Int("value", DfltMaximumTokenContextWindow).
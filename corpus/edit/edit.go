@@ -20,15 +20,17 @@ package edit
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"math"
 	"mquery/corpus"
 	"mquery/mango"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/czcorpus/cnc-gokit/fs"
-	"github.com/czcorpus/cnc-gokit/maths"
 )
 
 const (
@@ -68,17 +70,38 @@ func DeleteSplit(subcBaseDir, corpusPath string) error {
 	return nil
 }
 
-func SplitCorpus(subcBaseDir, corpusPath string, chunkSize int64) (*corpus.SplitCorpus, error) {
+// SplitCorpus splits a corpus into chunks (subcorpora) of approx. `chunkSize`
+// positions. With a non-empty `alignStruct` (e.g. `doc`), chunk boundaries
+// are aligned to the structure so no structure is divided between two chunks.
+// Parameters of the split are stored in a manifest (see corpus.SplitManifest).
+func SplitCorpus(subcBaseDir, corpusPath string, chunkSize int64, alignStruct string) (*corpus.SplitCorpus, error) {
 
 	ans := &corpus.SplitCorpus{CorpusPath: corpusPath}
-	size, err := mango.GetCorpusSize(corpusPath)
+	if chunkSize <= 0 {
+		return ans, fmt.Errorf("failed create split corpus: invalid chunk size %d", chunkSize)
+	}
+	corp, err := mango.OpenCorpus(corpusPath)
+	if err != nil {
+		return ans, fmt.Errorf("failed create split corpus: %w", err)
+	}
+	defer corp.Close()
+	size, err := corp.Size()
 	if err != nil {
 		return ans, fmt.Errorf("failed create split corpus: %w", err)
 	}
+	// aligned chunks cannot outnumber the fixed ones
 	numChunks := int(math.Ceil(float64(size) / float64(chunkSize)))
 	if numChunks > maxReasonableNumChunks {
 		return ans, fmt.Errorf("failed create split corpus: too much chunks (%d vs. limit %d)", numChunks, maxReasonableNumChunks)
 	}
+	bounds := fixedSplitBounds(size, chunkSize)
+	if alignStruct != "" {
+		bounds, err = corp.StructAlignedSplit(alignStruct, chunkSize)
+		if err != nil {
+			return ans, fmt.Errorf("failed create split corpus: %w", err)
+		}
+	}
+	numChunks = len(bounds) - 1
 	ans.Subcorpora = make([]string, numChunks)
 	cname := filepath.Base(corpusPath)
 	corpDir := filepath.Join(subcBaseDir, cname)
@@ -90,27 +113,99 @@ func SplitCorpus(subcBaseDir, corpusPath string, chunkSize int64) (*corpus.Split
 		os.Mkdir(corpDir, 0755)
 	}
 
+	manifest := &corpus.SplitManifest{
+		CorpusSize:  size,
+		ChunkSize:   chunkSize,
+		AlignStruct: alignStruct,
+		Chunks:      make([]corpus.SplitChunk, numChunks),
+		Created:     time.Now(),
+	}
 	for i := 0; i < numChunks; i++ {
-		path := filepath.Join(subcBaseDir, cname, fmt.Sprintf("chunk_%02d.subc", i))
-		limit := maths.Min(int64(i+1)*chunkSize, size)
-		err := createSubcorpus(path, int64(i)*chunkSize, limit)
+		name := fmt.Sprintf("chunk_%02d.subc", i)
+		path := filepath.Join(corpDir, name)
+		err := createSubcorpus(path, bounds[i], bounds[i+1])
 		if err != nil {
 			return ans, fmt.Errorf("failed to create split corpus: %w", err)
 		}
 		ans.Subcorpora[i] = path
+		manifest.Chunks[i] = corpus.SplitChunk{File: name, From: bounds[i], To: bounds[i+1]}
 	}
+	if err := writeSplitManifest(corpDir, manifest); err != nil {
+		return ans, fmt.Errorf("failed to create split corpus: %w", err)
+	}
+	ans.Manifest = manifest
 	return ans, nil
 }
 
+// fixedSplitBounds returns boundaries of chunks of `chunkSize` positions
+// (the last chunk can be smaller) in the format of mango.Corpus.StructAlignedSplit
+func fixedSplitBounds(size, chunkSize int64) []int64 {
+	ans := []int64{0}
+	for i := int64(1); i*chunkSize < size; i++ {
+		ans = append(ans, i*chunkSize)
+	}
+	return append(ans, size)
+}
+
+func writeSplitManifest(corpDir string, manifest *corpus.SplitManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to write split corpus manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(corpDir, corpus.SplitManifestFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write split corpus manifest: %w", err)
+	}
+	return nil
+}
+
 func createSubcorpus(path string, fromIdx int64, toIdx int64) error {
-	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	_, err := WriteSubcorpus(path, []mango.PosRange{{From: fromIdx, To: toIdx}})
+	return err
+}
+
+// WriteSubcorpus stores a subcorpus consisting of position ranges in
+// the Manatee format (pairs of 64-bit little-endian positions). The ranges
+// are expected to be sorted and non-overlapping (see NormalizeRanges).
+// The number of positions of the subcorpus is returned.
+func WriteSubcorpus(path string, ranges []mango.PosRange) (int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer file.Close()
-	bytesBuffer := make([]byte, 8, 8*2)
-	binary.LittleEndian.PutUint64(bytesBuffer, uint64(fromIdx))
-	bytesBuffer = binary.LittleEndian.AppendUint64(bytesBuffer, uint64(toIdx))
+	var size int64
+	bytesBuffer := make([]byte, 0, 8*2*len(ranges))
+	for _, rng := range ranges {
+		bytesBuffer = binary.LittleEndian.AppendUint64(bytesBuffer, uint64(rng.From))
+		bytesBuffer = binary.LittleEndian.AppendUint64(bytesBuffer, uint64(rng.To))
+		size += rng.To - rng.From
+	}
 	_, err = file.Write(bytesBuffer)
-	return err
+	return size, err
+}
+
+// NormalizeRanges validates position ranges [from, to) against
+// a corpus size and returns them sorted with overlapping and
+// adjacent ranges merged.
+func NormalizeRanges(ranges [][2]int64, corpusSize int64) ([]mango.PosRange, error) {
+	ans := make([]mango.PosRange, 0, len(ranges))
+	for _, rng := range ranges {
+		if rng[0] < 0 || rng[0] >= rng[1] || rng[1] > corpusSize {
+			return nil, fmt.Errorf("invalid range [%d, %d) for corpus size %d", rng[0], rng[1], corpusSize)
+		}
+		ans = append(ans, mango.PosRange{From: rng[0], To: rng[1]})
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		return ans[i].From < ans[j].From
+	})
+	merged := make([]mango.PosRange, 0, len(ans))
+	for _, rng := range ans {
+		if len(merged) > 0 && rng.From <= merged[len(merged)-1].To {
+			merged[len(merged)-1].To = max(merged[len(merged)-1].To, rng.To)
+
+		} else {
+			merged = append(merged, rng)
+		}
+	}
+	return merged, nil
 }
@@ -0,0 +1,54 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package edit
+
+import (
+	"encoding/binary"
+	"mquery/mango"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeRanges(t *testing.T) {
+	ans, err := NormalizeRanges([][2]int64{{50, 60}, {0, 10}, {5, 20}, {20, 30}}, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []mango.PosRange{{From: 0, To: 30}, {From: 50, To: 60}}, ans)
+}
+
+func TestNormalizeRangesInvalid(t *testing.T) {
+	_, err := NormalizeRanges([][2]int64{{0, 10}, {90, 101}}, 100)
+	assert.Error(t, err)
+	_, err = NormalizeRanges([][2]int64{{10, 10}}, 100)
+	assert.Error(t, err)
+}
+
+func TestWriteSubcorpus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.subc")
+	size, err := WriteSubcorpus(path, []mango.PosRange{{From: 0, To: 30}, {From: 50, To: 60}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(40), size)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, data, 32)
+	assert.Equal(t, uint64(50), binary.LittleEndian.Uint64(data[16:24]))
+	assert.Equal(t, uint64(60), binary.LittleEndian.Uint64(data[24:32]))
+}
@@ -0,0 +1,224 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package edit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mquery/rdb"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	subcFreqFileSuffix     = ".frq"
+	subcCoverageFileSuffix = ".token"
+
+	// PrecalcRecordFile is a file (within a split corpus directory)
+	// with the most recent precalculation record (see PrecalcRecord)
+	PrecalcRecordFile = "precalc.json"
+
+	// PrecalcStatusExpired is a status of a chunk whose job record
+	// is not available anymore (expired or removed). In such case,
+	// precalculated data can still be found via FindChunkPrecalc.
+	PrecalcStatusExpired rdb.JobStatus = "expired"
+)
+
+var (
+	ErrPrecalcRunning = errors.New("precalculation of the split corpus is already running")
+)
+
+// ChunkPrecalc lists data precalculated for a split corpus chunk
+type ChunkPrecalc struct {
+
+	// Attrs are positional attributes with compiled frequencies
+	Attrs []string `json:"attrs"`
+
+	// Structs are structures with calculated token coverage
+	Structs []string `json:"structs"`
+}
+
+// FindChunkPrecalc detects precalculated data of a split corpus chunk.
+// Manatee stores them along with the subcorpus file (e.g. `chunk_00.subc`)
+// as `chunk_00.[attr].frq` (see mango.Corpus.CompileSubcFreqs) and
+// `chunk_00.[struct].token` (see `mktokencov`).
+func FindChunkPrecalc(splitDir, chunkFile string) (ChunkPrecalc, error) {
+	ans := ChunkPrecalc{Attrs: []string{}, Structs: []string{}}
+	prefix := strings.TrimSuffix(chunkFile, filepath.Ext(chunkFile)) + "."
+	entries, err := os.ReadDir(splitDir)
+	if err != nil {
+		return ans, err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok {
+			continue
+		}
+		if attr, ok := strings.CutSuffix(name, subcFreqFileSuffix); ok {
+			ans.Attrs = append(ans.Attrs, attr)
+
+		} else if strct, ok := strings.CutSuffix(name, subcCoverageFileSuffix); ok {
+			ans.Structs = append(ans.Structs, strct)
+		}
+	}
+	return ans, nil
+}
+
+// PrecalcChunkState describes a chunk within a precalculation job
+type PrecalcChunkState struct {
+
+	// Num is a chunk number within the split corpus (starting with 1)
+	Num  int    `json:"num"`
+	File string `json:"file"`
+
+	// JobID is an ID of the chunk's job (see rdb.JobInfo)
+	JobID  string        `json:"jobId"`
+	Status rdb.JobStatus `json:"status"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// PrecalcRecord is a persistent record of the most recent precalculation
+// of data (see rdb.CalcCollFreqDataArgs) for chunks of a split corpus.
+// Each chunk is processed as a separate job (see rdb.QueryProducer.SubmitJob)
+// and the record refers to the jobs. It is stored in the split corpus
+// directory so it is shared by all the API server instances and it is
+// removed along with the split corpus.
+type PrecalcRecord struct {
+	Attrs   []string            `json:"attrs"`
+	Structs []string            `json:"structs"`
+	Created time.Time           `json:"created"`
+	Chunks  []PrecalcChunkState `json:"chunks"`
+}
+
+// WritePrecalcRecord stores a precalculation record to a split corpus directory
+func WritePrecalcRecord(splitDir string, rec *PrecalcRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to write precalculation record: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(splitDir, PrecalcRecordFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write precalculation record: %w", err)
+	}
+	return nil
+}
+
+// LoadPrecalcRecord loads a precalculation record from a split corpus
+// directory. In case there is no record, nil is returned along with no error.
+func LoadPrecalcRecord(splitDir string) (*PrecalcRecord, error) {
+	data, err := os.ReadFile(filepath.Join(splitDir, PrecalcRecordFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load precalculation record: %w", err)
+	}
+	var ans PrecalcRecord
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return nil, fmt.Errorf("failed to load precalculation record: %w", err)
+	}
+	return &ans, nil
+}
+
+// PrecalcJob describes the state of a precalculation
+// of a split corpus (see PrecalcRecord)
+type PrecalcJob struct {
+	CorpusID    string              `json:"corpusId"`
+	Attrs       []string            `json:"attrs"`
+	Structs     []string            `json:"structs"`
+	Status      rdb.JobStatus       `json:"status"`
+	Created     time.Time           `json:"created"`
+	NumFinished int                 `json:"numFinished"`
+	Chunks      []PrecalcChunkState `json:"chunks"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// FailedChunks returns numbers of chunks which failed
+// (or have been cancelled) in the job
+func (job *PrecalcJob) FailedChunks() []int {
+	ans := make([]int, 0, len(job.Chunks))
+	for _, ch := range job.Chunks {
+		if ch.Status.IsFinal() && ch.Status != rdb.JobStatusFinished {
+			ans = append(ans, ch.Num)
+		}
+	}
+	return ans
+}
+
+// IsRunning tests whether some chunks are still being processed
+func (job *PrecalcJob) IsRunning() bool {
+	return !job.Status.IsFinal() && job.Status != PrecalcStatusExpired
+}
+
+// CompilePrecalcJob determines the state of a precalculation from
+// the states of its chunk jobs. Chunks with job records not found
+// (e.g. expired) have the status PrecalcStatusExpired.
+func CompilePrecalcJob(
+	corpusID string,
+	rec *PrecalcRecord,
+	getJob func(jobID string) (rdb.JobInfo, error),
+) (PrecalcJob, error) {
+	ans := PrecalcJob{
+		CorpusID: corpusID,
+		Attrs:    rec.Attrs,
+		Structs:  rec.Structs,
+		Created:  rec.Created,
+		Chunks:   slices.Clone(rec.Chunks),
+	}
+	var numRunning, numExpired int
+	failed := make([]string, 0, len(ans.Chunks))
+	for i, ch := range ans.Chunks {
+		job, err := getJob(ch.JobID)
+		if errors.Is(err, rdb.ErrJobNotFound) {
+			ans.Chunks[i].Status = PrecalcStatusExpired
+			numExpired++
+			continue
+
+		} else if err != nil {
+			return ans, fmt.Errorf("failed to get state of chunk %d: %w", ch.Num, err)
+		}
+		ans.Chunks[i].Status = job.Status
+		ans.Chunks[i].Error = job.Error
+		if job.Status.IsFinal() {
+			ans.NumFinished++
+			if job.Status != rdb.JobStatusFinished {
+				failed = append(failed, strconv.Itoa(ch.Num))
+			}
+
+		} else {
+			numRunning++
+		}
+	}
+	switch {
+	case numRunning > 0:
+		ans.Status = rdb.JobStatusRunning
+	case len(failed) > 0:
+		ans.Status = rdb.JobStatusFailed
+		ans.Error = fmt.Sprintf("failed to calculate chunks %s", strings.Join(failed, ","))
+	case numExpired == len(ans.Chunks):
+		ans.Status = PrecalcStatusExpired
+	default:
+		ans.Status = rdb.JobStatusFinished
+	}
+	return ans, nil
+}
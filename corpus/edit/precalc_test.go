@@ -0,0 +1,110 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package edit
+
+import (
+	"errors"
+	"mquery/rdb"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindChunkPrecalc(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"chunk_00.subc", "chunk_00.word.frq", "chunk_00.lemma.frq", "chunk_00.doc.token",
+		"chunk_01.subc", "chunk_01.word.frq", "split.json",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{}, 0644))
+	}
+	ans, err := FindChunkPrecalc(dir, "chunk_00.subc")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"word", "lemma"}, ans.Attrs)
+	assert.Equal(t, []string{"doc"}, ans.Structs)
+}
+
+func TestPrecalcRecord(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := LoadPrecalcRecord(dir)
+	assert.NoError(t, err)
+	assert.Nil(t, rec)
+
+	assert.NoError(t, WritePrecalcRecord(dir, &PrecalcRecord{
+		Attrs:  []string{"word"},
+		Chunks: []PrecalcChunkState{{Num: 2, File: "chunk_01.subc", JobID: "j2"}},
+	}))
+	rec, err = LoadPrecalcRecord(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"word"}, rec.Attrs)
+	assert.Equal(t, "j2", rec.Chunks[0].JobID)
+}
+
+func TestCompilePrecalcJob(t *testing.T) {
+	rec := &PrecalcRecord{
+		Attrs: []string{"word"},
+		Chunks: []PrecalcChunkState{
+			{Num: 2, File: "chunk_01.subc", JobID: "j2"},
+			{Num: 5, File: "chunk_04.subc", JobID: "j5"},
+			{Num: 7, File: "chunk_06.subc", JobID: "j7"},
+		},
+	}
+	jobs := map[string]rdb.JobInfo{
+		"j2": {ID: "j2", Status: rdb.JobStatusFinished},
+		"j5": {ID: "j5", Status: rdb.JobStatusRunning},
+	}
+	getJob := func(jobID string) (rdb.JobInfo, error) {
+		job, ok := jobs[jobID]
+		if !ok {
+			return job, rdb.ErrJobNotFound
+		}
+		return job, nil
+	}
+
+	job, err := CompilePrecalcJob("corp1", rec, getJob)
+	assert.NoError(t, err)
+	assert.Equal(t, rdb.JobStatusRunning, job.Status)
+	assert.True(t, job.IsRunning())
+	assert.Equal(t, 1, job.NumFinished)
+	assert.Equal(t, PrecalcStatusExpired, job.Chunks[2].Status)
+
+	jobs["j5"] = rdb.JobInfo{ID: "j5", Status: rdb.JobStatusFailed, Error: "mktokencov failed"}
+	job, err = CompilePrecalcJob("corp1", rec, getJob)
+	assert.NoError(t, err)
+	assert.Equal(t, rdb.JobStatusFailed, job.Status)
+	assert.False(t, job.IsRunning())
+	assert.Equal(t, []int{5}, job.FailedChunks())
+	assert.Equal(t, "failed to calculate chunks 5", job.Error)
+	assert.Equal(t, "mktokencov failed", job.Chunks[1].Error)
+	assert.Empty(t, rec.Chunks[1].Status)
+
+	delete(jobs, "j2")
+	delete(jobs, "j5")
+	job, err = CompilePrecalcJob("corp1", rec, getJob)
+	assert.NoError(t, err)
+	assert.Equal(t, PrecalcStatusExpired, job.Status)
+	assert.False(t, job.IsRunning())
+
+	_, err = CompilePrecalcJob("corp1", rec, func(string) (rdb.JobInfo, error) {
+		return rdb.JobInfo{}, errors.New("connection refused")
+	})
+	assert.Error(t, err)
+}
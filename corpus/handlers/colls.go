@@ -19,10 +19,15 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"mquery/corpus"
+	"mquery/mango"
 	"mquery/rdb"
 	"mquery/rdb/results"
 	"net/http"
+	"regexp"
+	"slices"
 
 	"github.com/czcorpus/cnc-gokit/unireq"
 	"github.com/czcorpus/cnc-gokit/uniresp"
@@ -38,6 +43,10 @@ const (
 	DefaultCollMaxItems    = 20
 )
 
+var (
+	collStructRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+)
+
 type collArgs struct {
 	queryProps  queryProps
 	measure     string
@@ -118,6 +127,106 @@ func (a *Actions) fetchCollActionArgs(ctx *gin.Context) (collArgs, bool) {
 	return ans, true
 }
 
+// collocationsArgs parses and validates arguments of the Collocations action.
+// In case of an error, a respective HTTP response is written and false is returned.
+func (a *Actions) collocationsArgs(ctx *gin.Context) (rdb.CollocationsArgs, bool) {
+	collArgs, ok := a.fetchCollActionArgs(ctx)
+	if !ok {
+		return rdb.CollocationsArgs{}, false
+	}
+	srchAttr := ctx.Request.URL.Query().Get("srchAttr")
+	if srchAttr == "" {
+		srchAttr = CollDefaultAttr
+	}
+	filters, ok := parseConcFiltersOrFail(ctx)
+	if !ok {
+		return rdb.CollocationsArgs{}, false
+	}
+	sample, ok := parseConcSampleOrFail(ctx)
+	if !ok {
+		return rdb.CollocationsArgs{}, false
+	}
+	srchStruct := ctx.Query("srchStruct")
+	if srchStruct != "" {
+		if !collStructRegexp.MatchString(srchStruct) {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				fmt.Errorf("invalid srchStruct %s", srchStruct),
+				http.StatusBadRequest,
+			)
+			return rdb.CollocationsArgs{}, false
+		}
+		hasStruct, err := a.conf.HasStructure(collArgs.queryProps.corpus, srchStruct)
+		if err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+			return rdb.CollocationsArgs{}, false
+		}
+		if !hasStruct {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				fmt.Errorf("invalid srchStruct - unknown structure %s", srchStruct),
+				http.StatusBadRequest,
+			)
+			return rdb.CollocationsArgs{}, false
+		}
+	}
+	syntax, err := collSyntaxArgs(ctx, collArgs.queryProps)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return rdb.CollocationsArgs{}, false
+	}
+	return rdb.CollocationsArgs{
+		CorpusPath: a.conf.GetRegistryPath(collArgs.queryProps.corpus),
+		SubcPath:   collArgs.queryProps.savedSubcorpus,
+		Query:      collArgs.queryProps.query,
+		Attr:       srchAttr,
+		Measure:    collArgs.measure,
+		// Note: see the range below and note that the left context
+		// is published differently (as a positive number) in contrast
+		// with the "internals" where a negative number is required
+		SrchRange:   [2]int{-collArgs.srchLeft, collArgs.srchRight},
+		MinFreq:     int64(collArgs.minCollFreq),
+		MinCorpFreq: int64(collArgs.minCorpFreq),
+		MaxItems:    collArgs.maxItems,
+		SrchStruct:  srchStruct,
+		Syntax:      syntax,
+		Filters:     filters,
+		Sample:      sample,
+	}, true
+}
+
+// collSyntaxArgs parses and validates the `syntaxRel` and `deprel` arguments.
+// Syntactic relations are available only for corpora with configured
+// `syntaxConcordance.parentAttr`. Relation types are searched in
+// the attribute configured via `syntaxDeprelAttr` (`deprel` by default).
+func collSyntaxArgs(ctx *gin.Context, props queryProps) (rdb.CollSyntaxArgs, error) {
+	ans := rdb.CollSyntaxArgs{
+		Rel:    ctx.Query("syntaxRel"),
+		Deprel: ctx.Query("deprel"),
+	}
+	if ans.Rel == "" {
+		if ans.Deprel != "" {
+			return rdb.CollSyntaxArgs{}, errors.New("deprel requires syntaxRel")
+		}
+		return rdb.CollSyntaxArgs{}, nil
+	}
+	if ans.Rel != rdb.CollSyntaxRelDependent && ans.Rel != rdb.CollSyntaxRelHead {
+		return rdb.CollSyntaxArgs{}, fmt.Errorf("invalid syntaxRel %s", ans.Rel)
+	}
+	ans.ParentAttr = props.corpusConf.SyntaxConcordance.ParentAttr
+	if ans.ParentAttr == "" {
+		return rdb.CollSyntaxArgs{}, errors.New("the corpus does not support syntactic relations")
+	}
+	if ans.Deprel != "" {
+		deprelAttr := props.corpusConf.DeprelAttr()
+		if !slices.Contains(props.corpusConf.PosAttrs.GetIDs(), deprelAttr) {
+			return rdb.CollSyntaxArgs{}, fmt.Errorf("the corpus does not provide the %s attribute", deprelAttr)
+		}
+		ans.DeprelAttr = deprelAttr
+	}
+	return ans, nil
+}
+
 // Collocations godoc
 // @Summary      Collocations
 // @Description  Calculate a defined collocation profile of a searched expression. Values are sorted in descending order by their collocation score.
@@ -131,38 +240,24 @@ func (a *Actions) fetchCollActionArgs(ctx *gin.Context) (collArgs, bool) {
 // @Param        srchAttr query string false "a positional attribute considered when collocations are calculated ()" default(lemma)
 // @Param        minCollFreq query int false " the minimum frequency that a collocate must have in the searched range." default(3)
 // @Param        maxItems query int false "maximum number of result items" default(20)
+// @Param        srchStruct query string false "if set, candidates are searched only within the structure (e.g. `s` for sentences) containing the searched term (the srchLeft and srchRight ranges still apply)"
+// @Param        syntaxRel query string false "if set, candidates are limited to dependents of the searched term or to its head (only for corpora with syntactic annotation)" enums(dependent, head)
+// @Param        deprel query string false "a dependency relation type (e.g. `amod`) of the syntactic relation; for `dependent`, the relation of a candidate is tested, for `head`, the relation of the searched term is tested"
+// @Param        filter query []string false "A concordance filter in the format TYPE:LEFT:RIGHT:QUERY where TYPE is p (positive) or n (negative), optionally followed by l (range relative to the last KWIC token) and/or x (exclude KWIC). Filters can be repeated and are applied in order." collectionFormat(multi)
+// @Param        sample query int false "If set, the concordance is reduced to a random sample of the size (applied after filters)" minimum(0)
+// @Param        seed query int false "A seed for the random sample - the same seed always produces the same sample" default(0)
 // @Success      200 {object} results.CollocationsResponse
 // @Router       /collocations/{corpusId} [get]
 func (a *Actions) Collocations(ctx *gin.Context) {
-	collArgs, ok := a.fetchCollActionArgs(ctx)
+	args, ok := a.collocationsArgs(ctx)
 	if !ok {
 		return
 	}
-
-	corpusPath := a.conf.GetRegistryPath(collArgs.queryProps.corpus)
-
-	srchAttr := ctx.Request.URL.Query().Get("srchAttr")
-	if srchAttr == "" {
-		srchAttr = CollDefaultAttr
-	}
-
 	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
 		rdb.Query{
 			Func: "collocations",
-			Args: rdb.CollocationsArgs{
-				CorpusPath: corpusPath,
-				SubcPath:   collArgs.queryProps.savedSubcorpus,
-				Query:      collArgs.queryProps.query,
-				Attr:       srchAttr,
-				Measure:    collArgs.measure,
-				// Note: see the range below and note that the left context
-				// is published differently (as a positive number) in contrast
-				// with the "internals" where a negative number is required
-				SrchRange:   [2]int{-collArgs.srchLeft, collArgs.srchRight},
-				MinFreq:     int64(collArgs.minCollFreq),
-				MinCorpFreq: int64(collArgs.minCorpFreq),
-				MaxItems:    collArgs.maxItems,
-			},
+			Args: args,
 		},
 		GetCTXStoredTimeout(ctx),
 	)
@@ -188,3 +283,102 @@ func (a *Actions) Collocations(ctx *gin.Context) {
 		&result,
 	)
 }
+
+// CollocationsParallel godoc
+// @Summary      CollocationsParallel
+// @Description  Calculate a collocation profile the same way as the `collocations` action but in parallel on chunks of a split corpus. Chunks provide raw co-occurrence counts and collocate frequencies and the scores are calculated from the merged counts. The `subcorpus` argument is not supported.
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus to search in"
+// @Param        q query string true "The translated query"
+// @Param        measure query string false "a collocation measure" enums(absFreq, logLikelihood, logDice, minSensitivity, mutualInfo, mutualInfo3, mutualInfoLogF, relFreq, tScore) default(logDice)
+// @Param        srchLeft query int false "left range for candidates searching; values must be greater or equal to 1 (1 stands for words right before the searched term)" default(5)
+// @Param        srchRight query int false "right range for candidates searching; values must be greater or equal to 1 (1 stands for words right after the searched term)" default(5)
+// @Param        srchAttr query string false "a positional attribute considered when collocations are calculated ()" default(lemma)
+// @Param        minCollFreq query int false " the minimum frequency that a collocate must have in the searched range." default(3)
+// @Param        maxItems query int false "maximum number of result items" default(20)
+// @Param        srchStruct query string false "if set, candidates are searched only within the structure (e.g. `s` for sentences) containing the searched term (the srchLeft and srchRight ranges still apply)"
+// @Param        syntaxRel query string false "if set, candidates are limited to dependents of the searched term or to its head (only for corpora with syntactic annotation)" enums(dependent, head)
+// @Param        deprel query string false "a dependency relation type (e.g. `amod`) of the syntactic relation; for `dependent`, the relation of a candidate is tested, for `head`, the relation of the searched term is tested"
+// @Param        filter query []string false "A concordance filter in the format TYPE:LEFT:RIGHT:QUERY where TYPE is p (positive) or n (negative), optionally followed by l (range relative to the last KWIC token) and/or x (exclude KWIC). Filters can be repeated and are applied in order." collectionFormat(multi)
+// @Param        allowPartial query int false "If 1, then a result is produced even if some chunks of the split corpus fail (see the X-Missing-Chunks header)"
+// @Success      200 {object} results.CollocationsResponse
+// @Header       200 {string} X-Missing-Chunks "Comma-separated numbers of chunks missing in a partial result"
+// @Router       /collocations2/{corpusId} [get]
+func (a *Actions) CollocationsParallel(ctx *gin.Context) {
+	args, ok := a.collocationsArgs(ctx)
+	if !ok {
+		return
+	}
+	if args.SubcPath != "" {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New("subcorpora are not supported by parallel collocations"),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if args.Sample.Size > 0 {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New("sampling is not supported by parallel collocations"),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if _, err := mango.ImportCollMeasure(args.Measure); err != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("invalid measure %s: %w", args.Measure, err),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	sc, err := corpus.OpenSplitCorpus(a.conf.SplitCorporaDir, args.CorpusPath)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			splitCorpusErrorStatus(err, http.StatusInternalServerError),
+		)
+		return
+	}
+
+	merger := results.NewCollCountsMerger()
+	report, err := corpus.Gather(
+		ctx.Request.Context(),
+		a.newScatterGather(ctx),
+		sc.Subcorpora,
+		func(chunk corpus.Chunk) rdb.Query {
+			// chunks provide complete raw counts, the minimum
+			// frequencies and the limit are applied after merging
+			chunkArgs := rdb.CollocationCountsArgs(args)
+			chunkArgs.SubcPath = chunk.SubcPath
+			return rdb.Query{
+				Func: "collocationCounts",
+				Args: chunkArgs,
+			}
+		},
+		func(chunk corpus.Chunk, resultNext results.CollCounts, err error) {
+			if err == nil {
+				merger.Add(&resultNext)
+			}
+		},
+	)
+	if err != nil {
+		respondGatherError(ctx, err)
+		return
+	}
+	writeGatherReport(ctx, report)
+	result, err := merger.Result(args.Measure, args.MinFreq, args.MinCorpFreq, args.MaxItems)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+		return
+	}
+	result.SrchRange = args.SrchRange
+	result.SrchRange[0] = -1 * result.SrchRange[0] // note: HTTP and internal API are different
+	uniresp.WriteJSONResponse(
+		ctx.Writer,
+		&result,
+	)
+}
@@ -0,0 +1,57 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"mquery/corpus"
+	"mquery/rdb"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/corp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollSyntaxArgsDeprelAttr(t *testing.T) {
+	corpusConf := &corpus.MQCorpusSetup{
+		CorpusSetup: corp.CorpusSetup{
+			PosAttrs:          corp.PosAttrList{{Name: "word"}, {Name: "parent"}, {Name: "afun"}},
+			SyntaxConcordance: corp.SyntaxConcordance{ParentAttr: "parent"},
+		},
+	}
+	props := queryProps{corpusConf: corpusConf}
+	ctx, _ := newTestContext("syntaxRel=dependent&deprel=Atr")
+
+	// no `deprel` attribute in the corpus
+	_, err := collSyntaxArgs(ctx, props)
+	assert.Error(t, err)
+
+	corpusConf.SyntaxDeprelAttr = "afun"
+	args, err := collSyntaxArgs(ctx, props)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		rdb.CollSyntaxArgs{
+			Rel:        rdb.CollSyntaxRelDependent,
+			ParentAttr: "parent",
+			Deprel:     "Atr",
+			DeprelAttr: "afun",
+		},
+		args,
+	)
+}
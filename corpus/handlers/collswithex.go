@@ -193,6 +193,7 @@ func (a *Actions) CollocationsExtended(ctx *gin.Context) {
 	}
 
 	wait1, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
 		rdb.Query{
 			Func: "collocations",
 			Args: rdb.CollocationsArgs{
@@ -230,6 +231,7 @@ func (a *Actions) CollocationsExtended(ctx *gin.Context) {
 	} else {
 		corpus2Path := a.conf.GetRegistryPath(cmpCorp)
 		wait2, err2 = a.radapter.PublishQuery(
+			ctx.Request.Context(),
 			rdb.Query{
 				Func: "collocations",
 				Args: rdb.CollocationsArgs{
@@ -325,6 +327,7 @@ func (a *Actions) CollocationsExtended(ctx *gin.Context) {
 				defer wg.Done()
 				escapedWord := strings.ReplaceAll(collItem.Word, "\"", "\\\"")
 				wait, err := a.radapter.PublishQuery(
+					ctx.Request.Context(),
 					rdb.Query{
 						Func: "concordance",
 						Args: rdb.ConcordanceArgs{
@@ -37,6 +37,10 @@ import (
 
 const (
 	TimeoutCtxKey = "workerTimeout"
+
+	// MissingChunksHeader lists chunks of a split corpus missing
+	// in a partial result (see the `allowPartial` argument)
+	MissingChunksHeader = "X-Missing-Chunks"
 )
 
 type queryProps struct {
@@ -68,32 +72,48 @@ func DetermineQueryProps(ctx *gin.Context, cConf *corpus.CorporaSetup) queryProp
 	}
 	ans.corpusConf = corpusConf
 
-	var ttCQL string
 	userQuery := ctx.Query("q")
 	if userQuery == "" {
 		ans.err = errors.New("missing `q` argument")
 		ans.status = http.StatusBadRequest
 		return ans
 	}
-	subc := ctx.Query("subcorpus")
-	if subc != "" {
-		ttCQL = corpus.SubcorpusToCQL(corpusConf.Subcorpora[subc].TextTypes)
-		if ttCQL == "" {
-			savedSubcPath, ok := corpus.CheckSavedSubcorpus(cConf.SavedSubcorporaDir, ans.corpus, subc)
-			if ok {
-				ans.savedSubcorpus = savedSubcPath
-
-			} else {
-				ans.err = fmt.Errorf("invalid subcorpus specification: %s", savedSubcPath)
-				ans.status = http.StatusUnprocessableEntity
-				return ans
-			}
-		}
+	var ttCQL string
+	ttCQL, ans.savedSubcorpus, ans.err = resolveSubcorpus(
+		cConf, ans.corpus, corpusConf, ctx.Query("subcorpus"))
+	if ans.err != nil {
+		ans.status = http.StatusUnprocessableEntity
+		return ans
 	}
 	ans.query = userQuery + ttCQL
 	return ans
 }
 
+// resolveSubcorpus determines whether the subcorpus `subc` is a configured
+// text-type subcorpus (in such case, its `within` CQL suffix is returned) or
+// a saved one (in such case, a path to its file is returned).
+// For an empty `subc`, both values are empty.
+func resolveSubcorpus(
+	cConf *corpus.CorporaSetup,
+	corpusID string,
+	corpusConf *corpus.MQCorpusSetup,
+	subc string,
+) (ttCQL string, savedSubcPath string, err error) {
+	if subc == "" {
+		return
+	}
+	ttCQL = corpus.SubcorpusToCQL(corpusConf.Subcorpora[subc].TextTypes)
+	if ttCQL != "" {
+		return
+	}
+	savedSubcPath, ok := corpus.CheckSavedSubcorpus(cConf.SavedSubcorporaDir, corpusID, subc)
+	if !ok {
+		err = fmt.Errorf("invalid subcorpus specification: %s", savedSubcPath)
+		savedSubcPath = ""
+	}
+	return
+}
+
 func (a *Actions) DecodeTextTypeAttrOrFail(
 	ctx *gin.Context,
 	corpusID string,
@@ -241,3 +261,46 @@ func GetCTXStoredTimeout(ctx *gin.Context) time.Duration {
 	}
 	return v
 }
+
+// newScatterGather creates a scatter-gather for a split corpus calculation.
+// By default, the calculation fails if any of the chunks fails. With
+// the `allowPartial=1` argument, a partial result is produced instead
+// (see writeGatherReport).
+func (a *Actions) newScatterGather(ctx *gin.Context) *corpus.ScatterGather {
+	policy := corpus.FailOnMissingChunks
+	if ctx.Query("allowPartial") == "1" {
+		policy = corpus.AllowPartialResult
+	}
+	return corpus.NewScatterGather(
+		a.radapter, policy, a.conf.SplitChunkRetries, GetCTXStoredTimeout(ctx))
+}
+
+// splitCorpusErrorStatus returns an HTTP status for an error of opening
+// a split corpus. A split corpus not matching its corpus (e.g. after
+// the corpus was updated) is a conflict, otherwise `dflt` is returned.
+func splitCorpusErrorStatus(err error, dflt int) int {
+	if errors.Is(err, corpus.ErrSplitCorpusOutdated) {
+		return http.StatusConflict
+	}
+	return dflt
+}
+
+// respondGatherError writes an error of a scatter-gather calculation
+// (see corpus.Gather). Similarly to HandleWorkerError, errors caused
+// by user input (e.g. an invalid query) are reported as bad requests.
+func respondGatherError(ctx *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	var userErr corpus.ChunkUserError
+	if errors.As(err, &userErr) {
+		status = http.StatusBadRequest
+	}
+	uniresp.WriteJSONErrorResponse(ctx.Writer, uniresp.NewActionErrorFrom(err), status)
+}
+
+// writeGatherReport exposes chunks missing in a partial result
+// via the MissingChunksHeader header.
+func writeGatherReport(ctx *gin.Context, report corpus.GatherReport) {
+	if report.IsPartial() {
+		ctx.Header(MissingChunksHeader, report.MissingAsString())
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mquery/corpus"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCorpusErrorStatus(t *testing.T) {
+	outdated := fmt.Errorf("failed to open split corpus: %w", corpus.ErrSplitCorpusOutdated)
+	assert.Equal(t, http.StatusConflict, splitCorpusErrorStatus(outdated, http.StatusInternalServerError))
+	assert.Equal(t, http.StatusConflict, splitCorpusErrorStatus(outdated, http.StatusNotFound))
+	assert.Equal(
+		t,
+		http.StatusInternalServerError,
+		splitCorpusErrorStatus(errors.New("failed to read"), http.StatusInternalServerError),
+	)
+	assert.Equal(
+		t, http.StatusNotFound, splitCorpusErrorStatus(errors.New("failed to read"), http.StatusNotFound))
+}
+
+func TestRespondGatherError(t *testing.T) {
+	userErr := fmt.Errorf(
+		"failed to calculate 1 of 2 chunks (2): %w",
+		corpus.ChunkUserError{Err: errors.New("syntax error")},
+	)
+	ctx, w := newTestContext("")
+	respondGatherError(ctx, userErr)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "syntax error")
+
+	ctx, w = newTestContext("")
+	respondGatherError(ctx, errors.New("worker result timeout"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -25,6 +25,7 @@ import (
 	"mquery/rdb"
 	"mquery/rdb/results"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -40,6 +41,11 @@ const (
 	termFreqContext                    = 5
 	concFormatJSON          concFormat = "json"
 	concFormatMarkdown      concFormat = "markdown"
+	concDefaultSortPos                 = "0<0~0>0"
+)
+
+var (
+	concPosRegexp = regexp.MustCompile(`^-?\d+([<>]-?\d+)?(~-?\d+([<>]-?\d+)?)?$`)
 )
 
 type concFormat string
@@ -53,7 +59,7 @@ func (cf concFormat) Validate() error {
 
 type ConcArgsBuilder func(queryProps queryProps) rdb.ConcordanceArgs
 
-type ConcArgsValidator func(args *rdb.ConcordanceArgs) error
+type ConcArgsValidator func(args *rdb.ConcordanceArgs, corpusConf *corpus.MQCorpusSetup) error
 
 func (a *Actions) SyntaxConcordance(ctx *gin.Context) {
 	a.anyConcordance(
@@ -75,7 +81,7 @@ func (a *Actions) SyntaxConcordance(ctx *gin.Context) {
 				ViewContextStruct: queryProps.corpusConf.ViewContextStruct,
 			}
 		},
-		func(args *rdb.ConcordanceArgs) error {
+		func(args *rdb.ConcordanceArgs, corpusConf *corpus.MQCorpusSetup) error {
 			if args.ViewContextStruct == "" {
 				return fmt.Errorf("sentence structure is not defined for the corpus")
 			}
@@ -101,6 +107,13 @@ func (a *Actions) SyntaxConcordance(ctx *gin.Context) {
 // @Param        coll query string false "Optional collocate query (CQL)"
 // @Param        collRange query string false "Specifies where to search the collocate. I.e. this only applies if the `coll` is filled. Format: left,right where negative numbers are on the left side of the KWIC."
 // @Param        noShuffle query int false "if 1, then the order of matches will be the same as in the source corpus"
+// @Param        sortAttr query string false "A positional attribute to sort the lines by (sorted lines are not shuffled)"
+// @Param        sortPos query string false "Tokens used for sorting, relative to KWIC (e.g. -1<0 = first token on the left, 1>0 = first token on the right)" default(0<0~0>0)
+// @Param        sortDesc query int false "if 1, then the lines are sorted in descending order" enums(0,1) default(0)
+// @Param        sortICase query int false "if 1, then the sorting ignores case" enums(0,1) default(0)
+// @Param        filter query []string false "A concordance filter in the format TYPE:LEFT:RIGHT:QUERY where TYPE is p (positive) or n (negative), optionally followed by l (range relative to the last KWIC token) and/or x (exclude KWIC). Filters can be repeated and are applied in order." collectionFormat(multi)
+// @Param        sample query int false "If set, the concordance is reduced to a random sample of the size (applied after filters)" minimum(0)
+// @Param        seed query int false "A seed for the random sample - the same seed always produces the same sample" default(0)
 // @Success      200 {object} results.ConcordanceResponse
 // @Success      200 {string} text/markdown
 // @Router       /concordance/{corpusId} [get]
@@ -114,10 +127,40 @@ func (a *Actions) Concordance(ctx *gin.Context) {
 		)
 		return
 	}
+	argsBuilder, ok := a.concordanceArgsBuilder(ctx)
+	if !ok {
+		return
+	}
+	a.anyConcordance(
+		ctx,
+		format,
+		argsBuilder,
+		validateConcSort,
+	)
+}
 
+// validateConcSort tests whether the sorting of lines
+// is applicable to the concordance
+func validateConcSort(args *rdb.ConcordanceArgs, corpusConf *corpus.MQCorpusSetup) error {
+	if args.Sort.IsZero() {
+		return nil
+	}
+	if !corpusConf.PosAttrs.Contains(args.Sort.Attr) {
+		return fmt.Errorf("invalid sortAttr - unknown attribute %s", args.Sort.Attr)
+	}
+	if args.CollQuery != "" {
+		return fmt.Errorf("sorting cannot be combined with a collocate query")
+	}
+	return nil
+}
+
+// concordanceArgsBuilder parses and validates arguments of the Concordance
+// action and returns a function producing the final worker arguments.
+// In case of an error, a respective HTTP response is written and false is returned.
+func (a *Actions) concordanceArgsBuilder(ctx *gin.Context) (ConcArgsBuilder, bool) {
 	contextWidth, ok := unireq.GetURLIntArgOrFail(ctx, "contextWidth", ConcordanceDefaultWidth)
 	if !ok {
-		return
+		return nil, false
 	}
 	if contextWidth > ConcordanceMaxWidth {
 		uniresp.RespondWithErrorJSON(
@@ -125,21 +168,51 @@ func (a *Actions) Concordance(ctx *gin.Context) {
 			fmt.Errorf("invalid contextWidth - max value is %d", ConcordanceMaxWidth),
 			http.StatusBadRequest,
 		)
-		return
+		return nil, false
 	}
 
 	maxRows, ok := unireq.GetURLIntArgOrFail(ctx, "maxRows", 0) // default will be added later below
 	if !ok {
-		return
+		return nil, false
 	}
 
 	rowsOffset, ok := unireq.GetURLIntArgOrFail(ctx, "rowsOffset", 0)
 	if !ok {
-		return
+		return nil, false
 	}
 
 	noShuffle := ctx.Query("noShuffle") == "1"
 
+	sort := rdb.ConcSortArgs{
+		Attr:       ctx.Query("sortAttr"),
+		Pos:        ctx.DefaultQuery("sortPos", concDefaultSortPos),
+		Descending: ctx.Query("sortDesc") == "1",
+		IgnoreCase: ctx.Query("sortICase") == "1",
+	}
+	if sort.IsZero() {
+		sort = rdb.ConcSortArgs{}
+
+	} else if !concPosRegexp.MatchString(sort.Pos) {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("invalid sortPos format (should be e.g. -1<0 or 0<0~0>0)"),
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+
+	filters, ok := parseConcFiltersOrFail(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	sample, ok := parseConcSampleOrFail(ctx)
+	if !ok {
+		return nil, false
+	}
+	// a sample must keep its order so it can be paged
+	shuffle := !noShuffle && sample.Size == 0
+
 	var collLftCtx, collRgtCtx int
 	collQuery := ctx.Request.URL.Query().Get("coll")
 	rng := ctx.Request.URL.Query().Get("collRange")
@@ -152,7 +225,7 @@ func (a *Actions) Concordance(ctx *gin.Context) {
 				fmt.Errorf("invalid collocate range format (should be 'left,right')"),
 				http.StatusBadRequest,
 			)
-			return
+			return nil, false
 		}
 		collLftCtx, err = strconv.Atoi(rngItems[0])
 		if err != nil {
@@ -161,7 +234,7 @@ func (a *Actions) Concordance(ctx *gin.Context) {
 				fmt.Errorf("invalid collocate left range value %s: %w", rngItems[0], err),
 				http.StatusBadRequest,
 			)
-			return
+			return nil, false
 		}
 		collRgtCtx, err = strconv.Atoi(rngItems[1])
 		if err != nil {
@@ -170,47 +243,45 @@ func (a *Actions) Concordance(ctx *gin.Context) {
 				fmt.Errorf("invalid collocate right range value %s: %w", rngItems[1], err),
 				http.StatusBadRequest,
 			)
-			return
+			return nil, false
 		}
 	}
 
-	a.anyConcordance(
-		ctx,
-		format,
-		func(queryProps queryProps) rdb.ConcordanceArgs {
-			showStructs := []string{}
-			if ctx.Query("showMarkup") == "1" {
-				showStructs = queryProps.corpusConf.ConcMarkupStructures
-			}
-			showRefs := []string{}
-			switch ctx.Query("showTextProps") {
-			case "1":
-				showRefs = queryProps.corpusConf.ConcTextPropsAttrs()
-			case "2":
-				showRefs = queryProps.corpusConf.FullConcTextPropsAttrs()
-			}
-			contextStruct := ctx.DefaultQuery("contextStruct", queryProps.corpusConf.ViewContextStruct)
+	return func(queryProps queryProps) rdb.ConcordanceArgs {
+		showStructs := []string{}
+		if ctx.Query("showMarkup") == "1" {
+			showStructs = queryProps.corpusConf.ConcMarkupStructures
+		}
+		showRefs := []string{}
+		switch ctx.Query("showTextProps") {
+		case "1":
+			showRefs = queryProps.corpusConf.ConcTextPropsAttrs()
+		case "2":
+			showRefs = queryProps.corpusConf.FullConcTextPropsAttrs()
+		}
+		contextStruct := ctx.DefaultQuery("contextStruct", queryProps.corpusConf.ViewContextStruct)
 
-			return rdb.ConcordanceArgs{
-				CorpusPath:        a.conf.GetRegistryPath(queryProps.corpusConf.ID),
-				SubcPath:          queryProps.savedSubcorpus,
-				Query:             queryProps.query,
-				CollQuery:         collQuery,
-				CollLftCtx:        collLftCtx,
-				CollRgtCtx:        collRgtCtx,
-				Attrs:             queryProps.corpusConf.PosAttrs.GetIDs(),
-				ParentIdxAttr:     queryProps.corpusConf.SyntaxConcordance.ParentAttr,
-				ShowStructs:       showStructs,
-				ShowRefs:          showRefs,
-				MaxItems:          util.Ternary(maxRows > 0, maxRows, queryProps.corpusConf.MaximumRecords),
-				RowsOffset:        rowsOffset,
-				MaxContext:        contextWidth,
-				Shuffle:           !noShuffle,
-				ViewContextStruct: contextStruct,
-			}
-		},
-		func(args *rdb.ConcordanceArgs) error { return nil },
-	)
+		return rdb.ConcordanceArgs{
+			CorpusPath:        a.conf.GetRegistryPath(queryProps.corpusConf.ID),
+			SubcPath:          queryProps.savedSubcorpus,
+			Query:             queryProps.query,
+			CollQuery:         collQuery,
+			CollLftCtx:        collLftCtx,
+			CollRgtCtx:        collRgtCtx,
+			Attrs:             queryProps.corpusConf.PosAttrs.GetIDs(),
+			ParentIdxAttr:     queryProps.corpusConf.SyntaxConcordance.ParentAttr,
+			ShowStructs:       showStructs,
+			ShowRefs:          showRefs,
+			MaxItems:          util.Ternary(maxRows > 0, maxRows, queryProps.corpusConf.MaximumRecords),
+			RowsOffset:        rowsOffset,
+			MaxContext:        contextWidth,
+			Shuffle:           shuffle,
+			ViewContextStruct: contextStruct,
+			Sort:              sort,
+			Filters:           filters,
+			Sample:            sample,
+		}
+	}, true
 }
 
 // Sentences godoc
@@ -273,7 +344,7 @@ func (a *Actions) Sentences(ctx *gin.Context) {
 				ViewContextStruct: queryProps.corpusConf.ViewContextStruct,
 			}
 		},
-		func(args *rdb.ConcordanceArgs) error {
+		func(args *rdb.ConcordanceArgs, corpusConf *corpus.MQCorpusSetup) error {
 			if args.ViewContextStruct == "" {
 				return fmt.Errorf("sentence structure is not defined for the corpus")
 			}
@@ -295,11 +366,12 @@ func (a *Actions) anyConcordance(
 		return
 	}
 	args := argsBuilder(queryProps)
-	if err := validator(&args); err != nil {
+	if err := validator(&args, queryProps.corpusConf); err != nil {
 		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
 		return
 	}
 	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
 		rdb.Query{
 			Func: "concordance",
 			Args: args,
@@ -349,32 +421,26 @@ func (a *Actions) anyConcordance(
 // @Param        corpusId path string true "An ID of a corpus to search in"
 // @Param        q query string true "The translated query"
 // @Param        subcorpus query string false "An ID of a subcorpus"
+// @Param        dispersion query int false "if 1, then dispersion measures (docf, Gries' DP, Juilland's D) are calculated" enums(0,1) default(0)
+// @Param        docStruct query string false "A structure representing documents for the dispersion measures (the corpus DOCSTRUCTURE by default)"
+// @Param        attr query string false "A structural attribute (e.g. `doc.txtype`) to calculate relative frequencies of the term per its values (applies only with dispersion=1)"
+// @Param        textProperty query string false "A text property to calculate relative frequencies of the term per its values (an alternative to `attr`)"
 // @Success      200 {object} results.ConcSizeResponse
 // @Router       /term-frequency/{corpusId} [get]
 func (a *Actions) TermFrequency(ctx *gin.Context) {
 	queryProps := DetermineQueryProps(ctx, a.conf)
 	if queryProps.hasError() {
 		uniresp.RespondWithErrorJSON(ctx, queryProps.err, queryProps.status)
+		return
 	}
-	argsBuilder := func(conf *corpus.MQCorpusSetup, q string) rdb.TermFrequencyArgs {
-		return rdb.TermFrequencyArgs{
-			CorpusPath:        a.conf.GetRegistryPath(conf.ID),
-			SubcPath:          queryProps.savedSubcorpus,
-			Query:             q,
-			Attrs:             conf.PosAttrs.GetIDs(),
-			ParentIdxAttr:     conf.SyntaxConcordance.ParentAttr,
-			RowsOffset:        0, // TODO
-			MaxItems:          1,
-			MaxContext:        termFreqContext,
-			ViewContextStruct: conf.ViewContextStruct,
-		}
+	if ctx.Query("dispersion") == "1" {
+		a.termFrequencyWithDispersion(ctx, queryProps)
+		return
 	}
-	args := argsBuilder(
-		queryProps.corpusConf,
-		queryProps.query,
-	)
+	args := a.termFrequencyArgs(queryProps)
 
 	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
 		rdb.Query{
 			Func: "termFrequency",
 			Args: args,
@@ -399,3 +465,17 @@ func (a *Actions) TermFrequency(ctx *gin.Context) {
 	}
 	uniresp.WriteJSONResponse(ctx.Writer, &result)
 }
+
+func (a *Actions) termFrequencyArgs(queryProps queryProps) rdb.TermFrequencyArgs {
+	return rdb.TermFrequencyArgs{
+		CorpusPath:        a.conf.GetRegistryPath(queryProps.corpusConf.ID),
+		SubcPath:          queryProps.savedSubcorpus,
+		Query:             queryProps.query,
+		Attrs:             queryProps.corpusConf.PosAttrs.GetIDs(),
+		ParentIdxAttr:     queryProps.corpusConf.SyntaxConcordance.ParentAttr,
+		RowsOffset:        0, // TODO
+		MaxItems:          1,
+		MaxContext:        termFreqContext,
+		ViewContextStruct: queryProps.corpusConf.ViewContextStruct,
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"mquery/corpus"
+	"mquery/rdb"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/corp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConcSortAttr(t *testing.T) {
+	corpusConf := &corpus.MQCorpusSetup{
+		CorpusSetup: corp.CorpusSetup{
+			PosAttrs: corp.PosAttrList{{Name: "word"}, {Name: "lemma"}, {Name: "tag"}},
+		},
+	}
+	// the attribute is valid even if not displayed
+	args := &rdb.ConcordanceArgs{
+		Attrs: []string{"word"},
+		Sort:  rdb.ConcSortArgs{Attr: "tag", Pos: "0<0"},
+	}
+	assert.NoError(t, validateConcSort(args, corpusConf))
+
+	args.Sort.Attr = "foo"
+	assert.Error(t, validateConcSort(args, corpusConf))
+
+	args.Sort.Attr = "lemma"
+	args.CollQuery = `[lemma="be"]`
+	assert.Error(t, validateConcSort(args, corpusConf))
+
+	assert.NoError(t, validateConcSort(&rdb.ConcordanceArgs{}, corpusConf))
+}
@@ -100,6 +100,7 @@ func (a *Actions) TokenContext(ctx *gin.Context) {
 
 	corpConf.PosAttrs.GetIDs()
 	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
 		rdb.Query{
 			Func: "tokenContext",
 			Args: rdb.TokenContextArgs{
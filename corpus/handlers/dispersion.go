@@ -0,0 +1,226 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mquery/corpus"
+	"mquery/rdb"
+	"mquery/rdb/results"
+	"net/http"
+	"strings"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+)
+
+// dispersionArgs parses and validates arguments of dispersion calculation.
+// In case of an error, a respective HTTP response is written and false is returned.
+func (a *Actions) dispersionArgs(ctx *gin.Context, props queryProps) (rdb.DispersionArgs, bool) {
+	docStruct := ctx.Query("docStruct")
+	if docStruct != "" && !collStructRegexp.MatchString(docStruct) {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid docStruct %s", docStruct), http.StatusBadRequest)
+		return rdb.DispersionArgs{}, false
+	}
+	ttAttr, ok := a.DecodeTextTypeAttrOrFail(ctx, props.corpus)
+	if !ok {
+		return rdb.DispersionArgs{}, false
+	}
+	if ttAttr != "" && !strings.Contains(ttAttr, ".") {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("invalid attr %s - a structural attribute (e.g. doc.txtype) expected", ttAttr),
+			http.StatusBadRequest,
+		)
+		return rdb.DispersionArgs{}, false
+	}
+	return rdb.DispersionArgs{
+		CorpusPath:   a.conf.GetRegistryPath(props.corpus),
+		SubcPath:     props.savedSubcorpus,
+		Query:        props.query,
+		DocStruct:    docStruct,
+		TextTypeAttr: ttAttr,
+	}, true
+}
+
+func (a *Actions) termFrequencyWithDispersion(ctx *gin.Context, props queryProps) {
+	args, ok := a.dispersionArgs(ctx, props)
+	if !ok {
+		return
+	}
+	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
+		rdb.Query{
+			Func: "dispersion",
+			Args: args,
+		},
+		GetCTXStoredTimeout(ctx),
+	)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	rawResult := <-wait
+	if ok := HandleWorkerError(ctx, rawResult); !ok {
+		return
+	}
+	result, ok := TypedOrRespondError[results.Dispersion](ctx, rawResult)
+	if !ok {
+		return
+	}
+	resp := result.ConcSizeResponse()
+	uniresp.WriteJSONResponse(ctx.Writer, &resp)
+}
+
+// TermFrequencyParallel godoc
+// @Summary      TermFrequencyParallel
+// @Description  Calculate the frequency of a searched term along with dispersion measures (docf, Gries' DP, Juilland's D) in parallel over chunks of a split corpus (see `/split`). The split corpus must be aligned to documents (see `alignStruct` of `/split`). Please note that ARF is not available.
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus to search in"
+// @Param        q query string true "The translated query"
+// @Param        subcorpus query string false "An ID of a text-type subcorpus (saved subcorpora are not supported)"
+// @Param        docStruct query string false "A structure representing documents (the corpus DOCSTRUCTURE by default)"
+// @Param        attr query string false "A structural attribute (e.g. `doc.txtype`) to calculate relative frequencies of the term per its values"
+// @Param        textProperty query string false "A text property to calculate relative frequencies of the term per its values (an alternative to `attr`)"
+// @Param        allowPartial query int false "If 1, then a result is produced even if some chunks of the split corpus fail (see the X-Missing-Chunks header)"
+// @Success      200 {object} results.ConcSizeResponse
+// @Header       200 {string} X-Missing-Chunks "Comma-separated numbers of chunks missing in a partial result"
+// @Router       /term-frequency2/{corpusId} [get]
+func (a *Actions) TermFrequencyParallel(ctx *gin.Context) {
+	props := DetermineQueryProps(ctx, a.conf)
+	if props.hasError() {
+		uniresp.RespondWithErrorJSON(ctx, props.err, props.status)
+		return
+	}
+	if props.savedSubcorpus != "" {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New("saved subcorpora are not supported by parallel term frequency"),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	args, ok := a.dispersionArgs(ctx, props)
+	if !ok {
+		return
+	}
+	sc, err := corpus.OpenSplitCorpus(a.conf.SplitCorporaDir, args.CorpusPath)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			splitCorpusErrorStatus(err, http.StatusInternalServerError),
+		)
+		return
+	}
+	docStruct := args.DocStruct
+	if docStruct == "" {
+		docStruct, err = a.conf.DocStructure(props.corpus)
+		if err != nil {
+			uniresp.WriteJSONErrorResponse(
+				ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+			return
+		}
+	}
+	// documents divided between chunks would be counted more than once
+	if sc.Manifest == nil || sc.Manifest.AlignStruct != docStruct {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf(
+				"split corpus is not aligned to documents - please split the corpus with alignStruct=%s",
+				docStruct,
+			),
+			http.StatusConflict,
+		)
+		return
+	}
+
+	// Gries' DP of a chunk depends on the term frequency and the documents
+	// size of the whole corpus so the totals are calculated first and the
+	// chunks are then aggregated with them (their concordances are cached
+	// by workers so the second pass is cheap)
+	totals := new(results.Dispersion)
+	report, err := corpus.Gather(
+		ctx.Request.Context(),
+		a.newScatterGather(ctx),
+		sc.Subcorpora,
+		func(chunk corpus.Chunk) rdb.Query {
+			chunkArgs := args
+			chunkArgs.SubcPath = chunk.SubcPath
+			return rdb.Query{
+				Func: "dispersion",
+				Args: chunkArgs,
+			}
+		},
+		func(chunk corpus.Chunk, resultNext results.Dispersion, err error) {
+			if err == nil {
+				totals.MergeWith(&resultNext)
+			}
+		},
+	)
+	if err != nil {
+		respondGatherError(ctx, err)
+		return
+	}
+	result := totals
+	if totals.HitsInDocs > 0 {
+		result = new(results.Dispersion)
+		// the second pass must use exactly the chunks the totals
+		// are based on so any missing chunk makes it fail
+		sg := corpus.NewScatterGather(
+			a.radapter,
+			corpus.FailOnMissingChunks,
+			a.conf.SplitChunkRetries,
+			GetCTXStoredTimeout(ctx),
+		)
+		_, err = corpus.Gather(
+			ctx.Request.Context(),
+			sg,
+			report.Included(sc.Subcorpora),
+			func(chunk corpus.Chunk) rdb.Query {
+				chunkArgs := args
+				chunkArgs.SubcPath = chunk.SubcPath
+				chunkArgs.TotalHits = totals.HitsInDocs
+				chunkArgs.TotalDocsSize = totals.DocsSize
+				return rdb.Query{
+					Func: "dispersion",
+					Args: chunkArgs,
+				}
+			},
+			func(chunk corpus.Chunk, resultNext results.Dispersion, err error) {
+				if err == nil {
+					result.MergeWith(&resultNext)
+				}
+			},
+		)
+		if err != nil {
+			respondGatherError(ctx, err)
+			return
+		}
+	}
+	writeGatherReport(ctx, report)
+	resp := result.ConcSizeResponse()
+	uniresp.WriteJSONResponse(ctx.Writer, &resp)
+}
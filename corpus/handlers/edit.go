@@ -19,15 +19,17 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"mquery/cnf"
 	"mquery/corpus"
 	"mquery/corpus/edit"
 	"mquery/corpus/infoload"
 	"mquery/rdb"
-	"mquery/rdb/results"
 	"net/http"
-	"sync"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/czcorpus/cnc-gokit/unireq"
 	"github.com/czcorpus/cnc-gokit/uniresp"
@@ -38,6 +40,10 @@ import (
 const (
 	DfltNumSamples                     = 30
 	SplitCorpus    corpusStructVariant = "split"
+
+	// precalcLockTTL limits how long a crashed API server can block
+	// precalculations of a split corpus (see lockPrecalc)
+	precalcLockTTL = 30 * time.Second
 )
 
 type corpusStructVariant string
@@ -52,9 +58,13 @@ type multiSubcCorpus interface {
 
 type Actions struct {
 	conf         *corpus.CorporaSetup
-	radapter     *rdb.Adapter
+	radapter     rdb.QueryProducer
 	infoProvider *infoload.Manatee
 	locales      cnf.LocalesConf
+
+	// authTokenHeader is a name of an HTTP header with
+	// an authentication token (if configured)
+	authTokenHeader string
 }
 
 func (a *Actions) DeleteSplit(ctx *gin.Context) {
@@ -70,6 +80,25 @@ func (a *Actions) DeleteSplit(ctx *gin.Context) {
 			ctx.Writer, uniresp.NewActionError("split does not exist"), http.StatusNotFound)
 		return
 	}
+	unlock, err := a.lockPrecalc(ctx.Param("corpusId"))
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(err), precalcErrorStatus(err))
+		return
+	}
+	defer unlock()
+	job, err := a.loadPrecalcJob(ctx.Param("corpusId"))
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+		return
+	}
+	if job != nil && job.IsRunning() {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(edit.ErrPrecalcRunning), http.StatusConflict)
+		return
+	}
+	// note: the precalculation record is removed along with the split
 	err = edit.DeleteSplit(a.conf.SplitCorporaDir, corpPath)
 	if err != nil {
 		uniresp.WriteJSONErrorResponse(
@@ -80,10 +109,28 @@ func (a *Actions) DeleteSplit(ctx *gin.Context) {
 
 }
 
+// SplitCorpus godoc
+// @Summary      SplitCorpus
+// @Description  Split a corpus into chunks (subcorpora) used by parallel variants of endpoints. The split itself is created immediately while data for the chunks (frequencies of attributes, token coverage of structures) are precalculated in background. Progress can be watched via `GET /tools/split/{corpusId}`.
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus"
+// @Param        chunkSize query int false "An approximate size of a chunk (the configured `multiprocChunkSize` by default)"
+// @Param        alignStruct query string false "A structure (e.g. `doc`) chunk boundaries are aligned to"
+// @Param        precalcAttr query []string false "A positional attribute to compile frequencies for" collectionFormat(multi)
+// @Param        precalcStruct query []string false "A structure to calculate token coverage for" collectionFormat(multi)
+// @Success      202 {object} splitStatus
+// @Router       /tools/split/{corpusId} [post]
 func (a *Actions) SplitCorpus(ctx *gin.Context) {
 	corpPath := a.conf.GetRegistryPath(ctx.Param("corpusId"))
 	precalcAttr := ctx.QueryArray("precalcAttr")
 	precalcStruct := ctx.QueryArray("precalcStruct")
+	// alignStruct (e.g. `doc`) makes chunk boundaries respect the structure
+	alignStruct := ctx.Query("alignStruct")
+	if alignStruct != "" && !collStructRegexp.MatchString(alignStruct) {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionError("invalid alignStruct"), http.StatusBadRequest)
+		return
+	}
 	exists, err := edit.SplitCorpusExists(a.conf.SplitCorporaDir, corpPath)
 	if err != nil {
 		uniresp.WriteJSONErrorResponse(
@@ -102,59 +149,297 @@ func (a *Actions) SplitCorpus(ctx *gin.Context) {
 	}
 
 	// note: `splitCorpus` is very fast so there is no need to delegate it to a worker
-	corp, err := edit.SplitCorpus(a.conf.SplitCorporaDir, corpPath, int64(chunkSize))
+	corp, err := edit.SplitCorpus(a.conf.SplitCorporaDir, corpPath, int64(chunkSize), alignStruct)
 	if err != nil {
 		uniresp.WriteJSONErrorResponse(
 			ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusConflict)
 		return
 	}
 
-	wg := sync.WaitGroup{}
-	wg.Add(len(corp.Subcorpora))
-	errs := make([]error, 0, len(corp.Subcorpora))
-	for _, subc := range corp.Subcorpora {
-		wait, err := a.radapter.PublishQuery(
+	if len(precalcAttr) == 0 && len(precalcStruct) == 0 {
+		a.writeSplitStatus(ctx, http.StatusOK)
+		return
+	}
+	chunks := make([]edit.PrecalcChunkState, len(corp.Subcorpora))
+	for i, subc := range corp.Subcorpora {
+		chunks[i] = edit.PrecalcChunkState{Num: i + 1, File: filepath.Base(subc)}
+	}
+	if err := a.startPrecalc(ctx, corp, chunks, precalcAttr, precalcStruct); err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(err), precalcErrorStatus(err))
+		return
+	}
+	a.writeSplitStatus(ctx, http.StatusAccepted)
+}
+
+// splitCorpusDir returns a directory with chunks of a split corpus
+func (a *Actions) splitCorpusDir(corpusID string) string {
+	return filepath.Join(a.conf.SplitCorporaDir, filepath.Base(a.conf.GetRegistryPath(corpusID)))
+}
+
+// loadPrecalcJob returns the state of the most recent precalculation
+// of a split corpus. In case there is no such precalculation, nil
+// is returned along with no error.
+func (a *Actions) loadPrecalcJob(corpusID string) (*edit.PrecalcJob, error) {
+	rec, err := edit.LoadPrecalcRecord(a.splitCorpusDir(corpusID))
+	if err != nil || rec == nil {
+		return nil, err
+	}
+	job, err := edit.CompilePrecalcJob(corpusID, rec, a.radapter.GetJob)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// precalcErrorStatus returns an HTTP status for an error
+// returned by startPrecalc
+func precalcErrorStatus(err error) int {
+	if errors.Is(err, edit.ErrPrecalcRunning) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// lockPrecalc prevents concurrent changes of precalculation of a split
+// corpus (e.g. two API servers both finding no running precalculation
+// and both starting one). In case the lock is held by someone else,
+// edit.ErrPrecalcRunning is returned.
+func (a *Actions) lockPrecalc(corpusID string) (func(), error) {
+	unlock, ok, err := a.radapter.TryLock("precalc:"+corpusID, precalcLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, edit.ErrPrecalcRunning
+	}
+	return unlock, nil
+}
+
+// startPrecalc starts a background precalculation of data
+// (see rdb.CalcCollFreqDataArgs) for the specified chunks
+// of a split corpus. Progress can be watched via SplitStatus.
+func (a *Actions) startPrecalc(
+	ctx *gin.Context,
+	sc *corpus.SplitCorpus,
+	chunks []edit.PrecalcChunkState,
+	attrs, structs []string,
+) error {
+	corpusID := ctx.Param("corpusId")
+	// the lock covers the whole check-and-submit sequence, once
+	// the record is written, the running jobs are found via the record
+	unlock, err := a.lockPrecalc(corpusID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	job, err := a.loadPrecalcJob(corpusID)
+	if err != nil {
+		return err
+	}
+	if job != nil && job.IsRunning() {
+		return edit.ErrPrecalcRunning
+	}
+	rec := &edit.PrecalcRecord{
+		Attrs:   attrs,
+		Structs: structs,
+		Created: time.Now(),
+		Chunks:  make([]edit.PrecalcChunkState, 0, len(chunks)),
+	}
+	// each chunk is a separate job so the state of the precalculation
+	// is available to all the API server instances
+	for _, chunk := range chunks {
+		jobInfo, err := a.radapter.SubmitJob(
 			rdb.Query{
 				Func: "calcCollFreqData",
 				Args: rdb.CalcCollFreqDataArgs{
-					CorpusPath:     corpPath,
-					SubcPath:       subc,
-					Attrs:          precalcAttr,
-					Structs:        precalcStruct,
+					CorpusPath:     sc.CorpusPath,
+					SubcPath:       sc.Subcorpora[chunk.Num-1],
+					Attrs:          attrs,
+					Structs:        structs,
 					MktokencovPath: a.conf.MktokencovPath,
 				},
 			},
-			GetCTXStoredTimeout(ctx),
+			corpusID,
 		)
+		if err != nil {
+			err = fmt.Errorf("failed to submit precalculation of chunk %d: %w", chunk.Num, err)
+			if len(rec.Chunks) == 0 {
+				return err
+			}
+			// already submitted jobs must remain trackable
+			if err2 := edit.WritePrecalcRecord(a.splitCorpusDir(corpusID), rec); err2 != nil {
+				log.Error().Err(err2).Str("corpus", corpusID).Msg("failed to write precalculation record")
+			}
+			return err
+		}
+		chunk.JobID = jobInfo.ID
+		chunk.Status = jobInfo.Status
+		rec.Chunks = append(rec.Chunks, chunk)
+	}
+	return edit.WritePrecalcRecord(a.splitCorpusDir(corpusID), rec)
+}
+
+type splitChunkInfo struct {
+	Num     int               `json:"num"`
+	File    string            `json:"file"`
+	Precalc edit.ChunkPrecalc `json:"precalc"`
+}
+
+type splitStatus struct {
+	CorpusID string                `json:"corpusId"`
+	Manifest *corpus.SplitManifest `json:"manifest,omitempty"`
+	Chunks   []splitChunkInfo      `json:"chunks"`
+
+	// PrecalcJob is the most recent precalculation job
+	PrecalcJob *edit.PrecalcJob `json:"precalcJob,omitempty"`
+}
+
+// writeSplitStatus writes the current state of a split corpus
+// along with data precalculated for its chunks
+func (a *Actions) writeSplitStatus(ctx *gin.Context, status int) {
+	corpusID := ctx.Param("corpusId")
+	sc, err := corpus.OpenSplitCorpus(a.conf.SplitCorporaDir, a.conf.GetRegistryPath(corpusID))
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusConflict)
+		return
+	}
+	ans := splitStatus{
+		CorpusID: corpusID,
+		Manifest: sc.Manifest,
+		Chunks:   make([]splitChunkInfo, len(sc.Subcorpora)),
+	}
+	for i, subc := range sc.Subcorpora {
+		precalc, err := edit.FindChunkPrecalc(filepath.Dir(subc), filepath.Base(subc))
 		if err != nil {
 			uniresp.WriteJSONErrorResponse(
-				ctx.Writer,
-				uniresp.NewActionErrorFrom(err),
-				http.StatusInternalServerError,
-			)
+				ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
 			return
 		}
-		go func() {
-			defer wg.Done()
-			ans := <-wait
-			if err := ans.Value.Err(); err != nil {
-				errs = append(errs, err)
-				log.Error().Err(err).Msg("failed to execute action calcCollFreqData")
-			}
-			_, ok := ans.Value.(results.CollFreqData)
-			if !ok {
-				err := fmt.Errorf("invalid type for CollFreqData")
-				errs = append(errs, err)
-				log.Error().Err(err).Msg("failed to execute action calcCollFreqData")
+		ans.Chunks[i] = splitChunkInfo{Num: i + 1, File: filepath.Base(subc), Precalc: precalc}
+	}
+	ans.PrecalcJob, err = a.loadPrecalcJob(corpusID)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponseWithStatus(ctx.Writer, status, ans)
+}
+
+// SplitStatus godoc
+// @Summary      SplitStatus
+// @Description  Get chunks of a split corpus along with data precalculated for them and the state of the most recent precalculation job
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus"
+// @Success      200 {object} splitStatus
+// @Router       /tools/split/{corpusId} [get]
+func (a *Actions) SplitStatus(ctx *gin.Context) {
+	exists, err := edit.SplitCorpusExists(
+		a.conf.SplitCorporaDir, a.conf.GetRegistryPath(ctx.Param("corpusId")))
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionError("split does not exist"), http.StatusNotFound)
+		return
+	}
+	a.writeSplitStatus(ctx, http.StatusOK)
+}
+
+// SplitPrecalc godoc
+// @Summary      SplitPrecalc
+// @Description  Start a background precalculation of data for chunks of an existing split corpus - e.g. to add attributes or to re-run chunks which failed.
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus"
+// @Param        precalcAttr query []string false "A positional attribute to compile frequencies for" collectionFormat(multi)
+// @Param        precalcStruct query []string false "A structure to calculate token coverage for" collectionFormat(multi)
+// @Param        chunk query []int false "A number of a chunk to process (all chunks by default)" collectionFormat(multi)
+// @Param        failedOnly query int false "If 1, then chunks failed in the most recent job are processed (with the job's attributes and structures unless specified)"
+// @Success      202 {object} splitStatus
+// @Router       /tools/split/{corpusId}/precalc [post]
+func (a *Actions) SplitPrecalc(ctx *gin.Context) {
+	corpusID := ctx.Param("corpusId")
+	sc, err := corpus.OpenSplitCorpus(a.conf.SplitCorporaDir, a.conf.GetRegistryPath(corpusID))
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(err), splitCorpusErrorStatus(err, http.StatusNotFound))
+		return
+	}
+	precalcAttr := ctx.QueryArray("precalcAttr")
+	precalcStruct := ctx.QueryArray("precalcStruct")
+	var chunkNums []int
+	if ctx.Query("failedOnly") == "1" {
+		job, err := a.loadPrecalcJob(corpusID)
+		if err != nil {
+			uniresp.WriteJSONErrorResponse(
+				ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+			return
+		}
+		if job == nil {
+			uniresp.WriteJSONErrorResponse(
+				ctx.Writer, uniresp.NewActionError("no precalculation job found"), http.StatusNotFound)
+			return
+		}
+		chunkNums = job.FailedChunks()
+		if len(chunkNums) == 0 {
+			uniresp.WriteJSONErrorResponse(
+				ctx.Writer, uniresp.NewActionError("no failed chunks found"), http.StatusBadRequest)
+			return
+		}
+		// the split may have been re-created since the job
+		for _, ch := range job.Chunks {
+			if ch.Num < 1 || ch.Num > len(sc.Subcorpora) ||
+				filepath.Base(sc.Subcorpora[ch.Num-1]) != ch.File {
+				uniresp.WriteJSONErrorResponse(
+					ctx.Writer,
+					uniresp.NewActionError("the precalculation job does not match the split corpus"),
+					http.StatusConflict,
+				)
+				return
 			}
+		}
+		if len(precalcAttr) == 0 && len(precalcStruct) == 0 {
+			precalcAttr = job.Attrs
+			precalcStruct = job.Structs
+		}
 
-		}()
+	} else {
+		for _, v := range ctx.QueryArray("chunk") {
+			num, err := strconv.Atoi(v)
+			if err != nil || num < 1 || num > len(sc.Subcorpora) {
+				uniresp.WriteJSONErrorResponse(
+					ctx.Writer, uniresp.NewActionError("invalid chunk %s", v), http.StatusBadRequest)
+				return
+			}
+			chunkNums = append(chunkNums, num)
+		}
+		if len(chunkNums) == 0 {
+			for i := range sc.Subcorpora {
+				chunkNums = append(chunkNums, i+1)
+			}
+		}
+	}
+	if len(precalcAttr) == 0 && len(precalcStruct) == 0 {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionError("no precalcAttr or precalcStruct specified"),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	chunks := make([]edit.PrecalcChunkState, len(chunkNums))
+	for i, num := range chunkNums {
+		chunks[i] = edit.PrecalcChunkState{Num: num, File: filepath.Base(sc.Subcorpora[num-1])}
 	}
-	wg.Wait()
-	if len(errs) > 0 {
+	if err := a.startPrecalc(ctx, sc, chunks, precalcAttr, precalcStruct); err != nil {
 		uniresp.WriteJSONErrorResponse(
-			ctx.Writer, uniresp.NewActionErrorFrom(errs[0]), http.StatusInternalServerError)
+			ctx.Writer, uniresp.NewActionErrorFrom(err), precalcErrorStatus(err))
 		return
 	}
-	uniresp.WriteJSONResponse(ctx.Writer, corp)
+	a.writeSplitStatus(ctx, http.StatusAccepted)
 }
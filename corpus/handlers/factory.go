@@ -27,14 +27,21 @@ import (
 
 func NewActions(
 	conf *corpus.CorporaSetup,
-	radapter *rdb.Adapter,
+	radapter rdb.QueryProducer,
 	infoProvider *infoload.Manatee,
 	locales cnf.LocalesConf,
+	authConf *cnf.AuthConf,
 ) *Actions {
+	var authTokenHeader string
+	if authConf.IsDefined() {
+		authTokenHeader = authConf.TokenHeaderName
+	}
 	return &Actions{
 		conf:         conf,
 		radapter:     radapter,
 		infoProvider: infoProvider,
 		locales:      locales,
+
+		authTokenHeader: authTokenHeader,
 	}
 }
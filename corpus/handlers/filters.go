@@ -0,0 +1,133 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"fmt"
+	"mquery/rdb"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/czcorpus/cnc-gokit/unireq"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxNumConcFilters = 10
+)
+
+var (
+	concFilterTypeRegexp = regexp.MustCompile(`^[pn][lx]*$`)
+)
+
+// parseConcFilter parses a filter in the format `TYPE:LEFT:RIGHT:QUERY`
+// where TYPE is `p` (positive filter) or `n` (negative filter), optionally
+// followed by `l` (the range is relative to the last KWIC token) and/or `x`
+// (the KWIC itself is excluded from the range). LEFT and RIGHT specify
+// the range (negative values are on the left side of the KWIC).
+// E.g. `n:-3:3:[lemma="not"]`.
+func parseConcFilter(v string) (rdb.ConcFilterArgs, error) {
+	var ans rdb.ConcFilterArgs
+	items := strings.SplitN(v, ":", 4)
+	if len(items) != 4 {
+		return ans, fmt.Errorf("invalid filter format (should be TYPE:LEFT:RIGHT:QUERY)")
+	}
+	if !concFilterTypeRegexp.MatchString(items[0]) {
+		return ans, fmt.Errorf("invalid filter type %s", items[0])
+	}
+	ans.Positive = items[0][0] == 'p'
+	ans.AnchorLast = strings.Contains(items[0], "l")
+	ans.ExcludeKWIC = strings.Contains(items[0], "x")
+	var err error
+	ans.LftCtx, err = strconv.Atoi(items[1])
+	if err != nil {
+		return ans, fmt.Errorf("invalid filter left range value %s: %w", items[1], err)
+	}
+	ans.RgtCtx, err = strconv.Atoi(items[2])
+	if err != nil {
+		return ans, fmt.Errorf("invalid filter right range value %s: %w", items[2], err)
+	}
+	if ans.LftCtx > ans.RgtCtx {
+		return ans, fmt.Errorf("invalid filter range %d..%d", ans.LftCtx, ans.RgtCtx)
+	}
+	ans.Query = strings.TrimSpace(items[3])
+	if ans.Query == "" {
+		return ans, fmt.Errorf("empty filter query")
+	}
+	return ans, nil
+}
+
+// parseConcSampleOrFail parses the `sample` and `seed` URL arguments.
+// In case of an error, a respective HTTP response is written and false is returned.
+func parseConcSampleOrFail(ctx *gin.Context) (rdb.ConcSampleArgs, bool) {
+	var ans rdb.ConcSampleArgs
+	var ok bool
+	ans.Size, ok = unireq.GetURLIntArgOrFail(ctx, "sample", 0)
+	if !ok {
+		return ans, false
+	}
+	if ans.Size < 0 {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("invalid sample: %d, value must be greater or equal to 0", ans.Size),
+			http.StatusBadRequest,
+		)
+		return ans, false
+	}
+	if v := ctx.Query("seed"); v != "" {
+		var err error
+		ans.Seed, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				fmt.Errorf("invalid seed %s: %w", v, err),
+				http.StatusBadRequest,
+			)
+			return ans, false
+		}
+	}
+	return ans, true
+}
+
+// parseConcFiltersOrFail parses all the `filter` URL arguments.
+// In case of an error, a respective HTTP response is written and false is returned.
+func parseConcFiltersOrFail(ctx *gin.Context) ([]rdb.ConcFilterArgs, bool) {
+	values := ctx.QueryArray("filter")
+	if len(values) > maxNumConcFilters {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("too many filters (max. %d)", maxNumConcFilters),
+			http.StatusBadRequest,
+		)
+		return nil, false
+	}
+	ans := make([]rdb.ConcFilterArgs, 0, len(values))
+	for _, v := range values {
+		filter, err := parseConcFilter(v)
+		if err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+			return nil, false
+		}
+		ans = append(ans, filter)
+	}
+	return ans, true
+}
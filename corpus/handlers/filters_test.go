@@ -0,0 +1,103 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"mquery/rdb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConcFilter(t *testing.T) {
+	f, err := parseConcFilter(`n:-3:3:[lemma="not"]`)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		rdb.ConcFilterArgs{Query: `[lemma="not"]`, LftCtx: -3, RgtCtx: 3},
+		f,
+	)
+}
+
+func TestParseConcFilterModifiers(t *testing.T) {
+	f, err := parseConcFilter(`plx:1:5:[word="a:b"]`)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		rdb.ConcFilterArgs{
+			Query:       `[word="a:b"]`,
+			Positive:    true,
+			LftCtx:      1,
+			RgtCtx:      5,
+			AnchorLast:  true,
+			ExcludeKWIC: true,
+		},
+		f,
+	)
+}
+
+func TestParseConcFilterInvalid(t *testing.T) {
+	for _, v := range []string{
+		`p:-3:3`,
+		`q:-3:3:[word="x"]`,
+		`p:a:3:[word="x"]`,
+		`p:3:-3:[word="x"]`,
+		`p:-3:3: `,
+	} {
+		_, err := parseConcFilter(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func newTestContext(rawQuery string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/concordance/syn2020?"+rawQuery, nil)
+	return ctx, w
+}
+
+func TestParseConcSampleOrFail(t *testing.T) {
+	ctx, _ := newTestContext("sample=100&seed=42")
+	sample, ok := parseConcSampleOrFail(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, rdb.ConcSampleArgs{Size: 100, Seed: 42}, sample)
+
+	ctx, _ = newTestContext("")
+	sample, ok = parseConcSampleOrFail(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, rdb.ConcSampleArgs{}, sample)
+}
+
+func TestParseConcSampleOrFailInvalid(t *testing.T) {
+	for q, status := range map[string]int{
+		"sample=-1":         http.StatusBadRequest,
+		"sample=abc":        http.StatusUnprocessableEntity,
+		"sample=10&seed=-5": http.StatusBadRequest,
+		"sample=10&seed=x":  http.StatusBadRequest,
+	} {
+		ctx, w := newTestContext(q)
+		_, ok := parseConcSampleOrFail(ctx)
+		assert.False(t, ok, q)
+		assert.Equal(t, status, w.Code, q)
+	}
+}
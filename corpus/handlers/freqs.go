@@ -25,25 +25,124 @@ import (
 	"mquery/rdb"
 	"mquery/rdb/results"
 	"net/http"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/czcorpus/cnc-gokit/unireq"
 	"github.com/czcorpus/cnc-gokit/uniresp"
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
 )
 
 const (
 	defaultFreqCritTpl = "%s/%s 0~0>0"
 	DefaultFreqLimit   = 1
 	DefaultFreqAttr    = "lemma"
-	DefaultFreqCrit    = "lemma/e 0~0>0"
+	fallbackFreqAttr   = "word"
 	MaxFreqResultItems = 20
+	maxNumFreqLevels   = 5
 )
 
+// defaultFreqAttr returns DefaultFreqAttr in case the corpus
+// has the attribute. Otherwise, the `word` attribute is used.
+func defaultFreqAttr(corpusConf *corpus.MQCorpusSetup) string {
+	if corpusConf.PosAttrs.Contains(DefaultFreqAttr) {
+		return DefaultFreqAttr
+	}
+	return fallbackFreqAttr
+}
+
+// freqLevel is a single level of a (multi-level) frequency
+// criterion - i.e. an attribute and a position of tokens
+// (relative to the KWIC) the attribute is taken from.
+type freqLevel struct {
+	attr       string
+	pos        string
+	ignoreCase bool
+}
+
+// crit encodes the level in the Manatee format (e.g. `lemma/i -1<0`)
+func (lev freqLevel) crit() string {
+	flags := "e"
+	if lev.ignoreCase {
+		flags = "i"
+	}
+	return fmt.Sprintf("%s/%s %s", lev.attr, flags, lev.pos)
+}
+
+func freqLevelsCrit(levels []freqLevel) string {
+	items := make([]string, len(levels))
+	for i, lev := range levels {
+		items[i] = lev.crit()
+	}
+	return strings.Join(items, " ")
+}
+
+// parseFreqLevel parses a freq. level in the format ATTR:POS[:i]
+// where POS is a Manatee position (e.g. `-1<0`, `0~0>0`, `1>0`) and
+// the optional `i` stands for ignoring case.
+func parseFreqLevel(v string) (freqLevel, error) {
+	items := strings.Split(v, ":")
+	if len(items) < 2 || len(items) > 3 {
+		return freqLevel{}, fmt.Errorf("invalid level %s (should be ATTR:POS[:i])", v)
+	}
+	ans := freqLevel{attr: items[0], pos: items[1]}
+	if ans.attr == "" {
+		return freqLevel{}, fmt.Errorf("invalid level %s - missing attribute", v)
+	}
+	if !concPosRegexp.MatchString(ans.pos) {
+		return freqLevel{}, fmt.Errorf("invalid level %s - invalid position (should be e.g. -1<0 or 0~0>0)", v)
+	}
+	if len(items) == 3 {
+		if items[2] != "i" {
+			return freqLevel{}, fmt.Errorf("invalid level %s - unknown flag %s", v, items[2])
+		}
+		ans.ignoreCase = true
+	}
+	return ans, nil
+}
+
+// parseFreqCrit parses a Manatee-encoded multi-level frequency
+// criterion (e.g. `lemma/e -1<0 tag/i 0~0>0`). Only the `e` (match case)
+// and `i` (ignore case) flags are supported.
+func parseFreqCrit(fcrit string) ([]freqLevel, error) {
+	items := strings.Fields(fcrit)
+	if len(items) == 0 || len(items)%2 != 0 {
+		return nil, fmt.Errorf("invalid fcrit %s", fcrit)
+	}
+	ans := make([]freqLevel, 0, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		attr, flags, _ := strings.Cut(items[i], "/")
+		if attr == "" {
+			return nil, fmt.Errorf("invalid fcrit %s - missing attribute", fcrit)
+		}
+		if strings.Trim(flags, "ei") != "" {
+			return nil, fmt.Errorf("invalid fcrit %s - unsupported flags %s", fcrit, flags)
+		}
+		if !concPosRegexp.MatchString(items[i+1]) {
+			return nil, fmt.Errorf("invalid fcrit %s - invalid position %s", fcrit, items[i+1])
+		}
+		ans = append(
+			ans,
+			freqLevel{attr: attr, pos: items[i+1], ignoreCase: strings.Contains(flags, "i")},
+		)
+	}
+	return ans, nil
+}
+
+func validateFreqLevels(levels []freqLevel, posAttrs []string) error {
+	if len(levels) > maxNumFreqLevels {
+		return fmt.Errorf("too many levels (max. %d)", maxNumFreqLevels)
+	}
+	for _, lev := range levels {
+		if !slices.Contains(posAttrs, lev.attr) {
+			return fmt.Errorf("invalid level - unknown attribute %s", lev.attr)
+		}
+	}
+	return nil
+}
+
 // FreqDistrib godoc
 // @Summary      FreqDistrib
 // @Description  Calculate a frequency distribution for a searched term (KWIC).
@@ -51,17 +150,61 @@ const (
 // @Param        corpusId path string true "An ID of a corpus to search in"
 // @Param        q query string true "The translated query"
 // @Param        subcorpus query string false "An ID of a subcorpus"
-// @Param        attr query string false "a positional attribute (e.g. `word`, `lemma`, `tag`) the frequency will be calculated on" default(lemma)
+// @Param        attr query string false "a positional attribute (e.g. `word`, `lemma`, `tag`) the frequency will be calculated on (`word` for corpora without `lemma`)" default(lemma)
 // @Param        matchCase query int false " " enums(0, 1)
+// @Param        level query []string false "A level of a multi-level frequency distribution in the format ATTR:POS[:i] where POS is a position relative to the KWIC (e.g. `-1<0`, `0~0>0`, `1>0` for the first token after the KWIC end) and `i` means ignoring case. Levels can be repeated (max. 5). If set, `attr` and `matchCase` are ignored and result items contain the `values` of individual levels." collectionFormat(multi)
 // @Param        maxItems query int false "maximum number of result items" default(20)
 // @Param        flimit query int false "minimum frequency of result items to be included in the result set" minimum(0) default(1)
+// @Param        filter query []string false "A concordance filter in the format TYPE:LEFT:RIGHT:QUERY where TYPE is p (positive) or n (negative), optionally followed by l (range relative to the last KWIC token) and/or x (exclude KWIC). Filters can be repeated and are applied in order." collectionFormat(multi)
+// @Param        sample query int false "If set, the concordance is reduced to a random sample of the size (applied after filters)" minimum(0)
+// @Param        seed query int false "A seed for the random sample - the same seed always produces the same sample" default(0)
 // @Success      200 {object} results.FreqDistribResponse
 // @Router       /freqs/{corpusId} [get]
 func (a *Actions) FreqDistrib(ctx *gin.Context) {
+	args, ok := a.freqDistribArgs(ctx)
+	if !ok {
+		return
+	}
+	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
+		rdb.Query{
+			Func: "freqDistrib",
+			Args: args,
+		},
+		GetCTXStoredTimeout(ctx),
+	)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	rawResult := <-wait
+	if ok := HandleWorkerError(ctx, rawResult); !ok {
+		return
+	}
+	result, ok := TypedOrRespondError[results.FreqDistrib](ctx, rawResult)
+	if !ok {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid result type"), http.StatusInternalServerError,
+		)
+		return
+	}
+	uniresp.WriteJSONResponse(
+		ctx.Writer,
+		&result,
+	)
+}
+
+// freqDistribArgs parses and validates arguments of the FreqDistrib action.
+// In case of an error, a respective HTTP response is written and false is returned.
+func (a *Actions) freqDistribArgs(ctx *gin.Context) (rdb.FreqDistribArgs, bool) {
 	queryProps := DetermineQueryProps(ctx, a.conf)
 	if queryProps.hasError() {
 		uniresp.RespondWithErrorJSON(ctx, queryProps.err, queryProps.status)
-		return
+		return rdb.FreqDistribArgs{}, false
 	}
 	flimit := DefaultFreqLimit
 	if ctx.Request.URL.Query().Has("flimit") {
@@ -73,12 +216,12 @@ func (a *Actions) FreqDistrib(ctx *gin.Context) {
 				uniresp.NewActionErrorFrom(err),
 				http.StatusUnprocessableEntity,
 			)
-			return
+			return rdb.FreqDistribArgs{}, false
 		}
 	}
 	attr := ctx.Request.URL.Query().Get("attr")
 	if attr == "" {
-		attr = DefaultFreqAttr
+		attr = defaultFreqAttr(queryProps.corpusConf)
 	}
 	matchCase := ctx.Request.URL.Query().Get("matchCase")
 	var ic string
@@ -90,49 +233,48 @@ func (a *Actions) FreqDistrib(ctx *gin.Context) {
 	}
 	fcrit := fmt.Sprintf(defaultFreqCritTpl, attr, ic)
 
+	if rawLevels := ctx.QueryArray("level"); len(rawLevels) > 0 {
+		levels := make([]freqLevel, len(rawLevels))
+		for i, v := range rawLevels {
+			var err error
+			levels[i], err = parseFreqLevel(v)
+			if err != nil {
+				uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+				return rdb.FreqDistribArgs{}, false
+			}
+		}
+		if err := validateFreqLevels(levels, queryProps.corpusConf.PosAttrs.GetIDs()); err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+			return rdb.FreqDistribArgs{}, false
+		}
+		fcrit = freqLevelsCrit(levels)
+	}
+
 	maxItems, ok := unireq.GetURLIntArgOrFail(ctx, "maxItems", MaxFreqResultItems)
 	if !ok {
-		return
+		return rdb.FreqDistribArgs{}, false
 	}
 
-	corpusPath := a.conf.GetRegistryPath(queryProps.corpus)
-	wait, err := a.radapter.PublishQuery(
-		rdb.Query{
-			Func: "freqDistrib",
-			Args: rdb.FreqDistribArgs{
-				CorpusPath: corpusPath,
-				SubcPath:   queryProps.savedSubcorpus,
-				Query:      queryProps.query,
-				Crit:       fcrit,
-				FreqLimit:  flimit,
-				MaxItems:   maxItems,
-			},
-		},
-		GetCTXStoredTimeout(ctx),
-	)
-	if err != nil {
-		uniresp.WriteJSONErrorResponse(
-			ctx.Writer,
-			uniresp.NewActionErrorFrom(err),
-			http.StatusInternalServerError,
-		)
-		return
-	}
-	rawResult := <-wait
-	if ok := HandleWorkerError(ctx, rawResult); !ok {
-		return
+	filters, ok := parseConcFiltersOrFail(ctx)
+	if !ok {
+		return rdb.FreqDistribArgs{}, false
 	}
-	result, ok := TypedOrRespondError[results.FreqDistrib](ctx, rawResult)
+
+	sample, ok := parseConcSampleOrFail(ctx)
 	if !ok {
-		uniresp.RespondWithErrorJSON(
-			ctx, fmt.Errorf("invalid result type"), http.StatusInternalServerError,
-		)
-		return
+		return rdb.FreqDistribArgs{}, false
 	}
-	uniresp.WriteJSONResponse(
-		ctx.Writer,
-		&result,
-	)
+
+	return rdb.FreqDistribArgs{
+		CorpusPath: a.conf.GetRegistryPath(queryProps.corpus),
+		SubcPath:   queryProps.savedSubcorpus,
+		Query:      queryProps.query,
+		Crit:       fcrit,
+		FreqLimit:  flimit,
+		MaxItems:   maxItems,
+		Filters:    filters,
+		Sample:     sample,
+	}, true
 }
 
 func (a *Actions) FreqDistribParallel(ctx *gin.Context) {
@@ -148,7 +290,7 @@ func (a *Actions) FreqDistribParallel(ctx *gin.Context) {
 		uniresp.WriteJSONErrorResponse(
 			ctx.Writer,
 			uniresp.NewActionErrorFrom(err),
-			http.StatusInternalServerError,
+			splitCorpusErrorStatus(err, http.StatusInternalServerError),
 		)
 		return
 	}
@@ -213,55 +355,48 @@ func (a *Actions) FreqDistribParallel(ctx *gin.Context) {
 		}
 		q = fmt.Sprintf("%s within <%s %s=\"%s\" />", q, kv[0], kv[1], tmp[1])
 	}
-	mergedFreqLock := sync.Mutex{}
-	wg := sync.WaitGroup{}
-	wg.Add(len(sc.Subcorpora))
-	result := new(results.FreqDistrib)
-	result.Freqs = make([]*results.FreqDistribItem, 0)
 	fcrit := ctx.Request.URL.Query().Get("fcrit")
 	if fcrit == "" {
-		fcrit = DefaultFreqCrit
+		fcrit = fmt.Sprintf(defaultFreqCritTpl, defaultFreqAttr(queryProps.corpusConf), "e")
 	}
-	for _, subc := range sc.Subcorpora {
-		wait, err := a.radapter.PublishQuery(
-			rdb.Query{
+	levels, err := parseFreqCrit(fcrit)
+	if err == nil {
+		err = validateFreqLevels(levels, queryProps.corpusConf.PosAttrs.GetIDs())
+	}
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	result := new(results.FreqDistrib)
+	result.Freqs = make([]*results.FreqDistribItem, 0)
+	report, err := corpus.Gather(
+		ctx.Request.Context(),
+		a.newScatterGather(ctx),
+		sc.Subcorpora,
+		func(chunk corpus.Chunk) rdb.Query {
+			return rdb.Query{
 				Func: "freqDistrib",
 				Args: rdb.FreqDistribArgs{
 					CorpusPath: corpusPath,
-					SubcPath:   subc,
+					SubcPath:   chunk.SubcPath,
 					Query:      q,
 					Crit:       fcrit,
 					FreqLimit:  flimit,
 					MaxItems:   maxItems,
 				},
-			},
-			GetCTXStoredTimeout(ctx),
-		)
-		if err != nil {
-			// TODO
-			log.Error().Err(err).Msg("failed to publish query")
-
-		} else {
-			go func() {
-				defer wg.Done()
-				tmp := <-wait
-				if err := tmp.Value.Err(); err != nil {
-					// TODO
-					log.Error().Err(err).Msg("failed to deserialize query")
-				}
-				resultNext, ok := tmp.Value.(results.FreqDistrib)
-				if !ok {
-					// TODO
-					err := fmt.Errorf("invalid type for FreqDistrib")
-					log.Error().Err(err).Msg("failed to deserialize query")
-				}
-				mergedFreqLock.Lock()
+			}
+		},
+		func(chunk corpus.Chunk, resultNext results.FreqDistrib, err error) {
+			if err == nil {
 				result.MergeWith(&resultNext)
-				mergedFreqLock.Unlock()
-			}()
-		}
+			}
+		},
+	)
+	if err != nil {
+		respondGatherError(ctx, err)
+		return
 	}
-	wg.Wait()
+	writeGatherReport(ctx, report)
 	// TODO: no need to sort here (already sorted on worker)
 	sort.SliceStable(
 		result.Freqs,
@@ -0,0 +1,75 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"mquery/corpus"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/corp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFreqLevel(t *testing.T) {
+	lev, err := parseFreqLevel("lemma:-1<0:i")
+	assert.NoError(t, err)
+	assert.Equal(t, freqLevel{attr: "lemma", pos: "-1<0", ignoreCase: true}, lev)
+	assert.Equal(t, "lemma/i -1<0", lev.crit())
+
+	for _, v := range []string{"lemma", ":0~0>0", "lemma:x", "lemma:1>0:r", "lemma:1>0:i:i"} {
+		_, err := parseFreqLevel(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestParseFreqCrit(t *testing.T) {
+	levels, err := parseFreqCrit("lemma/e -1<0 tag/i 0~0>0")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]freqLevel{
+			{attr: "lemma", pos: "-1<0"},
+			{attr: "tag", pos: "0~0>0", ignoreCase: true},
+		},
+		levels,
+	)
+	assert.Equal(t, "lemma/e -1<0 tag/i 0~0>0", freqLevelsCrit(levels))
+
+	for _, v := range []string{"", "lemma/e", "lemma/x 0>0", "lemma/e 0>0 tag"} {
+		_, err := parseFreqCrit(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestValidateFreqLevels(t *testing.T) {
+	posAttrs := []string{"word", "lemma", "tag"}
+	assert.NoError(t, validateFreqLevels([]freqLevel{{attr: "lemma", pos: "0>0"}}, posAttrs))
+	assert.Error(t, validateFreqLevels([]freqLevel{{attr: "doc.id", pos: "0>0"}}, posAttrs))
+}
+
+func TestDefaultFreqAttr(t *testing.T) {
+	withLemma := &corpus.MQCorpusSetup{
+		CorpusSetup: corp.CorpusSetup{PosAttrs: corp.PosAttrList{{Name: "word"}, {Name: "lemma"}}},
+	}
+	assert.Equal(t, DefaultFreqAttr, defaultFreqAttr(withLemma))
+	noLemma := &corpus.MQCorpusSetup{
+		CorpusSetup: corp.CorpusSetup{PosAttrs: corp.PosAttrList{{Name: "word"}, {Name: "tag"}}},
+	}
+	assert.Equal(t, "word", defaultFreqAttr(noLemma))
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/czcorpus/cnc-gokit/uniresp"
 	"github.com/czcorpus/mquery-common/corp"
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 )
 
 type subcInfo struct {
@@ -51,6 +52,9 @@ type corpusInfoResponse struct {
 	Corpus *results.CorpusInfo   `json:"corpus"`
 	Locale string                `json:"locale"`
 	Conf   *corpus.MQCorpusSetup `json:"conf,omitempty"`
+
+	// SavedSubcorpora lists subcorpora created via `/subcorpora/{corpusId}`
+	SavedSubcorpora []*corpus.SavedSubcorpus `json:"savedSubcorpora,omitempty"`
 } // @name CorpusInfo
 
 func getTranslation(data map[string]string, lang string) string {
@@ -115,6 +119,16 @@ func (a *Actions) CorpusInfo(ctx *gin.Context) {
 	if ctx.Query("attachConf") == "1" {
 		ans.Conf = corpusConf
 	}
+	if a.conf.SavedSubcorporaDir != "" {
+		subcorpora, err := corpus.ListSavedSubcorpora(a.conf.SavedSubcorporaDir, corpusID)
+		if err != nil {
+			// saved subcorpora are just a supplementary information here
+			log.Error().Err(err).Str("corpus", corpusID).Msg("failed to list saved subcorpora")
+		}
+		for _, subc := range subcorpora {
+			ans.SavedSubcorpora = append(ans.SavedSubcorpora, publicSavedSubcorpus(subc))
+		}
+	}
 	uniresp.WriteJSONResponse(ctx.Writer, ans)
 }
 
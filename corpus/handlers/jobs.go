@@ -0,0 +1,184 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"fmt"
+	"mquery/corpus"
+	"mquery/rdb"
+	"mquery/rdb/results"
+	"net/http"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+)
+
+// jobQueryBuilder parses request arguments of a function
+// available via the asynchronous job API and creates a respective
+// worker query. In case of an error, the function is expected to
+// write a respective HTTP response and return false.
+type jobQueryBuilder func(ctx *gin.Context) (rdb.Query, bool)
+
+type jobResponse struct {
+	rdb.JobInfo
+	Result any `json:"result,omitempty"`
+}
+
+func (a *Actions) jobQueryBuilders() map[string]jobQueryBuilder {
+	return map[string]jobQueryBuilder{
+		"freqs": func(ctx *gin.Context) (rdb.Query, bool) {
+			args, ok := a.freqDistribArgs(ctx)
+			return rdb.Query{Func: "freqDistrib", Args: args}, ok
+		},
+		"collocations": func(ctx *gin.Context) (rdb.Query, bool) {
+			args, ok := a.collocationsArgs(ctx)
+			return rdb.Query{Func: "collocations", Args: args}, ok
+		},
+		"concordance": func(ctx *gin.Context) (rdb.Query, bool) {
+			argsBuilder, ok := a.concordanceArgsBuilder(ctx)
+			if !ok {
+				return rdb.Query{}, false
+			}
+			queryProps := DetermineQueryProps(ctx, a.conf)
+			if queryProps.hasError() {
+				uniresp.RespondWithErrorJSON(ctx, queryProps.err, queryProps.status)
+				return rdb.Query{}, false
+			}
+			args := argsBuilder(queryProps)
+			if err := validateConcSort(&args, queryProps.corpusConf); err != nil {
+				uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+				return rdb.Query{}, false
+			}
+			return rdb.Query{Func: "concordance", Args: args}, true
+		},
+		"term-frequency": func(ctx *gin.Context) (rdb.Query, bool) {
+			queryProps := DetermineQueryProps(ctx, a.conf)
+			if queryProps.hasError() {
+				uniresp.RespondWithErrorJSON(ctx, queryProps.err, queryProps.status)
+				return rdb.Query{}, false
+			}
+			return rdb.Query{Func: "termFrequency", Args: a.termFrequencyArgs(queryProps)}, true
+		},
+	}
+}
+
+// SubmitJob godoc
+// @Summary      SubmitJob
+// @Description  Submit an asynchronous job. The function arguments are the same as for the respective synchronous endpoint. The returned job ID can be used to poll for the job status and result.
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus to search in"
+// @Param        func path string true "A function to be run" enums(freqs, collocations, concordance, term-frequency)
+// @Success      202 {object} rdb.JobInfo
+// @Router       /jobs/{corpusId}/{func} [post]
+func (a *Actions) SubmitJob(ctx *gin.Context) {
+	builder, ok := a.jobQueryBuilders()[ctx.Param("func")]
+	if !ok {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("unsupported job function: %s", ctx.Param("func")),
+			http.StatusNotFound,
+		)
+		return
+	}
+	query, ok := builder(ctx)
+	if !ok {
+		return
+	}
+	job, err := a.radapter.SubmitJob(query, ctx.Param("corpusId"))
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	uniresp.WriteJSONResponseWithStatus(ctx.Writer, http.StatusAccepted, job)
+}
+
+// GetJob godoc
+// @Summary      GetJob
+// @Description  Get status of an asynchronous job. Once the job is finished, the result is attached.
+// @Produce      json
+// @Param        jobId path string true "An ID of a job"
+// @Success      200 {object} rdb.JobInfo
+// @Router       /jobs/{jobId} [get]
+func (a *Actions) GetJob(ctx *gin.Context) {
+	job, err := a.radapter.GetJob(ctx.Param("jobId"))
+	if err == rdb.ErrJobNotFound {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	ans := jobResponse{JobInfo: job}
+	if job.Status == rdb.JobStatusFinished {
+		rawResult, err := a.radapter.GetJobResult(job)
+		if err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+			return
+		}
+		ans.Result = a.jobResultForResponse(job, rawResult.Value)
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, ans)
+}
+
+// jobResultForResponse applies the same post-processing the respective
+// synchronous actions do and makes sure the result's JSON serialization
+// is used.
+func (a *Actions) jobResultForResponse(job rdb.JobInfo, value rdb.FuncResult) any {
+	switch tValue := value.(type) {
+	case results.FreqDistrib:
+		return &tValue
+	case results.ConcSize:
+		return &tValue
+	case results.Collocations:
+		tValue.SrchRange[0] = -1 * tValue.SrchRange[0] // note: HTTP and internal API are different
+		return &tValue
+	case results.Concordance:
+		if corpConf := a.conf.GetCorp(job.CorpusID); corpConf != nil {
+			corpus.ApplyTextPropertiesMapping(tValue, corpConf.TextProperties)
+		}
+		return &tValue
+	default:
+		return value
+	}
+}
+
+// DeleteJob godoc
+// @Summary      DeleteJob
+// @Description  Remove an asynchronous job along with its result. A job which has not been started yet will not be processed at all.
+// @Produce      json
+// @Param        jobId path string true "An ID of a job"
+// @Success      200 {object} any
+// @Router       /jobs/{jobId} [delete]
+func (a *Actions) DeleteJob(ctx *gin.Context) {
+	err := a.radapter.DeleteJob(ctx.Param("jobId"))
+	if err == rdb.ErrJobNotFound {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"ok": true})
+}
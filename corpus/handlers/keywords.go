@@ -0,0 +1,293 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mquery/corpus"
+	"mquery/mango"
+	"mquery/rdb"
+	"mquery/rdb/results"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/czcorpus/cnc-gokit/unireq"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DefaultKeywordsAttr      = "lemma"
+	DefaultKeywordsMinFreq   = 5
+	DefaultKeywordsMaxItems  = 50
+	DefaultKeywordsSmoothing = 1.0
+	MaxKeywordsResultItems   = 1000
+	keywordsWordListMaxItems = 1000000
+	keywordsAllTokensQuery   = "[]"
+)
+
+var errKeywordsListTooLarge = fmt.Errorf(
+	"word list has more than %d items - please increase minFreq", keywordsWordListMaxItems)
+
+// keywordsSide specifies a (sub)corpus a word list is calculated from
+type keywordsSide struct {
+	corpusID      string
+	corpusConf    *corpus.MQCorpusSetup
+	savedSubcPath string
+
+	// query is a query matching all the tokens of a text-type
+	// or query-defined subcorpus (empty for other subcorpora)
+	query string
+}
+
+func (side keywordsSide) equals(other keywordsSide) bool {
+	return side.corpusID == other.corpusID && side.savedSubcPath == other.savedSubcPath &&
+		side.query == other.query
+}
+
+// determineKeywordsSide resolves a corpus along with an optional subcorpus
+// and an optional `within` restriction (a query-defined subcorpus)
+func (a *Actions) determineKeywordsSide(corpusID, subc, within string) (keywordsSide, int, error) {
+	ans := keywordsSide{corpusID: corpusID}
+	ans.corpusConf = a.conf.GetCorp(corpusID)
+	if ans.corpusConf == nil {
+		return ans, http.StatusNotFound, fmt.Errorf("%w: %s", corpus.ErrNotFound, corpusID)
+	}
+	ttCQL, savedSubcPath, err := resolveSubcorpus(a.conf, corpusID, ans.corpusConf, subc)
+	if err != nil {
+		return ans, http.StatusUnprocessableEntity, err
+	}
+	ans.savedSubcPath = savedSubcPath
+	if ttCQL != "" {
+		ans.query = keywordsAllTokensQuery + ttCQL
+	}
+	if within != "" {
+		if ans.query == "" {
+			ans.query = keywordsAllTokensQuery
+		}
+		ans.query += " within " + within
+	}
+	return ans, http.StatusOK, nil
+}
+
+// Keywords godoc
+// @Summary      Keywords
+// @Description  Calculate keywords of a focus (sub)corpus - i.e. words which are significantly more frequent there than in a reference (sub)corpus. The focus can be a saved subcorpus, a text-type subcorpus or it can be defined by a `within` query. Word lists of whole corpora are read from attribute lexicons and reference frequencies are searched just for the focus words. In case the corpus is split (see `/split`), word lists of text-type or query-defined subcorpora are calculated in parallel.
+// @Produce      json
+// @Param        corpusId path string true "An ID of a focus corpus"
+// @Param        subcorpus query string false "An ID of a focus subcorpus"
+// @Param        within query string false "A CQL structure expression defining a focus subcorpus (e.g. `<doc txtype=\"FIC\" />`)"
+// @Param        refCorpus query string false "An ID of a reference corpus (the focus corpus by default)"
+// @Param        refSubcorpus query string false "An ID of a reference subcorpus"
+// @Param        attr query string false "A positional attribute word lists are calculated on" default(lemma)
+// @Param        measure query string false "A keyness measure the result is sorted by" enums(logLikelihood, percDiff, simpleMaths, chiSquare) default(logLikelihood)
+// @Param        smoothing query number false "The N parameter of the simple maths measure" default(1)
+// @Param        minFreq query int false "The minimum frequency of a word in the focus corpus" default(5)
+// @Param        minRefFreq query int false "The minimum frequency of a word in the reference corpus" default(0)
+// @Param        maxItems query int false "The maximum number of result items" default(50)
+// @Success      200 {object} results.Keywords
+// @Router       /keywords/{corpusId} [get]
+func (a *Actions) Keywords(ctx *gin.Context) {
+	focus, status, err := a.determineKeywordsSide(
+		ctx.Param("corpusId"), ctx.Query("subcorpus"), ctx.Query("within"))
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, status)
+		return
+	}
+	ref, status, err := a.determineKeywordsSide(
+		ctx.DefaultQuery("refCorpus", focus.corpusID), ctx.Query("refSubcorpus"), "")
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, status)
+		return
+	}
+	if focus.equals(ref) {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("focus and reference corpus must differ"), http.StatusBadRequest)
+		return
+	}
+	attr := ctx.DefaultQuery("attr", DefaultKeywordsAttr)
+	for _, side := range []keywordsSide{focus, ref} {
+		if !slices.Contains(side.corpusConf.PosAttrs.GetIDs(), attr) {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				fmt.Errorf("invalid attr - unknown attribute %s in %s", attr, side.corpusID),
+				http.StatusBadRequest,
+			)
+			return
+		}
+	}
+	conf := results.KeywordsConf{
+		Measure:   ctx.DefaultQuery("measure", results.KeynessLogLikelihood),
+		Smoothing: DefaultKeywordsSmoothing,
+	}
+	if !results.IsValidKeynessMeasure(conf.Measure) {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid measure %s", conf.Measure), http.StatusBadRequest)
+		return
+	}
+	if ctx.Request.URL.Query().Has("smoothing") {
+		conf.Smoothing, err = strconv.ParseFloat(ctx.Query("smoothing"), 64)
+		if err != nil || conf.Smoothing <= 0 {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				errors.New("invalid smoothing - value must be a number greater than 0"),
+				http.StatusBadRequest,
+			)
+			return
+		}
+	}
+	minFreq, ok := unireq.GetURLIntArgOrFail(ctx, "minFreq", DefaultKeywordsMinFreq)
+	if !ok {
+		return
+	}
+	minRefFreq, ok := unireq.GetURLIntArgOrFail(ctx, "minRefFreq", 0)
+	if !ok {
+		return
+	}
+	if minFreq < 1 || minRefFreq < 0 {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New("invalid minFreq or minRefFreq - values must be positive"),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	conf.MinFreq = int64(minFreq)
+	conf.MinRefFreq = int64(minRefFreq)
+	conf.MaxItems, ok = getBoundedIntArgOrFail(
+		ctx, "maxItems", DefaultKeywordsMaxItems, MaxKeywordsResultItems)
+	if !ok {
+		return
+	}
+
+	focusList, err := a.keywordsWordList(ctx, focus, attr, conf.MinFreq, nil)
+	if err != nil {
+		respondKeywordsError(ctx, err)
+		return
+	}
+	// the reference frequencies are searched just for the focus words so
+	// the reference list is always complete (and it remains small)
+	refValues := make([]string, 0, len(focusList.Items))
+	for _, item := range focusList.Items {
+		if item.Freq >= conf.MinFreq {
+			refValues = append(refValues, item.Word)
+		}
+	}
+	refList, err := a.keywordsWordList(ctx, ref, attr, 1, refValues)
+	if err != nil {
+		respondKeywordsError(ctx, err)
+		return
+	}
+	result, err := results.CompileKeywords(focusList, refList, conf)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, &result)
+}
+
+func respondKeywordsError(ctx *gin.Context, err error) {
+	if errors.Is(err, errKeywordsListTooLarge) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusUnprocessableEntity)
+		return
+	}
+	respondGatherError(ctx, err)
+}
+
+// keywordsWordList calculates a complete word list of a (sub)corpus using
+// the "wordlist" worker function (i.e. attribute lexicons are used for whole
+// corpora). In case `values` is not nil, the list is restricted to them.
+// For a split corpus and a text-type or query-defined subcorpus, chunks
+// are calculated in parallel and merged. A word list which would have
+// to be truncated is reported as an error (errKeywordsListTooLarge)
+// as it would distort the keyness scores.
+func (a *Actions) keywordsWordList(
+	ctx *gin.Context,
+	side keywordsSide,
+	attr string,
+	minFreq int64,
+	values []string,
+) (*results.Wordlist, error) {
+	args := rdb.WordlistArgs{
+		CorpusPath: a.conf.GetRegistryPath(side.corpusID),
+		SubcPath:   side.savedSubcPath,
+		Query:      side.query,
+		Attr:       attr,
+		Values:     values,
+		NgramSize:  1,
+		MinFreq:    minFreq,
+		SortBy:     rdb.WordlistSortFreq,
+		Limit:      keywordsWordListMaxItems,
+	}
+	if values != nil {
+		// with no values, we still need the size of the (sub)corpus
+		args.Limit = max(len(values), 1)
+	}
+	chunks := []string{side.savedSubcPath}
+	if side.savedSubcPath == "" && side.query != "" {
+		sc, err := corpus.OpenSplitCorpus(a.conf.SplitCorporaDir, args.CorpusPath)
+		if err == nil && len(sc.Subcorpora) > 0 {
+			chunks = sc.Subcorpora
+			// chunk items under the limit can still pass it once merged
+			args.MinFreq = 1
+		}
+	}
+	result := new(results.Wordlist)
+	var truncated bool
+	// a partial word list would distort the keyness scores
+	// so missing chunks always make the calculation fail
+	sg := corpus.NewScatterGather(
+		a.radapter,
+		corpus.FailOnMissingChunks,
+		a.conf.SplitChunkRetries,
+		GetCTXStoredTimeout(ctx),
+	)
+	_, err := corpus.Gather(
+		ctx.Request.Context(),
+		sg,
+		chunks,
+		func(chunk corpus.Chunk) rdb.Query {
+			chunkArgs := args
+			chunkArgs.SubcPath = chunk.SubcPath
+			return rdb.Query{
+				Func: "wordlist",
+				Args: chunkArgs,
+			}
+		},
+		func(chunk corpus.Chunk, resultNext results.Wordlist, err error) {
+			if err == nil {
+				truncated = truncated || resultNext.Total > int64(len(resultNext.Items))
+				result.MergeWith(&resultNext)
+			}
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate word list of %s: %w", side.corpusID, err)
+	}
+	if truncated {
+		return nil, fmt.Errorf("%w (%s)", errKeywordsListTooLarge, side.corpusID)
+	}
+	if len(values) == 0 && values != nil {
+		result.Items = []*mango.GoWordlistItem{}
+	}
+	return result, nil
+}
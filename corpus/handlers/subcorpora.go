@@ -0,0 +1,301 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mquery/corpus"
+	"mquery/rdb"
+	"mquery/rdb/results"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxSubcorpusQueryHits limits the number of items a subcorpus
+	// query may match so queries like `[]` cannot exhaust workers' memory
+	maxSubcorpusQueryHits = 10000000
+)
+
+type createSubcorpusArgs struct {
+	Name       string                     `json:"name"`
+	Definition corpus.SubcorpusDefinition `json:"definition"`
+
+	// PrecalcAttrs are positional attributes to compile
+	// frequencies for (see rdb.CalcCollFreqDataArgs)
+	PrecalcAttrs []string `json:"precalcAttrs"`
+
+	// PrecalcStructs are structures to calculate token
+	// coverage for (see rdb.CalcCollFreqDataArgs)
+	PrecalcStructs []string `json:"precalcStructs"`
+}
+
+type subcorpusResponse struct {
+	*corpus.SavedSubcorpus
+
+	// PrecalcJob is an asynchronous job (see `/jobs/{jobId}`)
+	// precalculating data for the subcorpus
+	PrecalcJob *rdb.JobInfo `json:"precalcJob,omitempty"`
+}
+
+// publicSavedSubcorpus returns a copy of the subcorpus
+// with no information about its author
+func publicSavedSubcorpus(subc *corpus.SavedSubcorpus) *corpus.SavedSubcorpus {
+	ans := *subc
+	ans.AuthorTokenHash = ""
+	return &ans
+}
+
+// savedSubcorporaDirOrFail returns the configured directory
+// for saved subcorpora. In case it is not configured, the function
+// writes an error response and returns false.
+// removeIncompleteSubcorpus removes a subcorpus which could not be
+// completed. Errors are only logged as the subcorpus is not listed anyway.
+func removeIncompleteSubcorpus(baseDir string, subc *corpus.SavedSubcorpus) {
+	if err := corpus.DeleteSavedSubcorpus(baseDir, subc.CorpusID, subc.ID); err != nil {
+		log.Error().Err(err).Str("subcorpus", subc.ID).Msg("failed to remove incomplete subcorpus")
+	}
+}
+
+func (a *Actions) savedSubcorporaDirOrFail(ctx *gin.Context) (string, bool) {
+	if a.conf.SavedSubcorporaDir == "" {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New("saved subcorpora are not configured"),
+			http.StatusNotImplemented,
+		)
+		return "", false
+	}
+	if a.conf.GetCorp(ctx.Param("corpusId")) == nil {
+		uniresp.RespondWithErrorJSON(ctx, corpus.ErrNotFound, http.StatusNotFound)
+		return "", false
+	}
+	return a.conf.SavedSubcorporaDir, true
+}
+
+// authorToken returns an authentication token of the request (if any)
+func (a *Actions) authorToken(ctx *gin.Context) string {
+	if a.authTokenHeader == "" {
+		return ""
+	}
+	return ctx.GetHeader(a.authTokenHeader)
+}
+
+// authorTokenOrFail returns an authentication token of the request.
+// Subcorpora are managed only by their authors so in case there is
+// no token, the function writes an error response and returns false.
+func (a *Actions) authorTokenOrFail(ctx *gin.Context) (string, bool) {
+	token := a.authorToken(ctx)
+	if token == "" {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("an authentication token is required"), http.StatusUnauthorized)
+		return "", false
+	}
+	return token, true
+}
+
+// CreateSubcorpus godoc
+// @Summary      CreateSubcorpus
+// @Description  Create a saved subcorpus from a text type selection (attribute values of a single structure), from explicit position ranges or from a CQL query (e.g. `<doc txtype="FIC" />` for whole documents). A CQL query may match at most 10,000,000 items. The subcorpus can be then used via the `subcorpus` argument of other endpoints. An authentication token is required as only the subcorpus author can remove the subcorpus. Optionally, data for collocations and text types (see `/tools/split`) are precalculated via an asynchronous job.
+// @Accept       json
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus"
+// @Param        args body createSubcorpusArgs true "A subcorpus name and definition"
+// @Success      201 {object} subcorpusResponse
+// @Router       /subcorpora/{corpusId} [post]
+func (a *Actions) CreateSubcorpus(ctx *gin.Context) {
+	baseDir, ok := a.savedSubcorporaDirOrFail(ctx)
+	if !ok {
+		return
+	}
+	authorToken, ok := a.authorTokenOrFail(ctx)
+	if !ok {
+		return
+	}
+	var args createSubcorpusArgs
+	if err := ctx.ShouldBindJSON(&args); err != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid subcorpus arguments: %w", err), http.StatusBadRequest)
+		return
+	}
+	if args.Name == "" {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("missing subcorpus name"), http.StatusBadRequest)
+		return
+	}
+	if err := args.Definition.Validate(); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	query, err := args.Definition.Query()
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	subcID, err := corpus.NewSavedSubcorpusID()
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	subc := &corpus.SavedSubcorpus{
+		ID:              subcID,
+		CorpusID:        ctx.Param("corpusId"),
+		Name:            args.Name,
+		Definition:      args.Definition,
+		Created:         time.Now(),
+		AuthorTokenHash: corpus.HashAuthorToken(authorToken),
+	}
+	if err := corpus.ReserveSavedSubcorpus(baseDir, subc); err != nil {
+		removeIncompleteSubcorpus(baseDir, subc)
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	subcPath := corpus.SavedSubcorpusPath(baseDir, subcID)
+	corpusPath := a.conf.GetRegistryPath(ctx.Param("corpusId"))
+	// note: the worker owns the subcorpus directory until it answers - it also
+	// removes the directory in case it fails or nobody waits for the result
+	// (e.g. cancelled or timed out request)
+	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
+		rdb.Query{
+			Func: "createSubcorpus",
+			Args: rdb.CreateSubcorpusArgs{
+				CorpusPath:   corpusPath,
+				SubcPath:     subcPath,
+				Query:        query,
+				Ranges:       args.Definition.Ranges,
+				MaxQueryHits: maxSubcorpusQueryHits,
+			},
+		},
+		GetCTXStoredTimeout(ctx),
+	)
+	if err != nil {
+		removeIncompleteSubcorpus(baseDir, subc)
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	rawResult := <-wait
+	if ok := HandleWorkerError(ctx, rawResult); !ok {
+		return
+	}
+	result, ok := TypedOrRespondError[results.Subcorpus](ctx, rawResult)
+	if !ok {
+		return
+	}
+	subc.Size = result.Size
+	if err := corpus.WriteSavedSubcorpusMeta(baseDir, subc); err != nil {
+		removeIncompleteSubcorpus(baseDir, subc)
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	ans := subcorpusResponse{SavedSubcorpus: publicSavedSubcorpus(subc)}
+	if len(args.PrecalcAttrs) > 0 || len(args.PrecalcStructs) > 0 {
+		job, err := a.radapter.SubmitJob(
+			rdb.Query{
+				Func: "calcCollFreqData",
+				Args: rdb.CalcCollFreqDataArgs{
+					CorpusPath:     corpusPath,
+					SubcPath:       subcPath,
+					Attrs:          args.PrecalcAttrs,
+					Structs:        args.PrecalcStructs,
+					MktokencovPath: a.conf.MktokencovPath,
+				},
+			},
+			ctx.Param("corpusId"),
+		)
+		if err != nil {
+			// the subcorpus itself is usable so we just report the problem
+			log.Error().Err(err).Str("subcorpus", subcID).Msg("failed to submit subcorpus precalculation")
+
+		} else {
+			ans.PrecalcJob = &job
+		}
+	}
+	uniresp.WriteJSONResponseWithStatus(ctx.Writer, http.StatusCreated, ans)
+}
+
+// SavedSubcorpora godoc
+// @Summary      SavedSubcorpora
+// @Description  List saved subcorpora of a corpus
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus"
+// @Success      200 {object} []corpus.SavedSubcorpus
+// @Router       /subcorpora/{corpusId} [get]
+func (a *Actions) SavedSubcorpora(ctx *gin.Context) {
+	baseDir, ok := a.savedSubcorporaDirOrFail(ctx)
+	if !ok {
+		return
+	}
+	items, err := corpus.ListSavedSubcorpora(baseDir, ctx.Param("corpusId"))
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	for i, item := range items {
+		items[i] = publicSavedSubcorpus(item)
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, items)
+}
+
+// DeleteSubcorpus godoc
+// @Summary      DeleteSubcorpus
+// @Description  Remove a saved subcorpus. A subcorpus can be removed only with the authentication token it was created with.
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus"
+// @Param        subcId path string true "An ID of a subcorpus"
+// @Success      200 {object} any
+// @Router       /subcorpora/{corpusId}/{subcId} [delete]
+func (a *Actions) DeleteSubcorpus(ctx *gin.Context) {
+	baseDir, ok := a.savedSubcorporaDirOrFail(ctx)
+	if !ok {
+		return
+	}
+	authorToken, ok := a.authorTokenOrFail(ctx)
+	if !ok {
+		return
+	}
+	subc, err := corpus.LoadSavedSubcorpus(baseDir, ctx.Param("subcId"))
+	if err == corpus.ErrSubcorpusNotFound || err == nil && subc.CorpusID != ctx.Param("corpusId") {
+		uniresp.RespondWithErrorJSON(ctx, corpus.ErrSubcorpusNotFound, http.StatusNotFound)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	if !subc.IsAuthor(authorToken) {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("the subcorpus can be removed only by its author"), http.StatusForbidden)
+		return
+	}
+	if err := corpus.DeleteSavedSubcorpus(baseDir, subc.CorpusID, subc.ID); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"ok": true})
+}
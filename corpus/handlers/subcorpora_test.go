@@ -0,0 +1,252 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"mquery/corpus"
+	"mquery/merror"
+	"mquery/rdb"
+	"mquery/rdb/results"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTokenHeader = "X-Api-Key"
+
+// fakeSubcWorker answers `createSubcorpus` queries. Before answering,
+// it calls `process` (if set) simulating the worker's processing.
+type fakeSubcWorker struct {
+	process func(args rdb.CreateSubcorpusArgs)
+	result  rdb.WorkerResult
+}
+
+func (fw *fakeSubcWorker) PublishQuery(ctx context.Context, query rdb.Query, customTimeout time.Duration) (<-chan rdb.WorkerResult, error) {
+	if fw.process != nil {
+		fw.process(query.Args.(rdb.CreateSubcorpusArgs))
+	}
+	ans := make(chan rdb.WorkerResult, 1)
+	ans <- fw.result
+	close(ans)
+	return ans, nil
+}
+
+func (fw *fakeSubcWorker) SubmitJob(query rdb.Query, corpusID string) (rdb.JobInfo, error) {
+	return rdb.JobInfo{}, errors.New("not supported")
+}
+
+func (fw *fakeSubcWorker) GetJob(jobID string) (rdb.JobInfo, error) {
+	return rdb.JobInfo{}, rdb.ErrJobNotFound
+}
+
+func (fw *fakeSubcWorker) GetJobResult(job rdb.JobInfo) (rdb.WorkerResult, error) {
+	return rdb.WorkerResult{}, rdb.ErrJobNotFound
+}
+
+func (fw *fakeSubcWorker) DeleteJob(jobID string) error {
+	return rdb.ErrJobNotFound
+}
+
+func (fw *fakeSubcWorker) TryLock(name string, ttl time.Duration) (func(), bool, error) {
+	return func() {}, true, nil
+}
+
+// writeTestSubcorpus simulates the worker writing subcorpus data
+func writeTestSubcorpus(t *testing.T) func(args rdb.CreateSubcorpusArgs) {
+	return func(args rdb.CreateSubcorpusArgs) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(args.SubcPath), 0755))
+		assert.NoError(t, os.WriteFile(args.SubcPath, make([]byte, 16), 0644))
+	}
+}
+
+func newSubcTestActions(t *testing.T, worker *fakeSubcWorker) *Actions {
+	act := newWordlistTestActions(t)
+	act.conf.SavedSubcorporaDir = t.TempDir()
+	act.radapter = worker
+	act.authTokenHeader = testTokenHeader
+	return act
+}
+
+func newSubcTestContext(method, body, token string, params gin.Params) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(method, "/subcorpora/testcorp", strings.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		ctx.Request.Header.Set(testTokenHeader, token)
+	}
+	ctx.Params = params
+	return ctx, w
+}
+
+func createTestSubcorpus(act *Actions, token string) *httptest.ResponseRecorder {
+	ctx, w := newSubcTestContext(
+		http.MethodPost,
+		`{"name": "fiction", "definition": {"within": "<doc txtype=\"FIC\" />"}}`,
+		token,
+		gin.Params{{Key: "corpusId", Value: "testcorp"}},
+	)
+	act.CreateSubcorpus(ctx)
+	return w
+}
+
+// subcDirs returns subcorpora directories found in a saved subcorpora directory
+func subcDirs(t *testing.T, baseDir string) []string {
+	dirs, err := filepath.Glob(filepath.Join(baseDir, "*", "*"))
+	assert.NoError(t, err)
+	ans := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if !strings.Contains(dir, "_index") {
+			ans = append(ans, dir)
+		}
+	}
+	return ans
+}
+
+func TestCreateSubcorpus(t *testing.T) {
+	var act *Actions
+	act = newSubcTestActions(t, &fakeSubcWorker{
+		process: func(args rdb.CreateSubcorpusArgs) {
+			// metadata must be available before the data file is written
+			subcID := filepath.Base(filepath.Dir(args.SubcPath))
+			meta, err := corpus.LoadSavedSubcorpus(act.conf.SavedSubcorporaDir, subcID)
+			assert.NoError(t, err)
+			assert.Equal(t, "testcorp", meta.CorpusID)
+			writeTestSubcorpus(t)(args)
+		},
+		result: rdb.WorkerResult{Value: results.Subcorpus{Size: 1000, NumRanges: 1}},
+	})
+	w := createTestSubcorpus(act, "secret")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "authorTokenHash")
+	items, err := corpus.ListSavedSubcorpora(act.conf.SavedSubcorporaDir, "testcorp")
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, int64(1000), items[0].Size)
+	assert.True(t, items[0].IsAuthor("secret"))
+}
+
+func TestCreateSubcorpusRequiresToken(t *testing.T) {
+	worker := &fakeSubcWorker{process: func(args rdb.CreateSubcorpusArgs) {
+		assert.Fail(t, "no query expected")
+	}}
+	act := newSubcTestActions(t, worker)
+	w := createTestSubcorpus(act, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, subcDirs(t, act.conf.SavedSubcorporaDir))
+}
+
+func TestCreateSubcorpusWorkerFailure(t *testing.T) {
+	act := newSubcTestActions(t, &fakeSubcWorker{
+		result: rdb.WorkerResult{
+			Value:        results.Subcorpus{Error: errors.New("the subcorpus query matches more than 10 items")},
+			HasUserError: true,
+		},
+	})
+	w := createTestSubcorpus(act, "secret")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	// the reserved directory is removed by the worker (see removeSubcorpus)
+	for _, dir := range subcDirs(t, act.conf.SavedSubcorporaDir) {
+		assert.NoFileExists(t, filepath.Join(dir, "data.subc"))
+	}
+	items, err := corpus.ListSavedSubcorpora(act.conf.SavedSubcorporaDir, "testcorp")
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestCreateSubcorpusCancelledKeepsWorkerData(t *testing.T) {
+	// the worker may still be writing the data so they are
+	// left to the worker (see Worker.clientWaits)
+	var subcPath string
+	act := newSubcTestActions(t, &fakeSubcWorker{
+		process: func(args rdb.CreateSubcorpusArgs) {
+			subcPath = args.SubcPath
+			writeTestSubcorpus(t)(args)
+		},
+		result: rdb.WorkerResult{
+			Value: rdb.ErrorResult{
+				Func:  "createSubcorpus",
+				Error: merror.CancelledError{Msg: "query cancelled by client"},
+			},
+		},
+	})
+	w := createTestSubcorpus(act, "secret")
+	assert.NotEqual(t, http.StatusCreated, w.Code)
+	assert.FileExists(t, subcPath)
+	items, err := corpus.ListSavedSubcorpora(act.conf.SavedSubcorporaDir, "testcorp")
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestCreateSubcorpusMetadataFailure(t *testing.T) {
+	act := newSubcTestActions(t, &fakeSubcWorker{
+		process: writeTestSubcorpus(t),
+		result:  rdb.WorkerResult{Value: results.Subcorpus{Size: 1000, NumRanges: 1}},
+	})
+	// a file in place of the index directory makes indexing fail
+	assert.NoError(t, os.WriteFile(
+		filepath.Join(act.conf.SavedSubcorporaDir, "_index"), []byte{}, 0644))
+	w := createTestSubcorpus(act, "secret")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, subcDirs(t, act.conf.SavedSubcorporaDir))
+}
+
+func TestDeleteSubcorpus(t *testing.T) {
+	act := newSubcTestActions(t, &fakeSubcWorker{
+		process: writeTestSubcorpus(t),
+		result:  rdb.WorkerResult{Value: results.Subcorpus{Size: 1000, NumRanges: 1}},
+	})
+	assert.Equal(t, http.StatusCreated, createTestSubcorpus(act, "secret").Code)
+	items, err := corpus.ListSavedSubcorpora(act.conf.SavedSubcorporaDir, "testcorp")
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	params := gin.Params{{Key: "corpusId", Value: "testcorp"}, {Key: "subcId", Value: items[0].ID}}
+
+	for token, status := range map[string]int{
+		"":      http.StatusUnauthorized,
+		"other": http.StatusForbidden,
+	} {
+		ctx, w := newSubcTestContext(http.MethodDelete, "", token, params)
+		act.DeleteSubcorpus(ctx)
+		assert.Equal(t, status, w.Code)
+		assert.Len(t, subcDirs(t, act.conf.SavedSubcorporaDir), 1)
+	}
+
+	ctx, w := newSubcTestContext(http.MethodDelete, "", "secret", params)
+	act.DeleteSubcorpus(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, subcDirs(t, act.conf.SavedSubcorporaDir))
+	items, err = corpus.ListSavedSubcorpora(act.conf.SavedSubcorporaDir, "testcorp")
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+
+	ctx, w = newSubcTestContext(http.MethodDelete, "", "secret", params)
+	act.DeleteSubcorpus(ctx)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -19,6 +19,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -28,7 +29,6 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/czcorpus/cnc-gokit/collections"
@@ -54,6 +54,26 @@ type StreamData struct {
 	Error error `json:"error,omitempty"`
 }
 
+func (sd StreamData) MarshalJSON() ([]byte, error) {
+	var errStr string
+	if sd.Error != nil {
+		errStr = sd.Error.Error()
+	}
+	return json.Marshal(
+		struct {
+			Entries  results.FreqDistrib `json:"entries"`
+			ChunkNum int                 `json:"chunkNum"`
+			Total    int                 `json:"totalChunks"`
+			Error    string              `json:"error,omitempty"`
+		}{
+			Entries:  sd.Entries,
+			ChunkNum: sd.ChunkNum,
+			Total:    sd.Total,
+			Error:    errStr,
+		},
+	)
+}
+
 type streamedFreqsBaseArgs struct {
 	Q        string
 	Attr     string
@@ -216,7 +236,12 @@ func (a *Actions) filterByYearRange(inStream chan StreamData, dateFormat, fromDa
 	return ans
 }
 
-func (a *Actions) streamCalc(query, attr, corpusID string, flimit, maxItems int, workerTimeout time.Duration) (chan StreamData, error) {
+// streamCalc calculates text type frequencies over chunks of a split corpus.
+// For each finished chunk, the merged result so far is sent to the returned
+// channel. A failed chunk is reported via StreamData.Error. In case the whole
+// calculation fails (see corpus.ChunkFailurePolicy), a final message
+// with the error is sent.
+func (a *Actions) streamCalc(ctx context.Context, query, attr, corpusID string, flimit, maxItems int, sg *corpus.ScatterGather) (chan StreamData, error) {
 	messageChannel := make(chan StreamData, 10)
 	corpusPath := a.conf.GetRegistryPath(corpusID)
 	sc, err := corpus.OpenSplitCorpus(a.conf.SplitCorporaDir, corpusPath)
@@ -227,70 +252,49 @@ func (a *Actions) streamCalc(query, attr, corpusID string, flimit, maxItems int,
 
 	result := new(results.FreqDistrib)
 	result.Freqs = make([]*results.FreqDistribItem, 0)
-	mergedFreqLock := sync.Mutex{}
 
 	go func() {
-		wg := sync.WaitGroup{}
-		wg.Add(len(sc.Subcorpora))
-
-		for chunkIdx, subc := range sc.Subcorpora {
-			go func(chIdx int, subcx string) {
-				defer wg.Done()
-				wait, err := a.radapter.PublishQuery(
-					rdb.Query{
-						Func: "freqDistrib",
-						Args: rdb.FreqDistribArgs{
-							CorpusPath:  corpusPath,
-							SubcPath:    subcx,
-							Query:       query,
-							Crit:        fmt.Sprintf("%s 0", attr),
-							IsTextTypes: true,
-							FreqLimit:   flimit,
-							MaxItems:    maxItems,
-						},
+		_, err := corpus.Gather(
+			ctx,
+			sg,
+			sc.Subcorpora,
+			func(chunk corpus.Chunk) rdb.Query {
+				return rdb.Query{
+					Func: "freqDistrib",
+					Args: rdb.FreqDistribArgs{
+						CorpusPath:  corpusPath,
+						SubcPath:    chunk.SubcPath,
+						Query:       query,
+						Crit:        fmt.Sprintf("%s 0", attr),
+						IsTextTypes: true,
+						FreqLimit:   flimit,
+						MaxItems:    maxItems,
 					},
-					workerTimeout,
-				)
+				}
+			},
+			func(chunk corpus.Chunk, resultNext results.FreqDistrib, err error) {
 				if err != nil {
 					messageChannel <- StreamData{
-						ChunkNum: chunkIdx + 1,
+						ChunkNum: chunk.Num,
 						Total:    len(sc.Subcorpora),
 						Error:    err,
 					}
 					return
-
-				} else {
-					tmp := <-wait
-					if err := tmp.Value.Err(); err != nil {
-						messageChannel <- StreamData{
-							ChunkNum: chIdx + 1,
-							Total:    len(sc.Subcorpora),
-							Error:    err,
-						}
-						return
-					}
-					resultNext, ok := tmp.Value.(results.FreqDistrib)
-					if !ok {
-						messageChannel <- StreamData{
-							ChunkNum: chIdx + 1,
-							Total:    len(sc.Subcorpora),
-							Error:    fmt.Errorf("invalid type for FreqDistrib"),
-						}
-						return
-					}
-					mergedFreqLock.Lock()
-					result.MergeWith(&resultNext)
-					mergedFreqLock.Unlock()
-					messageChannel <- StreamData{
-						Entries:  *result,
-						ChunkNum: chIdx + 1,
-						Total:    len(sc.Subcorpora),
-						Error:    resultNext.Error,
-					}
 				}
-			}(chunkIdx, subc)
+				result.MergeWith(&resultNext)
+				messageChannel <- StreamData{
+					Entries:  *result,
+					ChunkNum: chunk.Num,
+					Total:    len(sc.Subcorpora),
+				}
+			},
+		)
+		if err != nil {
+			messageChannel <- StreamData{
+				Total: len(sc.Subcorpora),
+				Error: err,
+			}
 		}
-		wg.Wait()
 		close(messageChannel)
 	}()
 
@@ -366,6 +370,7 @@ func (a *Actions) ttStreamedBase(ctx *gin.Context) (streamedFreqsBaseArgs, bool)
 // @Param        attr query string false "An attribute used for freq. calculation (mutually exclusive with `fcrit`)"
 // @Param        fcrit query string false "A freq. criterium in Manatee-open format (mutually exclusive with `attr`)"
 // @Param		 autobin query int 0 "If 1 then data will be grouped into a suitable number of bins for readability"
+// @Param        allowPartial query int false "If 1, then failed chunks of the split corpus do not make the whole calculation fail (they are still reported via the `error` property)"
 // @Success      200 {object} results.FreqDistrib
 // @Router       /text-types-streamed/{corpusId} [get]
 func (a *Actions) TextTypesStreamed(ctx *gin.Context) {
@@ -376,7 +381,7 @@ func (a *Actions) TextTypesStreamed(ctx *gin.Context) {
 		return
 	}
 
-	calc, err := a.streamCalc(args.Q, args.Attr, ctx.Param("corpusId"), args.Flimit, args.MaxItems, GetCTXStoredTimeout(ctx))
+	calc, err := a.streamCalc(ctx.Request.Context(), args.Q, args.Attr, ctx.Param("corpusId"), args.Flimit, args.MaxItems, a.newScatterGather(ctx))
 	if err != nil {
 		WriteStreamingError(ctx, err)
 		return
@@ -437,7 +442,7 @@ func (a *Actions) FreqsByYears(ctx *gin.Context) {
 		return
 	}
 
-	calc, err := a.streamCalc(args.Q, args.Attr, corpusID, args.Flimit, args.MaxItems, GetCTXStoredTimeout(ctx))
+	calc, err := a.streamCalc(ctx.Request.Context(), args.Q, args.Attr, corpusID, args.Flimit, args.MaxItems, a.newScatterGather(ctx))
 	if err != nil {
 		WriteStreamingError(ctx, err)
 		return
@@ -30,6 +30,7 @@ import (
 func (a *Actions) TextTypesNorms(ctx *gin.Context) {
 	corpusPath := a.conf.GetRegistryPath(ctx.Param("corpusId"))
 	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
 		rdb.Query{
 			Func: "textTypeNorms",
 			Args: rdb.TextTypeNormsArgs{
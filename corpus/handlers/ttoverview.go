@@ -131,6 +131,7 @@ func (a *Actions) TextTypesOverview(ctx *gin.Context) {
 
 	for _, attr := range textProps {
 		wait, err := a.radapter.PublishQuery(
+			ctx.Request.Context(),
 			rdb.Query{
 				Func: "freqDistrib",
 				Args: rdb.FreqDistribArgs{
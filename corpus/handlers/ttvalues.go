@@ -47,6 +47,7 @@ func (a *Actions) TextTypesAvailValues(ctx *gin.Context) {
 	corpusPath := a.conf.GetRegistryPath(corpusID)
 
 	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
 		rdb.Query{
 			Func: "textTypesAvailValues",
 			Args: rdb.TextTypesAvailValuesArgs{
@@ -93,6 +93,7 @@ func (a *Actions) TextTypes(ctx *gin.Context) {
 	}
 
 	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
 		rdb.Query{
 			Func: "freqDistrib",
 			Args: freqArgs,
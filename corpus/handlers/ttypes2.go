@@ -26,12 +26,10 @@ import (
 	"mquery/rdb/results"
 	"net/http"
 	"sort"
-	"sync"
 
 	"github.com/czcorpus/cnc-gokit/unireq"
 	"github.com/czcorpus/cnc-gokit/uniresp"
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
 )
 
 func (a *Actions) TextTypesParallel(ctx *gin.Context) {
@@ -43,7 +41,7 @@ func (a *Actions) TextTypesParallel(ctx *gin.Context) {
 		uniresp.WriteJSONErrorResponse(
 			ctx.Writer,
 			uniresp.NewActionErrorFrom(err),
-			http.StatusInternalServerError,
+			splitCorpusErrorStatus(err, http.StatusInternalServerError),
 		)
 		return
 	}
@@ -57,60 +55,37 @@ func (a *Actions) TextTypesParallel(ctx *gin.Context) {
 		return
 	}
 
-	mergedFreqLock := sync.Mutex{}
-	wg := sync.WaitGroup{}
-	wg.Add(len(sc.Subcorpora))
 	result := new(results.FreqDistrib)
 	result.Freqs = make([]*results.FreqDistribItem, 0)
-	errs := make([]error, 0, len(sc.Subcorpora))
-	for _, subc := range sc.Subcorpora {
-		wait, err := a.radapter.PublishQuery(
-			rdb.Query{
+	report, err := corpus.Gather(
+		ctx.Request.Context(),
+		a.newScatterGather(ctx),
+		sc.Subcorpora,
+		func(chunk corpus.Chunk) rdb.Query {
+			return rdb.Query{
 				Func: "freqDistrib",
 				Args: rdb.FreqDistribArgs{
 					CorpusPath:  corpusPath,
-					SubcPath:    subc,
+					SubcPath:    chunk.SubcPath,
 					Query:       q,
 					Crit:        fmt.Sprintf("%s 0", attr),
 					IsTextTypes: true,
 					FreqLimit:   flimit,
 					MaxItems:    maxItems,
 				},
-			},
-			GetCTXStoredTimeout(ctx),
-		)
-		if err != nil {
-			errs = append(errs, err)
-			log.Error().Err(err).Msg("failed to publish query")
-			wg.Done()
-
-		} else {
-			go func() {
-				defer wg.Done()
-				tmp := <-wait
-				if err := tmp.Value.Err(); err != nil {
-					errs = append(errs, err)
-					log.Error().Err(err).Msg("failed to deserialize query")
-				}
-				resultNext, ok := tmp.Value.(results.FreqDistrib)
-				if !ok {
-					err := fmt.Errorf("invalid type for FreqDistrib")
-					errs = append(errs, err)
-					log.Error().Err(err).Msg("failed to deserialize query")
-				}
-				mergedFreqLock.Lock()
+			}
+		},
+		func(chunk corpus.Chunk, resultNext results.FreqDistrib, err error) {
+			if err == nil {
 				result.MergeWith(&resultNext)
-				mergedFreqLock.Unlock()
-			}()
-		}
-	}
-	wg.Wait()
-
-	if len(errs) > 0 {
-		uniresp.WriteJSONErrorResponse(
-			ctx.Writer, uniresp.NewActionErrorFrom(errs[0]), http.StatusInternalServerError)
+			}
+		},
+	)
+	if err != nil {
+		respondGatherError(ctx, err)
 		return
 	}
+	writeGatherReport(ctx, report)
 
 	sort.SliceStable(
 		result.Freqs,
@@ -19,6 +19,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"mquery/corpus"
@@ -43,7 +44,7 @@ type lemmaItem struct {
 	POS      string `json:"pos"`
 }
 
-func (a *Actions) findLemmas(corpusID string, word, pos string, exportSublemmas bool, workerTimeout time.Duration) ([]*lemmaItem, error) {
+func (a *Actions) findLemmas(ctx context.Context, corpusID string, word, pos string, exportSublemmas bool, workerTimeout time.Duration) ([]*lemmaItem, error) {
 	q := "word=\"" + word + "\""
 	if len(pos) > 0 {
 		q += " & pos=\"" + pos + "\""
@@ -54,6 +55,7 @@ func (a *Actions) findLemmas(corpusID string, word, pos string, exportSublemmas
 	}
 	corpusPath := a.conf.GetRegistryPath(corpusID)
 	wait, err := a.radapter.PublishQuery(
+		ctx,
 		rdb.Query{
 			Func: "freqDistrib",
 			Args: rdb.FreqDistribArgs{
@@ -93,7 +95,7 @@ func (a *Actions) findLemmas(corpusID string, word, pos string, exportSublemmas
 	return ans, nil
 }
 
-func (a *Actions) findWordForms(corpusID string, lemma *lemmaItem, caseSensitive bool, workerTimeout time.Duration) (*results.WordFormsItem, error) {
+func (a *Actions) findWordForms(ctx context.Context, corpusID string, lemma *lemmaItem, caseSensitive bool, workerTimeout time.Duration) (*results.WordFormsItem, error) {
 	q := "lemma=\"" + lemma.Lemma + "\"" // TODO hardcoded `lemma`
 	if lemma.POS != "" {
 		q += " & pos=\"" + lemma.POS + "\"" // TODO hardcoded `pos`
@@ -107,6 +109,7 @@ func (a *Actions) findWordForms(corpusID string, lemma *lemmaItem, caseSensitive
 	}
 	corpusPath := a.conf.GetRegistryPath(corpusID)
 	wait, err := a.radapter.PublishQuery(
+		ctx,
 		rdb.Query{
 			Func: "freqDistrib",
 			Args: rdb.FreqDistribArgs{
@@ -164,7 +167,7 @@ func (a *Actions) OtherForms(ctx *gin.Context) {
 	var ans []*results.WordFormsItem
 	hasSublemma := corpInfo.PosAttrs.Contains("sublemma")
 
-	lemmas, err := a.findLemmas(corpusID, word, pos, hasSublemma, GetCTXStoredTimeout(ctx))
+	lemmas, err := a.findLemmas(ctx.Request.Context(), corpusID, word, pos, hasSublemma, GetCTXStoredTimeout(ctx))
 	if err != nil {
 		uniresp.WriteJSONErrorResponse(
 			ctx.Writer,
@@ -184,7 +187,7 @@ func (a *Actions) OtherForms(ctx *gin.Context) {
 	for _, v := range groupedFreqs {
 		// as we group by sublemmas, to get sublemma, we can
 		// just take the first item of the group (see v[0] below)
-		wordForms, err := a.findWordForms(ctx.Param("corpusId"), v[0], true, GetCTXStoredTimeout(ctx))
+		wordForms, err := a.findWordForms(ctx.Request.Context(), ctx.Param("corpusId"), v[0], true, GetCTXStoredTimeout(ctx))
 		if err != nil {
 			uniresp.WriteJSONErrorResponse(
 				ctx.Writer,
@@ -233,6 +236,7 @@ func (a *Actions) WordForms(ctx *gin.Context) {
 		return
 	}
 	wordForms, err := a.findWordForms(
+		ctx.Request.Context(),
 		corpusID,
 		&lemmaItem{Lemma: lemma, Sublemma: sublemma, POS: pos},
 		true,
@@ -0,0 +1,191 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mquery/corpus"
+	"mquery/rdb"
+	"mquery/rdb/results"
+	"net/http"
+	"slices"
+
+	"github.com/czcorpus/cnc-gokit/unireq"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DefaultWordlistAttr     = "word"
+	DefaultWordlistMaxItems = 50
+	MaxWordlistResultItems  = 1000
+	MaxWordlistNgramSize    = 6
+	wordlistAllTokensQuery  = "[]"
+)
+
+// Wordlist godoc
+// @Summary      Wordlist
+// @Description  Calculate a word list or an n-gram list of a corpus or a subcorpus. Word lists of whole corpora are read directly from attribute lexicons. For n-grams and subcorpora, tokens are read sequentially (no concordance is involved). In case there are too many distinct n-grams, the least frequent ones are pruned and the result is marked by `isApproximate`. Sorting by `docf` and `arf` is available only for word lists (ngramSize=1) of whole corpora with the respective statistics compiled.
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus"
+// @Param        subcorpus query string false "An ID of a subcorpus"
+// @Param        within query string false "A CQL structure expression defining a part of the corpus the list is calculated from (e.g. `<doc txtype=\"FIC\" />`)"
+// @Param        attr query string false "A positional attribute the list is calculated on" default(word)
+// @Param        pattern query string false "A regular expression values must match (for n-grams, at least one of the tokens must match)"
+// @Param        ignoreCase query int false "if 1, then the pattern ignores case" enums(0,1) default(0)
+// @Param        ngramSize query int false "1 for a word list, 2 and more for n-grams" minimum(1) maximum(6) default(1)
+// @Param        minFreq query int false "The minimum frequency of result items" minimum(1) default(1)
+// @Param        maxFreq query int false "The maximum frequency of result items (0 means no limit)" minimum(0) default(0)
+// @Param        sortBy query string false "A (descending) order of result items" enums(freq, docf, arf) default(freq)
+// @Param        offset query int false "Take result items starting from this one (first item = 0)" minimum(0) default(0)
+// @Param        maxItems query int false "The maximum number of returned items" minimum(1) maximum(1000) default(50)
+// @Success      200 {object} results.Wordlist
+// @Router       /wordlist/{corpusId} [get]
+func (a *Actions) Wordlist(ctx *gin.Context) {
+	args, ok := a.wordlistArgs(ctx)
+	if !ok {
+		return
+	}
+	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
+		rdb.Query{
+			Func: "wordlist",
+			Args: args,
+		},
+		GetCTXStoredTimeout(ctx),
+	)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	rawResult := <-wait
+	if ok := HandleWorkerError(ctx, rawResult); !ok {
+		return
+	}
+	result, ok := TypedOrRespondError[results.Wordlist](ctx, rawResult)
+	if !ok {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid result type"), http.StatusInternalServerError,
+		)
+		return
+	}
+	uniresp.WriteJSONResponse(
+		ctx.Writer,
+		&result,
+	)
+}
+
+// wordlistArgs parses and validates arguments of the Wordlist action.
+// In case of an error, a respective HTTP response is written and false is returned.
+func (a *Actions) wordlistArgs(ctx *gin.Context) (rdb.WordlistArgs, bool) {
+	corpusID := ctx.Param("corpusId")
+	corpusConf := a.conf.GetCorp(corpusID)
+	if corpusConf == nil {
+		uniresp.RespondWithErrorJSON(ctx, corpus.ErrNotFound, http.StatusNotFound)
+		return rdb.WordlistArgs{}, false
+	}
+	ttCQL, savedSubcPath, err := resolveSubcorpus(a.conf, corpusID, corpusConf, ctx.Query("subcorpus"))
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusUnprocessableEntity)
+		return rdb.WordlistArgs{}, false
+	}
+	var query string
+	if ttCQL != "" {
+		query = wordlistAllTokensQuery + ttCQL
+	}
+	if within := ctx.Query("within"); within != "" {
+		if query == "" {
+			query = wordlistAllTokensQuery
+		}
+		query += " within " + within
+	}
+
+	attr := ctx.DefaultQuery("attr", DefaultWordlistAttr)
+	if !slices.Contains(corpusConf.PosAttrs.GetIDs(), attr) {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid attr - unknown attribute %s", attr), http.StatusBadRequest)
+		return rdb.WordlistArgs{}, false
+	}
+	ngramSize, ok := getBoundedIntArgOrFail(ctx, "ngramSize", 1, MaxWordlistNgramSize)
+	if !ok {
+		return rdb.WordlistArgs{}, false
+	}
+	minFreq, ok := unireq.GetURLIntArgOrFail(ctx, "minFreq", 1)
+	if !ok {
+		return rdb.WordlistArgs{}, false
+	}
+	maxFreq, ok := unireq.GetURLIntArgOrFail(ctx, "maxFreq", 0)
+	if !ok {
+		return rdb.WordlistArgs{}, false
+	}
+	if minFreq < 1 || maxFreq < 0 || maxFreq > 0 && maxFreq < minFreq {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("invalid minFreq or maxFreq"), http.StatusBadRequest)
+		return rdb.WordlistArgs{}, false
+	}
+	sortBy := ctx.DefaultQuery("sortBy", rdb.WordlistSortFreq)
+	switch sortBy {
+	case rdb.WordlistSortFreq:
+	case rdb.WordlistSortDocf, rdb.WordlistSortARF:
+		if ngramSize > 1 || savedSubcPath != "" || query != "" {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				fmt.Errorf("sorting by %s is available only for word lists of whole corpora", sortBy),
+				http.StatusBadRequest,
+			)
+			return rdb.WordlistArgs{}, false
+		}
+	default:
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid sortBy %s", sortBy), http.StatusBadRequest)
+		return rdb.WordlistArgs{}, false
+	}
+	offset, ok := unireq.GetURLIntArgOrFail(ctx, "offset", 0)
+	if !ok {
+		return rdb.WordlistArgs{}, false
+	}
+	if offset < 0 {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("invalid offset - value must not be negative"), http.StatusBadRequest)
+		return rdb.WordlistArgs{}, false
+	}
+	maxItems, ok := getBoundedIntArgOrFail(ctx, "maxItems", DefaultWordlistMaxItems, MaxWordlistResultItems)
+	if !ok {
+		return rdb.WordlistArgs{}, false
+	}
+	return rdb.WordlistArgs{
+		CorpusPath: a.conf.GetRegistryPath(corpusID),
+		SubcPath:   savedSubcPath,
+		Query:      query,
+		Attr:       attr,
+		Pattern:    ctx.Query("pattern"),
+		IgnoreCase: ctx.Query("ignoreCase") == "1",
+		NgramSize:  ngramSize,
+		MinFreq:    int64(minFreq),
+		MaxFreq:    int64(maxFreq),
+		SortBy:     sortBy,
+		Offset:     offset,
+		Limit:      maxItems,
+	}, true
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"mquery/corpus"
+	"mquery/rdb"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/corp"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWordlistTestActions(t *testing.T) *Actions {
+	dir := t.TempDir()
+	// the data path must exist
+	reg := `PATH "` + dir + `"
+ATTRIBUTE word
+ATTRIBUTE lemma
+STRUCTURE doc {
+	ATTRIBUTE txtype
+}
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "testcorp"), []byte(reg), 0644))
+	return &Actions{
+		conf: &corpus.CorporaSetup{
+			RegistryDir: dir,
+			Resources: corpus.Resources{
+				&corpus.MQCorpusSetup{
+					CorpusSetup: corp.CorpusSetup{
+						ID:       "testcorp",
+						PosAttrs: corp.PosAttrList{{Name: "word"}, {Name: "lemma"}},
+						Subcorpora: map[string]corp.Subcorpus{
+							"fic": {TextTypes: corp.TextTypes{"doc.txtype": {"FIC"}}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newWordlistTestContext(corpusID, rawQuery string) (*gin.Context, *httptest.ResponseRecorder) {
+	ctx, w := newTestContext(rawQuery)
+	ctx.Params = gin.Params{{Key: "corpusId", Value: corpusID}}
+	return ctx, w
+}
+
+func TestWordlistArgsDefaults(t *testing.T) {
+	act := newWordlistTestActions(t)
+	ctx, _ := newWordlistTestContext("testcorp", "")
+	args, ok := act.wordlistArgs(ctx)
+	assert.True(t, ok)
+	assert.Equal(
+		t,
+		rdb.WordlistArgs{
+			CorpusPath: filepath.Join(act.conf.RegistryDir, "testcorp"),
+			Attr:       DefaultWordlistAttr,
+			NgramSize:  1,
+			MinFreq:    1,
+			SortBy:     rdb.WordlistSortFreq,
+			Limit:      DefaultWordlistMaxItems,
+		},
+		args,
+	)
+}
+
+func TestWordlistArgsSubcorpusAndWithin(t *testing.T) {
+	act := newWordlistTestActions(t)
+	ctx, _ := newWordlistTestContext(
+		"testcorp",
+		"subcorpus=fic&within=%3Cs%2F%3E&attr=lemma&pattern=a.*&ignoreCase=1&ngramSize=2"+
+			"&minFreq=2&maxFreq=10&offset=5&maxItems=20",
+	)
+	args, ok := act.wordlistArgs(ctx)
+	assert.True(t, ok)
+	ttCQL := corpus.SubcorpusToCQL(corp.TextTypes{"doc.txtype": {"FIC"}})
+	assert.Equal(t, "[]"+ttCQL+" within <s/>", args.Query)
+	assert.Equal(t, "lemma", args.Attr)
+	assert.Equal(t, "a.*", args.Pattern)
+	assert.True(t, args.IgnoreCase)
+	assert.Equal(t, 2, args.NgramSize)
+	assert.Equal(t, int64(2), args.MinFreq)
+	assert.Equal(t, int64(10), args.MaxFreq)
+	assert.Equal(t, 5, args.Offset)
+	assert.Equal(t, 20, args.Limit)
+
+	ctx, _ = newWordlistTestContext("testcorp", "within=%3Cs%2F%3E")
+	args, ok = act.wordlistArgs(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "[] within <s/>", args.Query)
+}
+
+func TestWordlistArgsInvalid(t *testing.T) {
+	act := newWordlistTestActions(t)
+	ctx, w := newWordlistTestContext("foo", "")
+	_, ok := act.wordlistArgs(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	for _, q := range []string{
+		"attr=tag",
+		"ngramSize=0",
+		"ngramSize=7",
+		"minFreq=0",
+		"minFreq=5&maxFreq=2",
+		"maxFreq=-1",
+		"sortBy=arf&ngramSize=2",
+		"sortBy=docf&within=%3Cs%2F%3E",
+		"sortBy=foo",
+		"offset=-1",
+		"maxItems=1001",
+	} {
+		ctx, w := newWordlistTestContext("testcorp", q)
+		_, ok := act.wordlistArgs(ctx)
+		assert.False(t, ok, q)
+		assert.Equal(t, http.StatusBadRequest, w.Code, q)
+	}
+
+	ctx, w = newWordlistTestContext("testcorp", "subcorpus=foo")
+	_, ok = act.wordlistArgs(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
@@ -0,0 +1,245 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mquery/corpus"
+	"mquery/rdb"
+	"mquery/rdb/results"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/czcorpus/cnc-gokit/unireq"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DefaultWSAttr        = "lemma"
+	DefaultWSMinFreq     = 2
+	DefaultWSMaxItems    = 10
+	DefaultThesMaxItems  = 20
+	DefaultThesContexts  = 50
+	maxWSItems           = 100
+	maxThesaurusContexts = 200
+)
+
+// wsCommonArgs contains arguments shared by word sketches
+// and thesaurus
+type wsCommonArgs struct {
+	corpusPath string
+	wsDefPath  string
+	attr       string
+	headword   string
+	minFreq    int
+	wsBase     string
+	wsThes     string
+}
+
+// precompiledWSData returns a registry value of precompiled data in case
+// the respective data file exists. Otherwise, an empty string is returned.
+func precompiledWSData(confirmFile, value string) string {
+	if _, err := os.Stat(confirmFile); err != nil {
+		return ""
+	}
+	return value
+}
+
+// fetchWSCommonArgs parses and validates arguments shared by word sketch
+// and thesaurus actions. In case of an error, a respective HTTP response
+// is written and false is returned.
+func (a *Actions) fetchWSCommonArgs(ctx *gin.Context) (wsCommonArgs, bool) {
+	var ans wsCommonArgs
+	corpusID := ctx.Param("corpusId")
+	corpusConf := a.conf.GetCorp(corpusID)
+	if corpusConf == nil {
+		uniresp.RespondWithErrorJSON(ctx, corpus.ErrNotFound, http.StatusNotFound)
+		return ans, false
+	}
+	ans.corpusPath = a.conf.GetRegistryPath(corpusID)
+	if a.conf.WordSketchDefsDir != "" {
+		ans.wsDefPath = corpus.GenWSDefFilename(a.conf.WordSketchDefsDir, corpusID)
+	}
+	ans.headword = ctx.Query("lemma")
+	if ans.headword == "" {
+		uniresp.RespondWithErrorJSON(ctx, errors.New("missing lemma"), http.StatusBadRequest)
+		return ans, false
+	}
+	ans.attr = ctx.DefaultQuery("attr", DefaultWSAttr)
+	if !slices.Contains(corpusConf.PosAttrs.GetIDs(), ans.attr) {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid attr - unknown attribute %s", ans.attr), http.StatusBadRequest)
+		return ans, false
+	}
+	if a.conf.WordSketchDataDir != "" {
+		ans.wsBase = precompiledWSData(
+			corpus.GenWSBaseFilename(a.conf.WordSketchDataDir, corpusID, ans.attr))
+		ans.wsThes = precompiledWSData(
+			corpus.GenWSThesFilename(a.conf.WordSketchDataDir, corpusID, ans.attr))
+	}
+	var ok bool
+	ans.minFreq, ok = unireq.GetURLIntArgOrFail(ctx, "minFreq", DefaultWSMinFreq)
+	if !ok {
+		return ans, false
+	}
+	if ans.minFreq < 1 {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("invalid minFreq - value must be greater than 0"), http.StatusBadRequest)
+		return ans, false
+	}
+	return ans, true
+}
+
+// getBoundedIntArgOrFail reads an integer argument which must be
+// within [1, maxValue]. In case of an error, a respective HTTP response
+// is written and false is returned.
+func getBoundedIntArgOrFail(ctx *gin.Context, name string, dflt, maxValue int) (int, bool) {
+	v, ok := unireq.GetURLIntArgOrFail(ctx, name, dflt)
+	if !ok {
+		return 0, false
+	}
+	if v < 1 || v > maxValue {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("invalid %s - value must be between 1 and %d", name, maxValue),
+			http.StatusBadRequest,
+		)
+		return 0, false
+	}
+	return v, true
+}
+
+// WordSketch godoc
+// @Summary      WordSketch
+// @Description  Calculate a word sketch of a lemma - i.e. grammatical relations with their top collocates sorted by logDice. In case word sketch data precompiled by Manatee are available (see `wordSketchDataDir`), they are used. Otherwise, the sketch is calculated on the fly from the corpus sketch grammar (the configured `wordSketchDefsDir` or the `WSDEF` registry value).
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus to search in"
+// @Param        lemma query string true "A headword"
+// @Param        attr query string false "A positional attribute of the headword and collocates" default(lemma)
+// @Param        minFreq query int false "The minimum frequency of a collocate within a relation" default(2)
+// @Param        maxItems query int false "The maximum number of collocates per relation" default(10)
+// @Success      200 {object} results.WordSketch
+// @Router       /word-sketch/{corpusId} [get]
+func (a *Actions) WordSketch(ctx *gin.Context) {
+	args, ok := a.fetchWSCommonArgs(ctx)
+	if !ok {
+		return
+	}
+	maxItems, ok := getBoundedIntArgOrFail(ctx, "maxItems", DefaultWSMaxItems, maxWSItems)
+	if !ok {
+		return
+	}
+	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
+		rdb.Query{
+			Func: "wordSketch",
+			Args: rdb.WordSketchArgs{
+				CorpusPath: args.corpusPath,
+				WSDefPath:  args.wsDefPath,
+				Attr:       args.attr,
+				Headword:   args.headword,
+				MinFreq:    args.minFreq,
+				MaxItems:   maxItems,
+				WSBase:     args.wsBase,
+			},
+		},
+		GetCTXStoredTimeout(ctx),
+	)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	rawResult := <-wait
+	if ok := HandleWorkerError(ctx, rawResult); !ok {
+		return
+	}
+	result, ok := TypedOrRespondError[results.WordSketch](ctx, rawResult)
+	if !ok {
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, result)
+}
+
+// Thesaurus godoc
+// @Summary      Thesaurus
+// @Description  Find words similar to a lemma based on shared word sketch contexts (pairs of a grammatical relation and a collocate). In case thesaurus data precompiled by Manatee are available (see `wordSketchDataDir`), they are used. Otherwise, the calculation is performed on the fly using the corpus sketch grammar.
+// @Produce      json
+// @Param        corpusId path string true "An ID of a corpus to search in"
+// @Param        lemma query string true "A headword"
+// @Param        attr query string false "A positional attribute of the headword and similar words" default(lemma)
+// @Param        minFreq query int false "The minimum frequency of a word within a context" default(2)
+// @Param        maxContexts query int false "The maximum number of the headword's best contexts used for the search" default(50)
+// @Param        maxItems query int false "The maximum number of similar words" default(20)
+// @Success      200 {object} results.Thesaurus
+// @Router       /thesaurus/{corpusId} [get]
+func (a *Actions) Thesaurus(ctx *gin.Context) {
+	args, ok := a.fetchWSCommonArgs(ctx)
+	if !ok {
+		return
+	}
+	maxItems, ok := getBoundedIntArgOrFail(ctx, "maxItems", DefaultThesMaxItems, maxWSItems)
+	if !ok {
+		return
+	}
+	maxContexts, ok := getBoundedIntArgOrFail(ctx, "maxContexts", DefaultThesContexts, maxThesaurusContexts)
+	if !ok {
+		return
+	}
+	wait, err := a.radapter.PublishQuery(
+		ctx.Request.Context(),
+		rdb.Query{
+			Func: "thesaurus",
+			Args: rdb.ThesaurusArgs{
+				CorpusPath:  args.corpusPath,
+				WSDefPath:   args.wsDefPath,
+				Attr:        args.attr,
+				Headword:    args.headword,
+				MinFreq:     args.minFreq,
+				MaxContexts: maxContexts,
+				MaxItems:    maxItems,
+				WSThes:      args.wsThes,
+			},
+		},
+		GetCTXStoredTimeout(ctx),
+	)
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			ctx.Writer,
+			uniresp.NewActionErrorFrom(err),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	rawResult := <-wait
+	if ok := HandleWorkerError(ctx, rawResult); !ok {
+		return
+	}
+	result, ok := TypedOrRespondError[results.Thesaurus](ctx, rawResult)
+	if !ok {
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, result)
+}
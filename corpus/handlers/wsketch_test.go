@@ -0,0 +1,40 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handlers
+
+import (
+	"mquery/corpus"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrecompiledWSData(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, "", precompiledWSData(corpus.GenWSBaseFilename(dir, "susanne", "lemma")))
+
+	confirmFile, value := corpus.GenWSBaseFilename(dir, "susanne", "lemma")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(confirmFile), 0755))
+	assert.NoError(t, os.WriteFile(confirmFile, []byte{}, 0644))
+	assert.Equal(t, value, precompiledWSData(confirmFile, value))
+	// thesaurus data are independent of word sketch data
+	assert.Equal(t, "", precompiledWSData(corpus.GenWSThesFilename(dir, "susanne", "lemma")))
+}
@@ -21,6 +21,13 @@ package corpus
 import (
 	"fmt"
 	"mquery/mango"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/cnc-gokit/fs"
+	"github.com/czcorpus/rexplorer/parser"
 )
 
 type DBInfo struct {
@@ -63,3 +70,100 @@ func LoadSizes(corpora []string, conf *CorporaSetup) (SizesInfo, error) {
 	}
 	return ans, nil
 }
+
+// corpusDataFiles are data files (within the corpus data directory)
+// changed by each compilation of a corpus. The first one found is used.
+var corpusDataFiles = []string{"word.text", "word.lex"}
+
+// corpusDataFile returns a path to a data file changed by each
+// compilation of a corpus (see corpusDataFiles) as a corpus can be
+// recompiled with no change of its registry file. In case no such
+// file is found, an empty string is returned.
+func corpusDataFile(corpusPath string) (string, error) {
+	regBytes, err := os.ReadFile(corpusPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read registry file: %w", err)
+	}
+	reg, err := parser.ParseRegistryBytes(filepath.Base(corpusPath), regBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse registry file: %w", err)
+	}
+	dataPath := reg.Entries.Get("PATH").Value()
+	for _, name := range corpusDataFiles {
+		path := filepath.Join(dataPath, name)
+		isf, err := fs.IsFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to find corpus data file: %w", err)
+		}
+		if isf {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// fileVersion identifies a state of a file by its modification
+// time and size. For an empty path, an empty string is returned.
+func fileVersion(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+type cachedCorpusSize struct {
+	size     int64
+	regMtime time.Time
+
+	// dataFile is a corpus data file (see corpusDataFile)
+	// determined along with the size
+	dataFile    string
+	dataVersion string
+}
+
+// corpusSizeCache keeps corpus sizes so a corpus does not have to be
+// opened each time its size is needed. A size is determined again once
+// the corpus registry file or a corpus data file (see corpusDataFile)
+// changes.
+type corpusSizeCache struct {
+	items map[string]cachedCorpusSize
+	mu    sync.Mutex
+}
+
+func (c *corpusSizeCache) get(corpusPath string) (int64, error) {
+	info, err := os.Stat(corpusPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get corpus size: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.items[corpusPath]
+	if !ok || !v.regMtime.Equal(info.ModTime()) {
+		// the data path may have changed along with the registry
+		dataFile, err := corpusDataFile(corpusPath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get corpus size: %w", err)
+		}
+		v = cachedCorpusSize{size: -1, regMtime: info.ModTime(), dataFile: dataFile}
+	}
+	dataVersion, err := fileVersion(v.dataFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get corpus size: %w", err)
+	}
+	if v.size >= 0 && v.dataVersion == dataVersion {
+		return v.size, nil
+	}
+	v.size, err = mango.GetCorpusSize(corpusPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get corpus size: %w", err)
+	}
+	v.dataVersion = dataVersion
+	c.items[corpusPath] = v
+	return v.size, nil
+}
+
+var splitCorpusSizes = &corpusSizeCache{items: make(map[string]cachedCorpusSize)}
@@ -0,0 +1,74 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorpusDataFile(t *testing.T) {
+	regDir := t.TempDir()
+	dataDir := t.TempDir()
+	regPath := filepath.Join(regDir, "testcorp")
+	reg := `PATH "` + dataDir + `"
+ATTRIBUTE word
+`
+	assert.NoError(t, os.WriteFile(regPath, []byte(reg), 0644))
+
+	path, err := corpusDataFile(regPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "", path)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dataDir, "word.lex"), []byte("foo"), 0644))
+	path, err = corpusDataFile(regPath)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dataDir, "word.lex"), path)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dataDir, "word.text"), []byte("foo"), 0644))
+	path, err = corpusDataFile(regPath)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dataDir, "word.text"), path)
+
+	_, err = corpusDataFile(filepath.Join(regDir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestFileVersion(t *testing.T) {
+	v, err := fileVersion("")
+	assert.NoError(t, err)
+	assert.Equal(t, "", v)
+
+	path := filepath.Join(t.TempDir(), "word.text")
+	assert.NoError(t, os.WriteFile(path, []byte("foo"), 0644))
+	v1, err := fileVersion(path)
+	assert.NoError(t, err)
+	// a recompiled corpus with the same modification time
+	// is still detected by a different size
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte("foobar"), 0644))
+	assert.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	v2, err := fileVersion(path)
+	assert.NoError(t, err)
+	assert.NotEqual(t, v1, v2)
+}
@@ -18,6 +18,7 @@
 package infoload
 
 import (
+	"context"
 	"fmt"
 	"mquery/corpus"
 	"mquery/rdb"
@@ -78,6 +79,7 @@ func (kdb *Manatee) LoadCorpusInfo(corpusId string, language string) (*results.C
 		return nil, corpus.ErrNotFound
 	}
 	wait, err := kdb.queryHandler.PublishQuery(
+		context.Background(),
 		rdb.Query{
 			Func: "corpusInfo",
 			Args: rdb.CorpusInfoArgs{
@@ -25,13 +25,26 @@ import (
 	"github.com/czcorpus/mquery-common/corp"
 )
 
+// FillStructAndAttrs fills in positional and structural attributes
+// of a corpus specified by its registry path.
 func FillStructAndAttrs(corpPath string, cinfo *corp.Overview) error {
-	attrs, err := mango.GetCorpusConf(corpPath, "ATTRLIST")
+	mcorp, err := mango.OpenCorpus(corpPath)
+	if err != nil {
+		return err
+	}
+	defer mcorp.Close()
+	return FillStructAndAttrsOf(mcorp, cinfo)
+}
+
+// FillStructAndAttrsOf fills in positional and structural attributes
+// of an already open corpus.
+func FillStructAndAttrsOf(mcorp *mango.Corpus, cinfo *corp.Overview) error {
+	attrs, err := mcorp.Conf("ATTRLIST")
 	if err != nil {
 		return err
 	}
 	for _, v := range strings.Split(attrs, ",") {
-		size, err := mango.GetPosAttrSize(corpPath, v)
+		size, err := mcorp.PosAttrSize(v)
 		if err != nil {
 			return err
 		}
@@ -40,12 +53,12 @@ func FillStructAndAttrs(corpPath string, cinfo *corp.Overview) error {
 			Size: size,
 		})
 	}
-	structs, err := mango.GetCorpusConf(corpPath, "STRUCTLIST")
+	structs, err := mcorp.Conf("STRUCTLIST")
 	if err != nil {
 		return err
 	}
 	for _, v := range strings.Split(structs, ",") {
-		size, err := mango.GetStructSize(corpPath, v)
+		size, err := mcorp.StructSize(v)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,307 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/mquery-common/corp"
+)
+
+const (
+	savedSubcDataFile = "data.subc"
+	savedSubcMetaFile = "meta.json"
+
+	// savedSubcIndexDir is a directory (within the saved subcorpora
+	// directory) with per-corpus indexes of subcorpora with metadata.
+	// An index is a directory containing an empty file for each subcorpus
+	// (so it can be updated by multiple API server instances without
+	// locking). The name cannot collide with KonText's two-character
+	// subcorpus directories.
+	savedSubcIndexDir = "_index"
+)
+
+var (
+	ErrSubcorpusNotFound = errors.New("subcorpus not found")
+
+	savedSubcIDRegexp = regexp.MustCompile(`^[a-f0-9]{32}$`)
+)
+
+// SubcorpusDefinition defines a saved subcorpus. Exactly one
+// of the variants must be used.
+type SubcorpusDefinition struct {
+
+	// TextTypes selects structures (all of the same type) by values
+	// of their attributes - e.g. {"doc.txtype": ["FIC", "NMG"]}
+	TextTypes corp.TextTypes `json:"textTypes,omitempty"`
+
+	// Ranges are explicit position ranges [from, to)
+	Ranges [][2]int64 `json:"ranges,omitempty"`
+
+	// Within is a CQL query whose matches define the subcorpus
+	// (e.g. `<doc txtype="FIC" /> within <text genre="prose" />`)
+	Within string `json:"within,omitempty"`
+}
+
+// Validate tests whether exactly one variant of the
+// definition is used and whether it is valid
+func (def SubcorpusDefinition) Validate() error {
+	var numVariants int
+	if len(def.TextTypes) > 0 {
+		numVariants++
+	}
+	if len(def.Ranges) > 0 {
+		numVariants++
+	}
+	if def.Within != "" {
+		numVariants++
+	}
+	if numVariants != 1 {
+		return errors.New("exactly one of textTypes, ranges and within must be specified")
+	}
+	if len(def.TextTypes) > 0 {
+		_, err := def.textTypesQuery()
+		return err
+	}
+	return nil
+}
+
+func (def SubcorpusDefinition) textTypesQuery() (string, error) {
+	var strct string
+	attrs := make([]string, 0, len(def.TextTypes))
+	for attr, values := range def.TextTypes {
+		tmp := strings.Split(attr, ".")
+		if len(tmp) != 2 || tmp[0] == "" || tmp[1] == "" {
+			return "", fmt.Errorf("invalid text type attribute %s", attr)
+		}
+		if strct != "" && tmp[0] != strct {
+			return "", errors.New("text types of a subcorpus must belong to a single structure")
+		}
+		if len(values) == 0 {
+			return "", fmt.Errorf("no values selected for %s", attr)
+		}
+		strct = tmp[0]
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	conds := make([]string, len(attrs))
+	for i, attr := range attrs {
+		values := make([]string, len(def.TextTypes[attr]))
+		for j, v := range def.TextTypes[attr] {
+			values[j] = strings.ReplaceAll(regexp.QuoteMeta(v), `"`, `\"`)
+		}
+		conds[i] = fmt.Sprintf(`%s="%s"`, strings.Split(attr, ".")[1], strings.Join(values, "|"))
+	}
+	return fmt.Sprintf("<%s %s />", strct, strings.Join(conds, " & ")), nil
+}
+
+// Query returns a CQL query whose matches define the subcorpus.
+// For a definition based on explicit ranges, an empty string is returned.
+func (def SubcorpusDefinition) Query() (string, error) {
+	if len(def.TextTypes) > 0 {
+		return def.textTypesQuery()
+	}
+	return def.Within, nil
+}
+
+// SavedSubcorpus describes a subcorpus stored
+// in CorporaSetup.SavedSubcorporaDir
+type SavedSubcorpus struct {
+	ID         string              `json:"id"`
+	CorpusID   string              `json:"corpusId"`
+	Name       string              `json:"name"`
+	Definition SubcorpusDefinition `json:"definition"`
+	Size       int64               `json:"size"`
+	Created    time.Time           `json:"created"`
+
+	// AuthorTokenHash is a hash of an authentication token
+	// the subcorpus was created with. Only the same token
+	// can be used to remove the subcorpus.
+	AuthorTokenHash string `json:"authorTokenHash,omitempty"`
+}
+
+// IsAuthor tests whether the `token` is the one
+// the subcorpus was created with. Subcorpora created
+// without a token cannot be managed by anyone.
+func (subc *SavedSubcorpus) IsAuthor(token string) bool {
+	return token != "" && subc.AuthorTokenHash != "" &&
+		subc.AuthorTokenHash == HashAuthorToken(token)
+}
+
+// HashAuthorToken creates a hash of an authentication token
+// so the token itself does not have to be stored. For an empty
+// token, an empty string is returned.
+func HashAuthorToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewSavedSubcorpusID generates a random ID of a saved subcorpus
+func NewSavedSubcorpusID() (string, error) {
+	buff := make([]byte, 16)
+	if _, err := rand.Read(buff); err != nil {
+		return "", fmt.Errorf("failed to generate subcorpus ID: %w", err)
+	}
+	return hex.EncodeToString(buff), nil
+}
+
+// SavedSubcorpusDir returns a directory of a saved subcorpus
+// (the layout is compatible with KonText's saved subcorpora)
+func SavedSubcorpusDir(baseDir, subcID string) string {
+	return filepath.Join(baseDir, subcID[:2], subcID)
+}
+
+// SavedSubcorpusPath returns a path to the data file of a saved subcorpus
+func SavedSubcorpusPath(baseDir, subcID string) string {
+	return filepath.Join(SavedSubcorpusDir(baseDir, subcID), savedSubcDataFile)
+}
+
+// savedSubcIndexPath returns a path to a per-corpus index of saved
+// subcorpora. Corpus IDs may contain slashes so they are escaped.
+func savedSubcIndexPath(baseDir, corpusID string) string {
+	return filepath.Join(baseDir, savedSubcIndexDir, url.PathEscape(corpusID))
+}
+
+// writeSavedSubcorpusMetaFile stores metadata of a saved subcorpus
+// to the subcorpus directory
+func writeSavedSubcorpusMetaFile(baseDir string, subc *SavedSubcorpus) error {
+	data, err := json.MarshalIndent(subc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to write subcorpus metadata: %w", err)
+	}
+	path := filepath.Join(SavedSubcorpusDir(baseDir, subc.ID), savedSubcMetaFile)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write subcorpus metadata: %w", err)
+	}
+	return nil
+}
+
+// ReserveSavedSubcorpus creates a directory of a new saved subcorpus
+// and stores its metadata there. It is expected to be called before
+// the subcorpus data file is written so there is never a data file
+// without metadata which would be usable with any corpus
+// (see CheckSavedSubcorpus). The subcorpus is not listed until
+// WriteSavedSubcorpusMeta is called.
+func ReserveSavedSubcorpus(baseDir string, subc *SavedSubcorpus) error {
+	if err := os.MkdirAll(SavedSubcorpusDir(baseDir, subc.ID), 0755); err != nil {
+		return fmt.Errorf("failed to write subcorpus metadata: %w", err)
+	}
+	return writeSavedSubcorpusMetaFile(baseDir, subc)
+}
+
+// WriteSavedSubcorpusMeta stores metadata of a saved subcorpus
+// along with its data file and adds the subcorpus to the index
+// of the corpus subcorpora
+func WriteSavedSubcorpusMeta(baseDir string, subc *SavedSubcorpus) error {
+	if err := writeSavedSubcorpusMetaFile(baseDir, subc); err != nil {
+		return err
+	}
+	indexPath := savedSubcIndexPath(baseDir, subc.CorpusID)
+	if err := os.MkdirAll(indexPath, 0755); err != nil {
+		return fmt.Errorf("failed to index subcorpus: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(indexPath, subc.ID), []byte{}, 0644); err != nil {
+		return fmt.Errorf("failed to index subcorpus: %w", err)
+	}
+	return nil
+}
+
+// LoadSavedSubcorpus loads metadata of a saved subcorpus. In case
+// the subcorpus does not exist (or it has no metadata), ErrSubcorpusNotFound
+// is returned.
+func LoadSavedSubcorpus(baseDir, subcID string) (*SavedSubcorpus, error) {
+	if !savedSubcIDRegexp.MatchString(subcID) {
+		return nil, ErrSubcorpusNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(SavedSubcorpusDir(baseDir, subcID), savedSubcMetaFile))
+	if os.IsNotExist(err) {
+		return nil, ErrSubcorpusNotFound
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load subcorpus %s: %w", subcID, err)
+	}
+	var ans SavedSubcorpus
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return nil, fmt.Errorf("failed to load subcorpus %s: %w", subcID, err)
+	}
+	return &ans, nil
+}
+
+// ListSavedSubcorpora returns saved subcorpora (with metadata) of
+// a corpus sorted by their creation time. Only the corpus index is
+// searched so subcorpora stored by other tools (i.e. with no metadata)
+// are not listed.
+func ListSavedSubcorpora(baseDir, corpusID string) ([]*SavedSubcorpus, error) {
+	ans := make([]*SavedSubcorpus, 0, 20)
+	entries, err := os.ReadDir(savedSubcIndexPath(baseDir, corpusID))
+	if os.IsNotExist(err) {
+		return ans, nil
+
+	} else if err != nil {
+		return ans, fmt.Errorf("failed to list subcorpora: %w", err)
+	}
+	for _, entry := range entries {
+		subc, err := LoadSavedSubcorpus(baseDir, entry.Name())
+		if err == ErrSubcorpusNotFound {
+			continue
+
+		} else if err != nil {
+			return ans, fmt.Errorf("failed to list subcorpora: %w", err)
+		}
+		if subc.CorpusID == corpusID {
+			ans = append(ans, subc)
+		}
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		return ans[i].Created.Before(ans[j].Created)
+	})
+	return ans, nil
+}
+
+// DeleteSavedSubcorpus removes a saved subcorpus along with
+// its metadata, its index entry and any data precalculated for it
+func DeleteSavedSubcorpus(baseDir, corpusID, subcID string) error {
+	if !savedSubcIDRegexp.MatchString(subcID) {
+		return ErrSubcorpusNotFound
+	}
+	if err := os.RemoveAll(SavedSubcorpusDir(baseDir, subcID)); err != nil {
+		return fmt.Errorf("failed to delete subcorpus %s: %w", subcID, err)
+	}
+	// note: a stale index entry is just skipped by ListSavedSubcorpora
+	indexEntry := filepath.Join(savedSubcIndexPath(baseDir, corpusID), subcID)
+	if err := os.Remove(indexEntry); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete subcorpus %s index entry: %w", subcID, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/mquery-common/corp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubcorpusDefinitionValidate(t *testing.T) {
+	assert.Error(t, SubcorpusDefinition{}.Validate())
+	assert.Error(t, SubcorpusDefinition{
+		Ranges: [][2]int64{{0, 10}},
+		Within: "<doc />",
+	}.Validate())
+	assert.NoError(t, SubcorpusDefinition{Ranges: [][2]int64{{0, 10}}}.Validate())
+	assert.Error(t, SubcorpusDefinition{
+		TextTypes: corp.TextTypes{"doc.txtype": {"FIC"}, "text.genre": {"prose"}},
+	}.Validate())
+	assert.Error(t, SubcorpusDefinition{
+		TextTypes: corp.TextTypes{"txtype": {"FIC"}},
+	}.Validate())
+}
+
+func TestSubcorpusDefinitionTextTypesQuery(t *testing.T) {
+	def := SubcorpusDefinition{
+		TextTypes: corp.TextTypes{
+			"doc.txtype": {"FIC", "NMG"},
+			"doc.title":  {`a "b" (c)`},
+		},
+	}
+	q, err := def.Query()
+	assert.NoError(t, err)
+	assert.Equal(t, `<doc title="a \"b\" \(c\)" & txtype="FIC|NMG" />`, q)
+}
+
+func TestSavedSubcorpusLifecycle(t *testing.T) {
+	baseDir := t.TempDir()
+	id, err := NewSavedSubcorpusID()
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(SavedSubcorpusDir(baseDir, id), 0755))
+	subc := &SavedSubcorpus{
+		ID:              id,
+		CorpusID:        "syn2020",
+		Name:            "fiction",
+		Definition:      SubcorpusDefinition{Within: `<doc txtype="FIC" />`},
+		Size:            1000,
+		Created:         time.Now(),
+		AuthorTokenHash: HashAuthorToken("secret"),
+	}
+	assert.NoError(t, WriteSavedSubcorpusMeta(baseDir, subc))
+
+	loaded, err := LoadSavedSubcorpus(baseDir, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "fiction", loaded.Name)
+	assert.Equal(t, int64(1000), loaded.Size)
+	assert.True(t, loaded.IsAuthor("secret"))
+	assert.False(t, loaded.IsAuthor("other"))
+	assert.False(t, loaded.IsAuthor(""))
+
+	items, err := ListSavedSubcorpora(baseDir, "syn2020")
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	items, err = ListSavedSubcorpora(baseDir, "syn2015")
+	assert.NoError(t, err)
+	assert.Len(t, items, 0)
+
+	assert.NoError(t, DeleteSavedSubcorpus(baseDir, "syn2020", id))
+	_, err = LoadSavedSubcorpus(baseDir, id)
+	assert.Equal(t, ErrSubcorpusNotFound, err)
+	items, err = ListSavedSubcorpora(baseDir, "syn2020")
+	assert.NoError(t, err)
+	assert.Len(t, items, 0)
+	_, err = LoadSavedSubcorpus(baseDir, "../foo")
+	assert.Equal(t, ErrSubcorpusNotFound, err)
+}
+
+func TestCheckSavedSubcorpus(t *testing.T) {
+	baseDir := t.TempDir()
+	id, err := NewSavedSubcorpusID()
+	assert.NoError(t, err)
+	assert.NoError(t, ReserveSavedSubcorpus(baseDir, &SavedSubcorpus{ID: id, CorpusID: "syn2020"}))
+	_, ok := CheckSavedSubcorpus(baseDir, "syn2020", id)
+	assert.False(t, ok, "no data file written yet")
+
+	assert.NoError(t, os.WriteFile(SavedSubcorpusPath(baseDir, id), make([]byte, 16), 0644))
+	path, ok := CheckSavedSubcorpus(baseDir, "syn2020", id)
+	assert.True(t, ok)
+	assert.Equal(t, SavedSubcorpusPath(baseDir, id), path)
+	_, ok = CheckSavedSubcorpus(baseDir, "syn2015", id)
+	assert.False(t, ok)
+
+	metaPath := filepath.Join(SavedSubcorpusDir(baseDir, id), savedSubcMetaFile)
+	assert.NoError(t, os.WriteFile(metaPath, []byte("{"), 0644))
+	_, ok = CheckSavedSubcorpus(baseDir, "syn2020", id)
+	assert.False(t, ok, "broken metadata")
+
+	// a subcorpus stored by other tools
+	assert.NoError(t, os.Remove(metaPath))
+	_, ok = CheckSavedSubcorpus(baseDir, "syn2015", id)
+	assert.True(t, ok)
+}
+
+func TestSavedSubcorpusNoAuthor(t *testing.T) {
+	subc := &SavedSubcorpus{}
+	assert.False(t, subc.IsAuthor(""))
+	assert.False(t, subc.IsAuthor("anything"))
+}
+
+func TestSavedSubcorpusIndex(t *testing.T) {
+	baseDir := t.TempDir()
+	ids := make([]string, 2)
+	for i := range ids {
+		id, err := NewSavedSubcorpusID()
+		assert.NoError(t, err)
+		ids[i] = id
+		assert.NoError(t, os.MkdirAll(SavedSubcorpusDir(baseDir, id), 0755))
+		assert.NoError(t, WriteSavedSubcorpusMeta(baseDir, &SavedSubcorpus{
+			ID:       id,
+			CorpusID: "omezeni/syn2020",
+			Created:  time.Now().Add(time.Duration(i) * time.Second),
+		}))
+	}
+	// a stale index entry (e.g. a subcorpus removed by other tools)
+	assert.NoError(t, os.RemoveAll(SavedSubcorpusDir(baseDir, ids[0])))
+
+	items, err := ListSavedSubcorpora(baseDir, "omezeni/syn2020")
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, ids[1], items[0].ID)
+	items, err = ListSavedSubcorpora(baseDir, "omezeni")
+	assert.NoError(t, err)
+	assert.Len(t, items, 0)
+}
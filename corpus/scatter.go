@@ -0,0 +1,297 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mquery/rdb"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	chunkRetryDelay = 200 * time.Millisecond
+)
+
+// ChunkFailurePolicy specifies how a scatter-gather calculation
+// treats chunks which failed even after retries.
+type ChunkFailurePolicy int
+
+const (
+
+	// FailOnMissingChunks makes the whole calculation fail
+	// in case any of the chunks is missing
+	FailOnMissingChunks ChunkFailurePolicy = iota
+
+	// AllowPartialResult makes the calculation succeed in case
+	// at least one chunk is calculated. Missing chunks are reported
+	// (see GatherReport).
+	AllowPartialResult
+)
+
+// Chunk identifies a chunk of a split corpus
+type Chunk struct {
+
+	// Num is a chunk number (starting with 1)
+	Num int
+
+	SubcPath string
+}
+
+// GatherReport describes a finished scatter-gather calculation
+type GatherReport struct {
+	Total int
+
+	// Missing contains numbers of chunks not included in the result
+	Missing []int
+
+	// Errors contains errors of the missing chunks
+	// (in the order of Missing)
+	Errors []error
+}
+
+// IsPartial tests whether some chunks are missing in the result
+func (r GatherReport) IsPartial() bool {
+	return len(r.Missing) > 0
+}
+
+// MissingAsString returns comma-separated numbers of missing chunks
+func (r GatherReport) MissingAsString() string {
+	items := make([]string, len(r.Missing))
+	for i, v := range r.Missing {
+		items[i] = strconv.Itoa(v)
+	}
+	return strings.Join(items, ",")
+}
+
+// Included returns chunks (in the order of `chunks`, numbered
+// from 1) which are included in the result
+func (r GatherReport) Included(chunks []string) []string {
+	ans := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		if !slices.Contains(r.Missing, i+1) {
+			ans = append(ans, chunk)
+		}
+	}
+	return ans
+}
+
+// HasUserError tests whether some chunks failed because
+// of a user error (e.g. an invalid query)
+func (r GatherReport) HasUserError() bool {
+	return slices.ContainsFunc(r.Errors, isChunkUserError)
+}
+
+func (r GatherReport) err() error {
+	if len(r.Missing) == 0 {
+		return nil
+	}
+	// a user error is preferred as it is the most relevant for the user
+	cause := r.Errors[0]
+	if i := slices.IndexFunc(r.Errors, isChunkUserError); i >= 0 {
+		cause = r.Errors[i]
+	}
+	return fmt.Errorf(
+		"failed to calculate %d of %d chunks (%s): %w",
+		len(r.Missing), r.Total, r.MissingAsString(), cause)
+}
+
+// ChunkUserError is an error of a chunk caused by user input
+// (e.g. an invalid query). Such chunks are not retried.
+type ChunkUserError struct {
+	Err error
+}
+
+func (err ChunkUserError) Error() string {
+	return err.Err.Error()
+}
+
+func (err ChunkUserError) Unwrap() error {
+	return err.Err
+}
+
+func isChunkUserError(err error) bool {
+	var userErr ChunkUserError
+	return errors.As(err, &userErr)
+}
+
+// ScatterGather publishes chunk queries of a split corpus calculation
+// to workers and gathers their results. Failed chunks are retried
+// (except for user errors which would fail again) and, based on
+// the ChunkFailurePolicy, either the whole calculation fails or
+// a partial result is produced.
+type ScatterGather struct {
+	handler       QueryHandler
+	policy        ChunkFailurePolicy
+	maxRetries    int
+	workerTimeout time.Duration
+}
+
+// runChunk publishes a chunk query and waits for its result. In case
+// of a failure, the query is retried (up to `maxRetries` times). Each
+// attempt is cancelled before a retry so a slow chunk does not keep
+// multiple workers busy. A user error is returned as ChunkUserError.
+func (sg *ScatterGather) runChunk(ctx context.Context, query rdb.Query) (rdb.WorkerResult, error) {
+	var lastErr error
+	for attempt := 0; attempt <= sg.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return rdb.WorkerResult{}, errors.Join(lastErr, ctx.Err())
+			case <-time.After(chunkRetryDelay * time.Duration(attempt)):
+			}
+		}
+		res, err := sg.runChunkAttempt(ctx, query)
+		if err == nil {
+			return res, nil
+		}
+		var userErr ChunkUserError
+		if errors.As(err, &userErr) {
+			return res, err
+		}
+		lastErr = err
+	}
+	return rdb.WorkerResult{}, lastErr
+}
+
+// runChunkAttempt runs a single attempt to calculate a chunk.
+// Once the attempt is finished, its query is cancelled in case
+// it is still being processed (e.g. after a timeout).
+func (sg *ScatterGather) runChunkAttempt(ctx context.Context, query rdb.Query) (rdb.WorkerResult, error) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wait, err := sg.handler.PublishQuery(attemptCtx, query, sg.workerTimeout)
+	if err != nil {
+		return rdb.WorkerResult{}, fmt.Errorf("failed to publish query: %w", err)
+	}
+	res := <-wait
+	if res.Value == nil {
+		return res, errors.New("empty worker result")
+	}
+	if err := res.Value.Err(); err != nil {
+		if res.HasUserError {
+			return res, ChunkUserError{Err: err}
+		}
+		return res, err
+	}
+	return res, nil
+}
+
+// Gather runs a query (created by `mkQuery`) for each of the `chunks`
+// (paths to split corpus subcorpora) in parallel. For each chunk,
+// `onChunk` is called once the chunk is finished - either with its
+// value or with an error (after all the retries). The `onChunk` calls
+// are serialized so it is safe to merge the values there without
+// additional locking. With the FailOnMissingChunks policy, an error
+// is returned in case any chunk is missing. With AllowPartialResult,
+// an error is returned only if all the chunks are missing.
+func Gather[T rdb.FuncResult](
+	ctx context.Context,
+	sg *ScatterGather,
+	chunks []string,
+	mkQuery func(chunk Chunk) rdb.Query,
+	onChunk func(chunk Chunk, value T, err error),
+) (GatherReport, error) {
+	report := GatherReport{Total: len(chunks)}
+	if len(chunks) == 0 {
+		return report, errors.New("no chunks to calculate")
+	}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(chunks))
+	for i, subc := range chunks {
+		chunk := Chunk{Num: i + 1, SubcPath: subc}
+		go func() {
+			defer wg.Done()
+			var value T
+			query := mkQuery(chunk)
+			query.Class = rdb.QueryClassSplitChunk
+			res, err := sg.runChunk(ctx, query)
+			if err == nil {
+				var ok bool
+				value, ok = res.Value.(T)
+				if !ok {
+					err = fmt.Errorf("invalid result type %T for chunk %d", res.Value, chunk.Num)
+				}
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				log.Error().
+					Err(err).
+					Int("chunk", chunk.Num).
+					Str("subcorpus", chunk.SubcPath).
+					Msg("failed to calculate split corpus chunk")
+				report.Missing = append(report.Missing, chunk.Num)
+				report.Errors = append(report.Errors, err)
+			}
+			onChunk(chunk, value, err)
+		}()
+	}
+	wg.Wait()
+
+	sort.Sort(missingChunks(report))
+	// user errors are not tolerated even in partial results
+	// as the user should fix the input
+	if len(report.Missing) == report.Total || sg.policy == FailOnMissingChunks ||
+		report.HasUserError() {
+		return report, report.err()
+	}
+	return report, nil
+}
+
+// missingChunks sorts missing chunks along with their errors
+type missingChunks GatherReport
+
+func (m missingChunks) Len() int {
+	return len(m.Missing)
+}
+
+func (m missingChunks) Less(i, j int) bool {
+	return m.Missing[i] < m.Missing[j]
+}
+
+func (m missingChunks) Swap(i, j int) {
+	m.Missing[i], m.Missing[j] = m.Missing[j], m.Missing[i]
+	m.Errors[i], m.Errors[j] = m.Errors[j], m.Errors[i]
+}
+
+// NewScatterGather creates a ScatterGather. The `workerTimeout`
+// is passed to individual chunk queries (see QueryHandler).
+func NewScatterGather(
+	handler QueryHandler,
+	policy ChunkFailurePolicy,
+	maxRetries int,
+	workerTimeout time.Duration,
+) *ScatterGather {
+	return &ScatterGather{
+		handler:       handler,
+		policy:        policy,
+		maxRetries:    max(maxRetries, 0),
+		workerTimeout: workerTimeout,
+	}
+}
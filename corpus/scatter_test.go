@@ -0,0 +1,228 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"context"
+	"errors"
+	"mquery/rdb"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testChunkResult struct {
+	Value int
+	Error error
+}
+
+func (res testChunkResult) Err() error {
+	return res.Error
+}
+
+func (res testChunkResult) Type() rdb.ResultType {
+	return "testChunk"
+}
+
+// testQueryHandler answers queries with results of `answer`
+// called with the chunk subcorpus and the number of the attempt
+type testQueryHandler struct {
+	answer   func(subc string, attempt int) (rdb.WorkerResult, error)
+	attempts map[string]int
+	classes  map[string]string
+
+	// contexts are contexts of all the published queries
+	contexts []context.Context
+	mu       sync.Mutex
+}
+
+func (h *testQueryHandler) PublishQuery(
+	ctx context.Context, query rdb.Query, workerTimeout time.Duration,
+) (<-chan rdb.WorkerResult, error) {
+	subc := query.Args.(string)
+	h.mu.Lock()
+	h.attempts[subc]++
+	h.classes[subc] = query.Class
+	h.contexts = append(h.contexts, ctx)
+	attempt := h.attempts[subc]
+	h.mu.Unlock()
+	res, err := h.answer(subc, attempt)
+	if err != nil {
+		return nil, err
+	}
+	ans := make(chan rdb.WorkerResult, 1)
+	ans <- res
+	return ans, nil
+}
+
+func newTestQueryHandler(answer func(subc string, attempt int) (rdb.WorkerResult, error)) *testQueryHandler {
+	return &testQueryHandler{answer: answer, attempts: make(map[string]int), classes: make(map[string]string)}
+}
+
+func mkTestQuery(chunk Chunk) rdb.Query {
+	return rdb.Query{Func: "test", Args: chunk.SubcPath}
+}
+
+func gatherTestSum(sg *ScatterGather, chunks []string) (int, GatherReport, error) {
+	var sum int
+	report, err := Gather(
+		context.Background(),
+		sg,
+		chunks,
+		mkTestQuery,
+		func(chunk Chunk, value testChunkResult, err error) {
+			if err == nil {
+				sum += value.Value
+			}
+		},
+	)
+	return sum, report, err
+}
+
+func TestGatherAllChunks(t *testing.T) {
+	h := newTestQueryHandler(func(subc string, attempt int) (rdb.WorkerResult, error) {
+		return rdb.WorkerResult{Value: testChunkResult{Value: len(subc)}}, nil
+	})
+	sg := NewScatterGather(h, FailOnMissingChunks, 0, 0)
+	sum, report, err := gatherTestSum(sg, []string{"a", "bb", "ccc"})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, sum)
+	assert.Equal(t, 3, report.Total)
+	assert.False(t, report.IsPartial())
+	assert.Equal(t, rdb.QueryClassSplitChunk, h.classes["bb"])
+}
+
+func TestGatherRetriesFailedChunk(t *testing.T) {
+	h := newTestQueryHandler(func(subc string, attempt int) (rdb.WorkerResult, error) {
+		if subc == "bb" && attempt == 1 {
+			return rdb.WorkerResult{}, errors.New("publish failed")
+		}
+		if subc == "ccc" && attempt == 1 {
+			return rdb.WorkerResult{Value: testChunkResult{Error: errors.New("worker failed")}}, nil
+		}
+		return rdb.WorkerResult{Value: testChunkResult{Value: len(subc)}}, nil
+	})
+	sg := NewScatterGather(h, FailOnMissingChunks, 1, 0)
+	sum, report, err := gatherTestSum(sg, []string{"a", "bb", "ccc"})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, sum)
+	assert.False(t, report.IsPartial())
+	assert.Equal(t, 2, h.attempts["bb"])
+	assert.Equal(t, 2, h.attempts["ccc"])
+}
+
+func TestGatherDoesNotRetryUserError(t *testing.T) {
+	h := newTestQueryHandler(func(subc string, attempt int) (rdb.WorkerResult, error) {
+		return rdb.WorkerResult{
+			Value:        testChunkResult{Error: errors.New("invalid query")},
+			HasUserError: true,
+		}, nil
+	})
+	sg := NewScatterGather(h, AllowPartialResult, 3, 0)
+	_, report, err := gatherTestSum(sg, []string{"a"})
+	var userErr ChunkUserError
+	assert.ErrorAs(t, err, &userErr)
+	assert.Equal(t, []int{1}, report.Missing)
+	assert.True(t, report.HasUserError())
+	assert.Equal(t, 1, h.attempts["a"])
+}
+
+func TestGatherUserErrorFailsPartialResult(t *testing.T) {
+	h := newTestQueryHandler(func(subc string, attempt int) (rdb.WorkerResult, error) {
+		if subc == "bb" {
+			return rdb.WorkerResult{
+				Value:        testChunkResult{Error: errors.New("invalid query")},
+				HasUserError: true,
+			}, nil
+		}
+		if subc == "ccc" {
+			return rdb.WorkerResult{Value: testChunkResult{Error: errors.New("worker failed")}}, nil
+		}
+		return rdb.WorkerResult{Value: testChunkResult{Value: len(subc)}}, nil
+	})
+	sg := NewScatterGather(h, AllowPartialResult, 0, 0)
+	_, _, err := gatherTestSum(sg, []string{"a", "bb", "ccc"})
+	var userErr ChunkUserError
+	assert.ErrorAs(t, err, &userErr)
+	assert.ErrorContains(t, err, "invalid query")
+}
+
+func TestGatherCancelsRetriedAttempt(t *testing.T) {
+	var h *testQueryHandler
+	h = newTestQueryHandler(func(subc string, attempt int) (rdb.WorkerResult, error) {
+		if attempt == 2 {
+			// the previous attempt must be cancelled before retrying
+			assert.ErrorIs(t, h.contexts[0].Err(), context.Canceled)
+		}
+		if attempt == 1 {
+			return rdb.WorkerResult{Value: testChunkResult{Error: errors.New("worker result timeout")}}, nil
+		}
+		return rdb.WorkerResult{Value: testChunkResult{Value: len(subc)}}, nil
+	})
+	sg := NewScatterGather(h, FailOnMissingChunks, 1, 0)
+	sum, _, err := gatherTestSum(sg, []string{"a"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sum)
+	assert.Len(t, h.contexts, 2)
+	for _, ctx := range h.contexts {
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	}
+}
+
+func TestGatherFailPolicy(t *testing.T) {
+	h := newTestQueryHandler(func(subc string, attempt int) (rdb.WorkerResult, error) {
+		if subc == "bb" {
+			return rdb.WorkerResult{Value: testChunkResult{Error: errors.New("worker failed")}}, nil
+		}
+		return rdb.WorkerResult{Value: testChunkResult{Value: len(subc)}}, nil
+	})
+	sg := NewScatterGather(h, FailOnMissingChunks, 0, 0)
+	_, report, err := gatherTestSum(sg, []string{"a", "bb", "ccc"})
+	assert.ErrorContains(t, err, "worker failed")
+	assert.Equal(t, []int{2}, report.Missing)
+}
+
+func TestGatherPartialPolicy(t *testing.T) {
+	h := newTestQueryHandler(func(subc string, attempt int) (rdb.WorkerResult, error) {
+		if subc != "bb" {
+			return rdb.WorkerResult{}, errors.New("publish failed")
+		}
+		return rdb.WorkerResult{Value: testChunkResult{Value: len(subc)}}, nil
+	})
+	sg := NewScatterGather(h, AllowPartialResult, 0, 0)
+	sum, report, err := gatherTestSum(sg, []string{"a", "bb", "ccc", "dddd"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sum)
+	assert.True(t, report.IsPartial())
+	assert.Equal(t, []int{1, 3, 4}, report.Missing)
+	assert.Len(t, report.Errors, 3)
+	assert.Equal(t, "1,3,4", report.MissingAsString())
+	assert.Equal(t, []string{"bb"}, report.Included([]string{"a", "bb", "ccc", "dddd"}))
+}
+
+func TestGatherPartialPolicyAllMissing(t *testing.T) {
+	h := newTestQueryHandler(func(subc string, attempt int) (rdb.WorkerResult, error) {
+		return rdb.WorkerResult{Value: testChunkResult{Error: errors.New("worker failed")}}, nil
+	})
+	sg := NewScatterGather(h, AllowPartialResult, 0, 0)
+	_, _, err := gatherTestSum(sg, []string{"a", "bb"})
+	assert.Error(t, err)
+}
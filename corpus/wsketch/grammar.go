@@ -0,0 +1,287 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package wsketch provides word sketches calculated on the fly
+// from sketch grammars (the `WSDEF` files).
+package wsketch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	dfltDefaultAttr = "tag"
+	headLabel       = 1
+	collLabel       = 2
+)
+
+var (
+	cqlSpecialChars = regexp.MustCompile(`([\\.^$*+?()\[\]{}|"])`)
+)
+
+// Pattern is a single CQL query of a grammatical relation.
+// The headword and the collocate are specified by the query
+// labels (`1:` and `2:` in a sketch grammar; they may be
+// switched for DUAL and SYMMETRIC relations).
+type Pattern struct {
+	Query     string
+	HeadLabel int
+	CollLabel int
+}
+
+// HeadwordQuery returns the pattern query with the headword
+// bound to the provided value.
+func (p Pattern) HeadwordQuery(attr, value string) (string, error) {
+	return constrainLabel(p.Query, p.HeadLabel, attr, value)
+}
+
+// CollocateQuery returns the pattern query with the collocate
+// bound to the provided value.
+func (p Pattern) CollocateQuery(attr, value string) (string, error) {
+	return constrainLabel(p.Query, p.CollLabel, attr, value)
+}
+
+// CollFcrit returns a frequency criterion for collocates
+// (i.e. values of the `attr` found at the collocate position)
+func (p Pattern) CollFcrit(attr string) string {
+	return fmt.Sprintf("%s/e 0<%d", attr, p.CollLabel)
+}
+
+// HeadFcrit returns a frequency criterion for headwords
+func (p Pattern) HeadFcrit(attr string) string {
+	return fmt.Sprintf("%s/e 0<%d", attr, p.HeadLabel)
+}
+
+// Relation is a grammatical relation (e.g. `modifier`)
+type Relation struct {
+	Name     string
+	Patterns []Pattern
+}
+
+// Grammar is a parsed sketch grammar. Only binary relations
+// (including DUAL and SYMMETRIC ones) are supported, UNARY and
+// TRINARY relations are skipped.
+type Grammar struct {
+	Relations []*Relation
+}
+
+type relationType int
+
+const (
+	relationBinary relationType = iota
+	relationDual
+	relationSymmetric
+	relationUnsupported
+)
+
+// EscapeValue escapes a value so it can be used as a literal
+// in a CQL expression (where values are regular expressions).
+func EscapeValue(v string) string {
+	return cqlSpecialChars.ReplaceAllString(v, `\$1`)
+}
+
+// findClosingBracket returns an index of the `]` closing
+// the token expression starting at `start` (which must be `[`).
+func findClosingBracket(query string, start int) int {
+	inQuotes := false
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case ']':
+			if !inQuotes {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// constrainLabel adds `attr="value"` to the token labeled by `label`
+func constrainLabel(query string, label int, attr, value string) (string, error) {
+	mark := fmt.Sprintf("%d:[", label)
+	idx := -1
+	for i := 0; i+len(mark) <= len(query); i++ {
+		if strings.HasPrefix(query[i:], mark) && (i == 0 || query[i-1] < '0' || query[i-1] > '9') {
+			idx = i + len(mark) - 1
+			break
+		}
+	}
+	if idx < 0 {
+		return "", fmt.Errorf("label %d not found in query %s", label, query)
+	}
+	end := findClosingBracket(query, idx)
+	if end < 0 {
+		return "", fmt.Errorf("invalid token expression in query %s", query)
+	}
+	cond := fmt.Sprintf(`%s="%s"`, attr, EscapeValue(value))
+	if inner := strings.TrimSpace(query[idx+1 : end]); inner != "" {
+		cond = fmt.Sprintf("%s & (%s)", cond, inner)
+	}
+	return query[:idx+1] + cond + query[end:], nil
+}
+
+// expandShorthands replaces tokens specified only by a quoted
+// value (e.g. `"N.*"`) with a full expression using the default
+// attribute (e.g. `[tag="N.*"]`).
+func expandShorthands(query, defaultAttr string) string {
+	var ans strings.Builder
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '[':
+			depth++
+			ans.WriteByte(query[i])
+		case ']':
+			depth--
+			ans.WriteByte(query[i])
+		case '"':
+			end := i + 1
+			for ; end < len(query) && query[end] != '"'; end++ {
+				if query[end] == '\\' {
+					end++
+				}
+			}
+			end = min(end, len(query)-1)
+			if depth > 0 {
+				ans.WriteString(query[i : end+1])
+
+			} else {
+				ans.WriteString(fmt.Sprintf("[%s=%s]", defaultAttr, query[i:end+1]))
+			}
+			i = end
+		default:
+			ans.WriteByte(query[i])
+		}
+	}
+	return ans.String()
+}
+
+func hasLabel(query string, label int) bool {
+	return strings.Contains(query, fmt.Sprintf("%d:[", label))
+}
+
+// ParseGrammar parses a sketch grammar. Macros (m4 `define`)
+// are not supported.
+func ParseGrammar(src io.Reader) (*Grammar, error) {
+	var ans Grammar
+	var curr, currDual *Relation
+	currType := relationBinary
+	nextType := relationBinary
+	defaultAttr := dfltDefaultAttr
+	var structLimit string
+	scanner := bufio.NewScanner(src)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "*") {
+			items := strings.Fields(line)
+			switch items[0] {
+			case "*DEFAULTATTR":
+				if len(items) != 2 {
+					return nil, fmt.Errorf("invalid *DEFAULTATTR on line %d", lineNum)
+				}
+				defaultAttr = items[1]
+			case "*STRUCTLIMIT":
+				if len(items) != 2 {
+					return nil, fmt.Errorf("invalid *STRUCTLIMIT on line %d", lineNum)
+				}
+				structLimit = items[1]
+			case "*DUAL":
+				nextType = relationDual
+			case "*SYMMETRIC":
+				nextType = relationSymmetric
+			case "*UNARY", "*TRINARY":
+				nextType = relationUnsupported
+			}
+			// other directives (e.g. *SEPARATEPAGE) do not affect
+			// the calculation
+			continue
+		}
+		if strings.HasPrefix(line, "=") {
+			curr, currDual = nil, nil
+			currType = nextType
+			nextType = relationBinary
+			name := strings.TrimSpace(line[1:])
+			if currType == relationUnsupported || strings.Contains(name, "%(") {
+				currType = relationUnsupported
+				continue
+			}
+			if currType == relationDual {
+				names := strings.SplitN(name, "/", 2)
+				if len(names) != 2 {
+					return nil, fmt.Errorf("invalid DUAL relation name on line %d", lineNum)
+				}
+				curr = &Relation{Name: names[0]}
+				currDual = &Relation{Name: names[1]}
+				ans.Relations = append(ans.Relations, curr, currDual)
+
+			} else {
+				curr = &Relation{Name: name}
+				ans.Relations = append(ans.Relations, curr)
+			}
+			continue
+		}
+		if currType == relationUnsupported {
+			continue
+		}
+		if curr == nil {
+			return nil, fmt.Errorf("query outside of a relation on line %d", lineNum)
+		}
+		query := expandShorthands(line, defaultAttr)
+		if !hasLabel(query, headLabel) || !hasLabel(query, collLabel) {
+			return nil, fmt.Errorf("missing label 1: or 2: on line %d", lineNum)
+		}
+		if structLimit != "" {
+			query = fmt.Sprintf("%s within <%s/>", query, structLimit)
+		}
+		curr.Patterns = append(
+			curr.Patterns, Pattern{Query: query, HeadLabel: headLabel, CollLabel: collLabel})
+		switch currType {
+		case relationDual:
+			currDual.Patterns = append(
+				currDual.Patterns, Pattern{Query: query, HeadLabel: collLabel, CollLabel: headLabel})
+		case relationSymmetric:
+			curr.Patterns = append(
+				curr.Patterns, Pattern{Query: query, HeadLabel: collLabel, CollLabel: headLabel})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse sketch grammar: %w", err)
+	}
+	return &ans, nil
+}
+
+// LoadGrammar loads and parses a sketch grammar file
+func LoadGrammar(path string) (*Grammar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sketch grammar: %w", err)
+	}
+	defer f.Close()
+	return ParseGrammar(f)
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package wsketch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testGrammar = `
+# a testing grammar
+*DEFAULTATTR tag
+*STRUCTLIMIT s
+
+=object
+1:"V.*" [tag="A.*"]{0,2} 2:"N.*"
+
+*DUAL
+=modifier/modifies
+2:[tag="A.*" & word!="\"x\""] 1:"N.*"
+
+*UNARY
+=passive
+1:"V.*" "R.*"
+
+*SYMMETRIC
+=and/or
+1:[] [lemma="and|or"] 2:[]
+`
+
+func TestParseGrammar(t *testing.T) {
+	g, err := ParseGrammar(strings.NewReader(testGrammar))
+	assert.NoError(t, err)
+	assert.Len(t, g.Relations, 4)
+
+	assert.Equal(t, "object", g.Relations[0].Name)
+	assert.Equal(
+		t,
+		[]Pattern{
+			{
+				Query:     `1:[tag="V.*"] [tag="A.*"]{0,2} 2:[tag="N.*"] within <s/>`,
+				HeadLabel: 1,
+				CollLabel: 2,
+			},
+		},
+		g.Relations[0].Patterns,
+	)
+
+	assert.Equal(t, "modifier", g.Relations[1].Name)
+	assert.Equal(t, "modifies", g.Relations[2].Name)
+	assert.Equal(t, g.Relations[1].Patterns[0].Query, g.Relations[2].Patterns[0].Query)
+	assert.Equal(t, 2, g.Relations[2].Patterns[0].HeadLabel)
+	assert.Equal(t, 1, g.Relations[2].Patterns[0].CollLabel)
+
+	assert.Equal(t, "and/or", g.Relations[3].Name)
+	assert.Len(t, g.Relations[3].Patterns, 2)
+}
+
+func TestParseGrammarMissingLabel(t *testing.T) {
+	_, err := ParseGrammar(strings.NewReader("=foo\n1:\"N.*\" \"V.*\"\n"))
+	assert.Error(t, err)
+}
+
+func TestPatternQueries(t *testing.T) {
+	p := Pattern{Query: `2:[tag="A.*" & word!="]"] 1:[] within <s/>`, HeadLabel: 1, CollLabel: 2}
+	q, err := p.HeadwordQuery("lemma", "c++")
+	assert.NoError(t, err)
+	assert.Equal(t, `2:[tag="A.*" & word!="]"] 1:[lemma="c\+\+"] within <s/>`, q)
+
+	q, err = p.CollocateQuery("lemma", "big")
+	assert.NoError(t, err)
+	assert.Equal(t, `2:[lemma="big" & (tag="A.*" & word!="]")] 1:[] within <s/>`, q)
+
+	assert.Equal(t, "lemma/e 0<2", p.CollFcrit("lemma"))
+	assert.Equal(t, "lemma/e 0<1", p.HeadFcrit("lemma"))
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package mango
+
+// #include <stdlib.h>
+// #include "mango.h"
+import "C"
+
+import (
+	"mquery/merror"
+	"sync"
+)
+
+// AbortSignal allows for a cooperative cancellation of running
+// Manatee calculations. The signal is passed to a mango function
+// and once Abort is called (typically from a different goroutine),
+// the function stops at the nearest check point and returns
+// merror.CancelledError.
+// A nil *AbortSignal is a valid value meaning "cannot be aborted".
+type AbortSignal struct {
+	flag   C.AbortFlag
+	closed bool
+	reason error
+	mu     sync.Mutex
+}
+
+// Abort signals a running calculation to stop.
+// It is safe to call the method more than once.
+func (s *AbortSignal) Abort() {
+	s.AbortWithReason(nil)
+}
+
+// AbortWithReason signals a running calculation to stop and
+// specifies an error the calculation will return instead of
+// the default merror.CancelledError (e.g. when a time limit
+// is exceeded). Only the first reason is kept.
+func (s *AbortSignal) AbortWithReason(reason error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		if s.reason == nil {
+			s.reason = reason
+		}
+		C.set_abort_flag(s.flag)
+	}
+}
+
+func (s *AbortSignal) IsAborted() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.closed && C.is_abort_flag_set(s.flag) != 0
+}
+
+// Close releases the signal. It must be called once the
+// respective calculation is finished.
+func (s *AbortSignal) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		C.delete_abort_flag(s.flag)
+		s.closed = true
+	}
+}
+
+func (s *AbortSignal) cFlag() C.AbortFlag {
+	if s == nil {
+		return nil
+	}
+	return s.flag
+}
+
+// mapError replaces an error caused by aborting a calculation
+// by the abort reason (merror.CancelledError by default).
+func (s *AbortSignal) mapError(err error) error {
+	if err != nil && s.IsAborted() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.reason != nil {
+			return s.reason
+		}
+		return merror.CancelledError{Msg: "calculation aborted"}
+	}
+	return err
+}
+
+func NewAbortSignal() *AbortSignal {
+	return &AbortSignal{flag: C.new_abort_flag()}
+}
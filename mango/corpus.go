@@ -0,0 +1,172 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package mango
+
+// #include <stdlib.h>
+// #include "mango.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"unsafe"
+)
+
+const (
+	// MaxOpenSubcorpora limits the number of subcorpora
+	// kept open along with a corpus handle.
+	MaxOpenSubcorpora = 10
+)
+
+// openSubcorpus is an open subcorpus along with a version
+// of its data file at the time it was opened
+type openSubcorpus struct {
+	value C.SubCorpusV
+	mtime time.Time
+	size  int64
+}
+
+// matches tests whether the subcorpus data file `info`
+// is the one the subcorpus was opened from
+func (subc openSubcorpus) matches(info os.FileInfo) bool {
+	return info.ModTime().Equal(subc.mtime) && info.Size() == subc.size
+}
+
+// Corpus is an open Manatee corpus. Subcorpora used along with the
+// corpus are opened lazily and kept open until the corpus is closed
+// or until their data files change or are removed.
+// Please note that Manatee objects are not safe for concurrent use
+// so a Corpus must not be used by multiple goroutines at the same
+// time (see CorpusPool).
+type Corpus struct {
+	path       string
+	corp       C.CorpusV
+	subcorpora map[string]openSubcorpus
+
+	// regMtime is a modification time of the corpus registry
+	// file at the time the corpus was opened
+	regMtime time.Time
+}
+
+// Path returns a path to the corpus registry file.
+func (c *Corpus) Path() string {
+	return c.path
+}
+
+// ModTime returns a modification time of the registry file
+// at the time the corpus was opened.
+func (c *Corpus) ModTime() time.Time {
+	return c.regMtime
+}
+
+// subcorpus returns an open subcorpus. For an empty `subcPath`,
+// nil is returned (which means "whole corpus" for mango functions).
+func (c *Corpus) subcorpus(subcPath string) (C.SubCorpusV, error) {
+	if subcPath == "" {
+		return nil, nil
+	}
+	c.closeStaleSubcorpora()
+	if subc, ok := c.subcorpora[subcPath]; ok {
+		return subc.value, nil
+	}
+	if len(c.subcorpora) >= MaxOpenSubcorpora {
+		c.closeSubcorpora()
+	}
+	info, err := os.Stat(subcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open subcorpus %s: %w", subcPath, err)
+	}
+	cSubcPath := C.CString(subcPath)
+	defer C.free(unsafe.Pointer(cSubcPath))
+	ans := C.open_subcorpus(c.corp, cSubcPath)
+	if ans.err != nil {
+		err := errors.New(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return nil, fmt.Errorf("failed to open subcorpus %s: %w", subcPath, err)
+	}
+	c.subcorpora[subcPath] = openSubcorpus{
+		value: ans.value,
+		mtime: info.ModTime(),
+		size:  info.Size(),
+	}
+	return ans.value, nil
+}
+
+func (c *Corpus) closeSubcorpora() {
+	for k, subc := range c.subcorpora {
+		C.close_subcorpus(subc.value)
+		delete(c.subcorpora, k)
+	}
+}
+
+// closeStaleSubcorpora closes subcorpora with data files changed
+// (e.g. recreated by a user) or removed since they were opened.
+func (c *Corpus) closeStaleSubcorpora() {
+	for k, subc := range c.subcorpora {
+		info, err := os.Stat(k)
+		if err == nil && subc.matches(info) {
+			continue
+		}
+		C.close_subcorpus(subc.value)
+		delete(c.subcorpora, k)
+	}
+}
+
+// isStale tests whether the corpus registry file has changed
+// since the corpus was opened.
+func (c *Corpus) isStale() bool {
+	info, err := os.Stat(c.path)
+	return err != nil || !info.ModTime().Equal(c.regMtime)
+}
+
+// Close closes the corpus along with all its subcorpora.
+// It is safe to call the method more than once.
+func (c *Corpus) Close() {
+	if c.corp == nil {
+		return
+	}
+	c.closeSubcorpora()
+	C.close_corpus(c.corp)
+	c.corp = nil
+}
+
+// OpenCorpus opens a Manatee corpus specified by its registry path.
+// The returned corpus must be closed once not needed.
+func OpenCorpus(corpusPath string) (*Corpus, error) {
+	info, err := os.Stat(corpusPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open corpus %s: %w", corpusPath, err)
+	}
+	cCorpusPath := C.CString(corpusPath)
+	defer C.free(unsafe.Pointer(cCorpusPath))
+	ans := C.open_corpus(cCorpusPath)
+	if ans.err != nil {
+		err := errors.New(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return nil, fmt.Errorf("failed to open corpus %s: %w", corpusPath, err)
+	}
+	return &Corpus{
+		path:       corpusPath,
+		corp:       ans.value,
+		subcorpora: make(map[string]openSubcorpus),
+		regMtime:   info.ModTime(),
+	}, nil
+}
@@ -23,6 +23,7 @@
 #include "concord/concstat.hh"
 #include "concord/concget.hh"
 #include "query/cqpeval.hh"
+#include "wmap/wmap.hh"
 #include "mango.h"
 #include <string.h>
 #include <stdio.h>
@@ -31,10 +32,69 @@
 #include <sstream>
 #include <cmath>
 #include <map>
+#include <unordered_map>
 #include <algorithm>
+#include <stdexcept>
+#include <random>
+#include <unistd.h>
 
 using namespace std;
 
+// how often (in microseconds) we test the abort flag
+// while waiting for a concordance to be calculated
+const useconds_t ABORT_CHECK_INTERVAL_US = 20000;
+
+const char* ABORTED_OPERATION_MSG = "operation aborted";
+
+// a line group used to mark lines selected to a sample
+const int SAMPLE_LINE_GROUP = 1;
+
+
+AbortFlag new_abort_flag() {
+    int* flag = (int*)malloc(sizeof(int));
+    __atomic_store_n(flag, 0, __ATOMIC_SEQ_CST);
+    return flag;
+}
+
+void set_abort_flag(AbortFlag flag) {
+    __atomic_store_n(flag, 1, __ATOMIC_SEQ_CST);
+}
+
+int is_abort_flag_set(AbortFlag flag) {
+    return flag != nullptr && __atomic_load_n(flag, __ATOMIC_SEQ_CST) != 0;
+}
+
+void delete_abort_flag(AbortFlag flag) {
+    free(flag);
+}
+
+/**
+ * @brief Throw an exception in case the abort flag is set.
+ */
+void check_abort(AbortFlag abortFlag) {
+    if (is_abort_flag_set(abortFlag)) {
+        throw std::runtime_error(ABORTED_OPERATION_MSG);
+    }
+}
+
+/**
+ * @brief Wait for a concordance to be calculated while watching
+ * the abort flag. Manatee calculates concordances in a background
+ * thread so we can poll for the result instead of a blocking `sync()`.
+ * In case the operation is aborted, an exception is thrown (and it
+ * is up to the caller to delete the concordance which stops the
+ * calculation).
+ */
+void sync_conc(Concordance* conc, AbortFlag abortFlag) {
+    if (abortFlag != nullptr) {
+        while (!conc->finished()) {
+            check_abort(abortFlag);
+            usleep(ABORT_CHECK_INTERVAL_US);
+        }
+    }
+    conc->sync();
+}
+
 
 CorpusRetval open_corpus(const char* corpusPath) {
     string tmp(corpusPath);
@@ -54,14 +114,124 @@ void close_corpus(CorpusV corpus) {
     delete (Corpus *)corpus;
 }
 
-CorpusSizeRetrval get_corpus_size(const char* corpusPath) {
+SubCorpusRetval open_subcorpus(CorpusV corpus, const char* subcPath) {
+    SubCorpusRetval ans;
+    ans.err = nullptr;
+    ans.value = nullptr;
+    try {
+        ans.value = new SubCorpus((Corpus*)corpus, subcPath);
+
+    } catch (std::exception &e) {
+        ans.err = strdup(e.what());
+    }
+    return ans;
+}
+
+void close_subcorpus(SubCorpusV subc) {
+    delete (SubCorpus *)subc;
+}
+
+/**
+ * @brief Create a concordance for the query. In case a subcorpus
+ * is provided (i.e. not NULL), the concordance is limited to it.
+ */
+Concordance* new_concordance(Corpus* corp, SubCorpus* subc, const char* query) {
+    if (subc != nullptr) {
+        return new Concordance(subc, subc->filter_query(eval_cqpquery(query, subc)));
+    }
+    return new Concordance(corp, corp->filter_query(eval_cqpquery(query, corp)));
+}
+
+/**
+ * @brief Apply a chain of positive/negative filters to a concordance.
+ * Each filter is evaluated as a collocation of the concordance and
+ * then, lines with (positive filter) or without (negative filter)
+ * the collocation are kept.
+ */
+void apply_filters(Concordance* conc, ConcFilters filters, AbortFlag abortFlag) {
+    for (int i = 0; i < filters.size; i++) {
+        check_abort(abortFlag);
+        ConcFilter& filter = filters.items[i];
+        int collnum = conc->numofcolls() + 1;
+        conc->set_collocation(
+            collnum, filter.query, filter.lctx, filter.rctx, 1, filter.excludeKwic != 0);
+        conc->delete_pnfilter(collnum, filter.positive != 0);
+    }
+}
+
+/**
+ * @brief Reduce a concordance to a random sample of lines. To make
+ * the sample reproducible (also across platforms), lines are selected
+ * using a seeded Mersenne Twister (Knuth's selection sampling) instead
+ * of Manatee's own reduction which relies on the global random generator.
+ * The selected lines keep their order.
+ */
+void apply_sample(Concordance* conc, ConcSample sample, AbortFlag abortFlag) {
+    PosInt concSize = conc->size();
+    if (sample.size <= 0 || sample.size >= concSize) {
+        return;
+    }
+    std::mt19937_64 rng(sample.seed);
+    PosInt numSelected = 0;
+    for (PosInt i = 0; i < concSize && numSelected < sample.size; i++) {
+        if (i % 100000 == 0) {
+            check_abort(abortFlag);
+        }
+        if ((PosInt)(rng() % (unsigned long long)(concSize - i)) < sample.size - numSelected) {
+            conc->set_linegroup(i, SAMPLE_LINE_GROUP);
+            numSelected++;
+        }
+    }
+    conc->delete_linegroups(std::to_string(SAMPLE_LINE_GROUP).c_str(), true);
+}
+
+/**
+ * @brief Obtain a calculated concordance for the query. In case
+ * `concFile.loadPath` is not empty, the concordance is loaded from
+ * the file (previously stored via `concFile.savePath`) instead of
+ * evaluating the query. In case `concFile.savePath` is not empty,
+ * the calculated concordance is saved there (before any modification
+ * like shuffling or filtering is applied). Then, the `filters` are
+ * applied and finally, the concordance is reduced to a `sample`.
+ */
+Concordance* get_concordance(
+    Corpus* corp,
+    SubCorpus* subc,
+    const char* query,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag) {
+
+    Concordance* conc = nullptr;
+    try {
+        if (concFile.loadPath != nullptr && strlen(concFile.loadPath) > 0) {
+            Corpus* src = subc != nullptr ? subc : corp;
+            conc = new Concordance(src, concFile.loadPath);
+            conc->sync();
+
+        } else {
+            conc = new_concordance(corp, subc, query);
+            sync_conc(conc, abortFlag);
+            if (concFile.savePath != nullptr && strlen(concFile.savePath) > 0) {
+                conc->save(concFile.savePath);
+            }
+        }
+        apply_filters(conc, filters, abortFlag);
+        apply_sample(conc, sample, abortFlag);
+
+    } catch (std::exception &e) {
+        delete conc;
+        throw;
+    }
+    return conc;
+}
+
+CorpusSizeRetrval get_corpus_size(CorpusV corpus) {
     CorpusSizeRetrval ans;
     ans.err = nullptr;
-    Corpus* corp = nullptr;
     try {
-        Corpus* corp = new Corpus(corpusPath);
-        ans.value = corp->size();
-        delete corp;
+        ans.value = ((Corpus*)corpus)->size();
 
     } catch (std::exception &e) {
         ans.err = strdup(e.what());
@@ -75,38 +245,27 @@ CorpusStringRetval get_corpus_conf(CorpusV corpus, const char* prop) {
     ans.value = nullptr;
     string tmp(prop);
     try {
-        const char * s = ((Corpus*)corpus)->get_conf(tmp).c_str();
-        ans.value = s;
-        return ans;
+        ans.value = strdup(((Corpus*)corpus)->get_conf(tmp).c_str());
 
     } catch (std::exception &e) {
         ans.err = strdup(e.what());
-        return ans;
     }
+    return ans;
 }
 
-ConcSizeRetVal concordance_size(const char* corpusPath, const char* subcPath, const char* query) {
-    string cPath(corpusPath);
+ConcSizeRetVal concordance_size(
+    CorpusV corpus, SubCorpusV subcorpus, const char* query, ConcFile concFile, ConcFilters filters, ConcSample sample, AbortFlag abortFlag) {
     ConcSizeRetVal ans;
     ans.err = nullptr;
     ans.value = 0;
     ans.corpusSize = 0;
     ans.arf = 0.0;
-    Corpus* corp = nullptr;
-    SubCorpus* subc = nullptr;
+    Corpus* corp = (Corpus*)corpus;
     Concordance* conc = nullptr;
 
     try {
-        corp = new Corpus(cPath);
         ans.corpusSize = corp->size();
-        if (subcPath && *subcPath != '\0') {
-            subc = new SubCorpus(corp, subcPath);
-            conc = new Concordance(subc, subc->filter_query(eval_cqpquery(query, subc)));
-
-        } else {
-            conc = new Concordance(corp, corp->filter_query(eval_cqpquery(query, corp)));
-        }
-        conc->sync();
+        conc = get_concordance(corp, (SubCorpus*)subcorpus, query, concFile, filters, sample, abortFlag);
         ans.value = conc->size();
         ans.arf = conc->compute_ARF();
 
@@ -115,31 +274,21 @@ ConcSizeRetVal concordance_size(const char* corpusPath, const char* subcPath, co
     }
 
     delete conc;
-    delete corp;
 
     return ans;
 }
 
-CompileFrqRetVal compile_subc_freqs(const char* corpusPath, const char* subcPath, const char* attr) {
+CompileFrqRetVal compile_subc_freqs(SubCorpusV subcorpus, const char* attr) {
     CompileFrqRetVal ans;
     ans.err = nullptr;
-    string cPath(corpusPath);
-    Corpus* corp = nullptr;
-    SubCorpus* subc = nullptr;
 
     try {
-        corp = new Corpus(cPath);
-        subc = new SubCorpus(corp, subcPath);
-        subc->compile_frq(attr);
-
+        ((SubCorpus*)subcorpus)->compile_frq(attr);
 
     } catch (std::exception &e) {
         ans.err = strdup(e.what());
     }
 
-    delete subc;
-    delete corp;
-
     return ans;
 }
 
@@ -168,12 +317,21 @@ FreqsRetval freq_dist_from_conc(CorpusV corpus, ConcV conc, char* fcrit, PosInt
 }
 
 
-FreqsRetval freq_dist(const char* corpusPath, const char* subcPath, const char* query, const char* fcrit, PosInt flimit) {
-    string cPath(corpusPath);
+FreqsRetval freq_dist(
+    CorpusV corpus,
+    SubCorpusV subcorpus,
+    const char* query,
+    const char* fcrit,
+    PosInt flimit,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag
+) {
+    Corpus* corp = (Corpus*)corpus;
+    SubCorpus* subc = (SubCorpus*)subcorpus;
+    Concordance* conc = nullptr;
     try {
-        Corpus* corp = new Corpus(cPath);
-        Concordance* conc = nullptr;
-        SubCorpus* subc = nullptr;
         auto xwords = new vector<string>;
         vector<string>& words = *xwords;
         auto xfreqs = new vector<PosInt>;
@@ -184,18 +342,14 @@ FreqsRetval freq_dist(const char* corpusPath, const char* subcPath, const char*
         PosInt corpSize;
         PosInt searchSize;
 
-        if (subcPath && *subcPath != '\0') {
-            subc = new SubCorpus(corp, subcPath);
-            conc = new Concordance(subc, subc->filter_query(eval_cqpquery(query, subc)));
-            conc->sync();
+        conc = get_concordance(corp, subc, query, concFile, filters, sample, abortFlag);
+        if (subc != nullptr) {
             subc->freq_dist(conc->RS(), fcrit, flimit, words, freqs, norms);
             concSize = conc->size();
             corpSize = corp->size();
             searchSize = subc->search_size();
 
         } else {
-            conc = new Concordance(corp, corp->filter_query(eval_cqpquery(query, corp)));
-            conc->sync();
             corp->freq_dist(conc->RS(), fcrit, flimit, words, freqs, norms);
             concSize = conc->size();
             corpSize = corp->size();
@@ -211,11 +365,10 @@ FreqsRetval freq_dist(const char* corpusPath, const char* subcPath, const char*
             nullptr
         };
         delete conc;
-        delete subc;
-        delete corp;
         return ans;
 
     } catch (std::exception &e) {
+        delete conc;
         FreqsRetval ans {
             nullptr,
             nullptr,
@@ -242,6 +395,7 @@ FreqsRetval freq_dist(const char* corpusPath, const char* subcPath, const char*
  * @param refs Reference attributes
  * @param refsSplitter Reference splitter string
  * @param viewContextStruct Context structure for viewing
+ * @param abortFlag
  * @return char** Array of formatted lines
  */
 char** process_kwic_lines(
@@ -254,7 +408,8 @@ char** process_kwic_lines(
     const char* structs,
     const char* refs,
     const char* refsSplitter,
-    const char* viewContextStruct) {
+    const char* viewContextStruct,
+    AbortFlag abortFlag) {
 
     std::string cppContextStruct(viewContextStruct);
     std::string halfLeft = "-" + std::to_string(int(std::floor(maxContext / 2.0)));
@@ -278,6 +433,14 @@ char** process_kwic_lines(
     char** lines = (char**)malloc(limit * sizeof(char*));
     int i = 0;
     while (kl->nextline()) {
+        if (is_abort_flag_set(abortFlag)) {
+            for (int i2 = 0; i2 < i; i2++) {
+                free(lines[i2]);
+            }
+            free(lines);
+            delete kl;
+            throw std::runtime_error(ABORTED_OPERATION_MSG);
+        }
         auto lft = kl->get_left();
         auto kwc = kl->get_kwic();
         auto rgt = kl->get_right();
@@ -309,21 +472,25 @@ char** process_kwic_lines(
             break;
         }
     }
+    delete kl;
     return lines;
 }
 
 /**
  * @brief Based on provided query, return at most `limit` sentences matching the query.
  *
- * @param corpusPath
+ * @param corpus
+ * @param subcorpus a subcorpus to search in or NULL
+ * @param corpusPath used to locate aligned corpora
  * @param query
  * @param attrs Positional attributes (comma-separated) to be attached to returned tokens
  * @param limit
  * @return KWICRowsRetval
  */
 KWICRowsRetval conc_examples(
+    CorpusV corpus,
+    SubCorpusV subcorpus,
     const char* corpusPath,
-    const char* subcPath,
     const char* query,
     const char* attrs,
     const char* structs,
@@ -333,23 +500,20 @@ KWICRowsRetval conc_examples(
     PosInt limit,
     PosInt maxContext,
     int shuffle,
-    const char* viewContextStruct) {
-
-    string cPath(corpusPath);
-    Corpus* corp = new Corpus(cPath);
-    PosInt corpSize = corp->size();
+    const char* sortCrit,
+    int sortDesc,
+    const char* viewContextStruct,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag) {
+
+    Corpus* corp = (Corpus*)corpus;
     Concordance* conc = nullptr;
-    SubCorpus* subc = nullptr;
 
     try {
-        if (subcPath && *subcPath != '\0') {
-            subc = new SubCorpus(corp, subcPath);
-            conc = new Concordance(subc, subc->filter_query(eval_cqpquery(query, subc)));
-
-        } else {
-            conc = new Concordance(corp, corp->filter_query(eval_cqpquery(query, corp)));
-        }
-        conc->sync();
+        PosInt corpSize = corp->size();
+        conc = get_concordance(corp, (SubCorpus*)subcorpus, query, concFile, filters, sample, abortFlag);
         if (conc->size() == 0 && fromLine == 0) {
             KWICRowsRetval ans {
                 nullptr,
@@ -376,7 +540,11 @@ KWICRowsRetval conc_examples(
             };
             return ans;
         }
-        if (shuffle) {
+        bool sorted = sortCrit != nullptr && strlen(sortCrit) > 0;
+        if (sorted) {
+            conc->sort(sortCrit);
+
+        } else if (shuffle) {
             conc->shuffle();
         }
         PosInt concSize = conc->size();
@@ -387,9 +555,13 @@ KWICRowsRetval conc_examples(
         if (limit + fromLine > conc->size()) {
             limit = conc->size() - fromLine;
         }
+        // Manatee sorts in ascending order only so for the descending
+        // one, we read the respective lines from the end and reverse them
+        bool reversed = sorted && sortDesc;
+        PosInt readFrom = reversed ? concSize - fromLine - limit : fromLine;
 
         char** lines = process_kwic_lines(
-            corp, conc, fromLine, limit, maxContext, attrs, structs, refs, refsSplitter, viewContextStruct);
+            corp, conc, readFrom, limit, maxContext, attrs, structs, refs, refsSplitter, viewContextStruct, abortFlag);
 
         char** alignedLines = nullptr;
         if (aligned_corps.size() == 2) {
@@ -404,7 +576,7 @@ KWICRowsRetval conc_examples(
             // Get the aligned corpus object after switching
             Corpus* alignedCorp = new Corpus(alignedCorpusPath);
             alignedLines = process_kwic_lines(
-                alignedCorp, conc, fromLine, limit, maxContext, attrs, structs, refs, refsSplitter, viewContextStruct);
+                alignedCorp, conc, readFrom, limit, maxContext, attrs, structs, refs, refsSplitter, viewContextStruct, nullptr);
             delete alignedCorp;
         }
 
@@ -430,8 +602,13 @@ KWICRowsRetval conc_examples(
                 }
             }
         }
+        if (reversed) {
+            std::reverse(lines, lines + i);
+            if (alignedLines != nullptr) {
+                std::reverse(alignedLines, alignedLines + i);
+            }
+        }
         delete conc;
-        delete corp;
         KWICRowsRetval ans {
             lines,
             alignedLines,
@@ -444,6 +621,7 @@ KWICRowsRetval conc_examples(
         return ans;
 
     } catch (std::exception &e) {
+        delete conc;
         KWICRowsRetval ans {
             nullptr,
             nullptr,
@@ -458,8 +636,8 @@ KWICRowsRetval conc_examples(
 }
 
 KWICRowsRetval conc_examples_with_coll_phrase(
-    const char* corpusPath,
-    const char* subcPath,
+    CorpusV corpus,
+    SubCorpusV subcorpus,
     const char* query,
     const char* collQuery,
     const char* lctx,
@@ -472,23 +650,18 @@ KWICRowsRetval conc_examples_with_coll_phrase(
     PosInt limit,
     PosInt maxContext,
     int shuffle,
-    const char* viewContextStruct) {
+    const char* viewContextStruct,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag) {
 
-        string cPath(corpusPath);
-        Corpus* corp = new Corpus(cPath);
-        PosInt corpSize = corp->size();
+        Corpus* corp = (Corpus*)corpus;
         Concordance* conc = nullptr;
-        SubCorpus* subc = nullptr;
 
         try {
-            if (subcPath && *subcPath != '\0') {
-                subc = new SubCorpus(corp, subcPath);
-                conc = new Concordance(subc, subc->filter_query(eval_cqpquery(query, subc)));
-
-            } else {
-                conc = new Concordance(corp, corp->filter_query(eval_cqpquery(query, corp)));
-            }
-            conc->sync();
+            PosInt corpSize = corp->size();
+            conc = get_concordance(corp, (SubCorpus*)subcorpus, query, concFile, filters, sample, abortFlag);
             if (conc->size() == 0 && fromLine == 0) {
                 KWICRowsRetval ans {
                     nullptr,
@@ -546,6 +719,14 @@ KWICRowsRetval conc_examples_with_coll_phrase(
             char** lines = (char**)malloc(limit * sizeof(char*));
             int i = 0;
             while (kl->nextline()) {
+                if (is_abort_flag_set(abortFlag)) {
+                    for (int i2 = 0; i2 < i; i2++) {
+                        free(lines[i2]);
+                    }
+                    free(lines);
+                    delete kl;
+                    throw std::runtime_error(ABORTED_OPERATION_MSG);
+                }
                 auto lft = kl->get_left();
                 auto kwc = kl->get_kwic();
                 auto rgt = kl->get_right();
@@ -584,8 +765,8 @@ KWICRowsRetval conc_examples_with_coll_phrase(
             for (int i2 = i; i2 < limit; i2++) {
                 lines[i2] = strdup("");
             }
+            delete kl;
             delete conc;
-            delete corp;
 
             KWICRowsRetval ans {
                 lines,
@@ -599,6 +780,7 @@ KWICRowsRetval conc_examples_with_coll_phrase(
             return ans;
 
         } catch (std::exception &e) {
+            delete conc;
             KWICRowsRetval ans {
                 nullptr,
                 nullptr,
@@ -660,8 +842,8 @@ PosInt int_vector_get_size(MVector v) {
 }
 
 CollsRetVal collocations(
-    const char* corpusPath,
-    const char* subcPath,
+    CorpusV corpus,
+    SubCorpusV subcorpus,
     const char* query,
     const char * attrName,
     char collFn,
@@ -670,38 +852,33 @@ CollsRetVal collocations(
     PosInt minbgr,
     int fromw,
     int tow,
-    int maxitems
+    int maxitems,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag
 ) {
     CollsRetVal ans;
     ans.err = nullptr;
-    string cPath(corpusPath);
-    Corpus* corp = nullptr;
+    Corpus* corp = (Corpus*)corpus;
     Concordance* conc = nullptr;
     CollocItems* collocs = nullptr;
-    SubCorpus* subc = nullptr;
 
     try {
-        corp = new Corpus(cPath);
-
-        if (subcPath && *subcPath != '\0') {
-            subc = new SubCorpus(corp, subcPath);
-            conc = new Concordance(subc, subc->filter_query(eval_cqpquery(query, subc)));
-
-        } else {
-            conc = new Concordance(corp, corp->filter_query(eval_cqpquery(query, corp)));
-        }
         ans.corpusSize = corp->size();
-        conc->sync();
+        conc = get_concordance(corp, (SubCorpus*)subcorpus, query, concFile, filters, sample, abortFlag);
         ans.concSize = conc->size();
         ans.searchSize = corp->size();
         ans.resultSize = 0;
         collocs = new CollocItems(conc, string(attrName), sortFunCode, minfreq, minbgr, fromw, tow, maxitems);
+        check_abort(abortFlag);
         CollItem* items = (CollItem*) malloc(maxitems * sizeof(CollItem));
         int i = 0;
         while (collocs->eos() == false && i < maxitems) {
             CollItem item;
             item.score = collocs->get_bgr(collFn);
             item.freq = collocs->get_cnt();
+            item.corpFreq = collocs->get_freq();
             item.word = strdup(collocs->get_item());
             items[i] = item;
             ans.resultSize++;
@@ -714,12 +891,141 @@ CollsRetVal collocations(
     }
     delete collocs;
     delete conc;
-    delete subc;
-    delete corp;
     return ans;
 }
 
 
+/**
+ * get_head returns a position of a token's head or -1
+ * if the token has no head.
+ */
+Position get_head(PosAttr* parent, Position pos) {
+    long offset = strtol(parent->pos2str(pos), nullptr, 10);
+    if (offset == 0) {
+        return -1;
+    }
+    return pos + offset;
+}
+
+bool has_deprel(PosAttr* deprel, const char* value, Position pos) {
+    return deprel == nullptr || strcmp(deprel->pos2str(pos), value) == 0;
+}
+
+CollsRetVal collocation_counts(
+    CorpusV corpus,
+    SubCorpusV subcorpus,
+    const char* query,
+    const char* attrName,
+    int fromw,
+    int tow,
+    CollCandidates candidates,
+    PosInt minCollFreq,
+    PosInt minCorpFreq,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag
+) {
+    CollsRetVal ans;
+    ans.err = nullptr;
+    ans.items = nullptr;
+    ans.resultSize = 0;
+    Corpus* corp = (Corpus*)corpus;
+    SubCorpus* subc = (SubCorpus*)subcorpus;
+    Concordance* conc = nullptr;
+
+    try {
+        ans.corpusSize = corp->size();
+        ans.searchSize = subc != nullptr ? subc->search_size() : corp->size();
+        conc = get_concordance(corp, subc, query, concFile, filters, sample, abortFlag);
+        ans.concSize = conc->size();
+
+        PosAttr* attr = conc->corp->get_attr(attrName);
+        Structure* strct = nullptr;
+        if (strlen(candidates.structName) > 0) {
+            strct = conc->corp->get_struct(candidates.structName);
+        }
+        PosAttr* parent = nullptr;
+        PosAttr* deprel = nullptr;
+        if (candidates.syntaxRel != COLL_SYNTAX_REL_NONE) {
+            parent = conc->corp->get_attr(candidates.parentAttr);
+            if (strlen(candidates.deprel) > 0) {
+                deprel = conc->corp->get_attr(candidates.deprelAttr);
+            }
+        }
+
+        map<int, PosInt> counts;
+        for (NumOfPos i = 0; i < conc->size(); i++) {
+            if (i % 10000 == 0) {
+                check_abort(abortFlag);
+            }
+            Position kwicBeg = conc->beg_at(i);
+            Position kwicEnd = conc->end_at(i);
+            Position rngBeg = kwicBeg + fromw;
+            Position rngEnd = kwicEnd - 1 + tow;
+            if (strct != nullptr) {
+                NumOfPos snum = strct->rng->num_at_pos(kwicBeg);
+                if (snum < 0) {
+                    continue;
+                }
+                rngBeg = max(rngBeg, strct->rng->beg_at(snum));
+                rngEnd = min(rngEnd, strct->rng->end_at(snum) - 1);
+            }
+            rngBeg = max(rngBeg, (Position)0);
+            rngEnd = min(rngEnd, (Position)corp->size() - 1);
+
+            if (candidates.syntaxRel == COLL_SYNTAX_REL_HEAD) {
+                for (Position k = kwicBeg; k < kwicEnd; k++) {
+                    Position head = get_head(parent, k);
+                    if (head >= rngBeg && head <= rngEnd && (head < kwicBeg || head >= kwicEnd)
+                            && has_deprel(deprel, candidates.deprel, k)) {
+                        counts[attr->pos2id(head)]++;
+                    }
+                }
+
+            } else {
+                for (Position p = rngBeg; p <= rngEnd; p++) {
+                    if (p >= kwicBeg && p < kwicEnd) {
+                        continue;
+                    }
+                    if (candidates.syntaxRel == COLL_SYNTAX_REL_DEPENDENT) {
+                        Position head = get_head(parent, p);
+                        if (head < kwicBeg || head >= kwicEnd || !has_deprel(deprel, candidates.deprel, p)) {
+                            continue;
+                        }
+                    }
+                    counts[attr->pos2id(p)]++;
+                }
+            }
+        }
+        check_abort(abortFlag);
+
+        CollItem* items = (CollItem*) malloc(max(counts.size(), (size_t)1) * sizeof(CollItem));
+        for (auto const& [id, cnt] : counts) {
+            if (cnt < minCollFreq) {
+                continue;
+            }
+            PosInt corpFreq = attr->freq(id);
+            if (corpFreq < minCorpFreq) {
+                continue;
+            }
+            CollItem item;
+            item.score = 0;
+            item.freq = cnt;
+            item.corpFreq = corpFreq;
+            item.word = strdup(attr->id2str(id));
+            items[ans.resultSize] = item;
+            ans.resultSize++;
+        }
+        ans.items = items;
+
+    } catch (std::exception &e) {
+        ans.err = strdup(e.what());
+    }
+    delete conc;
+    return ans;
+}
+
 CollItem get_coll_item(CollsRetVal data, int idx) {
     return ((CollItem*)data.items)[idx];
 }
@@ -734,19 +1040,18 @@ void coll_examples_free(CollsV items, int numItems) {
 
 
 AttrValSizes get_attr_values_sizes(
-    const char* corpus_path,
+    CorpusV corpus,
     const char* struct_name,
     const char* attr_name
 ) {
     AttrValSizes ans;
     ans.err = nullptr;
     ans.sizes = nullptr;
-    Corpus* corp = nullptr;
+    Corpus* corp = (Corpus*)corpus;
     Structure* strct = nullptr;
     PosAttr* attr = nullptr;
 
     try {
-        corp = new Corpus(corpus_path);
         strct = corp->get_struct(struct_name);
         attr = strct->get_attr(attr_name);
         map<PosInt, PosInt> normvals;
@@ -777,7 +1082,6 @@ AttrValSizes get_attr_values_sizes(
     } catch (std::exception &e) {
         ans.err = strdup(e.what());
     }
-    delete corp;
     return ans;
 }
 
@@ -815,43 +1119,647 @@ AttrVal get_next_attr_val_size(AttrValMap srcMap, AttrValMapIterator itr) {
     return ans;
 }
 
-CorpusSizeRetrval get_posattr_size(const char* corpus_path, const char* name) {
+CorpusSizeRetrval get_posattr_size(CorpusV corpus, const char* name) {
     CorpusSizeRetrval ans;
     ans.err = nullptr;
-    Corpus* corp = nullptr;
     try {
-        corp = new Corpus(corpus_path);
-        ans.value = corp->get_attr(name, false)->id_range();
+        ans.value = ((Corpus*)corpus)->get_attr(name, false)->id_range();
     } catch (std::exception &e) {
         ans.err = strdup(e.what());
     }
-    delete corp;
     return ans;
 }
 
-CorpusSizeRetrval get_struct_size(const char* corpus_path, const char* name) {
+CorpusSizeRetrval get_struct_size(CorpusV corpus, const char* name) {
     CorpusSizeRetrval ans;
     ans.err = nullptr;
-    Corpus* corp = nullptr;
     try {
-        corp = new Corpus(corpus_path);
-        ans.value = corp->get_struct(name)->size();
+        ans.value = ((Corpus*)corpus)->get_struct(name)->size();
+    } catch (std::exception &e) {
+        ans.err = strdup(e.what());
+    }
+    return ans;
+}
+
+CorpusSizeRetrval get_attr_value_freq(CorpusV corpus, const char* attrName, const char* value) {
+    CorpusSizeRetrval ans;
+    ans.err = nullptr;
+    ans.value = 0;
+    try {
+        PosAttr* attr = ((Corpus*)corpus)->get_attr(attrName, false);
+        int id = attr->str2id(value);
+        if (id >= 0) {
+            ans.value = attr->freq(id);
+        }
     } catch (std::exception &e) {
         ans.err = strdup(e.what());
     }
-    delete corp;
     return ans;
 }
 
 
-StructAttrValuesRetval get_struct_attr_values(const char* corpusPath, PosInt limit) {
+/**
+ * WordlistCandidate is an item of a word list with its value
+ * still encoded as attribute IDs (the values are resolved only
+ * for the returned items).
+ */
+struct WordlistCandidate {
+    vector<int> ids;
+    PosInt freq;
+    PosInt docf;
+    double arf;
+};
+
+struct NgramHash {
+    size_t operator()(const vector<int>& ids) const {
+        size_t h = ids.size();
+        for (int id : ids) {
+            h ^= std::hash<int>()(id) + 0x9e3779b9 + (h << 6) + (h >> 2);
+        }
+        return h;
+    }
+};
+
+/**
+ * @brief Find attribute values matching a regular expression.
+ * The returned vector is indexed by value IDs.
+ */
+vector<bool> find_matching_ids(PosAttr* attr, const char* pattern, int ignoreCase) {
+    vector<bool> ans(attr->id_range(), false);
+    unique_ptr<FastStream> ids(attr->regexp2ids(pattern, ignoreCase != 0));
+    while (ids->peek() < ids->final()) {
+        ans[ids->next()] = true;
+    }
+    return ans;
+}
+
+/**
+ * @brief Call `fn(beg, end)` for each segment of consecutive positions
+ * matched by the query (overlapping and adjacent matches are joined).
+ * For an empty query, the segments cover the whole (sub)corpus.
+ */
+template<typename F>
+void for_each_segment(Corpus* corp, SubCorpus* subc, const char* query, AbortFlag abortFlag, F fn) {
+    if (subc == nullptr && strlen(query) == 0) {
+        fn(0, corp->size());
+        return;
+    }
+    Corpus* src = subc != nullptr ? (Corpus*)subc : corp;
+    unique_ptr<RangeStream> rs(src->filter_query(eval_cqpquery(strlen(query) > 0 ? query : "[]", src)));
+    Position segBeg = -1;
+    Position segEnd = -1;
+    for (NumOfPos i = 0; !rs->end(); i++) {
+        if (i % 1000000 == 0) {
+            check_abort(abortFlag);
+        }
+        Position beg = rs->peek_beg();
+        Position end = rs->peek_end();
+        if (beg <= segEnd) {
+            segEnd = max(segEnd, end);
+
+        } else {
+            if (segBeg >= 0) {
+                fn(segBeg, segEnd);
+            }
+            segBeg = beg;
+            segEnd = end;
+        }
+        rs->next();
+    }
+    if (segBeg >= 0) {
+        fn(segBeg, segEnd);
+    }
+}
+
+/**
+ * @brief Remove the least frequent n-grams until there are at most
+ * half of WORDLIST_MAX_NGRAMS of them. The pruning threshold
+ * is increased with each pass and it is kept for next calls.
+ */
+void prune_ngrams(unordered_map<vector<int>, PosInt, NgramHash>& counts, PosInt& pruneFreq) {
+    while (counts.size() > WORDLIST_MAX_NGRAMS / 2) {
+        pruneFreq++;
+        for (auto it = counts.begin(); it != counts.end();) {
+            if (it->second <= pruneFreq) {
+                it = counts.erase(it);
+
+            } else {
+                ++it;
+            }
+        }
+    }
+}
+
+WordlistRetval wordlist(
+    CorpusV corpus,
+    SubCorpusV subcorpus,
+    const char* query,
+    const char* attrName,
+    const char* pattern,
+    int ignoreCase,
+    const char* values,
+    int ngramSize,
+    PosInt minFreq,
+    PosInt maxFreq,
+    int sortBy,
+    PosInt offset,
+    PosInt limit,
+    AbortFlag abortFlag
+) {
+    WordlistRetval ans;
+    ans.err = nullptr;
+    ans.items = nullptr;
+    ans.size = 0;
+    ans.total = 0;
+    ans.searchSize = 0;
+    ans.isApproximate = 0;
+    Corpus* corp = (Corpus*)corpus;
+    SubCorpus* subc = (SubCorpus*)subcorpus;
+
+    try {
+        PosAttr* attr = corp->get_attr(attrName);
+        bool fromLexicon = ngramSize == 1 && subc == nullptr && strlen(query) == 0;
+        if (sortBy != WORDLIST_SORT_FREQ && !fromLexicon) {
+            throw std::invalid_argument(
+                "sorting by docf or arf is available only for word lists of whole corpora");
+        }
+        vector<bool> matching;
+        if (strlen(pattern) > 0) {
+            matching = find_matching_ids(attr, pattern, ignoreCase);
+        }
+        if (strlen(values) > 0) {
+            if (ngramSize > 1) {
+                throw std::invalid_argument("values can be specified only for word lists");
+            }
+            vector<bool> selected(attr->id_range(), false);
+            std::istringstream valuesStream(values);
+            string value;
+            while (getline(valuesStream, value)) {
+                int id = attr->str2id(value.c_str());
+                if (id >= 0 && (matching.empty() || matching[id])) {
+                    selected[id] = true;
+                }
+            }
+            matching = std::move(selected);
+        }
+        auto isMatching = [&matching](int id) {
+            return matching.empty() || matching[id];
+        };
+        auto isInFreqRange = [minFreq, maxFreq](PosInt freq) {
+            return freq >= minFreq && (maxFreq <= 0 || freq <= maxFreq);
+        };
+
+        vector<WordlistCandidate> candidates;
+        if (fromLexicon) {
+            ans.searchSize = corp->size();
+            int idRange = attr->id_range();
+            for (int id = 0; id < idRange; id++) {
+                if (id % 1000000 == 0) {
+                    check_abort(abortFlag);
+                }
+                PosInt freq = attr->freq(id);
+                if (!isMatching(id) || !isInFreqRange(freq)) {
+                    continue;
+                }
+                WordlistCandidate item;
+                item.ids.push_back(id);
+                item.freq = freq;
+                item.docf = sortBy == WORDLIST_SORT_DOCF ? attr->docf(id) : -1;
+                item.arf = sortBy == WORDLIST_SORT_ARF ? attr->arf(id) : -1;
+                candidates.push_back(item);
+            }
+
+        } else if (ngramSize == 1) {
+            vector<PosInt> counts(attr->id_range(), 0);
+            for_each_segment(corp, subc, query, abortFlag, [&](Position beg, Position end) {
+                unique_ptr<IDIterator> it(attr->posat(beg));
+                for (Position p = beg; p < end; p++) {
+                    counts[it->next()]++;
+                }
+                ans.searchSize += end - beg;
+                check_abort(abortFlag);
+            });
+            for (int id = 0; id < (int)counts.size(); id++) {
+                if (counts[id] == 0 || !isMatching(id) || !isInFreqRange(counts[id])) {
+                    continue;
+                }
+                WordlistCandidate item;
+                item.ids.push_back(id);
+                item.freq = counts[id];
+                item.docf = -1;
+                item.arf = -1;
+                candidates.push_back(item);
+            }
+
+        } else {
+            unordered_map<vector<int>, PosInt, NgramHash> counts;
+            PosInt pruneFreq = 0;
+            vector<int> window(ngramSize);
+            for_each_segment(corp, subc, query, abortFlag, [&](Position beg, Position end) {
+                unique_ptr<IDIterator> it(attr->posat(beg));
+                for (Position p = beg; p < end; p++) {
+                    if ((p - beg) % 1000000 == 0) {
+                        check_abort(abortFlag);
+                    }
+                    window[(p - beg) % ngramSize] = it->next();
+                    if (p - beg + 1 < ngramSize) {
+                        continue;
+                    }
+                    vector<int> ngram(ngramSize);
+                    bool hasMatching = false;
+                    for (int i = 0; i < ngramSize; i++) {
+                        ngram[i] = window[(p - beg + 1 + i) % ngramSize];
+                        hasMatching = hasMatching || isMatching(ngram[i]);
+                    }
+                    if (hasMatching) {
+                        counts[ngram]++;
+                        if (counts.size() > WORDLIST_MAX_NGRAMS) {
+                            prune_ngrams(counts, pruneFreq);
+                            ans.isApproximate = 1;
+                        }
+                    }
+                }
+                ans.searchSize += end - beg;
+            });
+            for (auto const& [ngram, freq] : counts) {
+                if (!isInFreqRange(freq)) {
+                    continue;
+                }
+                WordlistCandidate item;
+                item.ids = ngram;
+                item.freq = freq;
+                item.docf = -1;
+                item.arf = -1;
+                candidates.push_back(item);
+            }
+        }
+        check_abort(abortFlag);
+
+        auto sortValue = [sortBy](const WordlistCandidate& item) -> double {
+            switch (sortBy) {
+                case WORDLIST_SORT_DOCF:
+                    return item.docf;
+                case WORDLIST_SORT_ARF:
+                    return item.arf;
+                default:
+                    return item.freq;
+            }
+        };
+        ans.total = candidates.size();
+        PosInt pageEnd = min((PosInt)candidates.size(), offset + limit);
+        offset = min(offset, pageEnd);
+        // only the requested page (and everything before it) must be sorted
+        partial_sort(
+            candidates.begin(),
+            candidates.begin() + pageEnd,
+            candidates.end(),
+            [&sortValue](const WordlistCandidate& a, const WordlistCandidate& b) {
+                double va = sortValue(a);
+                double vb = sortValue(b);
+                if (va != vb) {
+                    return va > vb;
+                }
+                return a.ids < b.ids;
+            }
+        );
+        WordlistItem* items = (WordlistItem*)malloc(max(pageEnd - offset, (PosInt)1) * sizeof(WordlistItem));
+        for (PosInt i = offset; i < pageEnd; i++) {
+            WordlistCandidate& cand = candidates[i];
+            string value;
+            for (size_t j = 0; j < cand.ids.size(); j++) {
+                if (j > 0) {
+                    value += " ";
+                }
+                value += attr->id2str(cand.ids[j]);
+            }
+            WordlistItem item;
+            item.value = strdup(value.c_str());
+            item.freq = cand.freq;
+            item.docf = cand.docf;
+            item.arf = cand.arf;
+            items[ans.size] = item;
+            ans.size++;
+        }
+        ans.items = items;
+
+    } catch (std::exception &e) {
+        ans.err = strdup(e.what());
+    }
+    return ans;
+}
+
+WordlistItem get_wordlist_item(WordlistRetval data, int idx) {
+    return ((WordlistItem*)data.items)[idx];
+}
+
+void wordlist_free(WordlistItemsV items, int numItems) {
+    WordlistItem* tItems = (WordlistItem*)items;
+    for (int i = 0; i < numItems; i++) {
+        free(tItems[i].value);
+    }
+    free(tItems);
+}
+
+/**
+ * @brief Add sizes of structures (i.e. of their parts within [beg, end))
+ * to `sizes` indexed by structure numbers.
+ */
+void add_struct_sizes(Structure* strct, Position beg, Position end, map<NumOfPos, PosInt>& sizes) {
+    Position p = beg;
+    while (p < end) {
+        NumOfPos n = strct->rng->num_at_pos(p);
+        if (n < 0) {
+            n = strct->rng->num_next_pos(p);
+            if (n < 0 || n >= strct->size() || strct->rng->beg_at(n) <= p) {
+                break;
+            }
+            p = strct->rng->beg_at(n);
+            continue;
+        }
+        Position strctEnd = min(end, strct->rng->end_at(n));
+        sizes[n] += strctEnd - p;
+        p = strctEnd;
+    }
+}
+
+DispersionRetval dispersion(
+    CorpusV corpus,
+    SubCorpusV subcorpus,
+    const char* query,
+    const char* docStruct,
+    const char* textTypeAttr,
+    ConcFile concFile,
+    AbortFlag abortFlag
+) {
+    DispersionRetval ans;
+    ans.err = nullptr;
+    ans.concSize = 0;
+    ans.corpusSize = 0;
+    ans.arf = 0.0;
+    ans.numDocs = 0;
+    ans.docsSize = 0;
+    ans.minDocSize = 0;
+    ans.hitDocs = nullptr;
+    ans.numHitDocs = 0;
+    ans.textTypes = nullptr;
+    ans.numTextTypes = 0;
+    Corpus* corp = (Corpus*)corpus;
+    SubCorpus* subc = (SubCorpus*)subcorpus;
+    Concordance* conc = nullptr;
+
+    try {
+        ans.corpusSize = corp->size();
+        string docStructName(docStruct);
+        if (docStructName.empty()) {
+            docStructName = corp->get_conf("DOCSTRUCTURE");
+        }
+        Structure* docs = corp->get_struct(docStructName);
+        Structure* ttStruct = nullptr;
+        PosAttr* ttAttr = nullptr;
+        if (strlen(textTypeAttr) > 0) {
+            string tmp(textTypeAttr);
+            size_t dotPos = tmp.find('.');
+            if (dotPos == string::npos) {
+                throw std::invalid_argument("invalid text type attribute " + tmp);
+            }
+            ttStruct = corp->get_struct(tmp.substr(0, dotPos));
+            ttAttr = ttStruct->get_attr(tmp.substr(dotPos + 1));
+        }
+
+        map<NumOfPos, PosInt> docSizes;
+        map<NumOfPos, PosInt> ttStructSizes;
+        for_each_segment(corp, subc, "", abortFlag, [&](Position beg, Position end) {
+            add_struct_sizes(docs, beg, end, docSizes);
+            if (ttStruct != nullptr) {
+                add_struct_sizes(ttStruct, beg, end, ttStructSizes);
+            }
+        });
+        check_abort(abortFlag);
+
+        ConcFilters noFilters = {nullptr, 0};
+        ConcSample noSample = {0, 0};
+        conc = get_concordance(corp, subc, query, concFile, noFilters, noSample, abortFlag);
+        ans.concSize = conc->size();
+        ans.arf = conc->compute_ARF();
+
+        map<NumOfPos, PosInt> docHits;
+        map<int, PosInt> ttHits;
+        for (NumOfPos i = 0; i < conc->size(); i++) {
+            if (i % 100000 == 0) {
+                check_abort(abortFlag);
+            }
+            Position pos = conc->beg_at(i);
+            NumOfPos docNum = docs->rng->num_at_pos(pos);
+            if (docNum >= 0) {
+                docHits[docNum]++;
+            }
+            if (ttStruct != nullptr) {
+                NumOfPos ttNum = ttStruct->rng->num_at_pos(pos);
+                if (ttNum >= 0) {
+                    ttHits[ttAttr->pos2id(ttNum)]++;
+                }
+            }
+        }
+
+        for (auto const& [docNum, size] : docSizes) {
+            if (size == 0) {
+                continue;
+            }
+            ans.numDocs++;
+            ans.docsSize += size;
+            if (ans.minDocSize == 0 || size < ans.minDocSize) {
+                ans.minDocSize = size;
+            }
+        }
+        DispersionDoc* hitDocs = (DispersionDoc*)malloc(max(docHits.size(), (size_t)1) * sizeof(DispersionDoc));
+        for (auto const& [docNum, freq] : docHits) {
+            DispersionDoc item;
+            item.freq = freq;
+            item.size = docSizes[docNum];
+            hitDocs[ans.numHitDocs] = item;
+            ans.numHitDocs++;
+        }
+        ans.hitDocs = hitDocs;
+
+        if (ttStruct != nullptr) {
+            map<int, PosInt> ttSizes;
+            for (auto const& [ttNum, size] : ttStructSizes) {
+                ttSizes[ttAttr->pos2id(ttNum)] += size;
+            }
+            DispersionTextType* textTypes = (DispersionTextType*)malloc(
+                max(ttSizes.size(), (size_t)1) * sizeof(DispersionTextType));
+            for (auto const& [valueID, size] : ttSizes) {
+                DispersionTextType item;
+                item.value = strdup(ttAttr->id2str(valueID));
+                item.freq = ttHits[valueID];
+                item.size = size;
+                textTypes[ans.numTextTypes] = item;
+                ans.numTextTypes++;
+            }
+            ans.textTypes = textTypes;
+        }
+
+    } catch (std::exception &e) {
+        ans.err = strdup(e.what());
+    }
+    delete conc;
+    return ans;
+}
+
+DispersionDoc get_dispersion_doc(DispersionRetval data, int idx) {
+    return ((DispersionDoc*)data.hitDocs)[idx];
+}
+
+DispersionTextType get_dispersion_text_type(DispersionRetval data, int idx) {
+    return ((DispersionTextType*)data.textTypes)[idx];
+}
+
+void dispersion_free(DispersionRetval data) {
+    free(data.hitDocs);
+    DispersionTextType* textTypes = (DispersionTextType*)data.textTypes;
+    for (int i = 0; i < data.numTextTypes; i++) {
+        free(textTypes[i].value);
+    }
+    free(textTypes);
+}
+
+SplitBoundsRetval aligned_split_bounds(CorpusV corpus, const char* structName, PosInt chunkSize) {
+    SplitBoundsRetval ans;
+    ans.err = nullptr;
+    ans.bounds = nullptr;
+    ans.numBounds = 0;
+    try {
+        if (chunkSize <= 0) {
+            throw std::invalid_argument("chunk size must be a positive number");
+        }
+        Corpus* corp = (Corpus*)corpus;
+        Structure* strct = corp->get_struct(structName);
+        Position size = corp->size();
+        PosInt numChunks = max((PosInt)1, (size + chunkSize - 1) / chunkSize);
+        vector<Position> bounds;
+        bounds.push_back(0);
+        for (PosInt i = 1; i < numChunks; i++) {
+            // the remaining part is divided evenly so a structure
+            // moving a cut does not affect sizes of next chunks
+            Position last = bounds.back();
+            Position target = last + (Position)((double)(size - last) / (numChunks - i + 1));
+            Position cut = target;
+            NumOfPos n = strct->rng->num_at_pos(target);
+            if (n >= 0) {
+                Position beg = strct->rng->beg_at(n);
+                Position end = strct->rng->end_at(n);
+                if (target - beg <= end - target && beg > bounds.back()) {
+                    cut = beg;
+
+                } else {
+                    cut = end;
+                }
+            }
+            if (cut > bounds.back() && cut < size) {
+                bounds.push_back(cut);
+            }
+        }
+        bounds.push_back(size);
+        ans.bounds = (PosInt*)malloc(bounds.size() * sizeof(PosInt));
+        for (size_t i = 0; i < bounds.size(); i++) {
+            ans.bounds[i] = bounds[i];
+        }
+        ans.numBounds = bounds.size();
+
+    } catch (std::exception &e) {
+        ans.err = strdup(e.what());
+    }
+    return ans;
+}
+
+PosInt get_split_bound(SplitBoundsRetval data, int idx) {
+    return data.bounds[idx];
+}
+
+void split_bounds_free(SplitBoundsRetval data) {
+    free(data.bounds);
+}
+
+QueryRangesRetval query_ranges(CorpusV corpus, const char* query, PosInt maxHits, AbortFlag abortFlag) {
+    QueryRangesRetval ans;
+    ans.err = nullptr;
+    ans.ranges = nullptr;
+    ans.numRanges = 0;
+    ans.size = 0;
+    ans.tooManyHits = 0;
+    Concordance* conc = nullptr;
+    try {
+        // the concordance is watched while being calculated so
+        // queries matching too many items are stopped early
+        conc = new_concordance((Corpus*)corpus, nullptr, query);
+        while (!conc->finished()) {
+            check_abort(abortFlag);
+            if (conc->size() > maxHits) {
+                ans.tooManyHits = 1;
+                delete conc;
+                return ans;
+            }
+            usleep(ABORT_CHECK_INTERVAL_US);
+        }
+        conc->sync();
+        if (conc->size() > maxHits) {
+            ans.tooManyHits = 1;
+            delete conc;
+            return ans;
+        }
+        vector<PosRange> hits;
+        hits.reserve(conc->size());
+        for (NumOfPos i = 0; i < conc->size(); i++) {
+            if (i % 100000 == 0) {
+                check_abort(abortFlag);
+            }
+            PosRange item;
+            item.from = conc->beg_at(i);
+            item.to = conc->end_at(i);
+            hits.push_back(item);
+        }
+        std::sort(hits.begin(), hits.end(), [](const PosRange& a, const PosRange& b) {
+            return a.from < b.from;
+        });
+        vector<PosRange> merged;
+        for (auto const& hit : hits) {
+            if (!merged.empty() && hit.from <= merged.back().to) {
+                merged.back().to = max(merged.back().to, hit.to);
+
+            } else {
+                merged.push_back(hit);
+            }
+        }
+        PosRange* ranges = (PosRange*)malloc(max(merged.size(), (size_t)1) * sizeof(PosRange));
+        for (auto const& rng : merged) {
+            ranges[ans.numRanges] = rng;
+            ans.numRanges++;
+            ans.size += rng.to - rng.from;
+        }
+        ans.ranges = ranges;
+
+    } catch (std::exception &e) {
+        ans.err = strdup(e.what());
+    }
+    delete conc;
+    return ans;
+}
+
+PosRange get_query_range(QueryRangesRetval data, PosInt idx) {
+    return ((PosRange*)data.ranges)[idx];
+}
+
+void query_ranges_free(QueryRangesRetval data) {
+    free(data.ranges);
+}
+
+StructAttrValuesRetval get_struct_attr_values(CorpusV corpus, PosInt limit) {
     StructAttrValuesRetval ans;
     ans.err = nullptr;
     ans.items = nullptr;
     ans.size = 0;
-    Corpus* corp = nullptr;
+    Corpus* corp = (Corpus*)corpus;
     try {
-        corp = new Corpus(corpusPath);
         vector<StructAttrValue> collected;
 
         // SUBCORPATTRS entries are conventionally comma-separated, but some
@@ -900,7 +1808,6 @@ StructAttrValuesRetval get_struct_attr_values(const char* corpusPath, PosInt lim
     } catch (std::exception &e) {
         ans.err = strdup(e.what());
     }
-    delete corp;
     return ans;
 }
 
@@ -922,7 +1829,7 @@ void delete_struct_attr_values(StructAttrValuesV items, int numItems) {
 
 
 CorpRegionRetval get_corp_region(
-    const char* corpusPath,
+    CorpusV corpus,
     PosInt fromPos,
     PosInt toPos,
     const char* attrs,
@@ -930,10 +1837,8 @@ CorpRegionRetval get_corp_region(
 ) {
     CorpRegionRetval ans;
     ans.err = nullptr;
-    Corpus* corp = nullptr;
-    string cPath(corpusPath);
+    Corpus* corp = (Corpus*)corpus;
     try {
-        corp = new Corpus(cPath);
         CorpRegion* region = new CorpRegion(corp, attrs, structs);
         const std::vector<std::string>& xreg = region->region(fromPos, toPos, ' ', '\x1F');
 
@@ -951,7 +1856,6 @@ CorpRegionRetval get_corp_region(
     } catch (std::exception &e) {
         ans.err = strdup(e.what());
     }
-    delete corp;
     return ans;
 }
 
@@ -959,3 +1863,140 @@ CorpRegionRetval get_corp_region(
 void free_string(char* str) {
     free(str);
 }
+
+// ---------------------------- precompiled word sketches
+
+/**
+ * collect_ws_level appends items of the current WMap level
+ * (sorted by score) with freq >= minFreq to `items`.
+ * Words are resolved via the positional attribute.
+ */
+static int collect_ws_level(
+    WMap* level,
+    PosAttr* attr,
+    const char* relation,
+    PosInt relationFreq,
+    PosInt minFreq,
+    int maxItems,
+    vector<WSItem>& items
+) {
+    int num = 0;
+    for (; !level->end() && num < maxItems; level->next()) {
+        if (level->getcnt() < minFreq) {
+            continue;
+        }
+        WSItem item;
+        item.relation = relation != nullptr ? strdup(relation) : nullptr;
+        item.relationFreq = relationFreq;
+        item.word = strdup(attr->id2str(level->getid()));
+        item.freq = level->getcnt();
+        item.score = level->getrnk();
+        items.push_back(item);
+        num++;
+    }
+    return num;
+}
+
+static WSRetval ws_items_retval(vector<WSItem>& items, PosInt headwordFreq) {
+    WSRetval ans;
+    ans.err = nullptr;
+    ans.headwordFreq = headwordFreq;
+    ans.size = items.size();
+    ans.items = (WSItem*)malloc(max(items.size(), (size_t)1) * sizeof(WSItem));
+    copy(items.begin(), items.end(), ans.items);
+    return ans;
+}
+
+WSRetval precompiled_word_sketch(
+    CorpusV corpus,
+    const char* wsBase,
+    const char* attrName,
+    const char* headword,
+    PosInt minFreq,
+    int maxItems
+) {
+    WSRetval ans;
+    ans.err = nullptr;
+    ans.items = nullptr;
+    ans.size = 0;
+    ans.headwordFreq = 0;
+    vector<WSItem> items;
+    try {
+        PosAttr* attr = ((Corpus*)corpus)->get_attr(attrName);
+        int id = attr->str2id(headword);
+        if (id < 0) {
+            return ans;
+        }
+        // level 0 = headwords, level 1 = relations (names are stored
+        // in the word sketch lexicon), level 2 = collocates
+        unique_ptr<WMap> ws(new_WMap(wsBase));
+        unique_ptr<lexicon> relations(new_lexicon(wsBase));
+        if (!ws->findid(id)) {
+            return ws_items_retval(items, attr->freq(id));
+        }
+        unique_ptr<WMap> rels(ws->nextlevel());
+        for (; !rels->end(); rels->next()) {
+            unique_ptr<WMap> colls(rels->nextlevel());
+            collect_ws_level(
+                colls.get(), attr, relations->id2str(rels->getid()), rels->getcnt(),
+                minFreq, maxItems, items);
+        }
+        ans = ws_items_retval(items, attr->freq(id));
+
+    } catch (std::exception &e) {
+        for (auto& item : items) {
+            free(item.relation);
+            free(item.word);
+        }
+        ans.err = strdup(e.what());
+    }
+    return ans;
+}
+
+WSRetval precompiled_thesaurus(
+    CorpusV corpus,
+    const char* wsThes,
+    const char* attrName,
+    const char* headword,
+    int maxItems
+) {
+    WSRetval ans;
+    ans.err = nullptr;
+    ans.items = nullptr;
+    ans.size = 0;
+    ans.headwordFreq = 0;
+    vector<WSItem> items;
+    try {
+        PosAttr* attr = ((Corpus*)corpus)->get_attr(attrName);
+        int id = attr->str2id(headword);
+        if (id < 0) {
+            return ans;
+        }
+        // level 0 = headwords, level 1 = similar words
+        unique_ptr<WMap> thes(new_WMap(wsThes));
+        if (thes->findid(id)) {
+            unique_ptr<WMap> similar(thes->nextlevel());
+            collect_ws_level(similar.get(), attr, nullptr, 0, 0, maxItems, items);
+        }
+        ans = ws_items_retval(items, attr->freq(id));
+
+    } catch (std::exception &e) {
+        for (auto& item : items) {
+            free(item.word);
+        }
+        ans.err = strdup(e.what());
+    }
+    return ans;
+}
+
+WSItem get_ws_item(WSRetval data, int idx) {
+    return data.items[idx];
+}
+
+void free_ws_items(WSRetval data) {
+    for (int i = 0; i < data.size; i++) {
+        free(data.items[i].relation);
+        free(data.items[i].word);
+    }
+    free(data.items);
+}
@@ -39,14 +39,225 @@ import (
 
 var (
 	ErrRowsRangeOutOfConc = errors.New("rows range is out of concordance size")
+	ErrTooManyQueryHits   = errors.New("the query matches too many items")
 )
 
+// ConcFile specifies a file used to store a calculated
+// concordance so it can be reused by subsequent queries.
+// The zero value means no file is involved.
+type ConcFile struct {
+
+	// LoadPath is a path of a previously saved concordance.
+	// If set, the concordance is loaded instead of evaluating
+	// the query.
+	LoadPath string
+
+	// SavePath is a path where an evaluated concordance
+	// should be saved.
+	SavePath string
+}
+
+func (cf ConcFile) cValue() (C.ConcFile, func()) {
+	ans := C.ConcFile{
+		loadPath: C.CString(cf.LoadPath),
+		savePath: C.CString(cf.SavePath),
+	}
+	return ans, func() {
+		C.free(unsafe.Pointer(ans.loadPath))
+		C.free(unsafe.Pointer(ans.savePath))
+	}
+}
+
+// ConcFilter specifies a filter applied to concordance lines.
+// A line is kept in case the filter query matches (Positive)
+// or does not match (!Positive) within the range given by LftCtx
+// and RgtCtx (negative values are on the left side of the KWIC).
+type ConcFilter struct {
+	Query    string
+	Positive bool
+	LftCtx   int
+	RgtCtx   int
+
+	// AnchorLast specifies that the range is relative to the last
+	// token of the KWIC (by default, the first token is used)
+	AnchorLast bool
+
+	ExcludeKWIC bool
+}
+
+func (cf ConcFilter) ctx(pos int) string {
+	if cf.AnchorLast {
+		return fmt.Sprintf("%d>0", pos)
+	}
+	return fmt.Sprintf("%d<0", pos)
+}
+
+// filtersCValue converts filters to their C representation.
+// The returned function must be called to release the C memory.
+func filtersCValue(filters []ConcFilter) (C.ConcFilters, func()) {
+	var ans C.ConcFilters
+	if len(filters) == 0 {
+		return ans, func() {}
+	}
+	items := (*C.ConcFilter)(C.malloc(C.size_t(len(filters)) * C.size_t(unsafe.Sizeof(C.ConcFilter{}))))
+	cItems := unsafe.Slice(items, len(filters))
+	for i, f := range filters {
+		cItems[i] = C.ConcFilter{
+			query: C.CString(f.Query + ";"),
+			lctx:  C.CString(f.ctx(f.LftCtx)),
+			rctx:  C.CString(f.ctx(f.RgtCtx)),
+		}
+		if f.Positive {
+			cItems[i].positive = 1
+		}
+		if f.ExcludeKWIC {
+			cItems[i].excludeKwic = 1
+		}
+	}
+	ans.items = items
+	ans.size = C.int(len(filters))
+	return ans, func() {
+		for _, item := range cItems {
+			C.free(unsafe.Pointer(item.query))
+			C.free(unsafe.Pointer(item.lctx))
+			C.free(unsafe.Pointer(item.rctx))
+		}
+		C.free(unsafe.Pointer(items))
+	}
+}
+
+// ConcSample specifies a random reduction of a concordance
+// to (at most) Size lines. For the same Seed, the same lines
+// are always selected. The zero Size means no reduction.
+type ConcSample struct {
+	Size int
+	Seed uint64
+}
+
+func (cs ConcSample) cValue() C.ConcSample {
+	return C.ConcSample{
+		size: C.longlong(cs.Size),
+		seed: C.ulonglong(cs.Seed),
+	}
+}
+
+// ConcSort specifies sorting of concordance lines.
+// The zero value means no sorting.
+type ConcSort struct {
+
+	// Attr is a positional attribute the lines are sorted by
+	Attr string
+
+	// Pos specifies tokens (relative to the KWIC) used for
+	// sorting in the Manatee format (e.g. `-1<0` for the first
+	// token on the left, `0<0~0>0` for the KWIC, `1>0` for the first
+	// token on the right)
+	Pos string
+
+	Descending bool
+
+	IgnoreCase bool
+}
+
+// crit returns a Manatee sorting criterion
+func (cs ConcSort) crit() string {
+	if cs.Attr == "" {
+		return ""
+	}
+	if cs.IgnoreCase {
+		return fmt.Sprintf("%s/i %s", cs.Attr, cs.Pos)
+	}
+	return fmt.Sprintf("%s %s", cs.Attr, cs.Pos)
+}
+
+// CollSyntaxRel specifies a syntactic relation between
+// the KWIC and collocation candidates
+type CollSyntaxRel int
+
+const (
+	CollSyntaxRelNone      CollSyntaxRel = C.COLL_SYNTAX_REL_NONE
+	CollSyntaxRelDependent CollSyntaxRel = C.COLL_SYNTAX_REL_DEPENDENT
+	CollSyntaxRelHead      CollSyntaxRel = C.COLL_SYNTAX_REL_HEAD
+)
+
+// CollCandidates specifies how collocation candidates are searched
+// in addition to the positional range. The zero value means
+// no additional restriction.
+type CollCandidates struct {
+
+	// Struct limits candidates to the structure (e.g. a sentence)
+	// containing the KWIC
+	Struct string
+
+	SyntaxRel CollSyntaxRel
+
+	// ParentAttr is a positional attribute containing a relative
+	// position of a token's head
+	ParentAttr string
+
+	DeprelAttr string
+
+	// Deprel limits the syntactic relation to a specific
+	// dependency relation type (e.g. `amod`)
+	Deprel string
+}
+
+func (cc CollCandidates) cValue() (C.CollCandidates, func()) {
+	ans := C.CollCandidates{
+		structName: C.CString(cc.Struct),
+		syntaxRel:  C.int(cc.SyntaxRel),
+		parentAttr: C.CString(cc.ParentAttr),
+		deprelAttr: C.CString(cc.DeprelAttr),
+		deprel:     C.CString(cc.Deprel),
+	}
+	return ans, func() {
+		C.free(unsafe.Pointer(ans.structName))
+		C.free(unsafe.Pointer(ans.parentAttr))
+		C.free(unsafe.Pointer(ans.deprelAttr))
+		C.free(unsafe.Pointer(ans.deprel))
+	}
+}
+
+// WordlistSortBy specifies a (descending) order of a word list
+type WordlistSortBy int
+
+const (
+	WordlistSortFreq WordlistSortBy = C.WORDLIST_SORT_FREQ
+	WordlistSortDocf WordlistSortBy = C.WORDLIST_SORT_DOCF
+	WordlistSortARF  WordlistSortBy = C.WORDLIST_SORT_ARF
+)
+
+// WordlistFilter specifies which items of a word list are returned.
+// The zero value means no restriction.
+type WordlistFilter struct {
+
+	// Pattern is a regular expression values must match
+	// (for n-grams, at least one of the tokens must match)
+	Pattern string
+
+	IgnoreCase bool
+
+	MinFreq int64
+
+	// MaxFreq is the maximum frequency (0 means no limit)
+	MaxFreq int64
+
+	// Values restricts a word list to the values (n-grams are not
+	// supported). An empty list means no restriction.
+	Values []string
+}
+
 type GoVector struct {
 	v C.MVector
 }
 
 type Freqs struct {
-	Words      []string
+	Words []string
+
+	// Levels contains values of individual levels of the words
+	// (in case of a multi-level criterion, Manatee separates
+	// them by tabs which are not preserved in Words)
+	Levels     [][]string
 	Freqs      []int64
 	Norms      []int64
 	ConcSize   int64
@@ -79,6 +290,67 @@ type GoCollItem struct {
 	Word  string  `json:"word"`
 	Score float64 `json:"score"`
 	Freq  int64   `json:"freq"`
+
+	// CorpFreq is a frequency of the collocate in the searched
+	// (sub)corpus
+	CorpFreq int64 `json:"corpFreq"`
+}
+
+type GoDispersionDoc struct {
+	Freq int64 `json:"freq"`
+
+	// Size is a number of document tokens within
+	// the searched (sub)corpus
+	Size int64 `json:"size"`
+}
+
+type GoDispersionTextType struct {
+	Value string `json:"value"`
+	Freq  int64  `json:"freq"`
+	Size  int64  `json:"size"`
+}
+
+// GoDispersion contains raw data needed for calculating
+// dispersion measures of a searched term. Only documents
+// containing the term are listed (in HitDocs).
+type GoDispersion struct {
+	ConcSize   int64
+	CorpusSize int64
+	ARF        float64
+	NumDocs    int64
+	DocsSize   int64
+	MinDocSize int64
+	HitDocs    []GoDispersionDoc
+	TextTypes  []GoDispersionTextType
+}
+
+type GoWordlistItem struct {
+	Word string `json:"word"`
+	Freq int64  `json:"freq"`
+
+	// Docf is a number of documents containing the word
+	// (available only when sorting by the value)
+	Docf int64 `json:"docf,omitempty"`
+
+	// ARF is an average reduced frequency of the word
+	// (available only when sorting by the value)
+	ARF float64 `json:"arf,omitempty"`
+}
+
+type GoWordlist struct {
+	Items []*GoWordlistItem
+
+	// Total is the number of all the items matching
+	// the filter (i.e. not only the returned page)
+	Total int64
+
+	// SearchSize is the number of tokens the list
+	// is calculated from
+	SearchSize int64
+
+	// IsApproximate is true in case n-grams had to be pruned
+	// and some frequencies may be underestimated
+	IsApproximate bool
 }
 
 type GoColls struct {
@@ -88,8 +360,9 @@ type GoColls struct {
 	SubcSize   int64
 }
 
-func GetCorpusSize(corpusPath string) (int64, error) {
-	ans := C.get_corpus_size(C.CString(corpusPath))
+// Size returns the number of positions in the corpus
+func (c *Corpus) Size() (int64, error) {
+	ans := C.get_corpus_size(c.corp)
 	if ans.err != nil {
 		err := errors.New(C.GoString(ans.err))
 		defer C.free(unsafe.Pointer(ans.err))
@@ -98,13 +371,39 @@ func GetCorpusSize(corpusPath string) (int64, error) {
 	return int64(ans.value), nil
 }
 
-func GetConcSize(corpusPath, subcPath, query string) (GoConcSize, error) {
-	ans := C.concordance_size(C.CString(corpusPath), C.CString(subcPath), C.CString(query))
+// GetCorpusSize returns the number of positions of a corpus
+// specified by its registry path. The corpus is opened just for
+// the call so for repeated queries, Corpus.Size is preferred.
+func GetCorpusSize(corpusPath string) (int64, error) {
+	corp, err := OpenCorpus(corpusPath)
+	if err != nil {
+		return 0, err
+	}
+	defer corp.Close()
+	return corp.Size()
+}
+
+func (c *Corpus) ConcSize(
+	subcPath, query string,
+	filters []ConcFilter,
+	sample ConcSample,
+	concFile ConcFile,
+	abort *AbortSignal,
+) (GoConcSize, error) {
 	var ret GoConcSize
+	subc, err := c.subcorpus(subcPath)
+	if err != nil {
+		return ret, err
+	}
+	cConcFile, freeConcFile := concFile.cValue()
+	defer freeConcFile()
+	cFilters, freeFilters := filtersCValue(filters)
+	defer freeFilters()
+	ans := C.concordance_size(c.corp, subc, C.CString(query), cConcFile, cFilters, sample.cValue(), abort.cFlag())
 	if ans.err != nil {
 		err := errors.New(C.GoString(ans.err))
 		defer C.free(unsafe.Pointer(ans.err))
-		return ret, err
+		return ret, abort.mapError(err)
 	}
 	ret.CorpusSize = int64(ans.corpusSize)
 	ret.Value = int64(ans.value)
@@ -112,8 +411,12 @@ func GetConcSize(corpusPath, subcPath, query string) (GoConcSize, error) {
 	return ret, nil
 }
 
-func CompileSubcFreqs(corpusPath, subcPath, attr string) error {
-	ans := C.compile_subc_freqs(C.CString(corpusPath), C.CString(subcPath), C.CString(attr))
+func (c *Corpus) CompileSubcFreqs(subcPath, attr string) error {
+	subc, err := c.subcorpus(subcPath)
+	if err != nil {
+		return err
+	}
+	ans := C.compile_subc_freqs(subc, C.CString(attr))
 	if ans.err != nil {
 		err := errors.New(C.GoString(ans.err))
 		defer C.free(unsafe.Pointer(ans.err))
@@ -123,27 +426,40 @@ func CompileSubcFreqs(corpusPath, subcPath, attr string) error {
 	return nil
 }
 
-func GetConcordance(
-	corpusPath, subcPath, query string,
+func (c *Corpus) Concordance(
+	subcPath, query string,
 	attrs []string,
 	structs []string,
 	refs []string,
 	fromLine, maxItems, maxContext int,
 	shuffle bool,
+	sort ConcSort,
 	viewContextStruct string,
+	filters []ConcFilter,
+	sample ConcSample,
+	concFile ConcFile,
+	abort *AbortSignal,
 ) (GoConcordance, error) {
 	if fromLine < 0 {
-		panic("GetConcordance - invalid fromLine value")
+		panic("Concordance - invalid fromLine value")
 	}
 	if maxItems < 0 {
-		panic("GetConcordance - invalid maxItems value")
+		panic("Concordance - invalid maxItems value")
 	}
 	if maxContext < 0 {
-		panic("GetConcordance - invalid maxContext value")
+		panic("Concordance - invalid maxContext value")
+	}
+	subc, err := c.subcorpus(subcPath)
+	if err != nil {
+		return GoConcordance{}, err
 	}
 	if !collections.SliceContains(refs, "#") {
 		refs = append([]string{"#"}, refs...)
 	}
+	cConcFile, freeConcFile := concFile.cValue()
+	defer freeConcFile()
+	cFilters, freeFilters := filtersCValue(filters)
+	defer freeFilters()
 	var shuffleInt C.int
 	if shuffle {
 		shuffleInt = 1
@@ -151,9 +467,16 @@ func GetConcordance(
 	} else {
 		shuffleInt = 0
 	}
+	var sortDescInt C.int
+	if sort.Descending {
+		sortDescInt = 1
+	}
+	cSortCrit := C.CString(sort.crit())
+	defer C.free(unsafe.Pointer(cSortCrit))
 	ans := C.conc_examples(
-		C.CString(corpusPath),
-		C.CString(subcPath),
+		c.corp,
+		subc,
+		C.CString(c.path),
 		C.CString(query),
 		C.CString(strings.Join(attrs, ",")),
 		C.CString(strings.Join(structs, ",")),
@@ -163,7 +486,13 @@ func GetConcordance(
 		C.longlong(maxItems),
 		C.longlong(maxContext),
 		shuffleInt,
-		C.CString(viewContextStruct))
+		cSortCrit,
+		sortDescInt,
+		C.CString(viewContextStruct),
+		cConcFile,
+		cFilters,
+		sample.cValue(),
+		abort.cFlag())
 	var ret GoConcordance
 	ret.Lines = make([]string, 0, maxItems)
 	ret.ConcSize = int(ans.concSize)
@@ -174,7 +503,7 @@ func GetConcordance(
 		if ans.errorCode == 1 {
 			return ret, ErrRowsRangeOutOfConc
 		}
-		return ret, err
+		return ret, abort.mapError(err)
 
 	} else {
 		defer C.conc_examples_free(ans.value, C.int(ans.size))
@@ -211,8 +540,8 @@ func GetConcordance(
 	return ret, nil
 }
 
-func GetConcordanceWithCollPhrase(
-	corpusPath, subcPath, query, collQuery string,
+func (c *Corpus) ConcordanceWithCollPhrase(
+	subcPath, query, collQuery string,
 	lftCtx, rgtCtx int,
 	attrs []string,
 	structs []string,
@@ -220,10 +549,22 @@ func GetConcordanceWithCollPhrase(
 	fromLine, maxItems, maxContext int,
 	shuffle bool,
 	viewContextStruct string,
+	filters []ConcFilter,
+	sample ConcSample,
+	concFile ConcFile,
+	abort *AbortSignal,
 ) (GoConcordance, error) {
+	subc, err := c.subcorpus(subcPath)
+	if err != nil {
+		return GoConcordance{}, err
+	}
 	if !collections.SliceContains(refs, "#") {
 		refs = append([]string{"#"}, refs...)
 	}
+	cConcFile, freeConcFile := concFile.cValue()
+	defer freeConcFile()
+	cFilters, freeFilters := filtersCValue(filters)
+	defer freeFilters()
 	var shuffleInt C.int
 	if shuffle {
 		shuffleInt = 1
@@ -231,8 +572,8 @@ func GetConcordanceWithCollPhrase(
 		shuffleInt = 0
 	}
 	ans := C.conc_examples_with_coll_phrase(
-		C.CString(corpusPath),
-		C.CString(subcPath),
+		c.corp,
+		subc,
 		C.CString(query),
 		C.CString(collQuery+";"),
 		C.CString(strconv.Itoa(lftCtx)),
@@ -245,7 +586,11 @@ func GetConcordanceWithCollPhrase(
 		C.longlong(maxItems),
 		C.longlong(maxContext),
 		shuffleInt,
-		C.CString(viewContextStruct))
+		C.CString(viewContextStruct),
+		cConcFile,
+		cFilters,
+		sample.cValue(),
+		abort.cFlag())
 	var ret GoConcordance
 	ret.Lines = make([]string, 0, maxItems)
 	ret.ConcSize = int(ans.concSize)
@@ -255,7 +600,7 @@ func GetConcordanceWithCollPhrase(
 		if ans.errorCode == 1 {
 			return ret, ErrRowsRangeOutOfConc
 		}
-		return ret, err
+		return ret, abort.mapError(err)
 
 	} else {
 		defer C.conc_examples_free(ans.value, C.int(ans.size))
@@ -292,9 +637,26 @@ func GetConcordanceWithCollPhrase(
 	return ret, nil
 }
 
-func CalcFreqDist(corpusID, subcID, query, fcrit string, flimit int) (*Freqs, error) {
+func (c *Corpus) FreqDist(
+	subcPath, query, fcrit string,
+	flimit int,
+	filters []ConcFilter,
+	sample ConcSample,
+	concFile ConcFile,
+	abort *AbortSignal,
+) (*Freqs, error) {
 	var ret Freqs
-	ans := C.freq_dist(C.CString(corpusID), C.CString(subcID), C.CString(query), C.CString(fcrit), C.longlong(flimit))
+	subc, err := c.subcorpus(subcPath)
+	if err != nil {
+		return &ret, err
+	}
+	cConcFile, freeConcFile := concFile.cValue()
+	defer freeConcFile()
+	cFilters, freeFilters := filtersCValue(filters)
+	defer freeFilters()
+	ans := C.freq_dist(
+		c.corp, subc, C.CString(query), C.CString(fcrit),
+		C.longlong(flimit), cConcFile, cFilters, sample.cValue(), abort.cFlag())
 	defer func() { // the 'new' was called before any possible error so we have to do this
 		C.delete_int_vector(ans.freqs)
 		C.delete_int_vector(ans.norms)
@@ -303,11 +665,20 @@ func CalcFreqDist(corpusID, subcID, query, fcrit string, flimit int) (*Freqs, er
 	if ans.err != nil {
 		err := errors.New(C.GoString(ans.err))
 		defer C.free(unsafe.Pointer(ans.err))
-		return &ret, err
+		return &ret, abort.mapError(err)
 	}
 	ret.Freqs = IntVectorToSlice(GoVector{ans.freqs})
 	ret.Norms = IntVectorToSlice(GoVector{ans.norms})
-	ret.Words = StrVectorToSlice(GoVector{ans.words})
+	rawWords := strVectorToRawSlice(GoVector{ans.words})
+	ret.Words = make([]string, len(rawWords))
+	ret.Levels = make([][]string, len(rawWords))
+	for i, w := range rawWords {
+		ret.Words[i] = normalizeMultiword(w)
+		ret.Levels[i] = strings.Split(strings.Trim(w, "\t"), "\t")
+		for j, v := range ret.Levels[i] {
+			ret.Levels[i][j] = normalizeMultiword(v)
+		}
+	}
 	ret.ConcSize = int64(ans.concSize)
 	ret.CorpusSize = int64(ans.corpusSize)
 	ret.SubcSize = int64(ans.searchSize)
@@ -323,12 +694,20 @@ func normalizeMultiword(w string) string {
 	}, w))
 }
 
-func StrVectorToSlice(vector GoVector) []string {
+func strVectorToRawSlice(vector GoVector) []string {
 	size := int(C.str_vector_get_size(vector.v))
 	slice := make([]string, size)
 	for i := 0; i < size; i++ {
 		cstr := C.str_vector_get_element(vector.v, C.int(i))
-		slice[i] = normalizeMultiword(C.GoString(cstr))
+		slice[i] = C.GoString(cstr)
+	}
+	return slice
+}
+
+func StrVectorToSlice(vector GoVector) []string {
+	slice := strVectorToRawSlice(vector)
+	for i, v := range slice {
+		slice[i] = normalizeMultiword(v)
 	}
 	return slice
 }
@@ -343,7 +722,7 @@ func IntVectorToSlice(vector GoVector) []int64 {
 	return slice
 }
 
-// GetCollcations
+// Collocations
 //
 // 't': 'T-score',
 // 'm': 'MI',
@@ -354,31 +733,44 @@ func IntVectorToSlice(vector GoVector) []int64 {
 // 'r': 'relative freq. [%]',
 // 'f': 'absolute freq.',
 // 'd': 'logDice'
-func GetCollcations(
-	corpusID, subcID, query string,
+func (c *Corpus) Collocations(
+	subcPath, query string,
 	attrName string,
 	measure byte,
 	srchRange [2]int,
 	minFreq int64,
 	minCorpFreq int64,
 	maxItems int,
+	filters []ConcFilter,
+	sample ConcSample,
+	concFile ConcFile,
+	abort *AbortSignal,
 ) (GoColls, error) {
+	subc, err := c.subcorpus(subcPath)
+	if err != nil {
+		return GoColls{}, err
+	}
+	cConcFile, freeConcFile := concFile.cValue()
+	defer freeConcFile()
+	cFilters, freeFilters := filtersCValue(filters)
+	defer freeFilters()
 	colls := C.collocations(
-		C.CString(corpusID), C.CString(subcID), C.CString(query), C.CString(attrName),
+		c.corp, subc, C.CString(query), C.CString(attrName),
 		C.char(measure), C.char(measure), C.longlong(minCorpFreq), C.longlong(minFreq),
-		C.int(srchRange[0]), C.int(srchRange[1]), C.int(maxItems))
+		C.int(srchRange[0]), C.int(srchRange[1]), C.int(maxItems), cConcFile, cFilters, sample.cValue(), abort.cFlag())
 	if colls.err != nil {
 		err := errors.New(C.GoString(colls.err))
 		defer C.free(unsafe.Pointer(colls.err))
-		return GoColls{}, err
+		return GoColls{}, abort.mapError(err)
 	}
 	items := make([]*GoCollItem, colls.resultSize)
 	for i := 0; i < int(colls.resultSize); i++ {
 		tmp := C.get_coll_item(colls, C.int(i))
 		items[i] = &GoCollItem{
-			Word:  C.GoString(tmp.word),
-			Score: maths.RoundToN(float64(tmp.score), 4),
-			Freq:  int64(tmp.freq),
+			Word:     C.GoString(tmp.word),
+			Score:    maths.RoundToN(float64(tmp.score), 4),
+			Freq:     int64(tmp.freq),
+			CorpFreq: int64(tmp.corpFreq),
 		}
 	}
 	//C.coll_examples_free(colls.items, colls.numItems)
@@ -390,7 +782,65 @@ func GetCollcations(
 	}, nil
 }
 
-func GetTextTypesNorms(corpusPath string, attr string) (map[string]int64, error) {
+// CollocationCounts calculates raw collocation counts - i.e. for each
+// candidate, its frequency within the search range (`Freq`) and
+// its frequency in the (sub)corpus (`CorpFreq`). Scores are not
+// calculated (see CollScore) and all the matching candidates are
+// returned (unsorted).
+func (c *Corpus) CollocationCounts(
+	subcPath, query string,
+	attrName string,
+	srchRange [2]int,
+	candidates CollCandidates,
+	minFreq int64,
+	minCorpFreq int64,
+	filters []ConcFilter,
+	sample ConcSample,
+	concFile ConcFile,
+	abort *AbortSignal,
+) (GoColls, error) {
+	subc, err := c.subcorpus(subcPath)
+	if err != nil {
+		return GoColls{}, err
+	}
+	cQuery := C.CString(query)
+	defer C.free(unsafe.Pointer(cQuery))
+	cAttrName := C.CString(attrName)
+	defer C.free(unsafe.Pointer(cAttrName))
+	cCandidates, freeCandidates := candidates.cValue()
+	defer freeCandidates()
+	cConcFile, freeConcFile := concFile.cValue()
+	defer freeConcFile()
+	cFilters, freeFilters := filtersCValue(filters)
+	defer freeFilters()
+	colls := C.collocation_counts(
+		c.corp, subc, cQuery, cAttrName, C.int(srchRange[0]), C.int(srchRange[1]),
+		cCandidates, C.longlong(minFreq), C.longlong(minCorpFreq),
+		cConcFile, cFilters, sample.cValue(), abort.cFlag())
+	if colls.err != nil {
+		err := errors.New(C.GoString(colls.err))
+		defer C.free(unsafe.Pointer(colls.err))
+		return GoColls{}, abort.mapError(err)
+	}
+	defer C.coll_examples_free(colls.items, C.int(colls.resultSize))
+	items := make([]*GoCollItem, colls.resultSize)
+	for i := 0; i < int(colls.resultSize); i++ {
+		tmp := C.get_coll_item(colls, C.int(i))
+		items[i] = &GoCollItem{
+			Word:     C.GoString(tmp.word),
+			Freq:     int64(tmp.freq),
+			CorpFreq: int64(tmp.corpFreq),
+		}
+	}
+	return GoColls{
+		Colls:      items,
+		ConcSize:   int64(colls.concSize),
+		CorpusSize: int64(colls.corpusSize),
+		SubcSize:   int64(colls.searchSize),
+	}, nil
+}
+
+func (c *Corpus) TextTypesNorms(attr string) (map[string]int64, error) {
 	ans := make(map[string]int64)
 	attrSplit := strings.Split(attr, ".")
 	if len(attrSplit) != 2 {
@@ -403,7 +853,7 @@ func GetTextTypesNorms(corpusPath string, attr string) (map[string]int64, error)
 			}
 	}
 	norms := C.get_attr_values_sizes(
-		C.CString(corpusPath), C.CString(attrSplit[0]), C.CString(attrSplit[1]))
+		c.corp, C.CString(attrSplit[0]), C.CString(attrSplit[1]))
 	if norms.err != nil {
 		err := errors.New(C.GoString(norms.err))
 		defer C.free(unsafe.Pointer(norms.err))
@@ -424,20 +874,34 @@ func GetTextTypesNorms(corpusPath string, attr string) (map[string]int64, error)
 	return ans, nil
 }
 
-// GetCorpusConf returns a corpus configuration item
+// Conf returns a corpus configuration item
 // stored in a corpus configuration file (aka "registry file")
-func GetCorpusConf(corpusPath string, prop string) (string, error) {
-	ans := (C.get_corpus_conf(C.open_corpus(C.CString(corpusPath)).value, C.CString(prop)))
+func (c *Corpus) Conf(prop string) (string, error) {
+	cProp := C.CString(prop)
+	defer C.free(unsafe.Pointer(cProp))
+	ans := C.get_corpus_conf(c.corp, cProp)
 	if ans.err != nil {
 		err := errors.New(C.GoString(ans.err))
 		defer C.free(unsafe.Pointer(ans.err))
 		return "", err
 	}
+	defer C.free(unsafe.Pointer(ans.value))
 	return C.GoString(ans.value), nil
 }
 
-func GetPosAttrSize(corpusPath string, name string) (int, error) {
-	ans := C.get_posattr_size(C.CString(corpusPath), C.CString(name))
+// GetCorpusConf returns a corpus configuration item
+// of a corpus specified by its registry path.
+func GetCorpusConf(corpusPath string, prop string) (string, error) {
+	corp, err := OpenCorpus(corpusPath)
+	if err != nil {
+		return "", err
+	}
+	defer corp.Close()
+	return corp.Conf(prop)
+}
+
+func (c *Corpus) PosAttrSize(name string) (int, error) {
+	ans := C.get_posattr_size(c.corp, C.CString(name))
 	if ans.err != nil {
 		err := errors.New(C.GoString(ans.err))
 		defer C.free(unsafe.Pointer(ans.err))
@@ -446,8 +910,8 @@ func GetPosAttrSize(corpusPath string, name string) (int, error) {
 	return int(ans.value), nil
 }
 
-func GetStructSize(corpusPath string, name string) (int, error) {
-	ans := C.get_struct_size(C.CString(corpusPath), C.CString(name))
+func (c *Corpus) StructSize(name string) (int, error) {
+	ans := C.get_struct_size(c.corp, C.CString(name))
 	if ans.err != nil {
 		err := errors.New(C.GoString(ans.err))
 		defer C.free(unsafe.Pointer(ans.err))
@@ -456,6 +920,191 @@ func GetStructSize(corpusPath string, name string) (int, error) {
 	return int(ans.value), nil
 }
 
+// AttrValueFreq returns a corpus frequency of a positional
+// attribute value. For values not present in the corpus, 0 is returned.
+func (c *Corpus) AttrValueFreq(attr, value string) (int64, error) {
+	cAttr := C.CString(attr)
+	defer C.free(unsafe.Pointer(cAttr))
+	cValue := C.CString(value)
+	defer C.free(unsafe.Pointer(cValue))
+	ans := C.get_attr_value_freq(c.corp, cAttr, cValue)
+	if ans.err != nil {
+		err := errors.New(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return 0, err
+	}
+	return int64(ans.value), nil
+}
+
+// Dispersion calculates raw data for dispersion measures of a query
+// over documents represented by `docStruct` (for an empty value, the
+// corpus DOCSTRUCTURE is used). In case `textTypeAttr` (e.g. `doc.txtype`)
+// is not empty, frequencies and sizes of the attribute values are
+// calculated too.
+func (c *Corpus) Dispersion(
+	subcPath, query string,
+	docStruct, textTypeAttr string,
+	concFile ConcFile,
+	abort *AbortSignal,
+) (GoDispersion, error) {
+	subc, err := c.subcorpus(subcPath)
+	if err != nil {
+		return GoDispersion{}, err
+	}
+	cQuery := C.CString(query)
+	defer C.free(unsafe.Pointer(cQuery))
+	cDocStruct := C.CString(docStruct)
+	defer C.free(unsafe.Pointer(cDocStruct))
+	cTextTypeAttr := C.CString(textTypeAttr)
+	defer C.free(unsafe.Pointer(cTextTypeAttr))
+	cConcFile, freeConcFile := concFile.cValue()
+	defer freeConcFile()
+	ans := C.dispersion(c.corp, subc, cQuery, cDocStruct, cTextTypeAttr, cConcFile, abort.cFlag())
+	if ans.err != nil {
+		err := errors.New(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return GoDispersion{}, abort.mapError(err)
+	}
+	defer C.dispersion_free(ans)
+	ret := GoDispersion{
+		ConcSize:   int64(ans.concSize),
+		CorpusSize: int64(ans.corpusSize),
+		ARF:        float64(ans.arf),
+		NumDocs:    int64(ans.numDocs),
+		DocsSize:   int64(ans.docsSize),
+		MinDocSize: int64(ans.minDocSize),
+		HitDocs:    make([]GoDispersionDoc, ans.numHitDocs),
+		TextTypes:  make([]GoDispersionTextType, ans.numTextTypes),
+	}
+	for i := range ret.HitDocs {
+		tmp := C.get_dispersion_doc(ans, C.int(i))
+		ret.HitDocs[i] = GoDispersionDoc{Freq: int64(tmp.freq), Size: int64(tmp.size)}
+	}
+	for i := range ret.TextTypes {
+		tmp := C.get_dispersion_text_type(ans, C.int(i))
+		ret.TextTypes[i] = GoDispersionTextType{
+			Value: C.GoString(tmp.value),
+			Freq:  int64(tmp.freq),
+			Size:  int64(tmp.size),
+		}
+	}
+	return ret, nil
+}
+
+// StructAlignedSplit determines boundaries of corpus chunks of similar
+// sizes (approx. `chunkSize`) not cutting through structures `structName`
+// (e.g. `doc`). The returned slice contains N+1 positions for N chunks
+// where chunk i spans [bounds[i], bounds[i+1]).
+func (c *Corpus) StructAlignedSplit(structName string, chunkSize int64) ([]int64, error) {
+	cStructName := C.CString(structName)
+	defer C.free(unsafe.Pointer(cStructName))
+	ans := C.aligned_split_bounds(c.corp, cStructName, C.longlong(chunkSize))
+	if ans.err != nil {
+		err := errors.New(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return nil, err
+	}
+	defer C.split_bounds_free(ans)
+	ret := make([]int64, ans.numBounds)
+	for i := range ret {
+		ret[i] = int64(C.get_split_bound(ans, C.int(i)))
+	}
+	return ret, nil
+}
+
+// PosRange is a range of corpus positions [From, To)
+type PosRange struct {
+	From int64
+	To   int64
+}
+
+// QueryRanges evaluates a query and returns ranges of its matches
+// (sorted, with overlapping and adjacent ones merged) along with the
+// number of positions they cover. This is mostly used to define
+// subcorpora - e.g. `<doc txtype="FIC" />` matches whole documents.
+// In case the query matches more than `maxHits` items, ErrTooManyQueryHits
+// is returned.
+func (c *Corpus) QueryRanges(query string, maxHits int64, abort *AbortSignal) ([]PosRange, int64, error) {
+	cQuery := C.CString(query)
+	defer C.free(unsafe.Pointer(cQuery))
+	ans := C.query_ranges(c.corp, cQuery, C.longlong(maxHits), abort.cFlag())
+	if ans.err != nil {
+		err := errors.New(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return nil, 0, abort.mapError(err)
+	}
+	if ans.tooManyHits == 1 {
+		return nil, 0, ErrTooManyQueryHits
+	}
+	defer C.query_ranges_free(ans)
+	ret := make([]PosRange, ans.numRanges)
+	for i := range ret {
+		tmp := C.get_query_range(ans, C.longlong(i))
+		ret[i] = PosRange{From: int64(tmp.from), To: int64(tmp.to)}
+	}
+	return ret, int64(ans.size), nil
+}
+
+// Wordlist calculates a word list (ngramSize = 1) or an n-gram list
+// of a positional attribute. The list is calculated from the (sub)corpus
+// or, in case `query` is not empty, from tokens matched by the query
+// (e.g. `[] within <doc txtype="FIC" />`). Only the page specified by
+// `offset` and `limit` is returned. Sorting by docf and ARF is available
+// only for word lists of whole corpora (with no query) as they are read
+// from precompiled attribute statistics.
+func (c *Corpus) Wordlist(
+	subcPath, query string,
+	attrName string,
+	ngramSize int,
+	filter WordlistFilter,
+	sortBy WordlistSortBy,
+	offset, limit int,
+	abort *AbortSignal,
+) (GoWordlist, error) {
+	subc, err := c.subcorpus(subcPath)
+	if err != nil {
+		return GoWordlist{}, err
+	}
+	cQuery := C.CString(query)
+	defer C.free(unsafe.Pointer(cQuery))
+	cAttrName := C.CString(attrName)
+	defer C.free(unsafe.Pointer(cAttrName))
+	cPattern := C.CString(filter.Pattern)
+	defer C.free(unsafe.Pointer(cPattern))
+	var ignoreCase C.int
+	if filter.IgnoreCase {
+		ignoreCase = 1
+	}
+	cValues := C.CString(strings.Join(filter.Values, "\n"))
+	defer C.free(unsafe.Pointer(cValues))
+	ans := C.wordlist(
+		c.corp, subc, cQuery, cAttrName, cPattern, ignoreCase, cValues, C.int(ngramSize),
+		C.longlong(filter.MinFreq), C.longlong(filter.MaxFreq), C.int(sortBy),
+		C.longlong(offset), C.longlong(limit), abort.cFlag())
+	if ans.err != nil {
+		err := errors.New(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return GoWordlist{}, abort.mapError(err)
+	}
+	defer C.wordlist_free(ans.items, C.int(ans.size))
+	items := make([]*GoWordlistItem, ans.size)
+	for i := 0; i < int(ans.size); i++ {
+		tmp := C.get_wordlist_item(ans, C.int(i))
+		items[i] = &GoWordlistItem{
+			Word: C.GoString(tmp.value),
+			Freq: int64(tmp.freq),
+			Docf: max(int64(tmp.docf), 0),
+			ARF:  max(float64(tmp.arf), 0),
+		}
+	}
+	return GoWordlist{
+		Items:         items,
+		Total:         int64(ans.total),
+		SearchSize:    int64(ans.searchSize),
+		IsApproximate: ans.isApproximate == 1,
+	}, nil
+}
+
 type GoStructAttr struct {
 	Struct    string   `json:"struct"`
 	Attr      string   `json:"attr"`
@@ -463,7 +1112,7 @@ type GoStructAttr struct {
 	Truncated bool     `json:"isTruncated"`
 }
 
-// GetStructAttrValues returns, for every structural attribute listed
+// StructAttrValues returns, for every structural attribute listed
 // in the corpus configuration value SUBCORPATTRS (e.g. `doc.author`,
 // `text.pubyear`), the list of all values it can have.
 //
@@ -471,8 +1120,8 @@ type GoStructAttr struct {
 // if a value domain exceeds it, the returned list is cut to limit
 // items and Truncated is set to true for that entry. A limit <= 0
 // means no cap is applied.
-func GetStructAttrValues(corpusPath string, limit int) ([]GoStructAttr, error) {
-	ans := C.get_struct_attr_values(C.CString(corpusPath), C.longlong(limit))
+func (c *Corpus) StructAttrValues(limit int) ([]GoStructAttr, error) {
+	ans := C.get_struct_attr_values(c.corp, C.longlong(limit))
 	if ans.err != nil {
 		err := errors.New(C.GoString(ans.err))
 		defer C.free(unsafe.Pointer(ans.err))
@@ -497,9 +1146,9 @@ func GetStructAttrValues(corpusPath string, limit int) ([]GoStructAttr, error) {
 	return ret, nil
 }
 
-func GetCorpRegion(corpusPath string, lftCtx, rgtCtx int64, structs, attrs []string) (GoTokenContext, error) {
+func (c *Corpus) CorpRegion(lftCtx, rgtCtx int64, structs, attrs []string) (GoTokenContext, error) {
 	ans := C.get_corp_region(
-		C.CString(corpusPath),
+		c.corp,
 		C.longlong(lftCtx),
 		C.longlong(rgtCtx),
 		C.CString(strings.Join(attrs, ",")),
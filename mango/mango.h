@@ -22,6 +22,7 @@ extern "C" {
 
 typedef void* PosAttrV;
 typedef void* CorpusV;
+typedef void* SubCorpusV;
 typedef void* StructV;
 typedef void* ConcV;
 typedef void* MVector;
@@ -33,6 +34,60 @@ typedef void* AttrValMapIterator;
 
 typedef long long int PosInt;
 
+/**
+ * AbortFlag points to a value which is set (from Go) to
+ * a non-zero value once a running calculation should be aborted.
+ * Functions accepting the flag test it regularly during their
+ * long-running parts. A NULL value means the calculation cannot
+ * be aborted.
+ */
+typedef int* AbortFlag;
+
+/**
+ * ConcFile specifies a file where a calculated concordance
+ * is stored. A non-empty `loadPath` means the concordance
+ * is loaded from the file instead of evaluating a query.
+ * A non-empty `savePath` means an evaluated concordance
+ * is saved to the file.
+ */
+typedef struct ConcFile {
+    const char* loadPath;
+    const char* savePath;
+} ConcFile;
+
+/**
+ * ConcFilter specifies a filter applied to concordance lines.
+ * A line is kept in case the filter query matches (`positive` non-zero)
+ * or does not match (`positive` zero) within the range given by `lctx`
+ * and `rctx` (in the Manatee format, e.g. `-5<0`, `5>0`).
+ */
+typedef struct ConcFilter {
+    const char* query;
+    const char* lctx;
+    const char* rctx;
+    int positive;
+    int excludeKwic;
+} ConcFilter;
+
+/**
+ * ConcFilters is a chain of filters applied in the order
+ * of `items`.
+ */
+typedef struct ConcFilters {
+    ConcFilter* items;
+    int size;
+} ConcFilters;
+
+/**
+ * ConcSample specifies a random reduction of a concordance
+ * to (at most) `size` lines. For the same `seed`, the same
+ * lines are selected. A `size` <= 0 means no reduction.
+ */
+typedef struct ConcSample {
+    PosInt size;
+    unsigned long long seed;
+} ConcSample;
+
 /**
  * CorpusRetval wraps both
  * a returned Manatee corpus object
@@ -44,6 +99,11 @@ typedef struct CorpusRetval {
 } CorpusRetval;
 
 
+typedef struct SubCorpusRetval {
+    SubCorpusV value;
+    const char * err;
+} SubCorpusRetval;
+
 typedef struct CorpusSizeRetrval {
     PosInt value;
     const char * err;
@@ -85,6 +145,12 @@ typedef struct FreqsRetval {
 typedef struct CollItem {
     double score;
     double freq;
+
+    /**
+     * corpFreq is a frequency of the collocate
+     * in the (sub)corpus
+     */
+    PosInt corpFreq;
     char *word;
 } CollItem;
 
@@ -118,6 +184,14 @@ typedef struct AttrValSizes {
     AttrValMap sizes;
 } AttrValSizes;
 
+AbortFlag new_abort_flag();
+
+void set_abort_flag(AbortFlag flag);
+
+int is_abort_flag_set(AbortFlag flag);
+
+void delete_abort_flag(AbortFlag flag);
+
 /**
  * Create a Manatee corpus instance
  */
@@ -125,13 +199,25 @@ CorpusRetval open_corpus(const char* corpusPath);
 
 void close_corpus(CorpusV corpus);
 
-CorpusSizeRetrval get_corpus_size(const char* corpusPath);
+/**
+ * Create a Manatee subcorpus instance. The parent `corpus`
+ * must not be closed before the subcorpus.
+ */
+SubCorpusRetval open_subcorpus(CorpusV corpus, const char* subcPath);
+
+void close_subcorpus(SubCorpusV subc);
+
+CorpusSizeRetrval get_corpus_size(CorpusV corpus);
 
+/**
+ * Get a corpus configuration value. The returned
+ * value must be freed by the caller.
+ */
 CorpusStringRetval get_corpus_conf(CorpusV corpus, const char* prop);
 
-ConcSizeRetVal concordance_size(const char* corpusPath, const char* subcPath, const char* query);
+ConcSizeRetVal concordance_size(CorpusV corpus, SubCorpusV subcorpus, const char* query, ConcFile concFile, ConcFilters filters, ConcSample sample, AbortFlag abortFlag);
 
-CompileFrqRetVal compile_subc_freqs(const char* corpusPath, const char* subcPath, const char* attr);
+CompileFrqRetVal compile_subc_freqs(SubCorpusV subcorpus, const char* attr);
 
 void delete_str_vector(MVector v);
 
@@ -147,7 +233,7 @@ PosInt int_vector_get_size(MVector v);
 
 FreqsRetval freq_dist_from_conc(CorpusV corpus, ConcV conc, char* fcrit, PosInt flimit);
 
-FreqsRetval freq_dist(const char* corpusPath, const char* subcPath, const char* query, const char* fcrit, PosInt flimit);
+FreqsRetval freq_dist(CorpusV corpus, SubCorpusV subcorpus, const char* query, const char* fcrit, PosInt flimit, ConcFile concFile, ConcFilters filters, ConcSample sample, AbortFlag abortFlag);
 
 /**
  * @brief Based on provided query, return at most `limit` sentences matching the query.
@@ -157,15 +243,21 @@ FreqsRetval freq_dist(const char* corpusPath, const char* subcPath, const char*
  * checks the `limit` argument against `mango.MaxRecordsInternalLimit` and will not allow
  * larger value.
  *
- * @param corpusPath
+ * @param corpus
+ * @param subcorpus a subcorpus to search in or NULL
+ * @param corpusPath used to locate aligned corpora
  * @param query
  * @param attrs Positional attributes (comma-separated) to be attached to returned tokens
  * @param limit
+ * @param shuffle if non-zero and no sorting is specified, the lines are shuffled
+ * @param sortCrit Manatee sorting criterion (e.g. `word/i -1<0`) or an empty string
+ * @param sortDesc if non-zero, the sorted lines are returned in descending order
  * @return KWICRowsRetval
  */
 KWICRowsRetval conc_examples(
+    CorpusV corpus,
+    SubCorpusV subcorpus,
     const char* corpusPath,
-    const char* subcPath,
     const char*query,
     const char* attrs,
     const char* structs,
@@ -175,14 +267,20 @@ KWICRowsRetval conc_examples(
     PosInt limit,
     PosInt maxContext,
     int shuffle,
-    const char* viewContextStruct);
+    const char* sortCrit,
+    int sortDesc,
+    const char* viewContextStruct,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag);
 
 void conc_examples_free(KWICRowsV value, int numItems);
 
 
 KWICRowsRetval conc_examples_with_coll_phrase(
-    const char* corpusPath,
-    const char* subcPath,
+    CorpusV corpus,
+    SubCorpusV subcorpus,
     const char* query,
     const char* collQuery,
     const char* lctx,
@@ -195,10 +293,14 @@ KWICRowsRetval conc_examples_with_coll_phrase(
     PosInt limit,
     PosInt maxContext,
     int shuffle,
-    const char* viewContextStruct);
+    const char* viewContextStruct,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag);
 
 CorpRegionRetval get_corp_region(
-    const char* corpusPath,
+    CorpusV corpus,
     PosInt position,
     PosInt numTok,
     const char* attrs,
@@ -206,8 +308,8 @@ CorpRegionRetval get_corp_region(
 );
 
 CollsRetVal collocations(
-    const char* corpusPath,
-    const char* subcPath,
+    CorpusV corpus,
+    SubCorpusV subcorpus,
     const char* query,
     const char * attrName,
     char collFn,
@@ -216,7 +318,71 @@ CollsRetVal collocations(
     PosInt minbgr,
     int fromw,
     int tow,
-    int maxitems
+    int maxitems,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag
+);
+
+/**
+ * CollCandidates specifies how collocation candidates are
+ * searched in addition to the positional range.
+ */
+typedef struct CollCandidates {
+
+    /**
+     * structName limits candidates to the structure (e.g. a sentence)
+     * containing the KWIC. Empty value means no limit.
+     */
+    const char* structName;
+
+    /**
+     * syntaxRel limits candidates to tokens syntactically related
+     * to the KWIC (see COLL_SYNTAX_REL_* values)
+     */
+    int syntaxRel;
+
+    /**
+     * parentAttr is a positional attribute containing a relative
+     * position of a token's head (0 means no head)
+     */
+    const char* parentAttr;
+
+    const char* deprelAttr;
+
+    /**
+     * deprel limits the syntactic relation to a specific
+     * dependency relation type (empty value = any type)
+     */
+    const char* deprel;
+} CollCandidates;
+
+#define COLL_SYNTAX_REL_NONE 0
+#define COLL_SYNTAX_REL_DEPENDENT 1
+#define COLL_SYNTAX_REL_HEAD 2
+
+/**
+ * collocation_counts calculates raw collocation counts (number of
+ * occurrences of a candidate in the search range and its frequency
+ * in the (sub)corpus) with no score calculated.
+ * In contrast to `collocations`, all the matching candidates
+ * are returned.
+ */
+CollsRetVal collocation_counts(
+    CorpusV corpus,
+    SubCorpusV subcorpus,
+    const char* query,
+    const char* attrName,
+    int fromw,
+    int tow,
+    CollCandidates candidates,
+    PosInt minCollFreq,
+    PosInt minCorpFreq,
+    ConcFile concFile,
+    ConcFilters filters,
+    ConcSample sample,
+    AbortFlag abortFlag
 );
 
 CollItem get_coll_item(CollsRetVal data, int idx);
@@ -232,7 +398,7 @@ typedef struct CollVal {
 
 
 AttrValSizes get_attr_values_sizes(
-    const char* corpus_path,
+    CorpusV corpus,
     const char* struct_name,
     const char* attr_name
 );
@@ -252,9 +418,276 @@ void delete_attr_val_iterator(AttrValMapIterator itr);
 
 AttrVal get_next_attr_val_size(AttrValMap srcMap, AttrValMapIterator itr);
 
-CorpusSizeRetrval get_posattr_size(const char* corpus_path, const char* name);
+CorpusSizeRetrval get_posattr_size(CorpusV corpus, const char* name);
+
+CorpusSizeRetrval get_struct_size(CorpusV corpus, const char* name);
+
+/**
+ * get_attr_value_freq returns a corpus frequency of a positional
+ * attribute value (0 for values not present in the corpus)
+ */
+CorpusSizeRetrval get_attr_value_freq(CorpusV corpus, const char* attrName, const char* value);
+
+/**
+ * DispersionDoc describes a document containing
+ * at least one occurrence of a searched term
+ */
+typedef struct DispersionDoc {
+    PosInt freq;
+
+    /**
+     * size is a number of document tokens within
+     * the searched (sub)corpus
+     */
+    PosInt size;
+} DispersionDoc;
+
+typedef struct DispersionTextType {
+    char* value;
+    PosInt freq;
+    PosInt size;
+} DispersionTextType;
+
+typedef void* DispersionDocsV;
+typedef void* DispersionTextTypesV;
+
+typedef struct DispersionRetval {
+    PosInt concSize;
+    PosInt corpusSize;
+    double arf;
+
+    /**
+     * numDocs is a number of documents (with non-zero size)
+     * within the searched (sub)corpus
+     */
+    PosInt numDocs;
+
+    /**
+     * docsSize is the total size of all the documents
+     * within the searched (sub)corpus
+     */
+    PosInt docsSize;
+
+    PosInt minDocSize;
+    DispersionDocsV hitDocs;
+    PosInt numHitDocs;
+    DispersionTextTypesV textTypes;
+    PosInt numTextTypes;
+    const char* err;
+} DispersionRetval;
+
+/**
+ * @brief Calculate raw data needed for dispersion measures (docf, DP,
+ * Juilland's D) of a query - i.e. frequencies and sizes of documents
+ * containing the searched term along with the number and sizes of all
+ * documents. Optionally, frequencies and sizes per values of a structural
+ * attribute (e.g. `doc.txtype`) are calculated.
+ *
+ * @param corpus
+ * @param subcorpus a subcorpus or NULL
+ * @param query
+ * @param docStruct a structure representing documents; for an empty value,
+ * the corpus DOCSTRUCTURE is used
+ * @param textTypeAttr a structural attribute (e.g. `doc.txtype`) or an empty value
+ * @param concFile
+ * @param abortFlag
+ * @return DispersionRetval
+ */
+DispersionRetval dispersion(
+    CorpusV corpus,
+    SubCorpusV subcorpus,
+    const char* query,
+    const char* docStruct,
+    const char* textTypeAttr,
+    ConcFile concFile,
+    AbortFlag abortFlag
+);
+
+DispersionDoc get_dispersion_doc(DispersionRetval data, int idx);
+
+DispersionTextType get_dispersion_text_type(DispersionRetval data, int idx);
 
-CorpusSizeRetrval get_struct_size(const char* corpus_path, const char* name);
+void dispersion_free(DispersionRetval data);
+
+typedef struct SplitBoundsRetval {
+
+    /**
+     * bounds contains `numBounds` positions where
+     * chunk i spans [bounds[i], bounds[i + 1])
+     */
+    PosInt* bounds;
+    int numBounds;
+    const char* err;
+} SplitBoundsRetval;
+
+/**
+ * @brief Determine how to split a corpus into chunks of similar sizes
+ * (approx. `chunkSize`) with boundaries not cutting through structures
+ * of the specified type (e.g. `doc`). Each boundary is placed at the
+ * start or at the end of the structure containing the ideal cut position
+ * (the remaining part of the corpus divided evenly) - whichever is closer. In case a structure is
+ * larger than a chunk, the resulting number of chunks is smaller.
+ *
+ * @param corpus
+ * @param structName
+ * @param chunkSize
+ * @return SplitBoundsRetval
+ */
+SplitBoundsRetval aligned_split_bounds(CorpusV corpus, const char* structName, PosInt chunkSize);
+
+PosInt get_split_bound(SplitBoundsRetval data, int idx);
+
+void split_bounds_free(SplitBoundsRetval data);
+
+/**
+ * PosRange is a range of corpus positions [from, to)
+ */
+typedef struct PosRange {
+    PosInt from;
+    PosInt to;
+} PosRange;
+
+typedef void* PosRangesV;
+
+typedef struct QueryRangesRetval {
+    PosRangesV ranges;
+    PosInt numRanges;
+
+    /**
+     * size is the number of positions covered by the ranges
+     */
+    PosInt size;
+
+    /**
+     * tooManyHits is set to 1 in case the query matches
+     * more than `maxHits` items (no ranges are returned then)
+     */
+    int tooManyHits;
+    const char* err;
+} QueryRangesRetval;
+
+/**
+ * @brief Evaluate a query and return ranges of its matches sorted
+ * by position with overlapping and adjacent matches merged. This can
+ * be used to define a subcorpus - e.g. a structure query
+ * `<doc txtype="FIC" />` matches whole documents.
+ * To prevent queries like `[]` from exhausting memory, the evaluation
+ * stops as soon as the number of matches exceeds `maxHits`.
+ *
+ * @param corpus
+ * @param query
+ * @param maxHits
+ * @param abortFlag
+ * @return QueryRangesRetval
+ */
+QueryRangesRetval query_ranges(CorpusV corpus, const char* query, PosInt maxHits, AbortFlag abortFlag);
+
+PosRange get_query_range(QueryRangesRetval data, PosInt idx);
+
+void query_ranges_free(QueryRangesRetval data);
+
+#define WORDLIST_SORT_FREQ 0
+#define WORDLIST_SORT_DOCF 1
+#define WORDLIST_SORT_ARF 2
+
+/**
+ * WORDLIST_MAX_NGRAMS is the maximum number of distinct n-grams
+ * counted at a time. Once exceeded, the least frequent n-grams
+ * are pruned (see `wordlist`).
+ */
+#define WORDLIST_MAX_NGRAMS 10000000
+
+/**
+ * WordlistItem is a single item of a word list. For n-grams,
+ * `value` contains space-separated values of individual tokens.
+ * The `docf` and `arf` values are available only in case the list
+ * is sorted by them (see `wordlist`), otherwise they are set to -1.
+ */
+typedef struct WordlistItem {
+    char* value;
+    PosInt freq;
+    PosInt docf;
+    double arf;
+} WordlistItem;
+
+typedef void* WordlistItemsV;
+
+typedef struct WordlistRetval {
+    WordlistItemsV items;
+
+    /**
+     * size is the number of returned items (i.e. a page of the list)
+     */
+    PosInt size;
+
+    /**
+     * total is the number of all the items matching the filters
+     */
+    PosInt total;
+
+    PosInt searchSize;
+
+    /**
+     * isApproximate is 1 in case n-grams had to be pruned
+     * and some frequencies may be underestimated
+     */
+    int isApproximate;
+
+    const char* err;
+} WordlistRetval;
+
+/**
+ * @brief Calculate a word list (or an n-gram list) of a positional attribute.
+ * For unigrams of a whole corpus, the list is obtained directly from
+ * the attribute lexicon and its precompiled frequencies (i.e. also
+ * `docf` and `arf` are available). In other cases (n-grams, subcorpora,
+ * query-defined parts of the corpus), the tokens are read sequentially
+ * from the attribute (no concordance is involved) and only frequencies
+ * are counted (i.e. sorting by `docf` and `arf` is not available).
+ * To keep memory bounded, n-grams are pruned once there are more than
+ * WORDLIST_MAX_NGRAMS of them - n-grams with frequency up to a threshold
+ * (increasing with each pruning) are removed. In such case, frequencies
+ * may be underestimated and `isApproximate` is set.
+ *
+ * @param corpus
+ * @param subcorpus a subcorpus or NULL
+ * @param query a query matching tokens the list is calculated from (e.g. `[] within <doc />`);
+ * an empty value means all tokens of the (sub)corpus
+ * @param attrName
+ * @param pattern a regular expression values must match (for n-grams, at least
+ * one of the tokens must match); an empty value means no filter
+ * @param ignoreCase
+ * @param values newline-separated values the list is restricted to (word lists only);
+ * an empty value means no restriction
+ * @param ngramSize 1 for a word list, 2 and more for n-grams
+ * @param minFreq
+ * @param maxFreq a value <= 0 means no limit
+ * @param sortBy one of WORDLIST_SORT_* values (the order is always descending)
+ * @param offset
+ * @param limit
+ * @param abortFlag
+ * @return WordlistRetval
+ */
+WordlistRetval wordlist(
+    CorpusV corpus,
+    SubCorpusV subcorpus,
+    const char* query,
+    const char* attrName,
+    const char* pattern,
+    int ignoreCase,
+    const char* values,
+    int ngramSize,
+    PosInt minFreq,
+    PosInt maxFreq,
+    int sortBy,
+    PosInt offset,
+    PosInt limit,
+    AbortFlag abortFlag
+);
+
+WordlistItem get_wordlist_item(WordlistRetval data, int idx);
+
+void wordlist_free(WordlistItemsV items, int numItems);
 
 /**
  * StructAttrValue represents a single value found in the value domain
@@ -286,19 +719,82 @@ typedef struct StructAttrValuesRetval {
  * accessible via `get_struct_attr_value_item`. Use `delete_struct_attr_values`
  * to release it once done.
  *
- * @param corpusPath
+ * @param corpus
  * @param limit Maximum number of values collected per structural attribute.
  * If a value domain exceeds this limit, it is cut to `limit` items and
  * the `truncated` flag is set on the collected items. A value <= 0 means
  * no limit is applied.
  * @return StructAttrValuesRetval
  */
-StructAttrValuesRetval get_struct_attr_values(const char* corpusPath, PosInt limit);
+StructAttrValuesRetval get_struct_attr_values(CorpusV corpus, PosInt limit);
 
 StructAttrValue get_struct_attr_value_item(StructAttrValuesRetval data, int idx);
 
 void delete_struct_attr_values(StructAttrValuesV items, int numItems);
 
+/**
+ * WSItem is an item of a precompiled word sketch (a collocate
+ * within a grammatical relation) or of a precompiled thesaurus
+ * (a similar word; `relation` is NULL then).
+ */
+typedef struct WSItem {
+    char* relation;
+
+    /**
+     * relationFreq is a frequency of the relation
+     * with the headword
+     */
+    PosInt relationFreq;
+    char* word;
+
+    /**
+     * freq is a frequency of the collocate within the relation;
+     * for thesaurus items, it is a number of shared contexts
+     */
+    PosInt freq;
+    double score;
+} WSItem;
+
+typedef struct WSRetval {
+    WSItem* items;
+    int size;
+    PosInt headwordFreq;
+    const char* err;
+} WSRetval;
+
+/**
+ * precompiled_word_sketch reads a word sketch of the headword from
+ * word sketch data compiled by Manatee (the WSBASE files). At most
+ * `maxItems` collocates with frequency >= minFreq are returned per
+ * relation (the data are sorted by score). The result must be released
+ * via `free_ws_items`.
+ */
+WSRetval precompiled_word_sketch(
+    CorpusV corpus,
+    const char* wsBase,
+    const char* attrName,
+    const char* headword,
+    PosInt minFreq,
+    int maxItems
+);
+
+/**
+ * precompiled_thesaurus reads words similar to the headword from
+ * thesaurus data compiled by Manatee (the WSTHES files). The result
+ * must be released via `free_ws_items`.
+ */
+WSRetval precompiled_thesaurus(
+    CorpusV corpus,
+    const char* wsThes,
+    const char* attrName,
+    const char* headword,
+    int maxItems
+);
+
+WSItem get_ws_item(WSRetval data, int idx);
+
+void free_ws_items(WSRetval data);
+
 void free_string(char* str);
 
 #ifdef __cplusplus
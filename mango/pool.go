@@ -0,0 +1,112 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package mango
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CorpusPool keeps open corpus handles so repeated queries on
+// the same corpus do not have to reopen it. As Manatee objects
+// are not safe for concurrent use, a handle is always checked out
+// exclusively (Get) and returned once the caller is done (Put).
+// Concurrent queries on the same corpus therefore use different
+// handles. The number of idle handles is limited and the least
+// recently used ones are closed first.
+type CorpusPool struct {
+	maxIdle int
+
+	// idle contains idle *Corpus handles, the most recently
+	// used ones at the front
+	idle *list.List
+	mu   sync.Mutex
+}
+
+// Get returns an open corpus specified by its registry path.
+// If there is an idle handle for the corpus, it is reused
+// (unless the registry file has changed since it was opened).
+// The returned corpus must be returned via Put.
+func (pool *CorpusPool) Get(corpusPath string) (*Corpus, error) {
+	pool.mu.Lock()
+	var stale []*Corpus
+	var ans *Corpus
+	for e := pool.idle.Front(); e != nil; {
+		next := e.Next()
+		corp := e.Value.(*Corpus)
+		if corp.path == corpusPath {
+			pool.idle.Remove(e)
+			if !corp.isStale() {
+				ans = corp
+				break
+			}
+			stale = append(stale, corp)
+		}
+		e = next
+	}
+	pool.mu.Unlock()
+	for _, corp := range stale {
+		corp.Close()
+	}
+	if ans != nil {
+		return ans, nil
+	}
+	return OpenCorpus(corpusPath)
+}
+
+// Put returns a corpus obtained via Get back to the pool.
+func (pool *CorpusPool) Put(corp *Corpus) {
+	if corp == nil {
+		return
+	}
+	// idle handles should not keep removed subcorpora open
+	corp.closeStaleSubcorpora()
+	pool.mu.Lock()
+	pool.idle.PushFront(corp)
+	var evicted []*Corpus
+	for pool.idle.Len() > pool.maxIdle {
+		evicted = append(evicted, pool.idle.Remove(pool.idle.Back()).(*Corpus))
+	}
+	pool.mu.Unlock()
+	for _, c := range evicted {
+		c.Close()
+	}
+}
+
+// Close closes all the idle handles. Handles checked out
+// at the time of the call are closed once returned.
+func (pool *CorpusPool) Close() {
+	pool.mu.Lock()
+	idle := pool.idle
+	pool.idle = list.New()
+	pool.maxIdle = 0
+	pool.mu.Unlock()
+	for e := idle.Front(); e != nil; e = e.Next() {
+		e.Value.(*Corpus).Close()
+	}
+}
+
+// NewCorpusPool creates a pool keeping at most `maxIdle`
+// idle corpus handles.
+func NewCorpusPool(maxIdle int) *CorpusPool {
+	return &CorpusPool{
+		maxIdle: maxIdle,
+		idle:    list.New(),
+	}
+}
@@ -18,7 +18,10 @@
 
 package mango
 
-import "errors"
+import (
+	"errors"
+	"math"
+)
 
 var (
 	collFunc = map[string]byte{
@@ -67,3 +70,43 @@ func NormalizeCollMeasureName(v string) (string, error) {
 	}
 	return "", ErrUnsupportedValue
 }
+
+func xlogx(x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return x * math.Log(x)
+}
+
+// CollScore calculates a collocation measure (specified by its Manatee code,
+// see ImportCollMeasure) the same way Manatee does. This allows for calculating
+// the measures from raw counts merged from multiple chunks of a corpus.
+//
+//   - fAB is a frequency of the collocate in the search range
+//   - fA is a number of concordance lines (i.e. a frequency of the node)
+//   - fB is a frequency of the collocate in the (sub)corpus
+//   - n is a size of the (sub)corpus
+func CollScore(measure byte, fAB, fA, fB, n float64) (float64, error) {
+	switch measure {
+	case 't':
+		return (fAB - fA*fB/n) / math.Sqrt(fAB), nil
+	case 'm':
+		return math.Log2(fAB * n / (fA * fB)), nil
+	case '3':
+		return math.Log2(fAB * fAB * fAB * n / (fA * fB)), nil
+	case 'l':
+		return 2 * (xlogx(fAB) + xlogx(fA-fAB) + xlogx(fB-fAB) + xlogx(n-fA-fB+fAB) -
+			xlogx(fA) - xlogx(fB) - xlogx(n-fA) - xlogx(n-fB) + xlogx(n)), nil
+	case 's':
+		return math.Min(fAB/fA, fAB/fB), nil
+	case 'p':
+		return math.Log2(fAB*n/(fA*fB)) * math.Log(fAB+1), nil
+	case 'r':
+		return fAB / fA * 100, nil
+	case 'f':
+		return fAB, nil
+	case 'd':
+		return 14 + math.Log2(2*fAB/(fA+fB)), nil
+	}
+	return 0, ErrUnsupportedValue
+}
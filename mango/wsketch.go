@@ -0,0 +1,111 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package mango
+
+// #include <stdlib.h>
+// #include "mango.h"
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// GoWSItem is an item of a precompiled word sketch or thesaurus
+type GoWSItem struct {
+
+	// Relation is a name of a grammatical relation
+	// (empty for thesaurus items)
+	Relation string
+
+	// RelationFreq is a frequency of the relation with the headword
+	RelationFreq int64
+
+	Word string
+
+	// Freq is a frequency of the collocate within the relation.
+	// For thesaurus items, it is a number of shared contexts.
+	Freq int64
+
+	Score float64
+}
+
+type GoWSItems struct {
+	HeadwordFreq int64
+	Items        []GoWSItem
+}
+
+func importWSItems(ans C.WSRetval) (GoWSItems, error) {
+	if ans.err != nil {
+		err := errors.New(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return GoWSItems{}, err
+	}
+	defer C.free_ws_items(ans)
+	items := make([]GoWSItem, ans.size)
+	for i := range items {
+		tmp := C.get_ws_item(ans, C.int(i))
+		items[i] = GoWSItem{
+			RelationFreq: int64(tmp.relationFreq),
+			Word:         C.GoString(tmp.word),
+			Freq:         int64(tmp.freq),
+			Score:        float64(tmp.score),
+		}
+		if tmp.relation != nil {
+			items[i].Relation = C.GoString(tmp.relation)
+		}
+	}
+	return GoWSItems{HeadwordFreq: int64(ans.headwordFreq), Items: items}, nil
+}
+
+// PrecompiledWordSketch reads a word sketch of a headword from data
+// compiled by Manatee (`wsBase` is the WSBASE registry value). Items
+// are grouped by relations and sorted by score within a relation.
+func (c *Corpus) PrecompiledWordSketch(
+	wsBase, attr, headword string,
+	minFreq int64,
+	maxItems int,
+) (GoWSItems, error) {
+	cWSBase := C.CString(wsBase)
+	defer C.free(unsafe.Pointer(cWSBase))
+	cAttr := C.CString(attr)
+	defer C.free(unsafe.Pointer(cAttr))
+	cHeadword := C.CString(headword)
+	defer C.free(unsafe.Pointer(cHeadword))
+	return importWSItems(
+		C.precompiled_word_sketch(
+			c.corp, cWSBase, cAttr, cHeadword, C.longlong(minFreq), C.int(maxItems)))
+}
+
+// PrecompiledThesaurus reads words similar to a headword from data
+// compiled by Manatee (`wsThes` is the WSTHES registry value). Items
+// are sorted by score.
+func (c *Corpus) PrecompiledThesaurus(
+	wsThes, attr, headword string,
+	maxItems int,
+) (GoWSItems, error) {
+	cWSThes := C.CString(wsThes)
+	defer C.free(unsafe.Pointer(cWSThes))
+	cAttr := C.CString(attr)
+	defer C.free(unsafe.Pointer(cAttr))
+	cHeadword := C.CString(headword)
+	defer C.free(unsafe.Pointer(cHeadword))
+	return importWSItems(
+		C.precompiled_thesaurus(c.corp, cWSThes, cAttr, cHeadword, C.int(maxItems)))
+}
@@ -89,6 +89,26 @@ func (err TimeoutError) MarshalJSON() ([]byte, error) {
 	return json.Marshal(nil)
 }
 
+// ---------------------------
+
+// CancelledError signals that a query has been cancelled
+// (typically because the client is not interested in the result
+// anymore) before it could be finished.
+type CancelledError struct {
+	Msg string
+}
+
+func (err CancelledError) Error() string {
+	return err.Msg
+}
+
+func (err CancelledError) MarshalJSON() ([]byte, error) {
+	if err.Msg != "" {
+		return json.Marshal(err.Msg)
+	}
+	return json.Marshal(nil)
+}
+
 // -----------------
 
 func PanicValueToErr(v any) (err error) {
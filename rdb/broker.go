@@ -0,0 +1,111 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"time"
+)
+
+// QueryProducer is the API server's side of a job broker.
+type QueryProducer interface {
+
+	// PublishQuery sends a query to a worker and returns a channel
+	// where the result will be sent. Cancelling the `ctx` cancels
+	// the query.
+	PublishQuery(ctx context.Context, query Query, customTimeout time.Duration) (<-chan WorkerResult, error)
+
+	// SubmitJob publishes a query as an asynchronous job
+	SubmitJob(query Query, corpusID string) (JobInfo, error)
+
+	// GetJob returns a job record or ErrJobNotFound
+	GetJob(jobID string) (JobInfo, error)
+
+	// GetJobResult returns a result of a finished job
+	GetJobResult(job JobInfo) (WorkerResult, error)
+
+	// DeleteJob removes a job and cancels it if still running
+	DeleteJob(jobID string) error
+
+	// TryLock acquires a named lock shared by all the API servers.
+	// False means the lock is held by someone else. The lock expires
+	// after `ttl` unless it is released via the returned function.
+	TryLock(name string, ttl time.Duration) (func(), bool, error)
+}
+
+// NormsStore stores text type norms shared by workers.
+type NormsStore interface {
+	GetTextTypeNorms(id string) (map[string]int64, bool, error)
+	SetTextTypeNorms(id string, norms map[string]int64, ttl time.Duration) error
+}
+
+// QueryConsumer is the worker's side of a job broker.
+type QueryConsumer interface {
+	NormsStore
+
+	// Subscribe returns a channel with notifications about
+	// incoming queries (MsgNewQuery)
+	Subscribe() <-chan string
+
+	// DequeueQuery returns a next query to process or ErrorEmptyQueue
+	DequeueQuery(workerID string) (Query, error)
+
+	// AckQuery confirms that a dequeued query has been processed
+	AckQuery(workerID string, query Query) error
+
+	// SomeoneListens tests whether a client still waits for a result
+	SomeoneListens(channel string) (bool, error)
+
+	// StartJob marks a job as running. False means the job
+	// should not be processed.
+	StartJob(jobID, workerID string) (bool, error)
+
+	// SetJobProgress reports progress (0...1) of a running job
+	SetJobProgress(jobID string, progress float64) error
+
+	// WatchCancellation calls `onCancel` once a query is cancelled.
+	// The returned function releases the watch.
+	WatchCancellation(channel string, onCancel func()) (stop func())
+
+	// PublishResult sends a result of a query to a waiting client
+	PublishResult(query Query, value WorkerResult) error
+
+	// FinishJob stores a result of an asynchronous job
+	FinishJob(jobID string, value WorkerResult) error
+
+	// Heartbeat tells others that the worker is alive
+	Heartbeat(workerID string) error
+
+	// RecoverWorkerQueries handles unacknowledged queries of a worker
+	RecoverWorkerQueries(workerID string) error
+}
+
+// Broker transfers queries from API servers to workers
+// and results back to API servers. There are two implementations:
+// Adapter (Redis based, for multi-process installations) and
+// InProcBroker (for a single process installations).
+type Broker interface {
+	QueryProducer
+	QueryConsumer
+}
+
+var (
+	_ Broker = (*Adapter)(nil)
+	_ Broker = (*InProcBroker)(nil)
+)
@@ -0,0 +1,219 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/czcorpus/rexplorer/parser"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultCacheKeyPrefix    = "mqueryCache"
+	DefaultInflightKeyPrefix = "mqueryInflight"
+)
+
+// nonCacheableFuncs lists functions with side effects
+// which must always be processed by a worker no matter
+// how the cache is configured.
+var nonCacheableFuncs = map[string]bool{
+	"calcCollFreqData": true,
+}
+
+// cacheabilityTester is implemented by query arguments which may
+// produce results not suitable for caching (e.g. randomly shuffled
+// concordances).
+type cacheabilityTester interface {
+	IsCacheable() bool
+}
+
+// cachedDataFiles contains arguments common to most of the functions
+// specifying data files a result depends on
+type cachedDataFiles struct {
+	CorpusPath string `json:"corpusPath"`
+	SubcPath   string `json:"subcPath"`
+}
+
+// versionedCorpusFiles are files within a corpus data directory
+// rewritten by each compilation of the corpus. The first one found
+// represents the state of the corpus data.
+var versionedCorpusFiles = []string{"word.text", "word.lex"}
+
+// findVersionedCorpusFile returns a path to a corpus data file
+// representing the state of the corpus data (see versionedCorpusFiles).
+// In case there is no such file, an empty string is returned.
+func findVersionedCorpusFile(regPath string) (string, error) {
+	regBytes, err := os.ReadFile(regPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read registry file: %w", err)
+	}
+	reg, err := parser.ParseRegistryBytes(filepath.Base(regPath), regBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse registry file: %w", err)
+	}
+	dataPath := reg.Entries.Get("PATH").Value()
+	for _, name := range versionedCorpusFiles {
+		path := filepath.Join(dataPath, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to determine state of %s: %w", path, err)
+		}
+	}
+	return "", nil
+}
+
+// writeDataFilesVersion writes a state of data files (corpus registry,
+// corpus data, subcorpus) to the hash so once they change, previously
+// cached results are not used anymore (and they eventually expire).
+// The corpus data are included as a corpus can be recompiled without
+// touching its registry file.
+func writeDataFilesVersion(h io.Writer, files cachedDataFiles) error {
+	var corpusDataPath string
+	if files.CorpusPath != "" {
+		var err error
+		corpusDataPath, err = findVersionedCorpusFile(files.CorpusPath)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range []string{files.CorpusPath, corpusDataPath, files.SubcPath} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to determine state of %s: %w", path, err)
+		}
+		fmt.Fprintf(h, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return nil
+}
+
+func cacheKey(cacheID string) string {
+	return fmt.Sprintf("%s:%s", DefaultCacheKeyPrefix, cacheID)
+}
+
+func inflightKey(cacheID string) string {
+	return fmt.Sprintf("%s:%s", DefaultInflightKeyPrefix, cacheID)
+}
+
+// cacheID returns a stable identifier of a query based on its
+// function, arguments and a state of the corpus (and subcorpus)
+// files. The second returned value is false if results of the query
+// should not be cached.
+func (a *Adapter) cacheID(query Query) (string, bool) {
+	if nonCacheableFuncs[query.Func] || a.conf.ResultCacheTTLSecs[query.Func] <= 0 {
+		return "", false
+	}
+	if tester, ok := query.Args.(cacheabilityTester); ok && !tester.IsCacheable() {
+		return "", false
+	}
+	// note: JSON encoding of structs (args) is stable as it
+	// follows the order of fields and map keys are sorted
+	args, err := json.Marshal(query.Args)
+	if err != nil {
+		log.Error().Err(err).Str("func", query.Func).Msg("failed to create query cache ID")
+		return "", false
+	}
+	var files cachedDataFiles
+	if err := json.Unmarshal(args, &files); err != nil {
+		// args not encoded as an object, i.e. no data files
+		files = cachedDataFiles{}
+	}
+	h := sha1.New()
+	if err := writeDataFilesVersion(h, files); err != nil {
+		log.Error().Err(err).Str("func", query.Func).Msg("failed to create query cache ID")
+		return "", false
+	}
+	h.Write([]byte(query.Func))
+	h.Write([]byte{0})
+	h.Write(args)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// getCachedResult returns a cached result (if found).
+// Any problem with the cache is logged and reported as
+// a cache miss.
+func (a *Adapter) getCachedResult(cacheID string) (WorkerResult, bool) {
+	cmd := a.redis.Get(a.ctx, cacheKey(cacheID))
+	if cmd.Err() == redis.Nil {
+		return WorkerResult{}, false
+
+	} else if cmd.Err() != nil {
+		log.Error().Err(cmd.Err()).Str("cacheId", cacheID).Msg("failed to get cached result")
+		return WorkerResult{}, false
+	}
+	wr, err := DecodeWorkerResult(cmd.Val())
+	if err != nil {
+		log.Error().Err(err).Str("cacheId", cacheID).Msg("failed to decode cached result")
+		return WorkerResult{}, false
+	}
+	return wr, true
+}
+
+func (a *Adapter) storeCachedResult(query Query, data []byte) error {
+	ttl := time.Duration(a.conf.ResultCacheTTLSecs[query.Func]) * time.Second
+	if ttl <= 0 {
+		return nil
+	}
+	return a.redis.Set(a.ctx, cacheKey(query.CacheID), data, ttl).Err()
+}
+
+// registerInflightQuery tries to register a query as the one which
+// will be actually processed. If an identical query has been already
+// registered, the returned channel is the one of the registered query
+// and the returned bool is false. The registration expires after
+// `timeout` so a lost query does not block others forever.
+func (a *Adapter) registerInflightQuery(
+	cacheID, channel string,
+	timeout time.Duration,
+) (string, bool, error) {
+	for {
+		ok, err := a.redis.SetNX(a.ctx, inflightKey(cacheID), channel, timeout).Result()
+		if err != nil {
+			return "", false, fmt.Errorf("failed to register query: %w", err)
+		}
+		if ok {
+			return channel, true, nil
+		}
+		leaderChannel, err := a.redis.Get(a.ctx, inflightKey(cacheID)).Result()
+		if err == redis.Nil {
+			continue // the query has just finished, let's try again
+
+		} else if err != nil {
+			return "", false, fmt.Errorf("failed to register query: %w", err)
+		}
+		return leaderChannel, false, nil
+	}
+}
+
+func (a *Adapter) unregisterInflightQuery(cacheID string) error {
+	return a.redis.Del(a.ctx, inflightKey(cacheID)).Err()
+}
@@ -0,0 +1,128 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCachingAdapter() *Adapter {
+	return &Adapter{
+		conf: &Conf{
+			ResultCacheTTLSecs: map[string]int{
+				"concordance":      60,
+				"freqDistrib":      60,
+				"calcCollFreqData": 60,
+			},
+		},
+	}
+}
+
+func createTestFile(t *testing.T, path string) {
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createTestRegistry creates a registry file of a corpus
+// with data in the `dataDir` directory
+func createTestRegistry(t *testing.T, path, dataDir string) {
+	reg := "PATH \"" + dataDir + "\"\nATTRIBUTE word\n"
+	if err := os.WriteFile(path, []byte(reg), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheIDStable(t *testing.T) {
+	a := newTestCachingAdapter()
+	regPath := filepath.Join(t.TempDir(), "syn2020")
+	createTestRegistry(t, regPath, t.TempDir())
+	q := Query{Func: "concordance", Args: ConcordanceArgs{CorpusPath: regPath, Query: "[word=\"a\"]"}}
+	id1, ok := a.cacheID(q)
+	assert.True(t, ok)
+	id2, ok := a.cacheID(q)
+	assert.True(t, ok)
+	assert.Equal(t, id1, id2)
+
+	q2 := Query{Func: "concordance", Args: ConcordanceArgs{CorpusPath: regPath, Query: "[word=\"b\"]"}}
+	id3, ok := a.cacheID(q2)
+	assert.True(t, ok)
+	assert.NotEqual(t, id1, id3)
+}
+
+func TestCacheIDNonCacheable(t *testing.T) {
+	a := newTestCachingAdapter()
+	regPath := filepath.Join(t.TempDir(), "syn2020")
+	createTestRegistry(t, regPath, t.TempDir())
+	_, ok := a.cacheID(Query{Func: "concordance", Args: ConcordanceArgs{CorpusPath: regPath, Shuffle: true}})
+	assert.False(t, ok)
+	_, ok = a.cacheID(Query{
+		Func: "concordance",
+		Args: ConcordanceArgs{CorpusPath: regPath, Sample: ConcSampleArgs{Size: 100, Seed: 7}},
+	})
+	assert.False(t, ok)
+	_, ok = a.cacheID(Query{
+		Func: "freqDistrib",
+		Args: FreqDistribArgs{CorpusPath: regPath, Sample: ConcSampleArgs{Size: 100}},
+	})
+	assert.False(t, ok)
+	_, ok = a.cacheID(Query{Func: "calcCollFreqData", Args: CalcCollFreqDataArgs{CorpusPath: regPath}})
+	assert.False(t, ok)
+	_, ok = a.cacheID(Query{Func: "collocations", Args: CollocationsArgs{CorpusPath: regPath}})
+	assert.False(t, ok)
+	// missing corpus files
+	_, ok = a.cacheID(Query{Func: "concordance", Args: ConcordanceArgs{CorpusPath: regPath + "x"}})
+	assert.False(t, ok)
+}
+
+func TestCacheIDChangesWithData(t *testing.T) {
+	a := newTestCachingAdapter()
+	dir := t.TempDir()
+	dataDir := t.TempDir()
+	regPath := filepath.Join(dir, "syn2020")
+	subcPath := filepath.Join(dir, "chunk_00.subc")
+	createTestRegistry(t, regPath, dataDir)
+	createTestFile(t, filepath.Join(dataDir, "word.text"))
+	createTestFile(t, subcPath)
+	q := Query{Func: "freqDistrib", Args: FreqDistribArgs{CorpusPath: regPath, SubcPath: subcPath}}
+	id1, ok := a.cacheID(q)
+	assert.True(t, ok)
+
+	future := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(regPath, future, future))
+	id2, ok := a.cacheID(q)
+	assert.True(t, ok)
+	assert.NotEqual(t, id1, id2)
+
+	assert.NoError(t, os.WriteFile(subcPath, []byte("other data"), 0644))
+	id3, ok := a.cacheID(q)
+	assert.True(t, ok)
+	assert.NotEqual(t, id2, id3)
+
+	// a recompiled corpus with the registry file untouched
+	assert.NoError(t, os.WriteFile(filepath.Join(dataDir, "word.text"), []byte("other data"), 0644))
+	id4, ok := a.cacheID(q)
+	assert.True(t, ok)
+	assert.NotEqual(t, id3, id4)
+}
@@ -0,0 +1,112 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MsgCancelQuery = "cancelQuery"
+)
+
+// cancelChannel returns a name of a channel used to notify
+// a worker that a query published on the `channel` has been
+// cancelled. The same name is used as a key of a flag
+// which prevents workers from starting an already cancelled
+// query (e.g. in case the cancel message is published before
+// the worker subscribes to the cancel channel).
+func cancelChannel(channel string) string {
+	return fmt.Sprintf("%s:cancel", channel)
+}
+
+// cancelQuery cancels a query identified by its result channel.
+// If the query is still queued, it is just removed from the queue.
+// Otherwise, a cancel flag is set and a worker processing the query
+// is notified via a respective cancel channel.
+// The `queueKey` and `receipt` arguments are optional (in such case,
+// no removal from the queue is attempted).
+func (a *Adapter) cancelQuery(channel, queueKey, receipt string) error {
+	if receipt != "" {
+		removed, err := a.backend.remove(queueKey, receipt)
+		if err != nil {
+			return fmt.Errorf("failed to cancel query: %w", err)
+		}
+		if removed {
+			log.Debug().Str("channel", channel).Msg("cancelled query removed from the queue")
+			return nil
+		}
+	}
+	if err := a.redis.Set(a.ctx, cancelChannel(channel), MsgCancelQuery, DefaultResultExpiration).Err(); err != nil {
+		return fmt.Errorf("failed to cancel query: %w", err)
+	}
+	if err := a.redis.Publish(a.ctx, cancelChannel(channel), MsgCancelQuery).Err(); err != nil {
+		return fmt.Errorf("failed to cancel query: %w", err)
+	}
+	log.Debug().Str("channel", channel).Msg("sent cancel signal for a running query")
+	return nil
+}
+
+// IsCancelled tests whether a query identified by its result
+// channel has been cancelled.
+func (a *Adapter) IsCancelled(channel string) (bool, error) {
+	n, err := a.redis.Exists(a.ctx, cancelChannel(channel)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to test query cancellation: %w", err)
+	}
+	return n > 0, nil
+}
+
+// WatchCancellation calls `onCancel` once a query identified by its
+// result channel is cancelled. The returned function must be called
+// once the query is processed to release the watch.
+func (a *Adapter) WatchCancellation(channel string, onCancel func()) (stop func()) {
+	sub := a.redis.Subscribe(a.ctx, cancelChannel(channel))
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case msg, ok := <-sub.Channel():
+				if !ok {
+					return
+				}
+				if msg.Payload == MsgCancelQuery {
+					onCancel()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	// the cancel message might have been published before
+	// we subscribed so we have to test the flag too
+	cancelled, err := a.IsCancelled(channel)
+	if err != nil {
+		log.Error().Err(err).Str("channel", channel).Msg("failed to test query cancellation")
+
+	} else if cancelled {
+		onCancel()
+	}
+	return func() {
+		close(done)
+		sub.Close()
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"errors"
+	"mquery/merror"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelQueuedQuery(t *testing.T) {
+	b := newTestInProcBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	wait, err := b.PublishQuery(ctx, Query{Func: "concordance"}, 0)
+	assert.NoError(t, err)
+	cancel()
+	res := <-wait
+	var cErr merror.CancelledError
+	assert.True(t, errors.As(res.Value.Err(), &cErr))
+	_, err = b.DequeueQuery("w1")
+	assert.Equal(t, ErrorEmptyQueue, err)
+}
+
+func TestCancelRunningQuery(t *testing.T) {
+	b := newTestInProcBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	wait, err := b.PublishQuery(ctx, Query{Func: "concordance"}, 0)
+	assert.NoError(t, err)
+	query, err := b.DequeueQuery("w1")
+	assert.NoError(t, err)
+
+	aborted := make(chan struct{})
+	stop := b.WatchCancellation(query.Channel, func() { close(aborted) })
+	defer stop()
+	cancel()
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Error("running query not aborted")
+	}
+	res := <-wait
+	var cErr merror.CancelledError
+	assert.True(t, errors.As(res.Value.Err(), &cErr))
+}
+
+func TestWatchAlreadyCancelledQuery(t *testing.T) {
+	b := newTestInProcBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	wait, err := b.PublishQuery(ctx, Query{Func: "concordance"}, 0)
+	assert.NoError(t, err)
+	query, err := b.DequeueQuery("w1")
+	assert.NoError(t, err)
+	// the client goes away before the worker starts watching
+	cancel()
+	<-wait
+	var aborted bool
+	stop := b.WatchCancellation(query.Channel, func() { aborted = true })
+	defer stop()
+	assert.True(t, aborted)
+}
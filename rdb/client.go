@@ -19,9 +19,7 @@
 package rdb
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"mquery/merror"
@@ -47,72 +45,292 @@ var (
 	ErrorEmptyQueue = errors.New("no queries in the queue")
 )
 
+// Query is a request for a worker to run a function. Queries
+// are transferred to workers in the form of QueryEnvelope.
 type Query struct {
 	Channel string
 	Func    string
 	Args    any
+
+	// JobID is set for asynchronous queries (jobs) where
+	// nobody waits for the result on the Channel.
+	JobID string
+
+	// CacheID is set for queries with cacheable results. The worker
+	// stores the result in the cache under the ID (see PublishResult).
+	CacheID string
+
+	// Class distinguishes queries of the same function by their
+	// origin (e.g. QueryClassSplitChunk for partial queries on split
+	// corpora) so they can be routed to different queues. Empty
+	// class means an ordinary (interactive) query.
+	Class string
+
+	// Attempt is a zero-based number of a processing attempt.
+	// It is increased each time the query is re-queued because
+	// a worker processing it stopped unexpectedly.
+	Attempt int
+
+	// queueKey and receipt identify a dequeued query
+	// in the queue backend (see AckQuery)
+	queueKey string
+	receipt  string
 }
 
 // ----------------------
 
 type CorpusInfoArgs struct {
-	CorpusPath string
-	Language   string
+	CorpusPath string `json:"corpusPath"`
+	Language   string `json:"language"`
+}
+
+// --------------
+
+// ConcFilterArgs specifies a filter applied to concordance lines
+// (see ConcFilterArgs.Positive).
+type ConcFilterArgs struct {
+	Query string `json:"query"`
+
+	// Positive specifies that lines with the Query matched within
+	// the range are kept. Otherwise, such lines are removed.
+	Positive bool `json:"positive"`
+
+	// LftCtx and RgtCtx specify the range where the Query is
+	// searched (negative numbers are on the left side of the KWIC)
+	LftCtx int `json:"lftCtx"`
+	RgtCtx int `json:"rgtCtx"`
+
+	// AnchorLast specifies that the range is relative to the last
+	// token of the KWIC (by default, the first token is used)
+	AnchorLast bool `json:"anchorLast"`
+
+	ExcludeKWIC bool `json:"excludeKwic"`
+}
+
+// ConcSampleArgs specifies a reproducible random reduction
+// of a concordance. The zero Size means no reduction.
+type ConcSampleArgs struct {
+	Size int    `json:"size"`
+	Seed uint64 `json:"seed"`
 }
 
 // --------------
 
 type FreqDistribArgs struct {
-	CorpusPath  string
-	SubcPath    string
-	Query       string
-	Crit        string
-	IsTextTypes bool
-	FreqLimit   int
-	MaxItems    int
+	CorpusPath  string `json:"corpusPath"`
+	SubcPath    string `json:"subcPath"`
+	Query       string `json:"query"`
+	Crit        string `json:"crit"`
+	IsTextTypes bool   `json:"isTextTypes"`
+	FreqLimit   int    `json:"freqLimit"`
+	MaxItems    int    `json:"maxItems"`
+
+	// Filters are applied to the concordance in the order of the slice
+	Filters []ConcFilterArgs `json:"filters,omitempty"`
+
+	// Sample reduces the (filtered) concordance
+	Sample ConcSampleArgs `json:"sample"`
+}
+
+// IsCacheable tells whether a result can be cached. Results
+// based on a random sample must be always recalculated.
+func (args FreqDistribArgs) IsCacheable() bool {
+	return args.Sample.Size == 0
 }
 
 // --------------
 
+const (
+	CollSyntaxRelDependent = "dependent"
+	CollSyntaxRelHead      = "head"
+)
+
+// CollSyntaxArgs specifies a syntactic relation between the KWIC
+// and collocates in a dependency-parsed corpus.
+// The zero value means no syntactic restriction.
+type CollSyntaxArgs struct {
+
+	// Rel is either CollSyntaxRelDependent (collocates are dependents
+	// of the KWIC) or CollSyntaxRelHead (a collocate is the head of the KWIC)
+	Rel string `json:"rel"`
+
+	// ParentAttr is a positional attribute containing a relative
+	// position of a token's head
+	ParentAttr string `json:"parentAttr"`
+
+	DeprelAttr string `json:"deprelAttr"`
+
+	// Deprel limits the relation to a dependency relation type
+	// (e.g. `amod`). In case of CollSyntaxRelDependent, the type
+	// of collocates is tested, in case of CollSyntaxRelHead,
+	// the type of the KWIC is tested.
+	Deprel string `json:"deprel"`
+}
+
+func (args CollSyntaxArgs) IsZero() bool {
+	return args.Rel == ""
+}
+
 type CollocationsArgs struct {
-	CorpusPath string
-	SubcPath   string
-	Query      string
-	Attr       string
-	Measure    string
-	SrchRange  [2]int
+	CorpusPath string `json:"corpusPath"`
+	SubcPath   string `json:"subcPath"`
+	Query      string `json:"query"`
+	Attr       string `json:"attr"`
+	Measure    string `json:"measure"`
+	SrchRange  [2]int `json:"srchRange"`
 
 	// MinFreq is the minimum frequency of the collocate in the collocation
-	MinFreq int64
+	MinFreq int64 `json:"minFreq"`
 
 	// MinCorpFreq is the minimum frequency of the collocate in corpus
-	MinCorpFreq int64
-	MaxItems    int
+	MinCorpFreq int64 `json:"minCorpFreq"`
+	MaxItems    int   `json:"maxItems"`
+
+	// SrchStruct limits collocates to the structure (e.g. a sentence)
+	// containing the KWIC
+	SrchStruct string `json:"srchStruct,omitempty"`
+
+	// Syntax limits collocates to tokens syntactically
+	// related to the KWIC
+	Syntax CollSyntaxArgs `json:"syntax"`
+
+	// Filters are applied to the concordance in the order of the slice
+	Filters []ConcFilterArgs `json:"filters,omitempty"`
+
+	// Sample reduces the (filtered) concordance
+	Sample ConcSampleArgs `json:"sample"`
+}
+
+// IsCacheable tells whether a result can be cached. Results
+// based on a random sample must be always recalculated.
+func (args CollocationsArgs) IsCacheable() bool {
+	return args.Sample.Size == 0
+}
+
+// --------------
+
+// CollocationCountsArgs specifies a calculation of raw collocation
+// counts (see CollocationsArgs). The Measure, MinFreq, MinCorpFreq and
+// MaxItems are ignored as all the candidates must be returned so
+// counts from multiple chunks of a split corpus can be merged.
+type CollocationCountsArgs CollocationsArgs
+
+// IsCacheable tells whether a result can be cached. Results
+// based on a random sample must be always recalculated.
+func (args CollocationCountsArgs) IsCacheable() bool {
+	return args.Sample.Size == 0
 }
 
 // --------------
 
 type TermFrequencyArgs ConcordanceArgs
 
+// IsCacheable tells whether a result can be cached. Results
+// based on a random sample must be always recalculated.
+func (args TermFrequencyArgs) IsCacheable() bool {
+	return args.Sample.Size == 0
+}
+
+// --------------
+
+type DispersionArgs struct {
+	CorpusPath string `json:"corpusPath"`
+	SubcPath   string `json:"subcPath"`
+	Query      string `json:"query"`
+
+	// DocStruct is a structure representing documents
+	// (if empty, the corpus DOCSTRUCTURE is used)
+	DocStruct string `json:"docStruct"`
+
+	// TextTypeAttr is an optional structural attribute
+	// (e.g. `doc.txtype`) to calculate frequencies for
+	TextTypeAttr string `json:"textTypeAttr"`
+
+	// TotalHits and TotalDocsSize are hits within documents and
+	// the documents size of the whole searched corpus in case
+	// the searched subcorpus is its part (e.g. a split corpus chunk).
+	// They are needed for Gries' DP. Zero values mean that the values
+	// of the searched subcorpus are used.
+	TotalHits     int64 `json:"totalHits"`
+	TotalDocsSize int64 `json:"totalDocsSize"`
+}
+
 // --------------
 
+// CreateSubcorpusArgs specifies a subcorpus to be created
+// (stored to SubcPath) either by a query or by explicit
+// position ranges (in case Query is empty)
+type CreateSubcorpusArgs struct {
+	CorpusPath string `json:"corpusPath"`
+	SubcPath   string `json:"subcPath"`
+
+	// Query is a CQL query whose matches define the subcorpus
+	// (e.g. `<doc txtype="FIC" />` for whole documents)
+	Query string `json:"query"`
+
+	// Ranges are position ranges [from, to)
+	Ranges [][2]int64 `json:"ranges"`
+
+	// MaxQueryHits is the maximum number of items the Query
+	// may match (e.g. `[]` matches all the corpus tokens)
+	MaxQueryHits int64 `json:"maxQueryHits"`
+}
+
+// --------------
+
+// ConcSortArgs specifies sorting of concordance lines.
+// The zero value means no sorting.
+type ConcSortArgs struct {
+
+	// Attr is a positional attribute the lines are sorted by
+	Attr string `json:"attr"`
+
+	// Pos specifies tokens used for sorting (relative to the KWIC)
+	// in the Manatee format - e.g. `-1<0` (the first token on the left),
+	// `0<0~0>0` (the KWIC), `1>0` (the first token on the right)
+	Pos string `json:"pos"`
+
+	Descending bool `json:"descending"`
+
+	IgnoreCase bool `json:"ignoreCase"`
+}
+
+func (args ConcSortArgs) IsZero() bool {
+	return args.Attr == ""
+}
+
 type ConcordanceArgs struct {
-	CorpusPath        string
-	SubcPath          string
-	Query             string
-	QueryLemma        string
-	CollQuery         string
-	CollLftCtx        int
-	CollRgtCtx        int
-	Attrs             []string
-	ShowStructs       []string
-	ShowRefs          []string
-	MaxItems          int
-	Shuffle           bool
-	RowsOffset        int
-	MaxContext        int
-	ViewContextStruct string
-	ParentIdxAttr     string
+	CorpusPath        string   `json:"corpusPath"`
+	SubcPath          string   `json:"subcPath"`
+	Query             string   `json:"query"`
+	QueryLemma        string   `json:"queryLemma"`
+	CollQuery         string   `json:"collQuery"`
+	CollLftCtx        int      `json:"collLftCtx"`
+	CollRgtCtx        int      `json:"collRgtCtx"`
+	Attrs             []string `json:"attrs"`
+	ShowStructs       []string `json:"showStructs"`
+	ShowRefs          []string `json:"showRefs"`
+	MaxItems          int      `json:"maxItems"`
+	Shuffle           bool     `json:"shuffle"`
+	RowsOffset        int      `json:"rowsOffset"`
+	MaxContext        int      `json:"maxContext"`
+	ViewContextStruct string   `json:"viewContextStruct"`
+	ParentIdxAttr     string   `json:"parentIdxAttr"`
+
+	// Sort specifies sorting of lines. If set, Shuffle is ignored.
+	Sort ConcSortArgs `json:"sort"`
+
+	// Filters are applied to the concordance in the order of the slice
+	Filters []ConcFilterArgs `json:"filters,omitempty"`
+
+	// Sample reduces the (filtered) concordance
+	Sample ConcSampleArgs `json:"sample"`
+}
+
+// IsCacheable tells whether a result can be cached. Randomly
+// shuffled or sampled concordances must be always recalculated.
+func (args ConcordanceArgs) IsCacheable() bool {
+	return !args.Shuffle && args.Sample.Size == 0
 }
 
 // AsDescription provides a human-readable representation
@@ -129,63 +347,141 @@ func (args *ConcordanceArgs) AsDescription() string {
 // --------------
 
 type CalcCollFreqDataArgs struct {
-	CorpusPath string
-	SubcPath   string
-	Attrs      []string
+	CorpusPath string   `json:"corpusPath"`
+	SubcPath   string   `json:"subcPath"`
+	Attrs      []string `json:"attrs"`
 
 	// Structs any structure involved in possible text type
 	// freq. distribution must be here so we can prepare
 	// intermediate data
-	Structs        []string
-	MktokencovPath string
+	Structs        []string `json:"structs"`
+	MktokencovPath string   `json:"mktokencovPath"`
 }
 
 // --------------
 
 type TextTypeNormsArgs struct {
-	CorpusPath string
-	StructAttr string
+	CorpusPath string `json:"corpusPath"`
+	StructAttr string `json:"structAttr"`
 }
 
 // ---------------
 
 type TokenContextArgs struct {
-	CorpusPath string
-	Idx        int64
-	KWICLen    int64
-	LeftCtx    int64
-	RightCtx   int64
-	Structs    []string
-	Attrs      []string
+	CorpusPath string   `json:"corpusPath"`
+	Idx        int64    `json:"idx"`
+	KWICLen    int64    `json:"kwicLen"`
+	LeftCtx    int64    `json:"leftCtx"`
+	RightCtx   int64    `json:"rightCtx"`
+	Structs    []string `json:"structs"`
+	Attrs      []string `json:"attrs"`
 }
 
 // --------------
 
 type TextTypesAvailValuesArgs struct {
-	CorpusPath       string
-	MaxValueListSize int
-	SkipTruncated    bool
+	CorpusPath       string `json:"corpusPath"`
+	MaxValueListSize int    `json:"maxValueListSize"`
+	SkipTruncated    bool   `json:"skipTruncated"`
 }
 
 // --------------
 
-type StatusWriter interface {
-	Write(rec JobLog)
+type WordSketchArgs struct {
+	CorpusPath string `json:"corpusPath"`
+
+	// WSDefPath is a path to a sketch grammar. If empty,
+	// the corpus `WSDEF` registry value is used.
+	WSDefPath string `json:"wsDefPath"`
+
+	// Attr is a positional attribute of headwords
+	// and collocates (typically `lemma`)
+	Attr string `json:"attr"`
+
+	Headword string `json:"headword"`
+
+	// MinFreq is the minimum frequency of a collocate
+	// within a relation
+	MinFreq int `json:"minFreq"`
+
+	// MaxItems is the maximum number of collocates per relation
+	MaxItems int `json:"maxItems"`
+
+	// WSBase is a path to word sketch data precompiled by Manatee
+	// (the `WSBASE` registry value). If empty, the sketch is calculated
+	// on the fly using the sketch grammar.
+	WSBase string `json:"wsBase"`
 }
 
 // --------------
 
-func DecodeQuery(q string) (Query, error) {
-	var ans Query
-	var buf bytes.Buffer
-	buf.WriteString(q)
-	dec := gob.NewDecoder(&buf)
-	if err := dec.Decode(&ans); err != nil {
-		return Query{}, err
-	}
-	return ans, nil
+type ThesaurusArgs struct {
+	CorpusPath string `json:"corpusPath"`
+	WSDefPath  string `json:"wsDefPath"`
+	Attr       string `json:"attr"`
+	Headword   string `json:"headword"`
+	MinFreq    int    `json:"minFreq"`
+
+	// MaxContexts is the maximum number of the headword's
+	// (relation, collocate) pairs used for finding similar words
+	MaxContexts int `json:"maxContexts"`
+
+	MaxItems int `json:"maxItems"`
+
+	// WSThes is a path to thesaurus data precompiled by Manatee
+	// (the `WSTHES` registry value). If empty, similar words
+	// are searched on the fly using the sketch grammar.
+	WSThes string `json:"wsThes"`
+}
+
+// --------------
+
+const (
+	WordlistSortFreq = "freq"
+	WordlistSortDocf = "docf"
+	WordlistSortARF  = "arf"
+)
+
+type WordlistArgs struct {
+	CorpusPath string `json:"corpusPath"`
+	SubcPath   string `json:"subcPath"`
+
+	// Query optionally limits tokens the list is calculated
+	// from (e.g. a text-type subcorpus `[] within <doc ... />`)
+	Query string `json:"query"`
+
+	Attr string `json:"attr"`
+
+	// Pattern is a regular expression values must match
+	Pattern    string `json:"pattern"`
+	IgnoreCase bool   `json:"ignoreCase"`
+
+	// Values optionally restricts a word list to the values
+	// (not available for n-grams)
+	Values []string `json:"values"`
+
+	// NgramSize is 1 for a word list and 2+ for n-grams
+	NgramSize int   `json:"ngramSize"`
+	MinFreq   int64 `json:"minFreq"`
+
+	// MaxFreq is the maximum frequency (0 means no limit)
+	MaxFreq int64 `json:"maxFreq"`
+
+	// SortBy is one of WordlistSort* values
+	SortBy string `json:"sortBy"`
+
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
 }
 
+// --------------
+
+type StatusWriter interface {
+	Write(rec JobLog)
+}
+
+// --------------
+
 // Adapter provides functions for query producers and consumers
 // using Redis database. It leverages Redis' PUBSUB functionality
 // to notify about incoming data.
@@ -197,6 +493,20 @@ type Adapter struct {
 	channelResultPrefix string
 	queryAnswerTimeout  time.Duration
 	statusWriter        StatusWriter
+
+	// queues contains all the configured queues (incl. the default one)
+	queues []queue
+
+	// funcQueues maps query functions to queue keys
+	funcQueues map[string]string
+
+	// classQueues maps query classes to queue keys
+	classQueues map[string]string
+
+	// consumedQueues are queues DequeueQuery takes queries from
+	consumedQueues []queue
+
+	backend queueBackend
 }
 
 func (a *Adapter) TestConnection(timeout time.Duration) error {
@@ -245,11 +555,44 @@ func (a *Adapter) SomeoneListens(channel string) (bool, error) {
 // process fails during the calculation, a respective error
 // is packed into the WorkerResult value. The error returned
 // by this method means that the publishing itself failed.
-func (a *Adapter) PublishQuery(query Query, customTimeout time.Duration) (<-chan WorkerResult, error) {
+// Once the provided `ctx` is cancelled (e.g. the HTTP client
+// disconnected), the query is removed from the queue or - if
+// already running - a worker processing it is asked to abort it.
+// For cacheable functions (see Conf.ResultCacheTTLSecs), a cached
+// result is returned right away if available. Also, in case an identical
+// query is already being processed, no new query is published and
+// its result is shared instead.
+func (a *Adapter) PublishQuery(ctx context.Context, query Query, customTimeout time.Duration) (<-chan WorkerResult, error) {
 	query.Channel = fmt.Sprintf("%s:%s", a.channelResultPrefix, uuid.New().String())
 	if customTimeout <= 0 {
 		customTimeout = a.queryAnswerTimeout
 	}
+	if cacheID, ok := a.cacheID(query); ok {
+		if wr, ok := a.getCachedResult(cacheID); ok {
+			log.Debug().
+				Str("func", query.Func).
+				Str("cacheId", cacheID).
+				Msg("using cached result")
+			ans := make(chan WorkerResult, 1)
+			ans <- wr
+			close(ans)
+			return ans, nil
+		}
+		leaderChannel, isLeader, err := a.registerInflightQuery(cacheID, query.Channel, customTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if !isLeader {
+			log.Debug().
+				Str("func", query.Func).
+				Str("channel", leaderChannel).
+				Msg("identical query already in progress, waiting for its result")
+			query.Channel = leaderChannel
+			sub := a.redis.Subscribe(a.ctx, query.Channel)
+			return a.awaitResult(ctx, sub, query, "", customTimeout), nil
+		}
+		query.CacheID = cacheID
+	}
 	log.Debug().
 		Str("channel", query.Channel).
 		Str("func", query.Func).
@@ -257,17 +600,71 @@ func (a *Adapter) PublishQuery(query Query, customTimeout time.Duration) (<-chan
 		Any("args", query.Args).
 		Msg("publishing query")
 
-	var msg bytes.Buffer
-	enc := gob.NewEncoder(&msg)
-	err := enc.Encode(query)
+	msg, err := EncodeQuery(query)
 	if err != nil {
 		return nil, err
 	}
 	sub := a.redis.Subscribe(a.ctx, query.Channel)
-	if err := a.redis.LPush(a.ctx, DefaultQueueKey, msg.Bytes()).Err(); err != nil {
+	receipt, err := a.backend.push(a.queueKeyFor(query), msg)
+	if err != nil {
+		sub.Close()
 		return nil, err
 	}
-	ans := make(chan WorkerResult)
+	ans := a.awaitResult(ctx, sub, query, receipt, customTimeout)
+	return ans, a.redis.Publish(a.ctx, a.channelQuery, MsgNewQuery).Err()
+}
+
+// loadResult loads and decodes a result stored under `resultKey`.
+// Any error is packed into the returned WorkerResult.
+func (a *Adapter) loadResult(query Query, resultKey string) WorkerResult {
+	cmd := a.redis.Get(a.ctx, resultKey)
+	if cmd.Err() != nil {
+		return WorkerResult{
+			Value: ErrorResult{
+				Func:  query.Func,
+				Error: cmd.Err(),
+			},
+		}
+	}
+	wr, err := DecodeWorkerResult(cmd.Val())
+	if err != nil {
+		a.statusWriter.Write(JobLog{
+			WorkerID: "-",
+			Func:     query.Func,
+			Err:      fmt.Errorf("undecodable worker response: %w", err),
+		})
+		return WorkerResult{
+			Value: ErrorResult{
+				Func:  query.Func,
+				Error: err,
+			},
+		}
+	}
+	a.statusWriter.Write(JobLog{
+		WorkerID: wr.ID,
+		Func:     string(wr.Value.Type()),
+		Begin:    wr.ProcBegin,
+		End:      wr.ProcEnd,
+		Err:      wr.Value.Err(),
+	})
+	return wr
+}
+
+// awaitResult waits for a result of a published query and sends it
+// via the returned channel. The `receipt` (see queueBackend.push) should
+// be empty in case we are not the publisher of the query (i.e. we just share
+// a result of an identical query) - in such case, the result may already be
+// available and we also never cancel the query.
+func (a *Adapter) awaitResult(
+	ctx context.Context,
+	sub *redis.PubSub,
+	query Query,
+	receipt string,
+	timeout time.Duration,
+) <-chan WorkerResult {
+	// note: the buffer allows the goroutine below to finish even
+	// if nobody reads the result anymore (e.g. cancelled request)
+	ans := make(chan WorkerResult, 1)
 
 	// now we wait for response and send result via `ans`
 	go func() {
@@ -276,7 +673,15 @@ func (a *Adapter) PublishQuery(query Query, customTimeout time.Duration) (<-chan
 			close(ans)
 		}()
 
-		tmr := time.NewTimer(customTimeout)
+		if receipt == "" {
+			// the result might have been published before we subscribed
+			if n, err := a.redis.Exists(a.ctx, query.Channel).Result(); err == nil && n > 0 {
+				ans <- a.loadResult(query, query.Channel)
+				return
+			}
+		}
+
+		tmr := time.NewTimer(timeout)
 
 		for {
 			select {
@@ -285,51 +690,35 @@ func (a *Adapter) PublishQuery(query Query, customTimeout time.Duration) (<-chan
 					Str("channel", query.Channel).
 					Bool("closedChannel", !ok).
 					Msg("received result")
-				cmd := a.redis.Get(a.ctx, item.Payload)
-				if cmd.Err() != nil {
-					ans <- WorkerResult{
-						Value: ErrorResult{
-							Func:  query.Func,
-							Error: cmd.Err(),
-						},
-					}
-					tmr.Stop()
-
-				} else {
-					var buff bytes.Buffer
-					buff.WriteString(cmd.Val())
-					dec := gob.NewDecoder(&buff)
-					var wr WorkerResult
-					err := dec.Decode(&wr)
-					if err != nil {
-						ans <- WorkerResult{
-							Value: ErrorResult{
-								Func:  query.Func,
-								Error: err,
-							},
-						}
-						a.statusWriter.Write(JobLog{
-							WorkerID: "-",
-							Func:     query.Func,
-							Err:      fmt.Errorf("undecodable worker response: %w", err),
-						})
-
-					} else {
-						ans <- wr
-						a.statusWriter.Write(JobLog{
-							WorkerID: wr.ID,
-							Func:     string(wr.Value.Type()),
-							Begin:    wr.ProcBegin,
-							End:      wr.ProcEnd,
-							Err:      wr.Value.Err(),
-						})
-					}
-					tmr.Stop()
+				tmr.Stop()
+				ans <- a.loadResult(query, item.Payload)
+				return
+			case <-ctx.Done():
+				tmr.Stop()
+				if receipt != "" {
+					a.cancelUnlessShared(sub, query, receipt)
+				}
+				err := merror.CancelledError{Msg: "query cancelled by client"}
+				ans <- WorkerResult{
+					Value: ErrorResult{
+						Func:  query.Func,
+						Error: err,
+					},
 				}
+				a.statusWriter.Write(JobLog{
+					WorkerID: "-",
+					Func:     query.Func,
+					Err:      err,
+				})
 				return
 			case <-tmr.C:
+				// nobody will read the result so the query is cancelled
+				// (unless the result is shared, see cancelUnlessShared)
+				if receipt != "" {
+					a.cancelUnlessShared(sub, query, receipt)
+				}
 				err := merror.TimeoutError{
-					Msg: fmt.Sprintf("worker result timeout (limit: %v)", customTimeout),
+					Msg: fmt.Sprintf("worker result timeout (limit: %v)", timeout),
 				}
 				ans <- WorkerResult{
 					Value: ErrorResult{
@@ -347,60 +736,127 @@ func (a *Adapter) PublishQuery(query Query, customTimeout time.Duration) (<-chan
 		}
 
 	}()
-	return ans, a.redis.Publish(a.ctx, a.channelQuery, MsgNewQuery).Err()
+	return ans
+}
+
+// cancelUnlessShared cancels a query unless there are other clients
+// waiting for its result (see query coalescing in PublishQuery).
+func (a *Adapter) cancelUnlessShared(sub *redis.PubSub, query Query, receipt string) {
+	if err := sub.Unsubscribe(a.ctx, query.Channel); err != nil {
+		log.Error().Err(err).Str("channel", query.Channel).Msg("failed to unsubscribe")
+	}
+	shared, err := a.SomeoneListens(query.Channel)
+	if err != nil {
+		log.Error().Err(err).Str("channel", query.Channel).Msg("failed to test channel listeners")
+	}
+	if shared {
+		log.Debug().Str("channel", query.Channel).Msg("query result shared with other clients, not cancelling")
+		return
+	}
+	if query.CacheID != "" {
+		if err := a.unregisterInflightQuery(query.CacheID); err != nil {
+			log.Error().Err(err).Str("channel", query.Channel).Msg("failed to unregister query")
+		}
+	}
+	if err := a.cancelQuery(query.Channel, a.queueKeyFor(query), receipt); err != nil {
+		log.Error().Err(err).Str("channel", query.Channel).Msg("failed to cancel query")
+	}
 }
 
 // DequeueQuery looks for a query queued for processing.
+// Consumed queues are searched in an order determined by their
+// priorities (see orderQueuesByPriority) so even low priority
+// queries are eventually processed.
+// The query is marked as being processed by the worker until
+// the worker calls AckQuery. This allows for recovering queries
+// of crashed workers (see RecoverWorkerQueries).
 // In case nothing is found, ErrorEmptyQueue is returned
 // as an error.
-func (a *Adapter) DequeueQuery() (Query, error) {
-	cmd := a.redis.RPop(a.ctx, DefaultQueueKey)
-
-	if cmd.Val() == "" {
-		return Query{}, ErrorEmptyQueue
+func (a *Adapter) DequeueQuery(workerID string) (Query, error) {
+	for _, q := range orderQueuesByPriority(a.consumedQueues) {
+		data, receipt, err := a.backend.pop(q.key, workerID)
+		if err == ErrorEmptyQueue {
+			continue
+
+		} else if err != nil {
+			return Query{}, err
+		}
+		query, err := DecodeQuery(data)
+		if err != nil {
+			// an undecodable query would stay unacknowledged forever
+			if err := a.backend.ack(q.key, workerID, receipt); err != nil {
+				log.Error().Err(err).Msg("failed to remove undecodable query")
+			}
+			return Query{}, fmt.Errorf("failed to deserialize query: %w", err)
+		}
+		query.queueKey = q.key
+		query.receipt = receipt
+		return query, nil
 	}
-	if cmd.Err() != nil {
-		return Query{}, fmt.Errorf("failed to dequeue query: %w", cmd.Err())
+	return Query{}, ErrorEmptyQueue
+}
+
+func (a *Adapter) encodeWorkerResult(value *WorkerResult) ([]byte, error) {
+	if value.Value.Err() != nil && IsUserError(value.Value.Err()) {
+		value.HasUserError = true
 	}
-	q, err := DecodeQuery(cmd.Val())
+	data, err := EncodeWorkerResult(*value)
 	if err != nil {
-		return Query{}, fmt.Errorf("failed to deserialize query: %w", err)
+		return nil, fmt.Errorf("failed to serialize result: %w", err)
 	}
-	return q, nil
+	return data, nil
 }
 
 // PublishResult sends notification via Redis PUBSUB mechanism
 // and also stores the result so a notified listener can retrieve
-// it.
-func (a *Adapter) PublishResult(channelName string, value WorkerResult) error {
+// it. For cacheable queries, the result is also stored in the cache.
+func (a *Adapter) PublishResult(query Query, value WorkerResult) error {
 	log.Debug().
 		AnErr("error", value.Value.Err()).
-		Str("channel", channelName).
+		Str("channel", query.Channel).
 		Str("resultType", string(value.Value.Type())).
 		Msg("publishing result")
-	if value.Value.Err() != nil && IsUserError(value.Value.Err()) {
-		value.HasUserError = true
-	}
-	var msg bytes.Buffer
-	enc := gob.NewEncoder(&msg)
-	err := enc.Encode(value)
+	data, err := a.encodeWorkerResult(&value)
 	if err != nil {
-		return fmt.Errorf("failed to serialize result: %w", err)
+		return err
 	}
-	cmd := a.redis.Set(a.ctx, channelName, msg.Bytes(), DefaultResultExpiration)
+	cmd := a.redis.Set(a.ctx, query.Channel, data, DefaultResultExpiration)
 	if cmd.Err() != nil {
 		return fmt.Errorf("failed to set result to Redis: %w", cmd.Err())
 	}
-	if err := a.redis.Publish(a.ctx, channelName, channelName).Err(); err != nil {
+	if query.CacheID != "" {
+		if value.Value.Err() == nil {
+			if err := a.storeCachedResult(query, data); err != nil {
+				log.Error().Err(err).Str("cacheId", query.CacheID).Msg("failed to cache result")
+			}
+		}
+		if err := a.unregisterInflightQuery(query.CacheID); err != nil {
+			log.Error().Err(err).Str("cacheId", query.CacheID).Msg("failed to unregister query")
+		}
+	}
+	if err := a.redis.Publish(a.ctx, query.Channel, query.Channel).Err(); err != nil {
 		return fmt.Errorf("failed to publish on Redis channel: %w", err)
 	}
 	return nil
 }
 
-// Subscribe subscribes to query queue.
-func (a *Adapter) Subscribe() <-chan *redis.Message {
+// Subscribe subscribes to query queue notifications.
+// The returned channel provides message payloads
+// (e.g. MsgNewQuery).
+func (a *Adapter) Subscribe() <-chan string {
 	sub := a.redis.Subscribe(a.ctx, a.channelQuery)
-	return sub.Channel()
+	ans := make(chan string)
+	go func() {
+		defer close(ans)
+		for msg := range sub.Channel() {
+			select {
+			case ans <- msg.Payload:
+			case <-a.ctx.Done():
+				return
+			}
+		}
+	}()
+	return ans
 }
 
 // NewAdapter is a recommended factory function
@@ -440,5 +896,16 @@ func NewAdapter(conf *Conf, ctx context.Context, statusWriter StatusWriter) *Ada
 		queryAnswerTimeout:  queryAnswerTimeout,
 		statusWriter:        statusWriter,
 	}
+	ans.initQueues()
+	if conf.QueueBackend == QueueBackendStreams {
+		queueKeys := make([]string, len(ans.queues))
+		for i, q := range ans.queues {
+			queueKeys[i] = q.key
+		}
+		ans.backend = &streamQueue{ctx: ctx, redis: ans.redis, queueKeys: queueKeys}
+
+	} else {
+		ans.backend = &listQueue{ctx: ctx, redis: ans.redis}
+	}
 	return ans
 }
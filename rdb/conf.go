@@ -18,7 +18,16 @@
 
 package rdb
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	QueueBackendLists   = "lists"
+	QueueBackendStreams = "streams"
+)
 
 type Conf struct {
 	Host                   string `json:"host"`
@@ -29,6 +38,87 @@ type Conf struct {
 	ChannelResultPrefix    string `json:"channelResultPrefix"`
 	QueryAnswerTimeoutSecs int    `json:"queryAnswerTimeoutSecs"`
 	AllowCustomTimeouts    bool   `json:"allowCustomTimeouts"`
+
+	// JobExpirationSecs specifies how long asynchronous job records
+	// and their results are kept in Redis
+	JobExpirationSecs int `json:"jobExpirationSecs"`
+
+	// MaxQueryAttempts specifies how many times a query is processed
+	// in case its workers keep stopping unexpectedly (e.g. killed
+	// because of a lack of memory). Once exceeded, the query fails.
+	MaxQueryAttempts int `json:"maxQueryAttempts"`
+
+	// ResultCacheTTLSecs specifies for how long results of
+	// individual functions (e.g. `concordance`, `freqDistrib`)
+	// are cached. Functions not listed here are not cached.
+	ResultCacheTTLSecs map[string]int `json:"resultCacheTtlSecs"`
+
+	// Queues defines additional job queues with their priorities
+	// and functions (query classes) routed to them. If omitted, all the queries
+	// are placed in the default queue.
+	Queues []QueueConf `json:"queues"`
+
+	// QueueBackend specifies Redis data structures used for queues.
+	// Either `lists` (default; lists + PUBSUB notifications)
+	// or `streams` (Redis streams with a consumer group).
+	QueueBackend string `json:"queueBackend"`
+}
+
+func (conf *Conf) ValidateAndDefaults(confContext string) error {
+	switch conf.QueueBackend {
+	case "":
+		conf.QueueBackend = QueueBackendLists
+		log.Warn().
+			Str("value", conf.QueueBackend).
+			Msgf("%s.queueBackend not specified, using default", confContext)
+	case QueueBackendLists, QueueBackendStreams:
+	default:
+		return fmt.Errorf("%s.queueBackend: unknown backend %s", confContext, conf.QueueBackend)
+	}
+	queueNames := make(map[string]bool)
+	funcs := make(map[string]string)
+	classes := make(map[string]string)
+	for i, q := range conf.Queues {
+		if q.Name == "" {
+			return fmt.Errorf("%s.queues[%d]: missing queue name", confContext, i)
+		}
+		if queueNames[q.Name] {
+			return fmt.Errorf("%s.queues: duplicate queue %s", confContext, q.Name)
+		}
+		queueNames[q.Name] = true
+		if q.Priority < 0 {
+			return fmt.Errorf("%s.queues[%s]: priority must be a positive number", confContext, q.Name)
+
+		} else if q.Priority == 0 {
+			conf.Queues[i].Priority = DefaultQueuePriority
+			log.Warn().
+				Str("queue", q.Name).
+				Int("value", DefaultQueuePriority).
+				Msgf("%s.queues[%s].priority not specified, using default", confContext, q.Name)
+		}
+		for _, fn := range q.Funcs {
+			if prev, ok := funcs[fn]; ok {
+				return fmt.Errorf(
+					"%s.queues: function %s routed to both %s and %s", confContext, fn, prev, q.Name)
+			}
+			funcs[fn] = q.Name
+		}
+		for _, cls := range q.Classes {
+			if prev, ok := classes[cls]; ok {
+				return fmt.Errorf(
+					"%s.queues: query class %s routed to both %s and %s", confContext, cls, prev, q.Name)
+			}
+			classes[cls] = q.Name
+		}
+	}
+	for fn := range conf.ResultCacheTTLSecs {
+		if nonCacheableFuncs[fn] {
+			log.Warn().
+				Str("func", fn).
+				Msgf("%s.resultCacheTtlSecs: function cannot be cached, ignoring", confContext)
+		}
+	}
+	return nil
 }
 
 func (conf *Conf) ServerInfo() string {
@@ -27,6 +27,10 @@ func (res ErrorResult) Err() error {
 	return res.Error
 }
 
+func (res *ErrorResult) SetErr(err error) {
+	res.Error = err
+}
+
 func (res ErrorResult) Type() ResultType {
 	return ResultTypeError
 }
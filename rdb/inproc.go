@@ -0,0 +1,445 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"fmt"
+	"mquery/merror"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+type inprocJob struct {
+	info   JobInfo
+	result *WorkerResult
+}
+
+type inprocNorms struct {
+	values  map[string]int64
+	expires time.Time
+}
+
+// InProcBroker is a Broker passing queries and results via Go
+// channels within a single process. It is intended for small
+// installations (see the `standalone` action) and for testing.
+// In contrast to Adapter, it has a single queue (i.e. no priorities),
+// it does not cache results and nothing survives a restart.
+type InProcBroker struct {
+	conf               *Conf
+	queryAnswerTimeout time.Duration
+	statusWriter       StatusWriter
+
+	mu sync.Mutex
+
+	// queue contains queries waiting for a worker (FIFO)
+	queue []Query
+
+	// listeners maps query channels to clients waiting for results
+	listeners map[string]chan WorkerResult
+
+	// cancelled contains channels of cancelled running queries
+	cancelled map[string]bool
+
+	// cancelWatchers maps query channels to functions
+	// aborting respective running queries
+	cancelWatchers map[string]func()
+
+	jobs map[string]*inprocJob
+
+	norms map[string]inprocNorms
+
+	locks map[string]inprocLock
+
+	notifications chan string
+}
+
+func (b *InProcBroker) notify() {
+	select {
+	case b.notifications <- MsgNewQuery:
+	default: // a notification is already pending
+	}
+}
+
+func (b *InProcBroker) jobExpiration() time.Duration {
+	if b.conf.JobExpirationSecs > 0 {
+		return time.Duration(b.conf.JobExpirationSecs) * time.Second
+	}
+	return DefaultJobExpiration
+}
+
+// removeExpiredJobs must be called with the `mu` locked
+func (b *InProcBroker) removeExpiredJobs() {
+	for id, job := range b.jobs {
+		if time.Since(job.info.Updated) > b.jobExpiration() {
+			delete(b.jobs, id)
+		}
+	}
+}
+
+func (b *InProcBroker) enqueue(query Query) {
+	b.mu.Lock()
+	b.queue = append(b.queue, query)
+	b.mu.Unlock()
+	b.notify()
+}
+
+// cancelQuery removes a query from the queue or - if already
+// running - asks a respective worker to abort it.
+func (b *InProcBroker) cancelQuery(channel string) {
+	b.mu.Lock()
+	for i, q := range b.queue {
+		if q.Channel == channel {
+			b.queue = append(b.queue[:i], b.queue[i+1:]...)
+			b.mu.Unlock()
+			log.Debug().Str("channel", channel).Msg("cancelled query removed from the queue")
+			return
+		}
+	}
+	b.cancelled[channel] = true
+	onCancel := b.cancelWatchers[channel]
+	b.mu.Unlock()
+	if onCancel != nil {
+		onCancel()
+	}
+	log.Debug().Str("channel", channel).Msg("sent cancel signal for a running query")
+}
+
+func (b *InProcBroker) errorResult(query Query, err error) WorkerResult {
+	b.statusWriter.Write(JobLog{
+		WorkerID: "-",
+		Func:     query.Func,
+		Err:      err,
+	})
+	return WorkerResult{
+		Value: ErrorResult{
+			Func:  query.Func,
+			Error: err,
+		},
+	}
+}
+
+// PublishQuery publishes a new query and returns a channel
+// by which a respective result will be returned.
+// Once the provided `ctx` is cancelled, the query is cancelled too.
+func (b *InProcBroker) PublishQuery(ctx context.Context, query Query, customTimeout time.Duration) (<-chan WorkerResult, error) {
+	query.Channel = fmt.Sprintf("%s:%s", DefaultResultChannelPrefix, uuid.New().String())
+	if customTimeout <= 0 {
+		customTimeout = b.queryAnswerTimeout
+	}
+	log.Debug().
+		Str("channel", query.Channel).
+		Str("func", query.Func).
+		Dur("timeout", customTimeout).
+		Any("args", query.Args).
+		Msg("publishing query")
+
+	listener := make(chan WorkerResult, 1)
+	b.mu.Lock()
+	b.listeners[query.Channel] = listener
+	b.mu.Unlock()
+	b.enqueue(query)
+
+	ans := make(chan WorkerResult, 1)
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			delete(b.listeners, query.Channel)
+			b.mu.Unlock()
+			close(ans)
+		}()
+		tmr := time.NewTimer(customTimeout)
+		defer tmr.Stop()
+		select {
+		case wr := <-listener:
+			b.statusWriter.Write(JobLog{
+				WorkerID: wr.ID,
+				Func:     string(wr.Value.Type()),
+				Begin:    wr.ProcBegin,
+				End:      wr.ProcEnd,
+				Err:      wr.Value.Err(),
+			})
+			ans <- wr
+		case <-ctx.Done():
+			b.cancelQuery(query.Channel)
+			ans <- b.errorResult(query, merror.CancelledError{Msg: "query cancelled by client"})
+		case <-tmr.C:
+			// nobody will read the result so the query is cancelled
+			b.cancelQuery(query.Channel)
+			ans <- b.errorResult(
+				query,
+				merror.TimeoutError{
+					Msg: fmt.Sprintf("worker result timeout (limit: %v)", customTimeout),
+				},
+			)
+		}
+	}()
+	return ans, nil
+}
+
+// SubmitJob publishes a query as an asynchronous job.
+func (b *InProcBroker) SubmitJob(query Query, corpusID string) (JobInfo, error) {
+	jobID := uuid.New().String()
+	query.Channel = fmt.Sprintf("%s:%s", DefaultResultChannelPrefix, jobID)
+	query.JobID = jobID
+	now := time.Now()
+	job := JobInfo{
+		ID:        jobID,
+		Func:      query.Func,
+		CorpusID:  corpusID,
+		Status:    JobStatusQueued,
+		Created:   now,
+		Updated:   now,
+		ResultKey: query.Channel,
+	}
+	b.mu.Lock()
+	b.removeExpiredJobs()
+	b.jobs[jobID] = &inprocJob{info: job}
+	b.mu.Unlock()
+	log.Debug().
+		Str("jobId", jobID).
+		Str("func", query.Func).
+		Any("args", query.Args).
+		Msg("submitting job")
+	b.enqueue(query)
+	return job, nil
+}
+
+// GetJob returns a job record. If the job does not exist
+// (or it has already expired), ErrJobNotFound is returned.
+func (b *InProcBroker) GetJob(jobID string) (JobInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	job, ok := b.jobs[jobID]
+	if !ok || time.Since(job.info.Updated) > b.jobExpiration() {
+		return JobInfo{}, ErrJobNotFound
+	}
+	return job.info, nil
+}
+
+// GetJobResult returns a result of a finished (or failed) job.
+func (b *InProcBroker) GetJobResult(job JobInfo) (WorkerResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stored, ok := b.jobs[job.ID]
+	if !ok || stored.result == nil {
+		return WorkerResult{}, ErrJobNotFound
+	}
+	return *stored.result, nil
+}
+
+// DeleteJob removes a job along with its result.
+// A queued or running job is cancelled.
+func (b *InProcBroker) DeleteJob(jobID string) error {
+	job, err := b.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	delete(b.jobs, jobID)
+	b.mu.Unlock()
+	if !job.Status.IsFinal() {
+		b.cancelQuery(job.ResultKey)
+	}
+	return nil
+}
+
+// Subscribe returns a channel with notifications about new
+// queries. Please note that the notifications are not broadcast
+// so there should be just one subscriber.
+func (b *InProcBroker) Subscribe() <-chan string {
+	return b.notifications
+}
+
+// DequeueQuery takes the oldest query from the queue.
+// In case nothing is found, ErrorEmptyQueue is returned.
+func (b *InProcBroker) DequeueQuery(workerID string) (Query, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.queue) == 0 {
+		return Query{}, ErrorEmptyQueue
+	}
+	ans := b.queue[0]
+	b.queue = b.queue[1:]
+	return ans, nil
+}
+
+// AckQuery releases resources related to a processed query.
+func (b *InProcBroker) AckQuery(workerID string, query Query) error {
+	b.mu.Lock()
+	delete(b.cancelled, query.Channel)
+	b.mu.Unlock()
+	return nil
+}
+
+// SomeoneListens tests if there is a client waiting
+// for a result of a query.
+func (b *InProcBroker) SomeoneListens(channel string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.listeners[channel]
+	return ok, nil
+}
+
+// StartJob marks a job as running. In case the job record
+// does not exist anymore, false is returned and the job should
+// not be processed.
+func (b *InProcBroker) StartJob(jobID, workerID string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	job, ok := b.jobs[jobID]
+	if !ok || job.info.Status != JobStatusQueued {
+		return false, nil
+	}
+	job.info.Status = JobStatusRunning
+	job.info.WorkerID = workerID
+	job.info.Updated = time.Now()
+	return true, nil
+}
+
+// SetJobProgress updates progress of a running job. In case the job
+// record does not exist anymore (or the job is not running), nothing
+// is changed.
+func (b *InProcBroker) SetJobProgress(jobID string, progress float64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	job, ok := b.jobs[jobID]
+	if !ok || job.info.Status != JobStatusRunning {
+		return nil
+	}
+	job.info.Progress = progress
+	job.info.Updated = time.Now()
+	return nil
+}
+
+// WatchCancellation calls `onCancel` once a query identified by its
+// result channel is cancelled. The returned function must be called
+// once the query is processed to release the watch.
+func (b *InProcBroker) WatchCancellation(channel string, onCancel func()) (stop func()) {
+	b.mu.Lock()
+	b.cancelWatchers[channel] = onCancel
+	cancelled := b.cancelled[channel]
+	b.mu.Unlock()
+	if cancelled {
+		onCancel()
+	}
+	return func() {
+		b.mu.Lock()
+		delete(b.cancelWatchers, channel)
+		b.mu.Unlock()
+	}
+}
+
+// PublishResult sends a result to a client waiting for it.
+// If nobody waits anymore, the result is thrown away.
+func (b *InProcBroker) PublishResult(query Query, value WorkerResult) error {
+	if value.Value.Err() != nil && IsUserError(value.Value.Err()) {
+		value.HasUserError = true
+	}
+	b.mu.Lock()
+	listener, ok := b.listeners[query.Channel]
+	b.mu.Unlock()
+	if !ok {
+		log.Warn().Str("channel", query.Channel).Msg("nobody waits for the result, throwing away")
+		return nil
+	}
+	select {
+	case listener <- value:
+	default: // the listener already has a result (should not happen)
+	}
+	return nil
+}
+
+// FinishJob stores a job result and updates the respective job record.
+// In case the job record does not exist anymore, the result is
+// thrown away.
+func (b *InProcBroker) FinishJob(jobID string, value WorkerResult) error {
+	if value.Value.Err() != nil && IsUserError(value.Value.Err()) {
+		value.HasUserError = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	job, ok := b.jobs[jobID]
+	if !ok {
+		log.Warn().Str("jobId", jobID).Msg("job removed before finished, throwing away the result")
+		return nil
+	}
+	job.result = &value
+	job.info.setFinished(value)
+	return nil
+}
+
+// Heartbeat does nothing as workers cannot die
+// independently of the broker.
+func (b *InProcBroker) Heartbeat(workerID string) error {
+	return nil
+}
+
+// RecoverWorkerQueries does nothing as there are no queries
+// left by a previous instance of a worker.
+func (b *InProcBroker) RecoverWorkerQueries(workerID string) error {
+	return nil
+}
+
+// GetTextTypeNorms loads text type norms stored by SetTextTypeNorms.
+func (b *InProcBroker) GetTextTypeNorms(id string) (map[string]int64, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.norms[id]
+	if !ok || time.Now().After(v.expires) {
+		delete(b.norms, id)
+		return map[string]int64{}, false, nil
+	}
+	return v.values, true, nil
+}
+
+// SetTextTypeNorms stores text type norms.
+func (b *InProcBroker) SetTextTypeNorms(id string, norms map[string]int64, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.norms[id] = inprocNorms{values: norms, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// NewInProcBroker creates a new InProcBroker. From the `conf`, only
+// values related to timeouts and jobs are used.
+func NewInProcBroker(conf *Conf, statusWriter StatusWriter) *InProcBroker {
+	queryAnswerTimeout := time.Duration(conf.QueryAnswerTimeoutSecs) * time.Second
+	if queryAnswerTimeout == 0 {
+		queryAnswerTimeout = DefaultQueryAnswerTimeout
+		log.Warn().
+			Float64("value", queryAnswerTimeout.Seconds()).
+			Msg("queryAnswerTimeoutSecs not specified for in-process broker, using default")
+	}
+	return &InProcBroker{
+		conf:               conf,
+		queryAnswerTimeout: queryAnswerTimeout,
+		statusWriter:       statusWriter,
+		listeners:          make(map[string]chan WorkerResult),
+		cancelled:          make(map[string]bool),
+		cancelWatchers:     make(map[string]func()),
+		jobs:               make(map[string]*inprocJob),
+		norms:              make(map[string]inprocNorms),
+		locks:              make(map[string]inprocLock),
+		notifications:      make(chan string, 1),
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"errors"
+	"mquery/merror"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInProcQueryRoundTrip(t *testing.T) {
+	b := newTestInProcBroker()
+	wait, err := b.PublishQuery(context.Background(), Query{Func: "concordance"}, 0)
+	assert.NoError(t, err)
+
+	select {
+	case msg := <-b.Subscribe():
+		assert.Equal(t, MsgNewQuery, msg)
+	default:
+		t.Error("no notification about a new query")
+	}
+	query, err := b.DequeueQuery("w1")
+	assert.NoError(t, err)
+	assert.Equal(t, "concordance", query.Func)
+	listens, err := b.SomeoneListens(query.Channel)
+	assert.NoError(t, err)
+	assert.True(t, listens)
+
+	assert.NoError(t, b.PublishResult(query, WorkerResult{ID: "w1", Value: ErrorResult{Func: "concordance"}}))
+	res := <-wait
+	assert.Equal(t, "w1", res.ID)
+	assert.NoError(t, res.Value.Err())
+	assert.NoError(t, b.AckQuery("w1", query))
+
+	listens, err = b.SomeoneListens(query.Channel)
+	assert.NoError(t, err)
+	assert.False(t, listens)
+}
+
+func TestInProcQueueOrder(t *testing.T) {
+	b := newTestInProcBroker()
+	for _, fn := range []string{"concordance", "freqDistrib", "collocations"} {
+		_, err := b.PublishQuery(context.Background(), Query{Func: fn}, 0)
+		assert.NoError(t, err)
+	}
+	for _, fn := range []string{"concordance", "freqDistrib", "collocations"} {
+		query, err := b.DequeueQuery("w1")
+		assert.NoError(t, err)
+		assert.Equal(t, fn, query.Func)
+	}
+	_, err := b.DequeueQuery("w1")
+	assert.Equal(t, ErrorEmptyQueue, err)
+}
+
+func TestInProcQueryTimeout(t *testing.T) {
+	b := newTestInProcBroker()
+	wait, err := b.PublishQuery(context.Background(), Query{Func: "concordance"}, 10*time.Millisecond)
+	assert.NoError(t, err)
+	query, err := b.DequeueQuery("w1")
+	assert.NoError(t, err)
+	res := <-wait
+	var tErr merror.TimeoutError
+	assert.True(t, errors.As(res.Value.Err(), &tErr))
+
+	// a late result is thrown away
+	listens, err := b.SomeoneListens(query.Channel)
+	assert.NoError(t, err)
+	assert.False(t, listens)
+	assert.NoError(t, b.PublishResult(query, WorkerResult{Value: ErrorResult{}}))
+}
+
+func TestInProcUserErrorFlag(t *testing.T) {
+	b := newTestInProcBroker()
+	wait, err := b.PublishQuery(context.Background(), Query{Func: "concordance"}, 0)
+	assert.NoError(t, err)
+	query, err := b.DequeueQuery("w1")
+	assert.NoError(t, err)
+	assert.NoError(t, b.PublishResult(
+		query, WorkerResult{Value: ErrorResult{Error: merror.InputError{Msg: "invalid query"}}}))
+	res := <-wait
+	assert.True(t, res.HasUserError)
+}
+
+func TestInProcTextTypeNorms(t *testing.T) {
+	b := newTestInProcBroker()
+	assert.NoError(t, b.SetTextTypeNorms("n1", map[string]int64{"FIC": 10}, time.Minute))
+	assert.NoError(t, b.SetTextTypeNorms("n2", map[string]int64{"FIC": 20}, -time.Second))
+
+	v, ok, err := b.GetTextTypeNorms("n1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]int64{"FIC": 10}, v)
+
+	_, ok, err = b.GetTextTypeNorms("n2")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestAdapterQueueBackend(t *testing.T) {
+	conf := &Conf{}
+	assert.NoError(t, conf.ValidateAndDefaults("redis"))
+	assert.Equal(t, QueueBackendLists, conf.QueueBackend)
+	a := NewAdapter(conf, context.Background(), nullStatusWriter{})
+	defer a.redis.Close()
+	assert.IsType(t, &listQueue{}, a.backend)
+
+	conf = &Conf{QueueBackend: QueueBackendStreams}
+	assert.NoError(t, conf.ValidateAndDefaults("redis"))
+	a = NewAdapter(conf, context.Background(), nullStatusWriter{})
+	defer a.redis.Close()
+	assert.IsType(t, &streamQueue{}, a.backend)
+
+	conf = &Conf{QueueBackend: "kafka"}
+	assert.Error(t, conf.ValidateAndDefaults("redis"))
+}
@@ -0,0 +1,351 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mquery/merror"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultJobKeyPrefix  = "mqueryJob"
+	DefaultJobExpiration = 24 * time.Hour
+
+	// maxJobUpdateAttempts limits repeated attempts to change
+	// a job record which is being concurrently changed by others
+	maxJobUpdateAttempts = 10
+
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusFinished  JobStatus = "finished"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+)
+
+type JobStatus string
+
+// IsFinal returns true for statuses after which no
+// other status change is possible.
+func (js JobStatus) IsFinal() bool {
+	return js == JobStatusFinished || js == JobStatusFailed || js == JobStatusCancelled
+}
+
+// JobInfo is a persistent record of an asynchronous query (job).
+// It is stored in Redis next to the job result (which is stored
+// under the key equal to the job's result channel).
+type JobInfo struct {
+	ID       string    `json:"id"`
+	Func     string    `json:"func"`
+	CorpusID string    `json:"corpusId"`
+	Status   JobStatus `json:"status"`
+
+	// Progress is a value between 0 and 1. Multi-step jobs (e.g.
+	// calcCollFreqData) report it after each finished step, other
+	// jobs just switch from 0 to 1 once finished.
+	Progress float64   `json:"progress"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	WorkerID string    `json:"workerId,omitempty"`
+	Error    string    `json:"error,omitempty"`
+
+	// ResultKey is a Redis key where the result is stored
+	ResultKey string `json:"-"`
+}
+
+// setFinished sets a final status of the job based
+// on a result of its query.
+func (job *JobInfo) setFinished(value WorkerResult) {
+	job.Updated = time.Now()
+	job.Progress = 1
+	var cErr merror.CancelledError
+	if errors.As(value.Value.Err(), &cErr) {
+		job.Status = JobStatusCancelled
+
+	} else if value.Value.Err() != nil {
+		job.Status = JobStatusFailed
+		job.Error = value.Value.Err().Error()
+
+	} else {
+		job.Status = JobStatusFinished
+	}
+}
+
+// jobRecord is the form in which JobInfo is stored in Redis.
+// We need it to keep the ResultKey which is not exported
+// to API users.
+type jobRecord struct {
+	JobInfo
+	ResultKey string `json:"resultKey"`
+}
+
+func (a *Adapter) jobKey(jobID string) string {
+	return fmt.Sprintf("%s:%s", DefaultJobKeyPrefix, jobID)
+}
+
+func (a *Adapter) jobExpiration() time.Duration {
+	if a.conf.JobExpirationSecs > 0 {
+		return time.Duration(a.conf.JobExpirationSecs) * time.Second
+	}
+	return DefaultJobExpiration
+}
+
+func (a *Adapter) storeJob(cmd redis.StringCmdable, job JobInfo) error {
+	data, err := json.Marshal(jobRecord{JobInfo: job, ResultKey: job.ResultKey})
+	if err != nil {
+		return fmt.Errorf("failed to store job %s: %w", job.ID, err)
+	}
+	if err := cmd.Set(a.ctx, a.jobKey(job.ID), data, a.jobExpiration()).Err(); err != nil {
+		return fmt.Errorf("failed to store job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+func (a *Adapter) loadJob(cmd redis.StringCmdable, jobID string) (JobInfo, error) {
+	data, err := cmd.Get(a.ctx, a.jobKey(jobID)).Result()
+	if err == redis.Nil {
+		return JobInfo{}, ErrJobNotFound
+
+	} else if err != nil {
+		return JobInfo{}, fmt.Errorf("failed to get job %s: %w", jobID, err)
+	}
+	var rec jobRecord
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		return JobInfo{}, fmt.Errorf("failed to get job %s: %w", jobID, err)
+	}
+	ans := rec.JobInfo
+	ans.ResultKey = rec.ResultKey
+	return ans, nil
+}
+
+// updateJob atomically changes a job record. The `update` function
+// obtains the current state of the job and it returns false in case
+// nothing should be changed. It can also add other commands (e.g. storing
+// a job result) to the transaction via `pipe`. The transaction fails
+// in case someone else changes the record meanwhile - in such case
+// the update is attempted again with the new state of the record. This
+// e.g. prevents a finishing job from restoring a just deleted job record.
+// In case the job record does not exist, ErrJobNotFound is returned.
+func (a *Adapter) updateJob(
+	jobID string,
+	update func(job *JobInfo, pipe redis.Pipeliner) (bool, error),
+) (bool, error) {
+	for i := 0; i < maxJobUpdateAttempts; i++ {
+		var changed bool
+		err := a.redis.Watch(a.ctx, func(tx *redis.Tx) error {
+			job, err := a.loadJob(tx, jobID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(a.ctx, func(pipe redis.Pipeliner) error {
+				var err error
+				changed, err = update(&job, pipe)
+				if err != nil || !changed {
+					return err
+				}
+				return a.storeJob(pipe, job)
+			})
+			return err
+		}, a.jobKey(jobID))
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return changed, err
+	}
+	return false, fmt.Errorf("failed to update job %s: too many concurrent changes", jobID)
+}
+
+// SubmitJob publishes a query as an asynchronous job. In contrast
+// to PublishQuery, nobody waits for the result - it is stored in Redis
+// along with the job record and it can be obtained via GetJob and
+// GetJobResult.
+func (a *Adapter) SubmitJob(query Query, corpusID string) (JobInfo, error) {
+	jobID := uuid.New().String()
+	query.Channel = fmt.Sprintf("%s:%s", a.channelResultPrefix, jobID)
+	query.JobID = jobID
+	now := time.Now()
+	job := JobInfo{
+		ID:        jobID,
+		Func:      query.Func,
+		CorpusID:  corpusID,
+		Status:    JobStatusQueued,
+		Created:   now,
+		Updated:   now,
+		ResultKey: query.Channel,
+	}
+	if err := a.storeJob(a.redis, job); err != nil {
+		return JobInfo{}, err
+	}
+	log.Debug().
+		Str("jobId", jobID).
+		Str("func", query.Func).
+		Any("args", query.Args).
+		Msg("submitting job")
+
+	msg, err := EncodeQuery(query)
+	if err != nil {
+		return JobInfo{}, fmt.Errorf("failed to submit job: %w", err)
+	}
+	if _, err := a.backend.push(a.queueKeyFor(query), msg); err != nil {
+		return JobInfo{}, fmt.Errorf("failed to submit job: %w", err)
+	}
+	return job, a.redis.Publish(a.ctx, a.channelQuery, MsgNewQuery).Err()
+}
+
+// GetJob returns a job record. If the job does not exist
+// (or it has already expired), ErrJobNotFound is returned.
+func (a *Adapter) GetJob(jobID string) (JobInfo, error) {
+	return a.loadJob(a.redis, jobID)
+}
+
+// GetJobResult loads a result of a finished (or failed) job.
+func (a *Adapter) GetJobResult(job JobInfo) (WorkerResult, error) {
+	cmd := a.redis.Get(a.ctx, job.ResultKey)
+	if cmd.Err() == redis.Nil {
+		return WorkerResult{}, ErrJobNotFound
+
+	} else if cmd.Err() != nil {
+		return WorkerResult{}, fmt.Errorf("failed to get result of job %s: %w", job.ID, cmd.Err())
+	}
+	wr, err := DecodeWorkerResult(cmd.Val())
+	if err != nil {
+		return WorkerResult{}, fmt.Errorf("failed to decode result of job %s: %w", job.ID, err)
+	}
+	return wr, nil
+}
+
+// DeleteJob removes both the job record and its result.
+// A job which has not been started yet will be skipped by workers.
+// A running job is cancelled.
+func (a *Adapter) DeleteJob(jobID string) error {
+	var job JobInfo
+	for i := 0; i < maxJobUpdateAttempts; i++ {
+		err := a.redis.Watch(a.ctx, func(tx *redis.Tx) error {
+			var err error
+			job, err = a.loadJob(tx, jobID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(a.ctx, func(pipe redis.Pipeliner) error {
+				return pipe.Del(a.ctx, a.jobKey(jobID), job.ResultKey).Err()
+			})
+			return err
+		}, a.jobKey(jobID))
+		if err == redis.TxFailedErr {
+			continue
+
+		} else if err == ErrJobNotFound {
+			return err
+
+		} else if err != nil {
+			return fmt.Errorf("failed to delete job %s: %w", jobID, err)
+		}
+		if job.Status == JobStatusRunning {
+			return a.cancelQuery(job.ResultKey, "", "")
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to delete job %s: too many concurrent changes", jobID)
+}
+
+// StartJob marks a job as running. In case the job record
+// does not exist anymore (deleted by user, expired), false
+// is returned and the job should not be processed.
+func (a *Adapter) StartJob(jobID, workerID string) (bool, error) {
+	started, err := a.updateJob(jobID, func(job *JobInfo, pipe redis.Pipeliner) (bool, error) {
+		if job.Status != JobStatusQueued {
+			return false, nil
+		}
+		job.Status = JobStatusRunning
+		job.WorkerID = workerID
+		job.Updated = time.Now()
+		return true, nil
+	})
+	if err == ErrJobNotFound {
+		return false, nil
+	}
+	return started, err
+}
+
+// SetJobProgress updates progress of a running job. In case the job
+// record does not exist anymore (or the job is not running), nothing
+// is changed.
+func (a *Adapter) SetJobProgress(jobID string, progress float64) error {
+	_, err := a.updateJob(jobID, func(job *JobInfo, pipe redis.Pipeliner) (bool, error) {
+		if job.Status != JobStatusRunning {
+			return false, nil
+		}
+		job.Progress = progress
+		job.Updated = time.Now()
+		return true, nil
+	})
+	if err == ErrJobNotFound {
+		return nil
+	}
+	return err
+}
+
+// requeueJob returns a running job back to the queued state
+// (e.g. after its worker stopped unexpectedly). In case the job
+// record does not exist anymore, false is returned.
+func (a *Adapter) requeueJob(jobID string) (bool, error) {
+	requeued, err := a.updateJob(jobID, func(job *JobInfo, pipe redis.Pipeliner) (bool, error) {
+		job.Status = JobStatusQueued
+		job.WorkerID = ""
+		job.Progress = 0
+		job.Updated = time.Now()
+		return true, nil
+	})
+	if err == ErrJobNotFound {
+		return false, nil
+	}
+	return requeued, err
+}
+
+// FinishJob stores a job result and updates the respective job record.
+// In case the job record does not exist anymore, the result is
+// thrown away.
+func (a *Adapter) FinishJob(jobID string, value WorkerResult) error {
+	data, err := a.encodeWorkerResult(&value)
+	if err != nil {
+		return err
+	}
+	_, err = a.updateJob(jobID, func(job *JobInfo, pipe redis.Pipeliner) (bool, error) {
+		if err := pipe.Set(a.ctx, job.ResultKey, data, a.jobExpiration()).Err(); err != nil {
+			return false, fmt.Errorf("failed to set job result to Redis: %w", err)
+		}
+		job.setFinished(value)
+		return true, nil
+	})
+	if err == ErrJobNotFound {
+		log.Warn().Str("jobId", jobID).Msg("job removed before finished, throwing away the result")
+		return nil
+	}
+	return err
+}
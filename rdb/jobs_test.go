@@ -0,0 +1,96 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nullStatusWriter struct{}
+
+func (sw nullStatusWriter) Write(rec JobLog) {}
+
+func newTestInProcBroker() *InProcBroker {
+	return NewInProcBroker(&Conf{QueryAnswerTimeoutSecs: 10}, nullStatusWriter{})
+}
+
+func TestJobLifecycle(t *testing.T) {
+	b := newTestInProcBroker()
+	job, err := b.SubmitJob(Query{Func: "calcCollFreqData"}, "syn2020")
+	assert.NoError(t, err)
+	assert.Equal(t, JobStatusQueued, job.Status)
+
+	query, err := b.DequeueQuery("w1")
+	assert.NoError(t, err)
+	assert.Equal(t, job.ID, query.JobID)
+
+	started, err := b.StartJob(job.ID, "w1")
+	assert.NoError(t, err)
+	assert.True(t, started)
+	started, err = b.StartJob(job.ID, "w2")
+	assert.NoError(t, err)
+	assert.False(t, started)
+
+	assert.NoError(t, b.SetJobProgress(job.ID, 0.5))
+	job, err = b.GetJob(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobStatusRunning, job.Status)
+	assert.Equal(t, 0.5, job.Progress)
+
+	assert.NoError(t, b.FinishJob(job.ID, WorkerResult{Value: ErrorResult{}}))
+	job, err = b.GetJob(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobStatusFinished, job.Status)
+	assert.Equal(t, 1.0, job.Progress)
+
+	// progress of a finished job cannot be changed anymore
+	assert.NoError(t, b.SetJobProgress(job.ID, 0.2))
+	job, err = b.GetJob(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, job.Progress)
+}
+
+func TestFailedJob(t *testing.T) {
+	b := newTestInProcBroker()
+	job, err := b.SubmitJob(Query{Func: "calcCollFreqData"}, "syn2020")
+	assert.NoError(t, err)
+	_, err = b.StartJob(job.ID, "w1")
+	assert.NoError(t, err)
+	assert.NoError(t, b.FinishJob(job.ID, WorkerResult{Value: ErrorResult{Error: errors.New("failed")}}))
+	job, err = b.GetJob(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobStatusFailed, job.Status)
+	assert.Equal(t, "failed", job.Error)
+}
+
+func TestFinishDeletedJob(t *testing.T) {
+	b := newTestInProcBroker()
+	job, err := b.SubmitJob(Query{Func: "calcCollFreqData"}, "syn2020")
+	assert.NoError(t, err)
+	_, err = b.StartJob(job.ID, "w1")
+	assert.NoError(t, err)
+	assert.NoError(t, b.DeleteJob(job.ID))
+	assert.NoError(t, b.FinishJob(job.ID, WorkerResult{Value: ErrorResult{}}))
+	_, err = b.GetJob(job.ID)
+	assert.Equal(t, ErrJobNotFound, err)
+	assert.NoError(t, b.SetJobProgress(job.ID, 0.5))
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// listQueue stores queries in Redis lists. Queries taken by
+// a worker are atomically moved to the worker's processing list.
+// Receipts are the encoded queries themselves.
+type listQueue struct {
+	ctx   context.Context
+	redis *redis.Client
+}
+
+func (q *listQueue) push(queueKey string, data []byte) (string, error) {
+	if err := q.redis.LPush(q.ctx, queueKey, data).Err(); err != nil {
+		return "", fmt.Errorf("failed to enqueue query: %w", err)
+	}
+	return string(data), nil
+}
+
+func (q *listQueue) pop(queueKey, workerID string) (string, string, error) {
+	cmd := q.redis.LMove(q.ctx, queueKey, processingKey(workerID), "RIGHT", "LEFT")
+	if cmd.Err() == redis.Nil {
+		return "", "", ErrorEmptyQueue
+
+	} else if cmd.Err() != nil {
+		return "", "", fmt.Errorf("failed to dequeue query: %w", cmd.Err())
+	}
+	return cmd.Val(), cmd.Val(), nil
+}
+
+func (q *listQueue) ack(queueKey, workerID, receipt string) error {
+	if err := q.redis.LRem(q.ctx, processingKey(workerID), 1, receipt).Err(); err != nil {
+		return fmt.Errorf("failed to acknowledge query: %w", err)
+	}
+	return nil
+}
+
+func (q *listQueue) remove(queueKey, receipt string) (bool, error) {
+	removed, err := q.redis.LRem(q.ctx, queueKey, 1, receipt).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove query from queue: %w", err)
+	}
+	return removed > 0, nil
+}
+
+func (q *listQueue) popUnacked(workerID string) (string, error) {
+	// RPOP is atomic so even with multiple API servers running
+	// their reapers, each query is recovered just once
+	cmd := q.redis.RPop(q.ctx, processingKey(workerID))
+	if cmd.Err() == redis.Nil {
+		return "", ErrorEmptyQueue
+
+	} else if cmd.Err() != nil {
+		return "", fmt.Errorf("failed to get unfinished queries of worker %s: %w", workerID, cmd.Err())
+	}
+	return cmd.Val(), nil
+}
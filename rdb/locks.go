@@ -0,0 +1,101 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultLockKeyPrefix = "mqueryLock"
+)
+
+func lockKey(name string) string {
+	return fmt.Sprintf("%s:%s", DefaultLockKeyPrefix, name)
+}
+
+// TryLock acquires a lock shared by all the API server instances.
+// In case the lock is held by someone else, false is returned. The lock
+// expires after `ttl` so a crashed holder does not block others forever.
+// The returned function releases the lock.
+func (a *Adapter) TryLock(name string, ttl time.Duration) (func(), bool, error) {
+	token := uuid.New().String()
+	ok, err := a.redis.SetNX(a.ctx, lockKey(name), token, ttl).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	return func() { a.releaseLock(name, token) }, true, nil
+}
+
+// releaseLock removes a lock unless it has already expired
+// and it has been acquired by someone else
+func (a *Adapter) releaseLock(name, token string) {
+	err := a.redis.Watch(a.ctx, func(tx *redis.Tx) error {
+		curr, err := tx.Get(a.ctx, lockKey(name)).Result()
+		if err == redis.Nil {
+			return nil
+
+		} else if err != nil {
+			return err
+		}
+		if curr != token {
+			return nil
+		}
+		_, err = tx.TxPipelined(a.ctx, func(pipe redis.Pipeliner) error {
+			return pipe.Del(a.ctx, lockKey(name)).Err()
+		})
+		return err
+	}, lockKey(name))
+	if err != nil && err != redis.TxFailedErr {
+		log.Error().Err(err).Str("lock", name).Msg("failed to release lock")
+	}
+}
+
+type inprocLock struct {
+	token   string
+	expires time.Time
+}
+
+// TryLock acquires a lock. In case the lock is held by someone else,
+// false is returned. The lock expires after `ttl`. The returned
+// function releases the lock.
+func (b *InProcBroker) TryLock(name string, ttl time.Duration) (func(), bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if curr, ok := b.locks[name]; ok && time.Now().Before(curr.expires) {
+		return nil, false, nil
+	}
+	token := uuid.New().String()
+	b.locks[name] = inprocLock{token: token, expires: time.Now().Add(ttl)}
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.locks[name].token == token {
+			delete(b.locks, name)
+		}
+	}, true, nil
+}
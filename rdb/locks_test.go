@@ -0,0 +1,73 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testLocker interface {
+	TryLock(name string, ttl time.Duration) (func(), bool, error)
+}
+
+func testLock(t *testing.T, locker testLocker) {
+	unlock, ok, err := locker.TryLock("precalc:syn2020", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	_, ok, err = locker.TryLock("precalc:syn2020", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	unlock2, ok, err := locker.TryLock("precalc:syn2015", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	unlock2()
+
+	unlock()
+	unlock, ok, err = locker.TryLock("precalc:syn2020", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	unlock()
+}
+
+func TestInProcLock(t *testing.T) {
+	testLock(t, newTestInProcBroker())
+}
+
+func TestInProcLockExpired(t *testing.T) {
+	b := newTestInProcBroker()
+	unlock, ok, err := b.TryLock("precalc:syn2020", -time.Second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	unlock2, ok, err := b.TryLock("precalc:syn2020", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	// releasing the expired lock must not release the new one
+	unlock()
+	_, ok, err = b.TryLock("precalc:syn2020", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	unlock2()
+}
+
+func TestAdapterLock(t *testing.T) {
+	testLock(t, newTestAdapter(t, QueueBackendLists))
+}
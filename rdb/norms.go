@@ -0,0 +1,66 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultNormsKeyPrefix = "mqueryNorms"
+)
+
+func normsKey(id string) string {
+	return fmt.Sprintf("%s:%s", DefaultNormsKeyPrefix, id)
+}
+
+// GetTextTypeNorms loads text type norms (sizes of individual
+// structural attribute values) shared by all the workers.
+// The second returned value is false if nothing is found.
+func (a *Adapter) GetTextTypeNorms(id string) (map[string]int64, bool, error) {
+	cmd := a.redis.Get(a.ctx, normsKey(id))
+	if cmd.Err() == redis.Nil {
+		return map[string]int64{}, false, nil
+
+	} else if cmd.Err() != nil {
+		return map[string]int64{}, false, fmt.Errorf("failed to get text type norms: %w", cmd.Err())
+	}
+	var ans map[string]int64
+	if err := json.Unmarshal([]byte(cmd.Val()), &ans); err != nil {
+		return map[string]int64{}, false, fmt.Errorf("failed to decode text type norms: %w", err)
+	}
+	return ans, true, nil
+}
+
+// SetTextTypeNorms stores text type norms so other workers
+// can use them too.
+func (a *Adapter) SetTextTypeNorms(id string, norms map[string]int64, ttl time.Duration) error {
+	data, err := json.Marshal(norms)
+	if err != nil {
+		return fmt.Errorf("failed to store text type norms: %w", err)
+	}
+	if err := a.redis.Set(a.ctx, normsKey(id), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store text type norms: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"fmt"
+	"mquery/merror"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultProcessingKeyPrefix = "mqueryProcessing"
+	DefaultHeartbeatKeyPrefix  = "mqueryHeartbeat"
+	DefaultWorkersKey          = "mqueryWorkers"
+	DefaultHeartbeatInterval   = 5 * time.Second
+	DefaultHeartbeatTTL        = 20 * time.Second
+	DefaultReaperInterval      = 10 * time.Second
+	DefaultMaxQueryAttempts    = 2
+)
+
+// processingKey returns a key of a list containing queries
+// currently processed by a worker.
+func processingKey(workerID string) string {
+	return fmt.Sprintf("%s:%s", DefaultProcessingKeyPrefix, workerID)
+}
+
+func heartbeatKey(workerID string) string {
+	return fmt.Sprintf("%s:%s", DefaultHeartbeatKeyPrefix, workerID)
+}
+
+func (a *Adapter) maxQueryAttempts() int {
+	if a.conf.MaxQueryAttempts > 0 {
+		return a.conf.MaxQueryAttempts
+	}
+	return DefaultMaxQueryAttempts
+}
+
+// AckQuery removes a query from the worker's processing list.
+// It must be called once the query is processed (no matter
+// whether successfully or not).
+func (a *Adapter) AckQuery(workerID string, query Query) error {
+	if query.receipt == "" {
+		return nil
+	}
+	return a.backend.ack(query.queueKey, workerID, query.receipt)
+}
+
+// Heartbeat tells other MQuery instances that a worker is alive.
+// It should be called regularly with a period considerably shorter
+// than DefaultHeartbeatTTL.
+func (a *Adapter) Heartbeat(workerID string) error {
+	pipe := a.redis.TxPipeline()
+	pipe.Set(a.ctx, heartbeatKey(workerID), time.Now().Format(time.RFC3339), DefaultHeartbeatTTL)
+	pipe.SAdd(a.ctx, DefaultWorkersKey, workerID)
+	if _, err := pipe.Exec(a.ctx); err != nil {
+		return fmt.Errorf("failed to write worker heartbeat: %w", err)
+	}
+	return nil
+}
+
+// RecoverWorkerQueries handles queries left in the processing list
+// of a (presumably dead) worker. Queries with remaining attempts
+// are re-queued, the rest is answered with an error right away so
+// clients do not have to wait for a timeout.
+func (a *Adapter) RecoverWorkerQueries(workerID string) error {
+	for {
+		data, err := a.backend.popUnacked(workerID)
+		if err == ErrorEmptyQueue {
+			return nil
+
+		} else if err != nil {
+			return fmt.Errorf("failed to recover queries of worker %s: %w", workerID, err)
+		}
+		query, err := DecodeQuery(data)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("workerId", workerID).
+				Msg("failed to decode orphaned query, skipping")
+			continue
+		}
+		if err := a.recoverQuery(workerID, query); err != nil {
+			log.Error().
+				Err(err).
+				Str("workerId", workerID).
+				Str("channel", query.Channel).
+				Msg("failed to recover orphaned query")
+		}
+	}
+}
+
+func (a *Adapter) recoverQuery(workerID string, query Query) error {
+	cancelled, err := a.IsCancelled(query.Channel)
+	if err != nil {
+		return err
+	}
+	if cancelled {
+		log.Debug().Str("channel", query.Channel).Msg("orphaned query already cancelled, skipping")
+		return nil
+	}
+	if query.Attempt+1 >= a.maxQueryAttempts() {
+		log.Warn().
+			Str("workerId", workerID).
+			Str("channel", query.Channel).
+			Str("func", query.Func).
+			Int("attempts", query.Attempt+1).
+			Msg("orphaned query failed too many times, giving up")
+		wr := WorkerResult{
+			ID: workerID,
+			Value: ErrorResult{
+				Func: query.Func,
+				Error: merror.InternalError{
+					Msg: "worker processing the query stopped unexpectedly",
+				},
+			},
+			ProcBegin: time.Now(),
+			ProcEnd:   time.Now(),
+		}
+		if query.JobID != "" {
+			return a.FinishJob(query.JobID, wr)
+		}
+		return a.PublishResult(query, wr)
+	}
+	if query.JobID != "" {
+		ok, err := a.requeueJob(query.JobID)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	query.Attempt++
+	data, err := EncodeQuery(query)
+	if err != nil {
+		return fmt.Errorf("failed to re-queue query: %w", err)
+	}
+	if _, err := a.backend.push(a.queueKeyFor(query), data); err != nil {
+		return fmt.Errorf("failed to re-queue query: %w", err)
+	}
+	log.Warn().
+		Str("workerId", workerID).
+		Str("channel", query.Channel).
+		Str("func", query.Func).
+		Int("attempt", query.Attempt).
+		Msg("re-queued orphaned query")
+	return a.redis.Publish(a.ctx, a.channelQuery, MsgNewQuery).Err()
+}
+
+// RecoverDeadWorkersQueries searches for registered workers
+// without a valid heartbeat and recovers their queries.
+func (a *Adapter) RecoverDeadWorkersQueries() error {
+	workers, err := a.redis.SMembers(a.ctx, DefaultWorkersKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get list of workers: %w", err)
+	}
+	for _, workerID := range workers {
+		alive, err := a.redis.Exists(a.ctx, heartbeatKey(workerID)).Result()
+		if err != nil {
+			return fmt.Errorf("failed to test worker heartbeat: %w", err)
+		}
+		if alive > 0 {
+			continue
+		}
+		log.Warn().Str("workerId", workerID).Msg("found dead worker, recovering its queries")
+		if err := a.RecoverWorkerQueries(workerID); err != nil {
+			return err
+		}
+		if err := a.redis.SRem(a.ctx, DefaultWorkersKey, workerID).Err(); err != nil {
+			return fmt.Errorf("failed to unregister worker %s: %w", workerID, err)
+		}
+	}
+	return nil
+}
+
+// ----------------------------
+
+// OrphanedQueriesReaper is a service regularly looking for
+// queries of dead workers.
+type OrphanedQueriesReaper struct {
+	radapter *Adapter
+	ticker   *time.Ticker
+}
+
+func (r *OrphanedQueriesReaper) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-r.ticker.C:
+				if err := r.radapter.RecoverDeadWorkersQueries(); err != nil {
+					log.Error().Err(err).Msg("failed to recover queries of dead workers")
+				}
+			case <-ctx.Done():
+				log.Info().Msg("about to close orphaned queries reaper")
+				return
+			}
+		}
+	}()
+}
+
+func (r *OrphanedQueriesReaper) Stop(ctx context.Context) error {
+	log.Warn().Msg("stopping orphaned queries reaper")
+	r.ticker.Stop()
+	return nil
+}
+
+func NewOrphanedQueriesReaper(radapter *Adapter) *OrphanedQueriesReaper {
+	return &OrphanedQueriesReaper{
+		radapter: radapter,
+		ticker:   time.NewTicker(DefaultReaperInterval),
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testQueueBackends = []string{QueueBackendLists, QueueBackendStreams}
+
+func TestRemoveUnclaimedQuery(t *testing.T) {
+	for _, backend := range testQueueBackends {
+		t.Run(backend, func(t *testing.T) {
+			a := newTestAdapter(t, backend)
+			receipt, err := a.backend.push(DefaultQueueKey, []byte("q1"))
+			assert.NoError(t, err)
+			removed, err := a.backend.remove(DefaultQueueKey, receipt)
+			assert.NoError(t, err)
+			assert.True(t, removed)
+			_, _, err = a.backend.pop(DefaultQueueKey, "w1")
+			assert.Equal(t, ErrorEmptyQueue, err)
+		})
+	}
+}
+
+func TestRemoveClaimedQuery(t *testing.T) {
+	for _, backend := range testQueueBackends {
+		t.Run(backend, func(t *testing.T) {
+			a := newTestAdapter(t, backend)
+			receipt, err := a.backend.push(DefaultQueueKey, []byte("q1"))
+			assert.NoError(t, err)
+			data, _, err := a.backend.pop(DefaultQueueKey, "w1")
+			assert.NoError(t, err)
+			assert.Equal(t, "q1", data)
+			removed, err := a.backend.remove(DefaultQueueKey, receipt)
+			assert.NoError(t, err)
+			assert.False(t, removed)
+			// the query is still recoverable
+			data, err = a.backend.popUnacked("w1")
+			assert.NoError(t, err)
+			assert.Equal(t, "q1", data)
+		})
+	}
+}
+
+func TestAckedQueryNotRecovered(t *testing.T) {
+	for _, backend := range testQueueBackends {
+		t.Run(backend, func(t *testing.T) {
+			a := newTestAdapter(t, backend)
+			_, err := a.backend.push(DefaultQueueKey, []byte("q1"))
+			assert.NoError(t, err)
+			_, receipt, err := a.backend.pop(DefaultQueueKey, "w1")
+			assert.NoError(t, err)
+			assert.NoError(t, a.backend.ack(DefaultQueueKey, "w1", receipt))
+			_, err = a.backend.popUnacked("w1")
+			assert.Equal(t, ErrorEmptyQueue, err)
+		})
+	}
+}
+
+func TestRecoverWorkerQueries(t *testing.T) {
+	for _, backend := range testQueueBackends {
+		t.Run(backend, func(t *testing.T) {
+			a := newTestAdapter(t, backend)
+			data, err := EncodeQuery(Query{Func: "concordance", Channel: "test:1", Args: ConcordanceArgs{}})
+			assert.NoError(t, err)
+			_, err = a.backend.push(DefaultQueueKey, data)
+			assert.NoError(t, err)
+			query, err := a.DequeueQuery("w1")
+			assert.NoError(t, err)
+			assert.Equal(t, 0, query.Attempt)
+
+			// the worker dies and its query is processed by another one
+			assert.NoError(t, a.RecoverWorkerQueries("w1"))
+			query, err = a.DequeueQuery("w2")
+			assert.NoError(t, err)
+			assert.Equal(t, "test:1", query.Channel)
+			assert.Equal(t, 1, query.Attempt)
+
+			// also the second worker dies - no more attempts
+			assert.NoError(t, a.RecoverWorkerQueries("w2"))
+			_, err = a.DequeueQuery("w3")
+			assert.Equal(t, ErrorEmptyQueue, err)
+		})
+	}
+}
+
+func TestRecoverCancelledQuery(t *testing.T) {
+	a := newTestAdapter(t, QueueBackendLists)
+	data, err := EncodeQuery(Query{Func: "concordance", Channel: "test:1", Args: ConcordanceArgs{}})
+	assert.NoError(t, err)
+	_, err = a.backend.push(DefaultQueueKey, data)
+	assert.NoError(t, err)
+	_, err = a.DequeueQuery("w1")
+	assert.NoError(t, err)
+	assert.NoError(t, a.cancelQuery("test:1", "", ""))
+	assert.NoError(t, a.RecoverWorkerQueries("w1"))
+	_, err = a.DequeueQuery("w2")
+	assert.Equal(t, ErrorEmptyQueue, err)
+}
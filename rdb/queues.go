@@ -0,0 +1,196 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	DefaultQueueName     = "default"
+	DefaultQueuePriority = 1
+
+	// QueryClassSplitChunk marks queries processing a single
+	// chunk of a split corpus (see corpus.ScatterGather)
+	QueryClassSplitChunk = "splitChunk"
+)
+
+// QueueConf configures a named job queue. Queries are routed
+// to queues based on their class (Query.Class) and function (Query.Func)
+// - the class has precedence. Queries matching no queue go to the default
+// queue.
+type QueueConf struct {
+	Name string `json:"name"`
+
+	// Priority is a positive number specifying how often a queue is
+	// served compared to other queues. E.g. if both a queue with priority 3
+	// and a queue with priority 1 contain jobs, the first one is served
+	// (on average) three times more often. This means that even a low
+	// priority queue is guaranteed to progress.
+	Priority int `json:"priority"`
+
+	// Funcs lists query functions (e.g. `concordance`, `calcCollFreqData`)
+	// which will be routed to the queue.
+	Funcs []string `json:"funcs"`
+
+	// Classes lists query classes (e.g. `splitChunk`) which will be routed
+	// to the queue regardless of their function. This allows for separating
+	// e.g. heavy split corpus calculations from interactive queries of the same
+	// function.
+	Classes []string `json:"classes"`
+}
+
+type queue struct {
+	name     string
+	key      string
+	priority int
+}
+
+func queueKey(name string) string {
+	if name == DefaultQueueName {
+		return DefaultQueueKey // to keep compatibility with older setups
+	}
+	return fmt.Sprintf("%s:%s", DefaultQueueKey, name)
+}
+
+// orderQueuesByPriority returns a random permutation of queues
+// where a probability of a queue to be placed before other queues
+// is proportional to its priority.
+func orderQueuesByPriority(queues []queue) []queue {
+	remaining := make([]queue, len(queues))
+	copy(remaining, queues)
+	ans := make([]queue, 0, len(queues))
+	for len(remaining) > 0 {
+		var total int
+		for _, q := range remaining {
+			total += q.priority
+		}
+		v := rand.Intn(total)
+		for i, q := range remaining {
+			if v < q.priority {
+				ans = append(ans, q)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+			v -= q.priority
+		}
+	}
+	return ans
+}
+
+func (a *Adapter) initQueues() {
+	a.queues = []queue{{name: DefaultQueueName, key: DefaultQueueKey, priority: DefaultQueuePriority}}
+	a.funcQueues = make(map[string]string)
+	a.classQueues = make(map[string]string)
+	for _, qc := range a.conf.Queues {
+		if qc.Name == DefaultQueueName {
+			a.queues[0].priority = qc.Priority
+
+		} else {
+			a.queues = append(
+				a.queues,
+				queue{name: qc.Name, key: queueKey(qc.Name), priority: qc.Priority},
+			)
+		}
+		for _, fn := range qc.Funcs {
+			a.funcQueues[fn] = queueKey(qc.Name)
+		}
+		for _, cls := range qc.Classes {
+			a.classQueues[cls] = queueKey(qc.Name)
+		}
+	}
+	a.consumedQueues = a.queues
+}
+
+// queueKeyFor returns a Redis key of a queue where the query
+// should be placed.
+func (a *Adapter) queueKeyFor(query Query) string {
+	if key, ok := a.classQueues[query.Class]; ok && query.Class != "" {
+		return key
+	}
+	if key, ok := a.funcQueues[query.Func]; ok {
+		return key
+	}
+	return DefaultQueueKey
+}
+
+// SelectQueues restricts queues the adapter consumes queries from
+// (see DequeueQuery). This allows e.g. for dedicated workers processing
+// only heavy jobs. By default, all the configured queues are consumed.
+func (a *Adapter) SelectQueues(names []string) error {
+	selected := make([]queue, 0, len(names))
+	for _, name := range names {
+		var found bool
+		for _, q := range a.queues {
+			if q.name == name {
+				selected = append(selected, q)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown queue: %s", name)
+		}
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no queues selected")
+	}
+	a.consumedQueues = selected
+	return nil
+}
+
+// ConsumedQueues returns names of queues the adapter
+// takes queries from.
+func (a *Adapter) ConsumedQueues() []string {
+	ans := make([]string, len(a.consumedQueues))
+	for i, q := range a.consumedQueues {
+		ans[i] = q.name
+	}
+	return ans
+}
+
+// queueBackend abstracts the way queries are stored in queues
+// so different Redis data structures can be used (see
+// listQueue and streamQueue).
+type queueBackend interface {
+
+	// push appends an encoded query to a queue and returns
+	// a receipt which can be later used to remove the query
+	// from the queue
+	push(queueKey string, data []byte) (receipt string, err error)
+
+	// pop takes the oldest query from a queue and marks it as being
+	// processed by the worker. ErrorEmptyQueue is returned when
+	// there is nothing to process.
+	pop(queueKey, workerID string) (data, receipt string, err error)
+
+	// ack removes a processed query
+	ack(queueKey, workerID, receipt string) error
+
+	// remove removes a query which has not been taken by any
+	// worker yet. If the query is already being processed (or it
+	// does not exist anymore), false is returned.
+	remove(queueKey, receipt string) (bool, error)
+
+	// popUnacked removes one of queries taken by the worker
+	// and not acknowledged yet. ErrorEmptyQueue is returned
+	// when there are no such queries.
+	popUnacked(workerID string) (data string, err error)
+}
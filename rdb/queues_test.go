@@ -0,0 +1,69 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueKeyFor(t *testing.T) {
+	a := &Adapter{
+		conf: &Conf{
+			Queues: []QueueConf{
+				{Name: "heavy", Priority: 1, Funcs: []string{"calcCollFreqData"}},
+				{Name: "chunks", Priority: 1, Classes: []string{QueryClassSplitChunk}},
+			},
+		},
+	}
+	a.initQueues()
+	assert.Equal(t, DefaultQueueKey, a.queueKeyFor(Query{Func: "freqDistrib"}))
+	assert.Equal(t, queueKey("heavy"), a.queueKeyFor(Query{Func: "calcCollFreqData"}))
+	assert.Equal(
+		t,
+		queueKey("chunks"),
+		a.queueKeyFor(Query{Func: "freqDistrib", Class: QueryClassSplitChunk}),
+	)
+	// class has precedence over function
+	assert.Equal(
+		t,
+		queueKey("chunks"),
+		a.queueKeyFor(Query{Func: "calcCollFreqData", Class: QueryClassSplitChunk}),
+	)
+	assert.Equal(t, DefaultQueueKey, a.queueKeyFor(Query{Func: "freqDistrib", Class: "unknown"}))
+}
+
+func TestValidateQueueClasses(t *testing.T) {
+	conf := &Conf{
+		Queues: []QueueConf{
+			{Name: "a", Classes: []string{QueryClassSplitChunk}},
+			{Name: "b", Classes: []string{QueryClassSplitChunk}},
+		},
+	}
+	assert.Error(t, conf.ValidateAndDefaults("redis"))
+}
+
+func TestQueryClassOnWire(t *testing.T) {
+	data, err := EncodeQuery(Query{Func: "freqDistrib", Class: QueryClassSplitChunk, Args: FreqDistribArgs{}})
+	assert.NoError(t, err)
+	q, err := DecodeQuery(string(data))
+	assert.NoError(t, err)
+	assert.Equal(t, QueryClassSplitChunk, q.Class)
+}
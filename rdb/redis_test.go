@@ -0,0 +1,60 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	testRedisEnvVar = "MQUERY_TEST_REDIS"
+	testRedisDB     = 15
+)
+
+// newTestAdapter creates an adapter connected to a Redis instance
+// specified by the MQUERY_TEST_REDIS environment variable (host:port).
+// The test database is flushed first so the instance must not be used
+// for anything else. In case the variable is not set, the test is skipped.
+func newTestAdapter(t *testing.T, queueBackend string) *Adapter {
+	addr := os.Getenv(testRedisEnvVar)
+	if addr == "" {
+		t.Skipf("%s not set, skipping test requiring Redis", testRedisEnvVar)
+	}
+	host, port, _ := strings.Cut(addr, ":")
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatalf("invalid %s: %s", testRedisEnvVar, addr)
+	}
+	conf := &Conf{
+		Host:         host,
+		Port:         portNum,
+		DB:           testRedisDB,
+		QueueBackend: queueBackend,
+	}
+	a := NewAdapter(conf, context.Background(), nullStatusWriter{})
+	if err := a.redis.FlushDB(a.ctx).Err(); err != nil {
+		t.Fatalf("failed to prepare test Redis database: %s", err)
+	}
+	t.Cleanup(func() { a.redis.Close() })
+	return a
+}
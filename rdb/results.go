@@ -26,12 +26,18 @@ const (
 	ResultTypeCollocations             ResultType = "coll"
 	ResultTypeCOllocationsWithExamples ResultType = "collWithExamples"
 	ResultTypeCollFreqData             ResultType = "collFreqData"
+	ResultTypeCollCounts               ResultType = "collCounts"
 	ResultTypeFreqs                    ResultType = "freqs"
 	ResultTypeMultipleFreqs            ResultType = "multipleFreqs"
 	ResultTypeCorpusInfo               ResultType = "corpusInfo"
 	ResultTypeTextTypeNorms            ResultType = "textTypeNorms"
 	ResultTypeTokenContext             ResultType = "tokenContext"
 	ResultTypeTextTypesAvailValues     ResultType = "textTypesAvailValues"
+	ResultTypeWordSketch               ResultType = "wordSketch"
+	ResultTypeThesaurus                ResultType = "thesaurus"
+	ResultTypeWordlist                 ResultType = "wordlist"
+	ResultTypeDispersion               ResultType = "dispersion"
+	ResultTypeSubcorpus                ResultType = "subcorpus"
 	ResultTypeError                    ResultType = "error"
 )
 
@@ -0,0 +1,297 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"encoding/json"
+	"math"
+	"mquery/mango"
+	"mquery/rdb"
+	"slices"
+	"strings"
+)
+
+// Dispersion contains data needed for calculating dispersion
+// measures of a searched term (see Dispersion.Stats). Documents
+// with hits are aggregated (see NewDispersion) so the data of split
+// corpus chunks can be merged (see Dispersion.MergeWith).
+type Dispersion struct {
+	ConcSize   int64 `json:"concSize"`
+	CorpusSize int64 `json:"corpusSize"`
+
+	// ARF is nil in case it is not available (merged data)
+	ARF *float64 `json:"arf"`
+
+	// NumDocs is the number of documents within the searched (sub)corpus
+	NumDocs int64 `json:"numDocs"`
+
+	// DocsSize is the total size of the documents
+	DocsSize int64 `json:"docsSize"`
+
+	MinDocSize int64 `json:"minDocSize"`
+
+	// Docf is the number of documents with at least one
+	// occurrence of the searched term
+	Docf int64 `json:"docf"`
+
+	// HitsInDocs is the number of occurrences within the documents
+	HitsInDocs int64 `json:"hitsInDocs"`
+
+	// HitDocsSize is the total size of documents with hits
+	HitDocsSize int64 `json:"hitDocsSize"`
+
+	// DPDiffSum is the sum of |f_i/f - s_i/n| for documents with hits
+	// where f and n are the total hits and the total documents size
+	// the data were aggregated with (see NewDispersion)
+	DPDiffSum float64 `json:"dpDiffSum"`
+
+	// RelFreqSum is the sum of relative frequencies f_i/s_i
+	// of documents with hits
+	RelFreqSum float64 `json:"relFreqSum"`
+
+	// RelFreqSqSum is the sum of squared relative frequencies
+	RelFreqSqSum float64 `json:"relFreqSqSum"`
+
+	TextTypes []mango.GoDispersionTextType `json:"textTypes"`
+	Error     error                        `json:"error,omitempty"`
+}
+
+func (res Dispersion) Err() error {
+	return res.Error
+}
+
+func (res *Dispersion) SetErr(err error) {
+	res.Error = err
+}
+
+func (res Dispersion) Type() rdb.ResultType {
+	return rdb.ResultTypeDispersion
+}
+
+func (res Dispersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ConcSize   int64                        `json:"concSize"`
+		CorpusSize int64                        `json:"corpusSize"`
+		ARF        *float64                     `json:"arf,omitempty"`
+		NumDocs    int64                        `json:"numDocs"`
+		DocsSize   int64                        `json:"docsSize"`
+		MinDocSize int64                        `json:"minDocSize"`
+		Docf       int64                        `json:"docf"`
+		TextTypes  []mango.GoDispersionTextType `json:"textTypes"`
+		ResultType rdb.ResultType               `json:"resultType"`
+		Error      error                        `json:"error,omitempty"`
+	}{
+		ConcSize:   res.ConcSize,
+		CorpusSize: res.CorpusSize,
+		ARF:        res.ARF,
+		NumDocs:    res.NumDocs,
+		DocsSize:   res.DocsSize,
+		MinDocSize: res.MinDocSize,
+		Docf:       res.Docf,
+		TextTypes:  res.TextTypes,
+		ResultType: res.Type(),
+		Error:      res.Error,
+	})
+}
+
+// NewDispersion aggregates documents with hits of raw dispersion data.
+// The `totalHits` and `totalDocsSize` are hits within documents and
+// the documents size of the whole searched corpus, needed for Gries' DP.
+// In case the data cover the whole searched corpus, zero values can be
+// passed and the values of the data are used.
+func NewDispersion(disp mango.GoDispersion, totalHits, totalDocsSize int64) Dispersion {
+	ans := Dispersion{
+		ConcSize:   disp.ConcSize,
+		CorpusSize: disp.CorpusSize,
+		ARF:        &disp.ARF,
+		NumDocs:    disp.NumDocs,
+		DocsSize:   disp.DocsSize,
+		MinDocSize: disp.MinDocSize,
+		Docf:       int64(len(disp.HitDocs)),
+		TextTypes:  disp.TextTypes,
+	}
+	for _, doc := range disp.HitDocs {
+		ans.HitsInDocs += doc.Freq
+		ans.HitDocsSize += doc.Size
+		if doc.Size > 0 {
+			p := float64(doc.Freq) / float64(doc.Size)
+			ans.RelFreqSum += p
+			ans.RelFreqSqSum += p * p
+		}
+	}
+	if totalHits == 0 {
+		totalHits = ans.HitsInDocs
+	}
+	if totalDocsSize == 0 {
+		totalDocsSize = ans.DocsSize
+	}
+	if totalHits > 0 && totalDocsSize > 0 {
+		f := float64(totalHits)
+		n := float64(totalDocsSize)
+		for _, doc := range disp.HitDocs {
+			ans.DPDiffSum += math.Abs(float64(doc.Freq)/f - float64(doc.Size)/n)
+		}
+	}
+	return ans
+}
+
+// MergeWith adds data of another part of a corpus (typically a split
+// corpus chunk). The parts must not divide documents and their data
+// must be aggregated with the same totals (see NewDispersion).
+// The ARF cannot be merged so it is removed.
+func (res *Dispersion) MergeWith(other *Dispersion) {
+	res.ConcSize += other.ConcSize
+	res.CorpusSize = other.CorpusSize // always the same value but to resolve possible initial 0
+	res.ARF = nil
+	if res.NumDocs == 0 || other.NumDocs > 0 && other.MinDocSize < res.MinDocSize {
+		res.MinDocSize = other.MinDocSize
+	}
+	res.NumDocs += other.NumDocs
+	res.DocsSize += other.DocsSize
+	res.Docf += other.Docf
+	res.HitsInDocs += other.HitsInDocs
+	res.HitDocsSize += other.HitDocsSize
+	res.DPDiffSum += other.DPDiffSum
+	res.RelFreqSum += other.RelFreqSum
+	res.RelFreqSqSum += other.RelFreqSqSum
+	for _, tt := range other.TextTypes {
+		idx := slices.IndexFunc(
+			res.TextTypes,
+			func(v mango.GoDispersionTextType) bool { return v.Value == tt.Value },
+		)
+		if idx >= 0 {
+			res.TextTypes[idx].Freq += tt.Freq
+			res.TextTypes[idx].Size += tt.Size
+
+		} else {
+			res.TextTypes = append(res.TextTypes, tt)
+		}
+	}
+}
+
+// Stats calculates dispersion measures from the aggregated data
+func (res *Dispersion) Stats() *DispersionStats {
+	ans := &DispersionStats{
+		NumDocs:   res.NumDocs,
+		Docf:      res.Docf,
+		TextTypes: make([]*TextTypeFreq, 0, len(res.TextTypes)),
+	}
+	for _, tt := range res.TextTypes {
+		var ipm float64
+		if tt.Size > 0 {
+			ipm = float64(tt.Freq) / float64(tt.Size) * 1e6
+		}
+		ans.TextTypes = append(
+			ans.TextTypes,
+			&TextTypeFreq{
+				Value: tt.Value,
+				Freq:  tt.Freq,
+				Size:  tt.Size,
+				IPM:   rdb.NormRound(ipm),
+			},
+		)
+	}
+	slices.SortFunc(ans.TextTypes, func(a, b *TextTypeFreq) int {
+		return strings.Compare(a.Value, b.Value)
+	})
+
+	if res.HitsInDocs == 0 || res.DocsSize == 0 {
+		return ans
+	}
+
+	// Gries' DP - docs with no hits contribute by their
+	// expected share (i.e. the relative size)
+	n := float64(res.DocsSize)
+	dp := 0.5 * (res.DPDiffSum + max(1-float64(res.HitDocsSize)/n, 0))
+	ans.DP = rdb.NormRound(dp)
+	if minShare := float64(res.MinDocSize) / n; minShare < 1 {
+		ans.DPNorm = rdb.NormRound(dp / (1 - minShare))
+	}
+
+	// Juilland's D - calculated from relative frequencies
+	// in documents (docs with no hits have zero frequency)
+	if res.NumDocs > 1 {
+		numDocs := float64(res.NumDocs)
+		mean := res.RelFreqSum / numDocs
+		if mean > 0 {
+			sd := math.Sqrt(max(res.RelFreqSqSum/numDocs-mean*mean, 0))
+			ans.JuillandD = rdb.NormRound(1 - sd/mean/math.Sqrt(numDocs-1))
+		}
+	}
+	return ans
+}
+
+// ConcSizeResponse creates a term frequency response
+// extended with dispersion measures
+func (res *Dispersion) ConcSizeResponse() ConcSizeResponse {
+	var ipm float64
+	if res.CorpusSize > 0 {
+		ipm = float64(res.ConcSize) / float64(res.CorpusSize) * 1000000
+	}
+	if res.ARF != nil {
+		arf := rdb.NormRound(*res.ARF)
+		res.ARF = &arf
+	}
+	return ConcSizeResponse{
+		Total:      res.ConcSize,
+		ARF:        res.ARF,
+		IPM:        rdb.NormRound(ipm),
+		CorpusSize: res.CorpusSize,
+		Dispersion: res.Stats(),
+		ResultType: rdb.ResultTypeConcSize,
+		Error:      res.Error,
+	}
+}
+
+// ----
+
+type TextTypeFreq struct {
+	Value string `json:"value"`
+	Freq  int64  `json:"freq"`
+
+	// Size is a number of tokens of the text type
+	// within the searched (sub)corpus
+	Size int64   `json:"size"`
+	IPM  float64 `json:"ipm"`
+}
+
+type DispersionStats struct {
+
+	// NumDocs is the number of documents within the searched (sub)corpus
+	NumDocs int64 `json:"numDocs"`
+
+	// Docf is the number of documents containing the searched term
+	Docf int64 `json:"docf"`
+
+	// DP is Gries' deviation of proportions (0 = even distribution,
+	// values close to 1 = uneven distribution)
+	DP float64 `json:"dp"`
+
+	// DPNorm is the DP normalized to the range [0, 1]
+	// (see Lijffijt & Gries, 2012)
+	DPNorm float64 `json:"dpNorm"`
+
+	// JuillandD is Juilland's D calculated with documents as
+	// corpus parts (1 = even distribution, 0 = uneven distribution)
+	JuillandD float64 `json:"juillandD"`
+
+	// TextTypes contains frequencies of the searched term in
+	// individual text types (if requested)
+	TextTypes []*TextTypeFreq `json:"textTypes,omitempty"`
+} // @name DispersionStats
@@ -0,0 +1,160 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"encoding/json"
+	"mquery/mango"
+	"mquery/rdb"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispersionStats(t *testing.T) {
+	disp := NewDispersion(
+		mango.GoDispersion{
+			ConcSize:   9,
+			NumDocs:    4,
+			DocsSize:   400,
+			MinDocSize: 100,
+			HitDocs: []mango.GoDispersionDoc{
+				{Freq: 4, Size: 100},
+				{Freq: 4, Size: 100},
+			},
+		},
+		0,
+		0,
+	)
+	stats := disp.Stats()
+	assert.Equal(t, int64(4), stats.NumDocs)
+	assert.Equal(t, int64(2), stats.Docf)
+	assert.InDelta(t, 0.5, stats.DP, 0.001)
+	assert.InDelta(t, 0.667, stats.DPNorm, 0.001)
+	assert.InDelta(t, 0.423, stats.JuillandD, 0.001)
+}
+
+func TestDispersionStatsEven(t *testing.T) {
+	disp := NewDispersion(
+		mango.GoDispersion{
+			NumDocs:    2,
+			DocsSize:   300,
+			MinDocSize: 100,
+			HitDocs: []mango.GoDispersionDoc{
+				{Freq: 1, Size: 100},
+				{Freq: 2, Size: 200},
+			},
+		},
+		0,
+		0,
+	)
+	stats := disp.Stats()
+	assert.InDelta(t, 0, stats.DP, 0.001)
+	assert.InDelta(t, 1, stats.JuillandD, 0.001)
+}
+
+func TestDispersionStatsNoHits(t *testing.T) {
+	disp := NewDispersion(mango.GoDispersion{NumDocs: 2, DocsSize: 300, MinDocSize: 100}, 0, 0)
+	stats := disp.Stats()
+	assert.Equal(t, int64(0), stats.Docf)
+	assert.Equal(t, 0.0, stats.DP)
+	assert.Equal(t, 0.0, stats.JuillandD)
+}
+
+func TestDispersionMergeWith(t *testing.T) {
+	chunk1 := mango.GoDispersion{
+		ConcSize:   5,
+		CorpusSize: 400,
+		ARF:        3.2,
+		NumDocs:    2,
+		DocsSize:   250,
+		MinDocSize: 100,
+		HitDocs:    []mango.GoDispersionDoc{{Freq: 5, Size: 150}},
+		TextTypes: []mango.GoDispersionTextType{
+			{Value: "fiction", Freq: 5, Size: 150},
+			{Value: "news", Freq: 0, Size: 100},
+		},
+	}
+	chunk2 := mango.GoDispersion{
+		ConcSize:   3,
+		CorpusSize: 400,
+		ARF:        2.1,
+		NumDocs:    2,
+		DocsSize:   150,
+		MinDocSize: 50,
+		HitDocs:    []mango.GoDispersionDoc{{Freq: 3, Size: 100}},
+		TextTypes: []mango.GoDispersionTextType{
+			{Value: "news", Freq: 3, Size: 150},
+		},
+	}
+	result := new(Dispersion)
+	part1 := NewDispersion(chunk1, 8, 400)
+	result.MergeWith(&part1)
+	part2 := NewDispersion(chunk2, 8, 400)
+	result.MergeWith(&part2)
+	assert.Equal(t, int64(8), result.ConcSize)
+	assert.Equal(t, int64(400), result.CorpusSize)
+	assert.Nil(t, result.ARF)
+	assert.Equal(t, int64(4), result.NumDocs)
+	assert.Equal(t, int64(400), result.DocsSize)
+	assert.Equal(t, int64(50), result.MinDocSize)
+	assert.Equal(t, int64(2), result.Docf)
+	assert.Equal(t, int64(8), result.HitsInDocs)
+
+	stats := result.Stats()
+	assert.Equal(t, int64(2), stats.Docf)
+	assert.Equal(t, []*TextTypeFreq{
+		{Value: "fiction", Freq: 5, Size: 150, IPM: 33333.333},
+		{Value: "news", Freq: 3, Size: 250, IPM: 12000},
+	}, stats.TextTypes)
+
+	// merged chunks aggregated with the totals must
+	// produce the same measures as the whole corpus
+	whole := NewDispersion(
+		mango.GoDispersion{
+			NumDocs:    4,
+			DocsSize:   400,
+			MinDocSize: 50,
+			HitDocs:    append(chunk1.HitDocs, chunk2.HitDocs...),
+		},
+		0,
+		0,
+	)
+	wholeStats := whole.Stats()
+	assert.InDelta(t, wholeStats.DP, stats.DP, 0.0001)
+	assert.InDelta(t, wholeStats.DPNorm, stats.DPNorm, 0.0001)
+	assert.InDelta(t, wholeStats.JuillandD, stats.JuillandD, 0.0001)
+
+	resp := result.ConcSizeResponse()
+	assert.Equal(t, int64(8), resp.Total)
+	assert.Nil(t, resp.ARF)
+	assert.InDelta(t, 20000, resp.IPM, 0.001)
+	assert.Equal(t, stats, resp.Dispersion)
+	data, err := json.Marshal(resp)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `"arf"`)
+}
+
+func TestDispersionConcSizeResponseARF(t *testing.T) {
+	disp := NewDispersion(mango.GoDispersion{ConcSize: 3, CorpusSize: 100, ARF: 1.23456}, 0, 0)
+	resp := disp.ConcSizeResponse()
+	if assert.NotNil(t, resp.ARF) {
+		assert.Equal(t, rdb.NormRound(1.23456), *resp.ARF)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/czcorpus/cnc-gokit/maths"
+)
+
+const (
+	KeynessLogLikelihood = "logLikelihood"
+	KeynessPercDiff      = "percDiff"
+	KeynessSimpleMaths   = "simpleMaths"
+	KeynessChiSquare     = "chiSquare"
+
+	// percDiffZeroRefIPM replaces zero reference frequencies
+	// so %DIFF remains finite (see Gabrielatos & Marchi, 2012)
+	percDiffZeroRefIPM = 1e-18
+)
+
+func IsValidKeynessMeasure(v string) bool {
+	return v == KeynessLogLikelihood || v == KeynessPercDiff ||
+		v == KeynessSimpleMaths || v == KeynessChiSquare
+}
+
+type KeywordsItem struct {
+	Word          string  `json:"word"`
+	Freq          int64   `json:"freq"`
+	RefFreq       int64   `json:"refFreq"`
+	IPM           float64 `json:"ipm"`
+	RefIPM        float64 `json:"refIpm"`
+	LogLikelihood float64 `json:"logLikelihood"`
+	PercDiff      float64 `json:"percDiff"`
+	SimpleMaths   float64 `json:"simpleMaths"`
+	ChiSquare     float64 `json:"chiSquare"`
+}
+
+func (item *KeywordsItem) score(measure string) float64 {
+	switch measure {
+	case KeynessPercDiff:
+		return item.PercDiff
+	case KeynessSimpleMaths:
+		return item.SimpleMaths
+	case KeynessChiSquare:
+		return item.ChiSquare
+	default:
+		return item.LogLikelihood
+	}
+}
+
+type Keywords struct {
+
+	// FocusSize is a number of tokens of the focus (sub)corpus
+	FocusSize int64 `json:"focusSize"`
+
+	// RefSize is a number of tokens of the reference (sub)corpus
+	RefSize int64 `json:"refSize"`
+
+	Measure string          `json:"measure"`
+	Items   []*KeywordsItem `json:"items"`
+}
+
+// KeywordsConf configures calculation of keywords
+type KeywordsConf struct {
+
+	// Measure is one of Keyness* values; items are sorted by the measure
+	Measure string
+
+	// MinFreq is the minimum frequency in the focus corpus
+	MinFreq int64
+
+	// MinRefFreq is the minimum frequency in the reference corpus
+	MinRefFreq int64
+
+	// Smoothing is the N parameter of the "simple maths" measure
+	Smoothing float64
+
+	MaxItems int
+}
+
+func xlnx(x, e float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return x * math.Log(x/e)
+}
+
+// CompileKeywords compares word lists of a focus and a reference corpus
+// and returns words which are significantly more frequent in the focus
+// corpus. The reference list must contain all the focus words occurring
+// in the reference corpus (a missing word means zero frequency).
+func CompileKeywords(focus, ref *Wordlist, conf KeywordsConf) (Keywords, error) {
+	ans := Keywords{
+		FocusSize: focus.SearchSize,
+		RefSize:   ref.SearchSize,
+		Measure:   conf.Measure,
+		Items:     make([]*KeywordsItem, 0, len(focus.Items)),
+	}
+	if !IsValidKeynessMeasure(conf.Measure) {
+		return ans, fmt.Errorf("unknown keyness measure %s", conf.Measure)
+	}
+	if focus.SearchSize == 0 || ref.SearchSize == 0 {
+		return ans, nil
+	}
+	refFreqs := make(map[string]int64, len(ref.Items))
+	for _, v := range ref.Items {
+		refFreqs[v.Word] += v.Freq
+	}
+	c := float64(focus.SearchSize)
+	d := float64(ref.SearchSize)
+	for _, v := range focus.Items {
+		refFreq := refFreqs[v.Word]
+		if v.Freq < conf.MinFreq || refFreq < conf.MinRefFreq {
+			continue
+		}
+		a := float64(v.Freq)
+		b := float64(refFreq)
+		ipm := a / c * 1e6
+		refIPM := b / d * 1e6
+		if ipm <= refIPM {
+			continue
+		}
+		e1 := c * (a + b) / (c + d)
+		e2 := d * (a + b) / (c + d)
+		chiDenom := (a + b) * (c + d - a - b) * c * d
+		var chi float64
+		if chiDenom > 0 {
+			chi = (c + d) * math.Pow(a*(d-b)-b*(c-a), 2) / chiDenom
+		}
+		ans.Items = append(
+			ans.Items,
+			&KeywordsItem{
+				Word:          v.Word,
+				Freq:          v.Freq,
+				RefFreq:       refFreq,
+				IPM:           maths.RoundToN(ipm, 4),
+				RefIPM:        maths.RoundToN(refIPM, 4),
+				LogLikelihood: maths.RoundToN(2*(xlnx(a, e1)+xlnx(b, e2)), 4),
+				PercDiff:      maths.RoundToN((ipm-refIPM)*100/max(refIPM, percDiffZeroRefIPM), 4),
+				SimpleMaths:   maths.RoundToN((ipm+conf.Smoothing)/(refIPM+conf.Smoothing), 4),
+				ChiSquare:     maths.RoundToN(chi, 4),
+			},
+		)
+	}
+	slices.SortFunc(ans.Items, func(x, y *KeywordsItem) int {
+		return cmp.Or(cmp.Compare(y.score(conf.Measure), x.score(conf.Measure)), cmp.Compare(x.Word, y.Word))
+	})
+	if len(ans.Items) > conf.MaxItems {
+		ans.Items = ans.Items[:conf.MaxItems]
+	}
+	return ans, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"math"
+	"mquery/mango"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeywordsInput() (*Wordlist, *Wordlist) {
+	focus := &Wordlist{
+		SearchSize: 1000,
+		Items: []*mango.GoWordlistItem{
+			{Word: "x", Freq: 20},
+			{Word: "y", Freq: 1},
+			{Word: "z", Freq: 5},
+			{Word: "w", Freq: 10},
+		},
+	}
+	ref := &Wordlist{
+		SearchSize: 10000,
+		Items: []*mango.GoWordlistItem{
+			{Word: "x", Freq: 40},
+			{Word: "y", Freq: 1},
+			{Word: "z", Freq: 100},
+		},
+	}
+	return focus, ref
+}
+
+func TestCompileKeywords(t *testing.T) {
+	focus, ref := testKeywordsInput()
+	ans, err := CompileKeywords(
+		focus, ref, KeywordsConf{Measure: KeynessLogLikelihood, MinFreq: 2, Smoothing: 1, MaxItems: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), ans.FocusSize)
+	assert.Equal(t, int64(10000), ans.RefSize)
+	// "y" is under minFreq, "z" is relatively less frequent in the focus corpus
+	assert.Len(t, ans.Items, 2)
+	assert.Equal(t, "w", ans.Items[0].Word)
+	assert.Equal(t, "x", ans.Items[1].Word)
+
+	x := ans.Items[1]
+	assert.Equal(t, int64(40), x.RefFreq)
+	assert.InDelta(t, 20000, x.IPM, 0.001)
+	assert.InDelta(t, 4000, x.RefIPM, 0.001)
+	e1 := 1000.0 * 60 / 11000
+	e2 := 10000.0 * 60 / 11000
+	assert.InDelta(t, 2*(20*math.Log(20/e1)+40*math.Log(40/e2)), x.LogLikelihood, 0.001)
+	assert.InDelta(t, 400, x.PercDiff, 0.001)
+	assert.InDelta(t, 20001.0/4001.0, x.SimpleMaths, 0.001)
+	assert.InDelta(t, 11000*math.Pow(20*9960-40*980, 2)/(60*10940*1000*10000), x.ChiSquare, 0.001)
+
+	w := ans.Items[0]
+	assert.Equal(t, int64(0), w.RefFreq)
+	assert.InDelta(t, 20*math.Log(11), w.LogLikelihood, 0.001)
+	assert.InDelta(t, 10001, w.SimpleMaths, 0.001)
+}
+
+func TestCompileKeywordsThresholdsAndCut(t *testing.T) {
+	focus, ref := testKeywordsInput()
+	conf := KeywordsConf{Measure: KeynessSimpleMaths, MinFreq: 1, MinRefFreq: 1, Smoothing: 1, MaxItems: 10}
+	ans, err := CompileKeywords(focus, ref, conf)
+	assert.NoError(t, err)
+	// "w" is not in the reference corpus
+	assert.Len(t, ans.Items, 2)
+	assert.Equal(t, "y", ans.Items[0].Word)
+	assert.InDelta(t, 1001.0/101.0, ans.Items[0].SimpleMaths, 0.001)
+	assert.Equal(t, "x", ans.Items[1].Word)
+
+	conf.MaxItems = 1
+	ans, err = CompileKeywords(focus, ref, conf)
+	assert.NoError(t, err)
+	assert.Len(t, ans.Items, 1)
+	assert.Equal(t, "y", ans.Items[0].Word)
+}
+
+func TestCompileKeywordsInvalidMeasure(t *testing.T) {
+	focus, ref := testKeywordsInput()
+	_, err := CompileKeywords(focus, ref, KeywordsConf{Measure: "foo", MaxItems: 10})
+	assert.Error(t, err)
+}
@@ -19,12 +19,15 @@
 package results
 
 import (
+	"cmp"
 	"encoding/json"
 	"math"
 	"mquery/mango"
 	"mquery/rdb"
 	"slices"
+	"strings"
 
+	"github.com/czcorpus/cnc-gokit/maths"
 	"github.com/czcorpus/cnc-gokit/util"
 	"github.com/czcorpus/mquery-common/concordance"
 	"github.com/czcorpus/mquery-common/corp"
@@ -153,12 +156,28 @@ func (flist FreqDistribItemList) AlwaysAsList() []*FreqDistribItem {
 }
 
 type FreqDistribItem struct {
-	Word string  `json:"word"`
+	Word string `json:"word"`
+
+	// Values contains values of individual levels in case
+	// of a multi-level frequency distribution (Word then
+	// contains the values joined by spaces)
+	Values []string `json:"values,omitempty"`
+
 	Freq int64   `json:"freq"`
 	Base int64   `json:"base"`
 	IPM  float32 `json:"ipm"`
 }
 
+// mergeKey returns a value identifying the item when merging
+// distributions. For multi-level items, the space-joined Word
+// is ambiguous (values may contain spaces) so Values are used.
+func (item *FreqDistribItem) mergeKey() string {
+	if len(item.Values) > 0 {
+		return strings.Join(item.Values, "\t")
+	}
+	return item.Word
+}
+
 type WordFormsItem struct {
 	Lemma    string              `json:"lemma"`
 	Sublemma string              `json:"sublemma,omitempty"`
@@ -211,6 +230,10 @@ func (res FreqDistrib) Err() error {
 	return res.Error
 }
 
+func (res *FreqDistrib) SetErr(err error) {
+	res.Error = err
+}
+
 func (res FreqDistrib) Type() rdb.ResultType {
 	return rdb.ResultTypeFreqs
 }
@@ -241,8 +264,13 @@ func (res *FreqDistrib) MergeWith(other *FreqDistrib) {
 	res.ConcSize += other.ConcSize
 	res.CorpusSize = other.CorpusSize // always the same value but to resolve possible initial 0
 	res.ExamplesQueryTpl = ""         // we cannot merge two CQL queries so we remove it
+	// large lists (e.g. word lists) would be too slow with FindItem
+	index := make(map[string]*FreqDistribItem, len(res.Freqs))
+	for _, v := range res.Freqs {
+		index[v.mergeKey()] = v
+	}
 	for _, v2 := range other.Freqs {
-		v1 := res.FindItem(v2.Word)
+		v1 := index[v2.mergeKey()]
 		if v1 != nil {
 			v1.Freq += v2.Freq
 			v1.IPM = float32(v1.Freq) / float32(v1.Base) * 1e6
@@ -250,6 +278,7 @@ func (res *FreqDistrib) MergeWith(other *FreqDistrib) {
 		} else {
 			// orig IPM should be OK for the first item so no need to set it here
 			res.Freqs = append(res.Freqs, v2)
+			index[v2.mergeKey()] = v2
 		}
 	}
 }
@@ -257,12 +286,18 @@ func (res *FreqDistrib) MergeWith(other *FreqDistrib) {
 // ----
 
 type ConcSizeResponse struct {
-	Total      int64          `json:"total"`
-	ARF        float64        `json:"arf"`
-	IPM        float64        `json:"ipm"`
-	CorpusSize int64          `json:"corpusSize"`
-	ResultType rdb.ResultType `json:"resultType"`
-	Error      error          `json:"error,omitempty"`
+	Total int64 `json:"total"`
+
+	// ARF is omitted in case it is not available
+	// (e.g. for parallel calculations)
+	ARF        *float64 `json:"arf,omitempty"`
+	IPM        float64  `json:"ipm"`
+	CorpusSize int64    `json:"corpusSize"`
+
+	// Dispersion is available only if requested
+	Dispersion *DispersionStats `json:"dispersion,omitempty"`
+	ResultType rdb.ResultType   `json:"resultType"`
+	Error      error            `json:"error,omitempty"`
 } // @name ConcSize
 
 type ConcSize struct {
@@ -276,11 +311,16 @@ func (res ConcSize) Err() error {
 	return res.Error
 }
 
+func (res *ConcSize) SetErr(err error) {
+	res.Error = err
+}
+
 func (res ConcSize) Type() rdb.ResultType {
 	return rdb.ResultTypeConcSize
 }
 
 func (res *ConcSize) MarshalJSON() ([]byte, error) {
+	arf := rdb.NormRound(res.ARF)
 	var ipm float64
 	if res.CorpusSize > 0 {
 		ipm = float64(res.Total) / float64(res.CorpusSize) * 1000000
@@ -288,7 +328,7 @@ func (res *ConcSize) MarshalJSON() ([]byte, error) {
 	return json.Marshal(
 		ConcSizeResponse{
 			Total:      res.Total,
-			ARF:        rdb.NormRound(res.ARF),
+			ARF:        &arf,
 			IPM:        rdb.NormRound(ipm),
 			CorpusSize: res.CorpusSize,
 			ResultType: res.Type(),
@@ -324,6 +364,10 @@ func (res Collocations) Err() error {
 	return res.Error
 }
 
+func (res *Collocations) SetErr(err error) {
+	res.Error = err
+}
+
 func (res Collocations) Type() rdb.ResultType {
 	return rdb.ResultTypeCollocations
 }
@@ -347,6 +391,106 @@ func (res *Collocations) MarshalJSON() ([]byte, error) {
 	)
 }
 
+// CollCounts contains raw counts of collocates (i.e. `Freq` and `CorpFreq`
+// of each collocate with no scores, no minimum frequency and no limit
+// applied) calculated on a chunk of a split corpus (see CollCountsMerger)
+type CollCounts struct {
+	ConcSize   int64
+	CorpusSize int64
+	SubcSize   int64
+	Colls      []*mango.GoCollItem
+	Error      error
+}
+
+func (res CollCounts) Err() error {
+	return res.Error
+}
+
+func (res *CollCounts) SetErr(err error) {
+	res.Error = err
+}
+
+func (res CollCounts) Type() rdb.ResultType {
+	return rdb.ResultTypeCollCounts
+}
+
+// CollCountsMerger merges collocate counts calculated on chunks of
+// a split corpus (see CollCounts). As most of the measures cannot be
+// merged from per-chunk scores, the final scores are calculated from
+// the merged counts.
+type CollCountsMerger struct {
+	concSize   int64
+	corpusSize int64
+	subcSize   int64
+	items      map[string]*mango.GoCollItem
+}
+
+// Add adds a result of a chunk. The method is not safe
+// for concurrent use.
+func (m *CollCountsMerger) Add(chunk *CollCounts) {
+	m.concSize += chunk.ConcSize
+	m.corpusSize = chunk.CorpusSize // always the same value
+	m.subcSize += chunk.SubcSize
+	for _, v := range chunk.Colls {
+		curr, ok := m.items[v.Word]
+		if !ok {
+			curr = &mango.GoCollItem{Word: v.Word}
+			m.items[v.Word] = curr
+		}
+		curr.Freq += v.Freq
+		curr.CorpFreq += v.CorpFreq
+	}
+}
+
+// Result calculates scores of the merged collocates and returns
+// at most `maxItems` of them sorted by the score.
+func (m *CollCountsMerger) Result(
+	measure string,
+	minFreq, minCorpFreq int64,
+	maxItems int,
+) (Collocations, error) {
+	ans := Collocations{
+		ConcSize:   m.concSize,
+		CorpusSize: m.corpusSize,
+		SubcSize:   m.subcSize,
+		Colls:      make([]*mango.GoCollItem, 0, len(m.items)),
+	}
+	msr, err := mango.ImportCollMeasure(measure)
+	if err != nil {
+		return ans, err
+	}
+	ans.Measure, err = mango.NormalizeCollMeasureName(measure)
+	if err != nil {
+		return ans, err
+	}
+	for _, item := range m.items {
+		if item.Freq < minFreq || item.CorpFreq < minCorpFreq {
+			continue
+		}
+		score, err := mango.CollScore(
+			msr, float64(item.Freq), float64(m.concSize), float64(item.CorpFreq), float64(m.subcSize))
+		if err != nil {
+			return ans, err
+		}
+		item.Score = maths.RoundToN(score, 4)
+		ans.Colls = append(ans.Colls, item)
+	}
+	slices.SortFunc(ans.Colls, func(a, b *mango.GoCollItem) int {
+		if a.Score != b.Score {
+			return cmp.Compare(b.Score, a.Score)
+		}
+		return strings.Compare(a.Word, b.Word)
+	})
+	if len(ans.Colls) > maxItems {
+		ans.Colls = ans.Colls[:maxItems]
+	}
+	return ans, nil
+}
+
+func NewCollCountsMerger() *CollCountsMerger {
+	return &CollCountsMerger{items: make(map[string]*mango.GoCollItem)}
+}
+
 // ----
 
 type CollFreqData struct {
@@ -357,6 +501,10 @@ func (res CollFreqData) Err() error {
 	return res.Error
 }
 
+func (res *CollFreqData) SetErr(err error) {
+	res.Error = err
+}
+
 func (res CollFreqData) Type() rdb.ResultType {
 	return rdb.ResultTypeCollFreqData
 }
@@ -394,6 +542,10 @@ func (res Concordance) Err() error {
 	return res.Error
 }
 
+func (res *Concordance) SetErr(err error) {
+	res.Error = err
+}
+
 func (res Concordance) Type() rdb.ResultType {
 	return rdb.ResultTypeConcordance
 }
@@ -422,6 +574,10 @@ func (res CorpusInfo) Err() error {
 	return res.Error
 }
 
+func (res *CorpusInfo) SetErr(err error) {
+	res.Error = err
+}
+
 func (res CorpusInfo) Type() rdb.ResultType {
 	return rdb.ResultTypeCorpusInfo
 
@@ -450,6 +606,10 @@ func (res TextTypeNorms) Err() error {
 	return res.Error
 }
 
+func (res *TextTypeNorms) SetErr(err error) {
+	res.Error = err
+}
+
 func (res TextTypeNorms) Type() rdb.ResultType {
 	return rdb.ResultTypeTextTypeNorms
 }
@@ -477,6 +637,10 @@ func (res TokenContext) Err() error {
 	return res.Error
 }
 
+func (res *TokenContext) SetErr(err error) {
+	res.Error = err
+}
+
 func (res TokenContext) Type() rdb.ResultType {
 	return rdb.ResultTypeTokenContext
 }
@@ -504,6 +668,10 @@ func (res TextTypesAvailValues) Err() error {
 	return res.Error
 }
 
+func (res *TextTypesAvailValues) SetErr(err error) {
+	res.Error = err
+}
+
 func (res TextTypesAvailValues) Type() rdb.ResultType {
 	return rdb.ResultTypeTextTypesAvailValues
 }
@@ -0,0 +1,113 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"math"
+	"mquery/mango"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollCountsMerger(t *testing.T) {
+	m := NewCollCountsMerger()
+	m.Add(&CollCounts{
+		ConcSize:   10,
+		CorpusSize: 3000,
+		SubcSize:   1000,
+		Colls: []*mango.GoCollItem{
+			{Word: "a", Freq: 4, CorpFreq: 40},
+			{Word: "b", Freq: 1, CorpFreq: 10},
+		},
+	})
+	m.Add(&CollCounts{
+		ConcSize:   30,
+		CorpusSize: 3000,
+		SubcSize:   2000,
+		Colls: []*mango.GoCollItem{
+			{Word: "a", Freq: 6, CorpFreq: 60},
+			{Word: "b", Freq: 1, CorpFreq: 20},
+			{Word: "c", Freq: 3, CorpFreq: 3},
+		},
+	})
+	ans, err := m.Result("logDice", 3, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "logDice", ans.Measure)
+	assert.Equal(t, int64(40), ans.ConcSize)
+	assert.Equal(t, int64(3000), ans.SubcSize)
+	assert.Len(t, ans.Colls, 2)
+	// logDice = 14 + log2(2 * fAB / (fA + fB))
+	assert.Equal(t, "a", ans.Colls[0].Word)
+	assert.Equal(t, int64(10), ans.Colls[0].Freq)
+	assert.Equal(t, int64(100), ans.Colls[0].CorpFreq)
+	assert.InDelta(t, 14+math.Log2(20.0/140.0), ans.Colls[0].Score, 1e-4)
+	assert.Equal(t, "c", ans.Colls[1].Word)
+	assert.InDelta(t, 14+math.Log2(6.0/43.0), ans.Colls[1].Score, 1e-4)
+}
+
+func TestCollCountsMergerMaxItems(t *testing.T) {
+	m := NewCollCountsMerger()
+	m.Add(&CollCounts{
+		ConcSize: 10,
+		SubcSize: 1000,
+		Colls: []*mango.GoCollItem{
+			{Word: "a", Freq: 4, CorpFreq: 40},
+			{Word: "b", Freq: 5, CorpFreq: 10},
+		},
+	})
+	ans, err := m.Result("f", 1, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "absFreq", ans.Measure)
+	assert.Len(t, ans.Colls, 1)
+	assert.Equal(t, "b", ans.Colls[0].Word)
+	assert.Equal(t, 5.0, ans.Colls[0].Score)
+
+	_, err = m.Result("foo", 1, 1, 1)
+	assert.Error(t, err)
+}
+
+func TestFreqDistribMergeWithMultiLevel(t *testing.T) {
+	// "a b" + "c" and "a" + "b c" share the same space-joined Word
+	res := &FreqDistrib{
+		CorpusSize: 1000,
+		Freqs: FreqDistribItemList{
+			{Word: "a b c", Values: []string{"a b", "c"}, Freq: 2, Base: 100},
+		},
+	}
+	res.MergeWith(&FreqDistrib{
+		CorpusSize: 1000,
+		Freqs: FreqDistribItemList{
+			{Word: "a b c", Values: []string{"a", "b c"}, Freq: 3, Base: 100},
+			{Word: "a b c", Values: []string{"a b", "c"}, Freq: 5, Base: 100},
+		},
+	})
+	assert.Len(t, res.Freqs, 2)
+	assert.Equal(t, []string{"a b", "c"}, res.Freqs[0].Values)
+	assert.Equal(t, int64(7), res.Freqs[0].Freq)
+	assert.Equal(t, []string{"a", "b c"}, res.Freqs[1].Values)
+	assert.Equal(t, int64(3), res.Freqs[1].Freq)
+}
+
+func TestFreqDistribMergeWithSingleLevel(t *testing.T) {
+	res := &FreqDistrib{Freqs: FreqDistribItemList{{Word: "a", Freq: 2, Base: 100}}}
+	res.MergeWith(&FreqDistrib{Freqs: FreqDistribItemList{{Word: "a", Freq: 3, Base: 100}}})
+	assert.Len(t, res.Freqs, 1)
+	assert.Equal(t, int64(5), res.Freqs[0].Freq)
+}
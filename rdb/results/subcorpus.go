@@ -0,0 +1,61 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"encoding/json"
+	"mquery/rdb"
+)
+
+type Subcorpus struct {
+
+	// Size is the number of positions of the subcorpus
+	Size int64 `json:"size"`
+
+	// NumRanges is the number of position ranges
+	// the subcorpus consists of
+	NumRanges int   `json:"numRanges"`
+	Error     error `json:"error,omitempty"`
+}
+
+func (res Subcorpus) Err() error {
+	return res.Error
+}
+
+func (res *Subcorpus) SetErr(err error) {
+	res.Error = err
+}
+
+func (res Subcorpus) Type() rdb.ResultType {
+	return rdb.ResultTypeSubcorpus
+}
+
+func (res Subcorpus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Size       int64          `json:"size"`
+		NumRanges  int            `json:"numRanges"`
+		ResultType rdb.ResultType `json:"resultType"`
+		Error      error          `json:"error,omitempty"`
+	}{
+		Size:       res.Size,
+		NumRanges:  res.NumRanges,
+		ResultType: res.Type(),
+		Error:      res.Error,
+	})
+}
@@ -0,0 +1,175 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"mquery/rdb"
+
+	"github.com/czcorpus/mquery-common/concordance"
+)
+
+// RegisterResultTypes registers all the result types
+// so they can be transferred from workers to API servers
+func RegisterResultTypes() {
+	rdb.RegisterResultType[CollFreqData]()
+	rdb.RegisterResultType[Collocations]()
+	rdb.RegisterResultType[CollCounts]()
+	rdb.RegisterResultType[ConcSize]()
+	rdb.RegisterResultType[Concordance]()
+	rdb.RegisterResultType[CorpusInfo]()
+	rdb.RegisterResultType[FreqDistrib]()
+	rdb.RegisterResultType[TextTypeNorms]()
+	rdb.RegisterResultType[TokenContext]()
+	rdb.RegisterResultType[TextTypesAvailValues]()
+	rdb.RegisterResultType[WordSketch]()
+	rdb.RegisterResultType[Thesaurus]()
+	rdb.RegisterResultType[Wordlist]()
+	rdb.RegisterResultType[Dispersion]()
+	rdb.RegisterResultType[Subcorpus]()
+}
+
+// Decoding of concordance lines as transferred from workers.
+// We cannot rely on concordance.TokenSlice.UnmarshalJSON as it
+// does not support closing structures and it loses the
+// `self-close` flag.
+
+type wireLineElement struct {
+	Type          string            `json:"type"`
+	StructureType string            `json:"structureType"`
+	Name          string            `json:"name"`
+	Attrs         map[string]string `json:"attrs"`
+	ErrMsg        string            `json:"error"`
+}
+
+func decodeLineElements(data json.RawMessage) (concordance.TokenSlice, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var rawElements []json.RawMessage
+	if err := json.Unmarshal(data, &rawElements); err != nil {
+		return nil, err
+	}
+	ans := make(concordance.TokenSlice, len(rawElements))
+	for i, rawElm := range rawElements {
+		var elm wireLineElement
+		if err := json.Unmarshal(rawElm, &elm); err != nil {
+			return nil, err
+		}
+		switch elm.Type {
+		case "token":
+			var tok concordance.Token
+			if err := json.Unmarshal(rawElm, &tok); err != nil {
+				return nil, err
+			}
+			ans[i] = &tok
+		case "markup":
+			switch elm.StructureType {
+			case "open", "self-close":
+				ans[i] = &concordance.Struct{
+					Name:        elm.Name,
+					Attrs:       elm.Attrs,
+					ErrMsg:      elm.ErrMsg,
+					IsSelfClose: elm.StructureType == "self-close",
+				}
+			case "close":
+				ans[i] = &concordance.CloseStruct{Name: elm.Name}
+			default:
+				return nil, fmt.Errorf("unknown structure type %s", elm.StructureType)
+			}
+		default:
+			return nil, fmt.Errorf("unknown line element type %s", elm.Type)
+		}
+	}
+	return ans, nil
+}
+
+type wireLine struct {
+	Text        json.RawMessage   `json:"text"`
+	AlignedText json.RawMessage   `json:"alignedText"`
+	Ref         string            `json:"ref"`
+	Props       map[string]string `json:"props"`
+	ErrMsg      string            `json:"errMsg"`
+}
+
+func decodeLine(data json.RawMessage) (concordance.Line, error) {
+	var tmp wireLine
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return concordance.Line{}, err
+	}
+	text, err := decodeLineElements(tmp.Text)
+	if err != nil {
+		return concordance.Line{}, err
+	}
+	alignedText, err := decodeLineElements(tmp.AlignedText)
+	if err != nil {
+		return concordance.Line{}, err
+	}
+	return concordance.Line{
+		Text:        text,
+		AlignedText: alignedText,
+		Ref:         tmp.Ref,
+		Props:       tmp.Props,
+		ErrMsg:      tmp.ErrMsg,
+	}, nil
+}
+
+func (cl *ConcordanceLines) UnmarshalJSON(data []byte) error {
+	var rawLines []json.RawMessage
+	if err := json.Unmarshal(data, &rawLines); err != nil {
+		return err
+	}
+	*cl = make(ConcordanceLines, len(rawLines))
+	for i, rawLine := range rawLines {
+		line, err := decodeLine(rawLine)
+		if err != nil {
+			return fmt.Errorf("failed to decode concordance line: %w", err)
+		}
+		(*cl)[i] = line
+	}
+	return nil
+}
+
+// MarshalWire encodes the result for transfer from a worker. Please
+// note that concordance.Line does not support decoding of its own JSON
+// representation (see UnmarshalWire).
+func (res *TokenContext) MarshalWire() (json.RawMessage, error) {
+	return json.Marshal(struct {
+		Context concordance.Line `json:"context"`
+	}{
+		Context: res.Context,
+	})
+}
+
+// UnmarshalWire decodes the result as encoded by MarshalWire
+func (res *TokenContext) UnmarshalWire(data json.RawMessage) error {
+	var tmp struct {
+		Context json.RawMessage `json:"context"`
+	}
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	line, err := decodeLine(tmp.Context)
+	if err != nil {
+		return fmt.Errorf("failed to decode token context: %w", err)
+	}
+	res.Context = line
+	return nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"mquery/mango"
+	"mquery/merror"
+	"mquery/rdb"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-common/corp"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	RegisterResultTypes()
+}
+
+func roundTrip(t *testing.T, wr rdb.WorkerResult) rdb.WorkerResult {
+	data, err := rdb.EncodeWorkerResult(wr)
+	assert.NoError(t, err)
+	ans, err := rdb.DecodeWorkerResult(string(data))
+	assert.NoError(t, err)
+	return ans
+}
+
+func TestWireFreqDistribRoundTrip(t *testing.T) {
+	t0 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	orig := FreqDistrib{
+		ConcSize:   10,
+		CorpusSize: 1000,
+		Freqs: FreqDistribItemList{
+			{Word: "foo", Freq: 7, Base: 100, IPM: 70000},
+			{Word: "bar", Freq: 3, Base: 100, IPM: 30000},
+		},
+		Fcrit: "lemma 0",
+	}
+	ans := roundTrip(t, rdb.WorkerResult{ID: "w1", Value: orig, ProcBegin: t0, ProcEnd: t0})
+	assert.Equal(t, "w1", ans.ID)
+	assert.True(t, t0.Equal(ans.ProcBegin))
+	assert.Equal(t, orig, ans.Value)
+}
+
+func TestWireErrorRoundTrip(t *testing.T) {
+	orig := FreqDistrib{Error: merror.InputError{Msg: "invalid fcrit"}}
+	ans := roundTrip(t, rdb.WorkerResult{Value: orig, HasUserError: true})
+	assert.True(t, ans.HasUserError)
+	assert.Equal(t, merror.InputError{Msg: "invalid fcrit"}, ans.Value.Err())
+}
+
+func TestWireErrorResultRoundTrip(t *testing.T) {
+	orig := rdb.ErrorResult{Func: "concordance", Error: merror.CancelledError{Msg: "cancelled"}}
+	ans := roundTrip(t, rdb.WorkerResult{Value: orig})
+	assert.Equal(t, orig, ans.Value)
+}
+
+func TestWireConcordanceKeepsMarkup(t *testing.T) {
+	orig := Concordance{
+		Lines: ConcordanceLines{
+			{
+				Text: concordance.TokenSlice{
+					&concordance.Struct{Name: "s", Attrs: map[string]string{"id": "1"}},
+					&concordance.Token{Word: "hello", Strong: true, Attrs: map[string]string{"lemma": "hello"}},
+					&concordance.Struct{Name: "g", IsSelfClose: true},
+					&concordance.CloseStruct{Name: "s"},
+				},
+				Ref: "#12",
+			},
+		},
+		ConcSize:   1,
+		CorpusSize: 100,
+	}
+	ans := roundTrip(t, rdb.WorkerResult{Value: orig})
+	conc, ok := ans.Value.(Concordance)
+	assert.True(t, ok)
+	assert.Equal(t, orig.Lines, conc.Lines)
+	assert.Equal(t, 1, conc.ConcSize)
+}
+
+func TestWireQueryRoundTrip(t *testing.T) {
+	orig := rdb.Query{
+		Func:    "freqDistrib",
+		Channel: "ch1",
+		Attempt: 1,
+		Args:    rdb.FreqDistribArgs{CorpusPath: "/corp/syn", Crit: "lemma 0", MaxItems: 10},
+	}
+	data, err := rdb.EncodeQuery(orig)
+	assert.NoError(t, err)
+	ans, err := rdb.DecodeQuery(string(data))
+	assert.NoError(t, err)
+	assert.Equal(t, orig.Args, ans.Args)
+	assert.Equal(t, orig.Channel, ans.Channel)
+	assert.Equal(t, orig.Attempt, ans.Attempt)
+}
+
+func TestWireCollocationCountsArgs(t *testing.T) {
+	args := rdb.CollocationCountsArgs{CorpusPath: "/corpora/syn2020", SubcPath: "/split/1.subc", Attr: "lemma"}
+	data, err := rdb.EncodeQuery(rdb.Query{Func: "collocationCounts", Args: args})
+	assert.NoError(t, err)
+	ans, err := rdb.DecodeQuery(string(data))
+	assert.NoError(t, err)
+	assert.Equal(t, args, ans.Args)
+}
+
+func TestWireRejectsNewerVersion(t *testing.T) {
+	_, err := rdb.DecodeQuery(`{"version": 999, "func": "freqDistrib", "args": {}}`)
+	assert.ErrorIs(t, err, rdb.ErrUnsupportedWireVersion)
+}
+
+// wireSamples contains a value of each registered result type
+// with all the fields set
+var wireSamples = []rdb.FuncResult{
+	rdb.ErrorResult{Func: "concordance"},
+	CollFreqData{},
+	CollCounts{
+		ConcSize:   10,
+		CorpusSize: 1000,
+		SubcSize:   500,
+		Colls:      []*mango.GoCollItem{{Word: "foo", Freq: 3, CorpFreq: 20}},
+	},
+	Collocations{
+		ConcSize:   10,
+		CorpusSize: 1000,
+		SubcSize:   500,
+		Colls:      []*mango.GoCollItem{{Word: "foo", Score: 7.12345, Freq: 3, CorpFreq: 20}},
+		Measure:    "logDice",
+		SrchRange:  [2]int{-3, 3},
+	},
+	ConcSize{Total: 10, ARF: 3.14159265, CorpusSize: 1000},
+	Concordance{
+		Lines: ConcordanceLines{
+			{
+				Text: concordance.TokenSlice{
+					&concordance.Token{Word: "foo", Attrs: map[string]string{"lemma": "foo"}},
+				},
+				Ref:   "#1",
+				Props: map[string]string{"doc.id": "d1"},
+			},
+		},
+		ConcSize:   1,
+		CorpusSize: 1000,
+		IPM:        1000,
+	},
+	CorpusInfo{
+		Data: corp.Overview{
+			Corpname:     "syn2020",
+			Description:  "test corpus",
+			Size:         1000,
+			AttrList:     []corp.Attr{{Name: "word", Size: 100}},
+			StructList:   []corp.Attr{{Name: "doc", Size: 10}},
+			SrchKeywords: []string{"test"},
+		},
+	},
+	FreqDistrib{
+		ConcSize:         10,
+		CorpusSize:       1000,
+		SubcSize:         500,
+		Freqs:            FreqDistribItemList{{Word: "a b", Values: []string{"a", "b"}, Freq: 7, Base: 100, IPM: 70000}},
+		Fcrit:            "lemma 0 tag 0",
+		ExamplesQueryTpl: "[lemma=\"%s\"]",
+	},
+	TextTypeNorms{Sizes: map[string]int64{"FIC": 100, "NMG": 200}},
+	TokenContext{
+		Context: concordance.Line{
+			Text: concordance.TokenSlice{
+				&concordance.Struct{Name: "s", Attrs: map[string]string{"id": "1"}},
+				&concordance.Token{Word: "foo", Strong: true, Attrs: map[string]string{}},
+				&concordance.CloseStruct{Name: "s"},
+			},
+			Ref: "#10",
+		},
+	},
+	TextTypesAvailValues{
+		Attributes: []mango.GoStructAttr{{Struct: "doc", Attr: "txtype", Values: []string{"FIC"}, Truncated: true}},
+	},
+	WordSketch{
+		Headword:     "house",
+		HeadwordFreq: 100,
+		Relations: []*WordSketchRelation{
+			{Name: "modifier", Freq: 20, Collocates: []*WordSketchCollocate{{Word: "big", Freq: 5, Score: 9.5}}},
+		},
+	},
+	Thesaurus{
+		Headword:     "house",
+		HeadwordFreq: 100,
+		Items:        []*ThesaurusItem{{Word: "home", Score: 0.25, SharedContexts: 12}},
+	},
+	Wordlist{
+		Total:         20,
+		SearchSize:    1000,
+		IsApproximate: true,
+		Items:         []*mango.GoWordlistItem{{Word: "foo", Freq: 10, Docf: 2, ARF: 3.5}},
+	},
+	NewDispersion(
+		mango.GoDispersion{
+			ConcSize:   10,
+			CorpusSize: 1000,
+			ARF:        4.5,
+			NumDocs:    5,
+			DocsSize:   1000,
+			MinDocSize: 10,
+			HitDocs:    []mango.GoDispersionDoc{{Freq: 3, Size: 100}},
+			TextTypes:  []mango.GoDispersionTextType{{Value: "FIC", Freq: 3, Size: 400}},
+		},
+		0,
+		0,
+	),
+	Subcorpus{Size: 100, NumRanges: 3},
+}
+
+func TestWireRoundTripAllTypes(t *testing.T) {
+	samples := make(map[rdb.ResultType]rdb.FuncResult)
+	for _, v := range wireSamples {
+		samples[v.Type()] = v
+	}
+	for _, rt := range rdb.RegisteredResultTypes() {
+		t.Run(rt.String(), func(t *testing.T) {
+			orig, ok := samples[rt]
+			if !ok {
+				t.Fatalf("missing wire sample for result type %s", rt)
+			}
+			ans := roundTrip(t, rdb.WorkerResult{Value: orig})
+			assert.Equal(t, orig, ans.Value)
+
+			// errors are transferred with their types
+			withErr := reflect.New(reflect.TypeOf(orig))
+			withErr.Elem().Set(reflect.ValueOf(orig))
+			withErr.Interface().(interface{ SetErr(error) }).SetErr(merror.InputError{Msg: "invalid arg"})
+			ans = roundTrip(t, rdb.WorkerResult{Value: withErr.Elem().Interface().(rdb.FuncResult)})
+			assert.Equal(t, merror.InputError{Msg: "invalid arg"}, ans.Value.Err())
+		})
+	}
+}
+
+func TestWireShapeIgnoresHTTPRepresentation(t *testing.T) {
+	// the HTTP representation rounds the ARF
+	orig := ConcSize{Total: 10, ARF: 3.14159265, CorpusSize: 1000}
+	ans := roundTrip(t, rdb.WorkerResult{Value: orig})
+	assert.Equal(t, 3.14159265, ans.Value.(ConcSize).ARF)
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"cmp"
+	"encoding/json"
+	"mquery/mango"
+	"mquery/rdb"
+	"slices"
+)
+
+type Wordlist struct {
+
+	// Total is the number of all the items matching the filter
+	// (the Items contain just the requested page)
+	Total int64 `json:"total"`
+
+	// SearchSize is the number of tokens the list is calculated from
+	SearchSize int64 `json:"searchSize"`
+
+	// IsApproximate is true in case n-grams had to be pruned
+	// and some frequencies may be underestimated
+	IsApproximate bool                    `json:"isApproximate,omitempty"`
+	Items         []*mango.GoWordlistItem `json:"items"`
+	Error         error                   `json:"error,omitempty"`
+}
+
+func (res Wordlist) Err() error {
+	return res.Error
+}
+
+func (res *Wordlist) SetErr(err error) {
+	res.Error = err
+}
+
+func (res Wordlist) Type() rdb.ResultType {
+	return rdb.ResultTypeWordlist
+}
+
+func (res Wordlist) MarshalJSON() ([]byte, error) {
+	items := res.Items
+	if items == nil {
+		items = []*mango.GoWordlistItem{}
+	}
+	return json.Marshal(struct {
+		Total         int64                   `json:"total"`
+		SearchSize    int64                   `json:"searchSize"`
+		IsApproximate bool                    `json:"isApproximate,omitempty"`
+		Items         []*mango.GoWordlistItem `json:"items"`
+		ResultType    rdb.ResultType          `json:"resultType"`
+		Error         error                   `json:"error,omitempty"`
+	}{
+		Total:         res.Total,
+		SearchSize:    res.SearchSize,
+		IsApproximate: res.IsApproximate,
+		Items:         items,
+		ResultType:    res.Type(),
+		Error:         res.Error,
+	})
+}
+
+// MergeWith adds frequencies of another (complete) word list of
+// a different part of the same corpus (e.g. a split corpus chunk).
+// Items are merged by their values and the result is sorted
+// by frequency. The `Docf` and `ARF` values cannot be merged
+// so they are reset.
+func (res *Wordlist) MergeWith(other *Wordlist) {
+	res.SearchSize += other.SearchSize
+	res.IsApproximate = res.IsApproximate || other.IsApproximate
+	index := make(map[string]*mango.GoWordlistItem, len(res.Items))
+	for _, v := range res.Items {
+		v.Docf = 0
+		v.ARF = 0
+		index[v.Word] = v
+	}
+	for _, v2 := range other.Items {
+		if v1, ok := index[v2.Word]; ok {
+			v1.Freq += v2.Freq
+
+		} else {
+			item := &mango.GoWordlistItem{Word: v2.Word, Freq: v2.Freq}
+			res.Items = append(res.Items, item)
+			index[v2.Word] = item
+		}
+	}
+	slices.SortFunc(res.Items, func(a, b *mango.GoWordlistItem) int {
+		return cmp.Or(cmp.Compare(b.Freq, a.Freq), cmp.Compare(a.Word, b.Word))
+	})
+	res.Total = int64(len(res.Items))
+}
@@ -0,0 +1,75 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"mquery/mango"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWordlistMergeWith(t *testing.T) {
+	wl := &Wordlist{
+		Total:      2,
+		SearchSize: 100,
+		Items: []*mango.GoWordlistItem{
+			{Word: "a", Freq: 10, Docf: 3, ARF: 2.5},
+			{Word: "b", Freq: 5},
+		},
+	}
+	wl.MergeWith(&Wordlist{
+		Total:      2,
+		SearchSize: 50,
+		Items: []*mango.GoWordlistItem{
+			{Word: "b", Freq: 8},
+			{Word: "c", Freq: 1},
+		},
+	})
+	assert.Equal(t, int64(150), wl.SearchSize)
+	assert.Equal(t, int64(3), wl.Total)
+	assert.Equal(
+		t,
+		[]*mango.GoWordlistItem{{Word: "b", Freq: 13}, {Word: "a", Freq: 10}, {Word: "c", Freq: 1}},
+		wl.Items,
+	)
+}
+
+func TestWordlistMergeWithEmpty(t *testing.T) {
+	wl := new(Wordlist)
+	other := &Wordlist{
+		Total:      1,
+		SearchSize: 20,
+		Items:      []*mango.GoWordlistItem{{Word: "a", Freq: 4}},
+	}
+	wl.MergeWith(other)
+	assert.Equal(t, int64(20), wl.SearchSize)
+	assert.Equal(t, int64(1), wl.Total)
+	assert.Equal(t, []*mango.GoWordlistItem{{Word: "a", Freq: 4}}, wl.Items)
+	// the merged list does not share items with the source
+	wl.Items[0].Freq++
+	assert.Equal(t, int64(4), other.Items[0].Freq)
+}
+
+func TestWordlistMergeWithApproximate(t *testing.T) {
+	wl := &Wordlist{Items: []*mango.GoWordlistItem{{Word: "a b", Freq: 2}}}
+	wl.MergeWith(&Wordlist{IsApproximate: true, Items: []*mango.GoWordlistItem{{Word: "a b", Freq: 3}}})
+	assert.True(t, wl.IsApproximate)
+	assert.Equal(t, int64(5), wl.Items[0].Freq)
+}
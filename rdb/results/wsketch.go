@@ -0,0 +1,135 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package results
+
+import (
+	"encoding/json"
+	"mquery/rdb"
+)
+
+type WordSketchCollocate struct {
+	Word string `json:"word"`
+
+	// Freq is a frequency of the collocate within the relation
+	Freq int64 `json:"freq"`
+
+	// Score is a logDice value of the collocate
+	Score float64 `json:"score"`
+}
+
+type WordSketchRelation struct {
+	Name string `json:"name"`
+
+	// Freq is a total frequency of the relation with the headword
+	Freq int64 `json:"freq"`
+
+	Collocates []*WordSketchCollocate `json:"collocates"`
+}
+
+type WordSketch struct {
+	Headword     string                `json:"headword"`
+	HeadwordFreq int64                 `json:"headwordFreq"`
+	Relations    []*WordSketchRelation `json:"relations"`
+	Error        error                 `json:"error,omitempty"`
+}
+
+func (res WordSketch) Err() error {
+	return res.Error
+}
+
+func (res *WordSketch) SetErr(err error) {
+	res.Error = err
+}
+
+func (res WordSketch) Type() rdb.ResultType {
+	return rdb.ResultTypeWordSketch
+}
+
+func (res WordSketch) MarshalJSON() ([]byte, error) {
+	relations := res.Relations
+	if relations == nil {
+		relations = []*WordSketchRelation{}
+	}
+	return json.Marshal(struct {
+		Headword     string                `json:"headword"`
+		HeadwordFreq int64                 `json:"headwordFreq"`
+		Relations    []*WordSketchRelation `json:"relations"`
+		ResultType   rdb.ResultType        `json:"resultType"`
+		Error        error                 `json:"error,omitempty"`
+	}{
+		Headword:     res.Headword,
+		HeadwordFreq: res.HeadwordFreq,
+		Relations:    relations,
+		ResultType:   res.Type(),
+		Error:        res.Error,
+	})
+}
+
+// ---------------------------------
+
+type ThesaurusItem struct {
+	Word string `json:"word"`
+
+	// Score is a similarity of the word to the headword
+	// (0 = no shared contexts, 1 = the same contexts)
+	Score float64 `json:"score"`
+
+	// SharedContexts is a number of (relation, collocate)
+	// pairs shared with the headword
+	SharedContexts int `json:"sharedContexts"`
+}
+
+type Thesaurus struct {
+	Headword     string           `json:"headword"`
+	HeadwordFreq int64            `json:"headwordFreq"`
+	Items        []*ThesaurusItem `json:"items"`
+	Error        error            `json:"error,omitempty"`
+}
+
+func (res Thesaurus) Err() error {
+	return res.Error
+}
+
+func (res *Thesaurus) SetErr(err error) {
+	res.Error = err
+}
+
+func (res Thesaurus) Type() rdb.ResultType {
+	return rdb.ResultTypeThesaurus
+}
+
+func (res Thesaurus) MarshalJSON() ([]byte, error) {
+	items := res.Items
+	if items == nil {
+		items = []*ThesaurusItem{}
+	}
+	return json.Marshal(struct {
+		Headword     string           `json:"headword"`
+		HeadwordFreq int64            `json:"headwordFreq"`
+		Items        []*ThesaurusItem `json:"items"`
+		ResultType   rdb.ResultType   `json:"resultType"`
+		Error        error            `json:"error,omitempty"`
+	}{
+		Headword:     res.Headword,
+		HeadwordFreq: res.HeadwordFreq,
+		Items:        items,
+		ResultType:   res.Type(),
+		Error:        res.Error,
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultStreamConsumerGroup = "mqueryWorkers"
+	streamDataField            = "query"
+)
+
+// removeUnclaimedScript removes a stream entry (ARGV[2]) unless it has
+// been already delivered to a consumer of the group (ARGV[1]). Scripts
+// run atomically so no worker can claim the entry in between the test
+// and the removal.
+var removeUnclaimedScript = redis.NewScript(`
+local pending = redis.call('XPENDING', KEYS[1], ARGV[1], ARGV[2], ARGV[2], 1)
+if #pending > 0 then
+	return 0
+end
+return redis.call('XDEL', KEYS[1], ARGV[2])
+`)
+
+// streamQueue stores queries in Redis streams. All the workers
+// form a single consumer group so each query is delivered just once
+// and Redis itself keeps track of queries being processed (pending
+// entries) by individual workers. Receipts are stream entry IDs.
+type streamQueue struct {
+	ctx       context.Context
+	redis     *redis.Client
+	queueKeys []string
+
+	// groups contains streams with already created consumer group
+	groups sync.Map
+}
+
+// streamKey maps a queue key to a respective stream key.
+// We do not use queue keys directly to prevent conflicts
+// with list based queues (e.g. when switching between backends).
+func streamKey(queueKey string) string {
+	return queueKey + ":stream"
+}
+
+func (q *streamQueue) ensureGroup(key string) error {
+	if _, ok := q.groups.Load(key); ok {
+		return nil
+	}
+	err := q.redis.XGroupCreateMkStream(q.ctx, key, DefaultStreamConsumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group for %s: %w", key, err)
+	}
+	q.groups.Store(key, true)
+	return nil
+}
+
+func (q *streamQueue) push(queueKey string, data []byte) (string, error) {
+	key := streamKey(queueKey)
+	if err := q.ensureGroup(key); err != nil {
+		return "", err
+	}
+	id, err := q.redis.XAdd(q.ctx, &redis.XAddArgs{
+		Stream: key,
+		Values: map[string]any{streamDataField: data},
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue query: %w", err)
+	}
+	return id, nil
+}
+
+func (q *streamQueue) pop(queueKey, workerID string) (string, string, error) {
+	key := streamKey(queueKey)
+	if err := q.ensureGroup(key); err != nil {
+		return "", "", err
+	}
+	streams, err := q.redis.XReadGroup(q.ctx, &redis.XReadGroupArgs{
+		Group:    DefaultStreamConsumerGroup,
+		Consumer: workerID,
+		Streams:  []string{key, ">"},
+		Count:    1,
+		Block:    -1,
+	}).Result()
+	if err == redis.Nil {
+		return "", "", ErrorEmptyQueue
+
+	} else if err != nil {
+		return "", "", fmt.Errorf("failed to dequeue query: %w", err)
+	}
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			data, _ := msg.Values[streamDataField].(string)
+			return data, msg.ID, nil
+		}
+	}
+	return "", "", ErrorEmptyQueue
+}
+
+func (q *streamQueue) ack(queueKey, workerID, receipt string) error {
+	key := streamKey(queueKey)
+	pipe := q.redis.TxPipeline()
+	pipe.XAck(q.ctx, key, DefaultStreamConsumerGroup, receipt)
+	pipe.XDel(q.ctx, key, receipt)
+	if _, err := pipe.Exec(q.ctx); err != nil {
+		return fmt.Errorf("failed to acknowledge query: %w", err)
+	}
+	return nil
+}
+
+func (q *streamQueue) remove(queueKey, receipt string) (bool, error) {
+	key := streamKey(queueKey)
+	removed, err := removeUnclaimedScript.Run(
+		q.ctx, q.redis, []string{key}, DefaultStreamConsumerGroup, receipt).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove query from queue: %w", err)
+	}
+	// zero also means the query has been already taken by a worker
+	return removed > 0, nil
+}
+
+func (q *streamQueue) popUnacked(workerID string) (string, error) {
+	for _, queueKey := range q.queueKeys {
+		key := streamKey(queueKey)
+		if err := q.ensureGroup(key); err != nil {
+			return "", err
+		}
+		for {
+			data, found, err := q.popUnackedFrom(key, workerID)
+			if err != nil {
+				return "", fmt.Errorf("failed to get unfinished queries of worker %s: %w", workerID, err)
+			}
+			if !found {
+				break
+			}
+			if data != "" {
+				return data, nil
+			}
+		}
+	}
+	return "", ErrorEmptyQueue
+}
+
+// popUnackedFrom removes the oldest pending entry of the worker from
+// the stream `key`. If the entry has been meanwhile taken by someone else,
+// empty data are returned (with found == true).
+func (q *streamQueue) popUnackedFrom(key, workerID string) (data string, found bool, err error) {
+	pending, err := q.redis.XPendingExt(q.ctx, &redis.XPendingExtArgs{
+		Stream:   key,
+		Group:    DefaultStreamConsumerGroup,
+		Start:    "-",
+		End:      "+",
+		Count:    1,
+		Consumer: workerID,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return "", false, err
+	}
+	id := pending[0].ID
+	// XACK returns 1 just for the first caller so even with multiple
+	// API servers running their reapers, each query is recovered just once
+	acked, err := q.redis.XAck(q.ctx, key, DefaultStreamConsumerGroup, id).Result()
+	if err != nil {
+		return "", false, err
+	}
+	if acked == 0 {
+		return "", true, nil
+	}
+	msgs, err := q.redis.XRange(q.ctx, key, id, id).Result()
+	if err != nil {
+		return "", false, err
+	}
+	if err := q.redis.XDel(q.ctx, key, id).Err(); err != nil {
+		return "", false, err
+	}
+	if len(msgs) == 0 {
+		return "", true, nil
+	}
+	data, _ = msgs[0].Values[streamDataField].(string)
+	return data, true, nil
+}
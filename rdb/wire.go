@@ -0,0 +1,419 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mquery/merror"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// WireFormatVersion is a version of the format queries and results
+// are exchanged in between API servers and workers. The version must be
+// increased only in case of incompatible changes. Adding new functions,
+// result types or optional fields does not require a new version.
+// Both queries and results with a higher version than the one known
+// to a decoder are rejected.
+const WireFormatVersion = 1
+
+const (
+	WireErrorTypeInput     = "inputError"
+	WireErrorTypeInternal  = "internalError"
+	WireErrorTypeRecovered = "recoveredError"
+	WireErrorTypeTimeout   = "timeoutError"
+	WireErrorTypeCancelled = "cancelledError"
+	WireErrorTypeGeneral   = "error"
+)
+
+var (
+	ErrUnsupportedWireVersion = errors.New("unsupported wire format version")
+)
+
+// QueryEnvelope is a language neutral (JSON) form of Query.
+type QueryEnvelope struct {
+	Version int             `json:"version"`
+	Func    string          `json:"func"`
+	Channel string          `json:"channel"`
+	JobID   string          `json:"jobId,omitempty"`
+	CacheID string          `json:"cacheId,omitempty"`
+	Class   string          `json:"class,omitempty"`
+	Attempt int             `json:"attempt,omitempty"`
+	Args    json.RawMessage `json:"args"`
+}
+
+// WireError is a language neutral form of an error returned
+// by a worker.
+type WireError struct {
+	Type string `json:"type"`
+	Msg  string `json:"msg"`
+}
+
+// AsError converts the wire error back to the respective
+// error type.
+func (we *WireError) AsError() error {
+	if we == nil {
+		return nil
+	}
+	switch we.Type {
+	case WireErrorTypeInput:
+		return merror.InputError{Msg: we.Msg}
+	case WireErrorTypeInternal:
+		return merror.InternalError{Msg: we.Msg}
+	case WireErrorTypeRecovered:
+		return merror.RecoveredError{Msg: we.Msg}
+	case WireErrorTypeTimeout:
+		return merror.TimeoutError{Msg: we.Msg}
+	case WireErrorTypeCancelled:
+		return merror.CancelledError{Msg: we.Msg}
+	default:
+		return errors.New(we.Msg)
+	}
+}
+
+func newWireError(err error) *WireError {
+	if err == nil {
+		return nil
+	}
+	var tp string
+	switch err.(type) {
+	case merror.InputError, *merror.InputError:
+		tp = WireErrorTypeInput
+	case merror.InternalError, *merror.InternalError:
+		tp = WireErrorTypeInternal
+	case merror.RecoveredError, *merror.RecoveredError:
+		tp = WireErrorTypeRecovered
+	case merror.TimeoutError, *merror.TimeoutError:
+		tp = WireErrorTypeTimeout
+	case merror.CancelledError, *merror.CancelledError:
+		tp = WireErrorTypeCancelled
+	default:
+		tp = WireErrorTypeGeneral
+	}
+	return &WireError{Type: tp, Msg: err.Error()}
+}
+
+// ResultEnvelope is a language neutral (JSON) form of WorkerResult.
+// The Payload contains the result value without the error which
+// is stored separately in Error.
+type ResultEnvelope struct {
+	Version      int             `json:"version"`
+	WorkerID     string          `json:"workerId"`
+	ResultType   ResultType      `json:"resultType"`
+	HasUserError bool            `json:"hasUserError,omitempty"`
+	ProcBegin    time.Time       `json:"procBegin"`
+	ProcEnd      time.Time       `json:"procEnd"`
+	Error        *WireError      `json:"error,omitempty"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+}
+
+// ---------------------- registration of types
+
+type argsDecoder func(data json.RawMessage) (any, error)
+
+type resultCodec struct {
+	encode func(res FuncResult) (json.RawMessage, error)
+	decode func(data json.RawMessage, err error) (FuncResult, error)
+}
+
+var (
+	queryArgsDecoders = make(map[string]argsDecoder)
+	resultCodecs      = make(map[ResultType]resultCodec)
+)
+
+// RegisterQueryArgs registers type of arguments for a worker
+// function so they can be decoded by workers.
+func RegisterQueryArgs[T any](fn string) {
+	queryArgsDecoders[fn] = func(data json.RawMessage) (any, error) {
+		var ans T
+		if err := json.Unmarshal(data, &ans); err != nil {
+			return nil, err
+		}
+		return ans, nil
+	}
+}
+
+// WireMarshaler can be implemented by result types which need a custom
+// wire encoding. Other types are encoded by their fields (see wireShape).
+type WireMarshaler interface {
+	MarshalWire() (json.RawMessage, error)
+	UnmarshalWire(data json.RawMessage) error
+}
+
+var (
+	errorType     = reflect.TypeFor[error]()
+	wireErrorType = reflect.TypeFor[*WireError]()
+)
+
+// wireShape is a method-less struct type with the same exported fields
+// as a result type. Encoding results via their wire shapes ensures they
+// are transferred by their fields and not in their HTTP representation
+// (i.e. via their MarshalJSON methods) which may be lossy (e.g. rounded
+// numbers, omitted fields). Fields of the `error` type are replaced by
+// WireError so their messages and types are kept.
+type wireShape struct {
+	typ reflect.Type
+
+	// fields maps fields of the shape to the
+	// fields of the original type
+	fields []int
+}
+
+func (ws wireShape) encode(v reflect.Value) any {
+	ans := reflect.New(ws.typ).Elem()
+	for i, src := range ws.fields {
+		fv := v.Field(src)
+		if fv.Type() == errorType {
+			if !fv.IsNil() {
+				ans.Field(i).Set(reflect.ValueOf(newWireError(fv.Interface().(error))))
+			}
+			continue
+		}
+		ans.Field(i).Set(fv)
+	}
+	return ans.Interface()
+}
+
+func (ws wireShape) decode(data json.RawMessage, dst reflect.Value) error {
+	tmp := reflect.New(ws.typ)
+	if err := json.Unmarshal(data, tmp.Interface()); err != nil {
+		return err
+	}
+	for i, dstIdx := range ws.fields {
+		fv := tmp.Elem().Field(i)
+		if dst.Field(dstIdx).Type() == errorType {
+			if we := fv.Interface().(*WireError); we != nil {
+				dst.Field(dstIdx).Set(reflect.ValueOf(we.AsError()))
+			}
+			continue
+		}
+		dst.Field(dstIdx).Set(fv)
+	}
+	return nil
+}
+
+func newWireShape(t reflect.Type) wireShape {
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("result type %s must be a struct", t))
+	}
+	var ans wireShape
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		sf := reflect.StructField{Name: f.Name, Type: f.Type, Tag: f.Tag}
+		if f.Type == errorType {
+			sf.Type = wireErrorType
+		}
+		fields = append(fields, sf)
+		ans.fields = append(ans.fields, i)
+	}
+	ans.typ = reflect.StructOf(fields)
+	return ans
+}
+
+// ErrorSettableResult is a FuncResult which allows for replacing
+// its error. This is needed as errors are transferred separately
+// from results.
+type ErrorSettableResult[T any] interface {
+	*T
+	FuncResult
+	SetErr(err error)
+}
+
+// RegisterResultType registers a result type so it can be transferred
+// from workers back to clients. Once registered, each FuncResult value
+// of the type T is encoded and decoded as a value (not a pointer).
+// Unless the type implements WireMarshaler, it is encoded by its
+// exported fields (see wireShape).
+func RegisterResultType[T any, PT ErrorSettableResult[T]]() {
+	var empty T
+	rt := PT(&empty).Type()
+	if _, ok := any(empty).(FuncResult); !ok {
+		panic(fmt.Sprintf("type %T must implement FuncResult via value receivers", empty))
+	}
+	_, customWire := any(PT(&empty)).(WireMarshaler)
+	var shape wireShape
+	if !customWire {
+		shape = newWireShape(reflect.TypeFor[T]())
+	}
+	resultCodecs[rt] = resultCodec{
+		encode: func(res FuncResult) (json.RawMessage, error) {
+			tRes, ok := res.(T)
+			if !ok {
+				return nil, fmt.Errorf("invalid value type %T for result type %s", res, rt)
+			}
+			PT(&tRes).SetErr(nil)
+			if customWire {
+				return any(PT(&tRes)).(WireMarshaler).MarshalWire()
+			}
+			return json.Marshal(shape.encode(reflect.ValueOf(tRes)))
+		},
+		decode: func(data json.RawMessage, err error) (FuncResult, error) {
+			var ans T
+			if len(data) > 0 {
+				var decErr error
+				if customWire {
+					decErr = any(PT(&ans)).(WireMarshaler).UnmarshalWire(data)
+
+				} else {
+					decErr = shape.decode(data, reflect.ValueOf(PT(&ans)).Elem())
+				}
+				if decErr != nil {
+					return nil, fmt.Errorf("failed to decode result of type %s: %w", rt, decErr)
+				}
+			}
+			PT(&ans).SetErr(err)
+			return any(ans).(FuncResult), nil
+		},
+	}
+}
+
+func init() {
+	RegisterQueryArgs[CorpusInfoArgs]("corpusInfo")
+	RegisterQueryArgs[FreqDistribArgs]("freqDistrib")
+	RegisterQueryArgs[CollocationsArgs]("collocations")
+	RegisterQueryArgs[CollocationCountsArgs]("collocationCounts")
+	RegisterQueryArgs[TermFrequencyArgs]("termFrequency")
+	RegisterQueryArgs[ConcordanceArgs]("concordance")
+	RegisterQueryArgs[CalcCollFreqDataArgs]("calcCollFreqData")
+	RegisterQueryArgs[TextTypeNormsArgs]("textTypeNorms")
+	RegisterQueryArgs[TokenContextArgs]("tokenContext")
+	RegisterQueryArgs[TextTypesAvailValuesArgs]("textTypesAvailValues")
+	RegisterQueryArgs[WordSketchArgs]("wordSketch")
+	RegisterQueryArgs[ThesaurusArgs]("thesaurus")
+	RegisterQueryArgs[WordlistArgs]("wordlist")
+	RegisterQueryArgs[DispersionArgs]("dispersion")
+	RegisterQueryArgs[CreateSubcorpusArgs]("createSubcorpus")
+	RegisterResultType[ErrorResult]()
+}
+
+// RegisteredResultTypes returns all the registered result types
+func RegisteredResultTypes() []ResultType {
+	ans := make([]ResultType, 0, len(resultCodecs))
+	for rt := range resultCodecs {
+		ans = append(ans, rt)
+	}
+	slices.Sort(ans)
+	return ans
+}
+
+// ---------------------- encoding and decoding
+
+func EncodeQuery(q Query) ([]byte, error) {
+	args, err := json.Marshal(q.Args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode query args: %w", err)
+	}
+	return json.Marshal(QueryEnvelope{
+		Version: WireFormatVersion,
+		Func:    q.Func,
+		Channel: q.Channel,
+		JobID:   q.JobID,
+		CacheID: q.CacheID,
+		Class:   q.Class,
+		Attempt: q.Attempt,
+		Args:    args,
+	})
+}
+
+func DecodeQuery(q string) (Query, error) {
+	var env QueryEnvelope
+	if err := json.Unmarshal([]byte(q), &env); err != nil {
+		return Query{}, err
+	}
+	if env.Version > WireFormatVersion {
+		return Query{}, fmt.Errorf("%w: %d", ErrUnsupportedWireVersion, env.Version)
+	}
+	ans := Query{
+		Func:    env.Func,
+		Channel: env.Channel,
+		JobID:   env.JobID,
+		CacheID: env.CacheID,
+		Class:   env.Class,
+		Attempt: env.Attempt,
+	}
+	decodeArgs, ok := queryArgsDecoders[env.Func]
+	if !ok {
+		// we keep the raw args so the worker can report
+		// an unknown function back to the client
+		ans.Args = env.Args
+		return ans, nil
+	}
+	args, err := decodeArgs(env.Args)
+	if err != nil {
+		return Query{}, fmt.Errorf("failed to decode args of %s: %w", env.Func, err)
+	}
+	ans.Args = args
+	return ans, nil
+}
+
+func EncodeWorkerResult(wr WorkerResult) ([]byte, error) {
+	if wr.Value == nil {
+		return nil, fmt.Errorf("cannot encode empty worker result")
+	}
+	codec, ok := resultCodecs[wr.Value.Type()]
+	if !ok {
+		return nil, fmt.Errorf("unregistered result type %s", wr.Value.Type())
+	}
+	payload, err := codec.encode(wr.Value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ResultEnvelope{
+		Version:      WireFormatVersion,
+		WorkerID:     wr.ID,
+		ResultType:   wr.Value.Type(),
+		HasUserError: wr.HasUserError,
+		ProcBegin:    wr.ProcBegin,
+		ProcEnd:      wr.ProcEnd,
+		Error:        newWireError(wr.Value.Err()),
+		Payload:      payload,
+	})
+}
+
+func DecodeWorkerResult(data string) (WorkerResult, error) {
+	var env ResultEnvelope
+	if err := json.Unmarshal([]byte(data), &env); err != nil {
+		return WorkerResult{}, err
+	}
+	if env.Version > WireFormatVersion {
+		return WorkerResult{}, fmt.Errorf("%w: %d", ErrUnsupportedWireVersion, env.Version)
+	}
+	codec, ok := resultCodecs[env.ResultType]
+	if !ok {
+		return WorkerResult{}, fmt.Errorf("unregistered result type %s", env.ResultType)
+	}
+	value, err := codec.decode(env.Payload, env.Error.AsError())
+	if err != nil {
+		return WorkerResult{}, err
+	}
+	return WorkerResult{
+		ID:           env.WorkerID,
+		Value:        value,
+		HasUserError: env.HasUserError,
+		ProcBegin:    env.ProcBegin,
+		ProcEnd:      env.ProcEnd,
+	}, nil
+}
@@ -20,11 +20,13 @@ package worker
 
 import (
 	"fmt"
+	"mquery/corpus/edit"
 	"mquery/corpus/infoload"
 	"mquery/mango"
 	"mquery/merror"
 	"mquery/rdb"
 	"mquery/rdb/results"
+	"os"
 	"path/filepath"
 
 	"github.com/czcorpus/cnc-gokit/fs"
@@ -33,6 +35,25 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+func importConcFilters(filters []rdb.ConcFilterArgs) []mango.ConcFilter {
+	ans := make([]mango.ConcFilter, len(filters))
+	for i, f := range filters {
+		ans[i] = mango.ConcFilter{
+			Query:       f.Query,
+			Positive:    f.Positive,
+			LftCtx:      f.LftCtx,
+			RgtCtx:      f.RgtCtx,
+			AnchorLast:  f.AnchorLast,
+			ExcludeKWIC: f.ExcludeKWIC,
+		}
+	}
+	return ans
+}
+
+func importConcSample(sample rdb.ConcSampleArgs) mango.ConcSample {
+	return mango.ConcSample{Size: sample.Size, Seed: sample.Seed}
+}
+
 func (w *Worker) corpusInfo(args rdb.CorpusInfoArgs) results.CorpusInfo {
 	var ans results.CorpusInfo
 	ans.Data = corp.Overview{Corpname: filepath.Base(args.CorpusPath)}
@@ -46,17 +67,23 @@ func (w *Worker) corpusInfo(args rdb.CorpusInfoArgs) results.CorpusInfo {
 			Msg: fmt.Sprintf("Invalid corpus path: %s", args.CorpusPath)}
 		return ans
 	}
-	err = infoload.FillStructAndAttrs(args.CorpusPath, &ans.Data)
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	err = infoload.FillStructAndAttrsOf(mcorp, &ans.Data)
 	if err != nil {
 		ans.Error = err
 		return ans
 	}
-	ans.Data.Size, err = mango.GetCorpusSize(args.CorpusPath)
+	ans.Data.Size, err = mcorp.Size()
 	if err != nil {
 		ans.Error = err
 		return ans
 	}
-	ans.Data.Description, err = mango.GetCorpusConf(args.CorpusPath, "INFO")
+	ans.Data.Description, err = mcorp.Conf("INFO")
 	if err != nil {
 		ans.Error = err
 		return ans
@@ -64,15 +91,24 @@ func (w *Worker) corpusInfo(args rdb.CorpusInfoArgs) results.CorpusInfo {
 	return ans
 }
 
-func (w *Worker) freqDistrib(args rdb.FreqDistribArgs) results.FreqDistrib {
+func (w *Worker) freqDistrib(args rdb.FreqDistribArgs, abort *mango.AbortSignal) results.FreqDistrib {
 	ans := results.FreqDistrib{Freqs: []*results.FreqDistribItem{}}
 	if args.MaxItems <= 0 {
 		ans.Error = merror.InputError{
 			Msg: "maxItems must be a positive number"}
 		return ans
 	}
-	freqs, err := mango.CalcFreqDist(
-		args.CorpusPath, args.SubcPath, args.Query, args.Crit, args.FreqLimit)
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	concFile, releaseConc := w.concCache.Acquire(mcorp, args.SubcPath, args.Query)
+	freqs, err := mcorp.FreqDist(
+		args.SubcPath, args.Query, args.Crit, args.FreqLimit,
+		importConcFilters(args.Filters), importConcSample(args.Sample), concFile, abort)
+	releaseConc(err)
 	if err != nil {
 		ans.Error = err
 		return ans
@@ -91,9 +127,12 @@ func (w *Worker) freqDistrib(args rdb.FreqDistribArgs) results.FreqDistrib {
 				Msg("norms cache hit")
 		} else {
 			var err error
-			norms, err = mango.GetTextTypesNorms(args.CorpusPath, attr)
+			norms, err = mcorp.TextTypesNorms(attr)
 			if err != nil {
 				ans.Error = err
+
+			} else {
+				w.normsCache.Set(args.CorpusPath, attr, norms)
 			}
 		}
 	}
@@ -106,15 +145,24 @@ func (w *Worker) freqDistrib(args rdb.FreqDistribArgs) results.FreqDistrib {
 	return ans
 }
 
-func (w *Worker) collocations(args rdb.CollocationsArgs) results.Collocations {
+func (w *Worker) collocations(args rdb.CollocationsArgs, abort *mango.AbortSignal) results.Collocations {
 	var ans results.Collocations
 	msr, err := mango.ImportCollMeasure(args.Measure)
 	if err != nil {
 		ans.Error = err
 		return ans
 	}
-	colls, err := mango.GetCollcations(
-		args.CorpusPath,
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	if args.SrchStruct != "" || !args.Syntax.IsZero() {
+		return w.collocationsByCounts(mcorp, args, abort)
+	}
+	concFile, releaseConc := w.concCache.Acquire(mcorp, args.SubcPath, args.Query)
+	colls, err := mcorp.Collocations(
 		args.SubcPath,
 		args.Query,
 		args.Attr,
@@ -123,7 +171,12 @@ func (w *Worker) collocations(args rdb.CollocationsArgs) results.Collocations {
 		args.MinFreq,
 		args.MinCorpFreq,
 		args.MaxItems,
+		importConcFilters(args.Filters),
+		importConcSample(args.Sample),
+		concFile,
+		abort,
 	)
+	releaseConc(err)
 	if err != nil {
 		ans.Error = err
 		return ans
@@ -145,9 +198,131 @@ func (w *Worker) collocations(args rdb.CollocationsArgs) results.Collocations {
 	return ans
 }
 
-func (w *Worker) concSize(args rdb.ConcordanceArgs) results.ConcSize {
+// importCollCandidates converts candidate restrictions
+// of collocations to mango.CollCandidates
+func importCollCandidates(args rdb.CollocationsArgs) (mango.CollCandidates, error) {
+	candidates := mango.CollCandidates{
+		Struct:     args.SrchStruct,
+		ParentAttr: args.Syntax.ParentAttr,
+		DeprelAttr: args.Syntax.DeprelAttr,
+		Deprel:     args.Syntax.Deprel,
+	}
+	switch args.Syntax.Rel {
+	case "":
+	case rdb.CollSyntaxRelDependent:
+		candidates.SyntaxRel = mango.CollSyntaxRelDependent
+	case rdb.CollSyntaxRelHead:
+		candidates.SyntaxRel = mango.CollSyntaxRelHead
+	default:
+		return candidates, merror.InputError{
+			Msg: fmt.Sprintf("unknown syntactic relation %s", args.Syntax.Rel),
+		}
+	}
+	return candidates, nil
+}
+
+// collocationCounts calculates raw collocation counts of all the candidates
+// (with no scores, minimum frequencies and limits applied). It is intended
+// for chunks of a split corpus where only the merged counts can be scored.
+func (w *Worker) collocationCounts(args rdb.CollocationCountsArgs, abort *mango.AbortSignal) results.CollCounts {
+	var ans results.CollCounts
+	candidates, err := importCollCandidates(rdb.CollocationsArgs(args))
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	concFile, releaseConc := w.concCache.Acquire(mcorp, args.SubcPath, args.Query)
+	colls, err := mcorp.CollocationCounts(
+		args.SubcPath,
+		args.Query,
+		args.Attr,
+		args.SrchRange,
+		candidates,
+		1,
+		1,
+		importConcFilters(args.Filters),
+		importConcSample(args.Sample),
+		concFile,
+		abort,
+	)
+	releaseConc(err)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	ans.Colls = colls.Colls
+	ans.ConcSize = colls.ConcSize
+	ans.CorpusSize = colls.CorpusSize
+	ans.SubcSize = colls.SubcSize
+	return ans
+}
+
+// collocationsByCounts calculates collocations with candidates restricted
+// by a structure or by a syntactic relation. Manatee supports only positional
+// ranges so we obtain raw counts and calculate scores on our own.
+func (w *Worker) collocationsByCounts(
+	mcorp *mango.Corpus,
+	args rdb.CollocationsArgs,
+	abort *mango.AbortSignal,
+) results.Collocations {
+	var ans results.Collocations
+	candidates, err := importCollCandidates(args)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	concFile, releaseConc := w.concCache.Acquire(mcorp, args.SubcPath, args.Query)
+	colls, err := mcorp.CollocationCounts(
+		args.SubcPath,
+		args.Query,
+		args.Attr,
+		args.SrchRange,
+		candidates,
+		args.MinFreq,
+		args.MinCorpFreq,
+		importConcFilters(args.Filters),
+		importConcSample(args.Sample),
+		concFile,
+		abort,
+	)
+	releaseConc(err)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	merger := results.NewCollCountsMerger()
+	merger.Add(&results.CollCounts{
+		ConcSize:   colls.ConcSize,
+		CorpusSize: colls.CorpusSize,
+		SubcSize:   colls.SubcSize,
+		Colls:      colls.Colls,
+	})
+	ans, err = merger.Result(args.Measure, args.MinFreq, args.MinCorpFreq, args.MaxItems)
+	if err != nil {
+		ans.Error = err
+	}
+	ans.SrchRange = args.SrchRange
+	return ans
+}
+
+func (w *Worker) concSize(args rdb.ConcordanceArgs, abort *mango.AbortSignal) results.ConcSize {
 	var ans results.ConcSize
-	concSizeInfo, err := mango.GetConcSize(args.CorpusPath, args.SubcPath, args.Query)
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	concFile, releaseConc := w.concCache.Acquire(mcorp, args.SubcPath, args.Query)
+	concSizeInfo, err := mcorp.ConcSize(
+		args.SubcPath, args.Query, importConcFilters(args.Filters), importConcSample(args.Sample), concFile, abort)
+	releaseConc(err)
 	if err != nil {
 		ans.Error = err
 		return ans
@@ -158,7 +333,85 @@ func (w *Worker) concSize(args rdb.ConcordanceArgs) results.ConcSize {
 	return ans
 }
 
-func (w *Worker) concordance(args rdb.ConcordanceArgs) results.Concordance {
+func (w *Worker) dispersion(args rdb.DispersionArgs, abort *mango.AbortSignal) results.Dispersion {
+	var ans results.Dispersion
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	concFile, releaseConc := w.concCache.Acquire(mcorp, args.SubcPath, args.Query)
+	disp, err := mcorp.Dispersion(
+		args.SubcPath, args.Query, args.DocStruct, args.TextTypeAttr, concFile, abort)
+	releaseConc(err)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	return results.NewDispersion(disp, args.TotalHits, args.TotalDocsSize)
+}
+
+func (w *Worker) createSubcorpus(args rdb.CreateSubcorpusArgs, abort *mango.AbortSignal) results.Subcorpus {
+	var ans results.Subcorpus
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	var ranges []mango.PosRange
+	if args.Query != "" {
+		ranges, _, err = mcorp.QueryRanges(args.Query, args.MaxQueryHits, abort)
+		if err == mango.ErrTooManyQueryHits {
+			ans.Error = merror.InputError{
+				Msg: fmt.Sprintf("the subcorpus query matches more than %d items", args.MaxQueryHits),
+			}
+			return ans
+
+		} else if err != nil {
+			ans.Error = err
+			return ans
+		}
+
+	} else {
+		corpusSize, err := mcorp.Size()
+		if err != nil {
+			ans.Error = err
+			return ans
+		}
+		ranges, err = edit.NormalizeRanges(args.Ranges, corpusSize)
+		if err != nil {
+			ans.Error = merror.InputError{Msg: err.Error()}
+			return ans
+		}
+	}
+	if len(ranges) == 0 {
+		ans.Error = merror.InputError{Msg: "the subcorpus definition matches no positions"}
+		return ans
+	}
+	// note: the directory (along with the subcorpus metadata)
+	// is created by the API server (see corpus.ReserveSavedSubcorpus)
+	ans.Size, err = edit.WriteSubcorpus(args.SubcPath, ranges)
+	if err != nil {
+		ans.Error = fmt.Errorf("failed to write subcorpus: %w", err)
+		return ans
+	}
+	ans.NumRanges = len(ranges)
+	return ans
+}
+
+// removeSubcorpus removes a subcorpus written by createSubcorpus along
+// with its directory. The directory belongs to the subcorpus only so its
+// metadata written by the API server (see corpus.ReserveSavedSubcorpus)
+// are removed too.
+func removeSubcorpus(subcPath string) {
+	if err := os.RemoveAll(filepath.Dir(subcPath)); err != nil {
+		log.Error().Err(err).Str("path", subcPath).Msg("failed to remove subcorpus")
+	}
+}
+
+func (w *Worker) concordance(args rdb.ConcordanceArgs, abort *mango.AbortSignal) results.Concordance {
 	ans := results.Concordance{
 		Lines: []concordance.Line{},
 	}
@@ -166,12 +419,17 @@ func (w *Worker) concordance(args rdb.ConcordanceArgs) results.Concordance {
 		ans.Error = merror.InputError{Msg: "No positional attributes selected for the concordance"}
 		return ans
 	}
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
 	var concEx mango.GoConcordance
-	var err error
+	concFile, releaseConc := w.concCache.Acquire(mcorp, args.SubcPath, args.Query)
 
 	if args.CollQuery != "" {
-		concEx, err = mango.GetConcordanceWithCollPhrase(
-			args.CorpusPath,
+		concEx, err = mcorp.ConcordanceWithCollPhrase(
 			args.SubcPath,
 			args.Query,
 			args.CollQuery,
@@ -185,11 +443,14 @@ func (w *Worker) concordance(args rdb.ConcordanceArgs) results.Concordance {
 			args.MaxContext,
 			args.Shuffle,
 			args.ViewContextStruct,
+			importConcFilters(args.Filters),
+			importConcSample(args.Sample),
+			concFile,
+			abort,
 		)
 
 	} else {
-		concEx, err = mango.GetConcordance(
-			args.CorpusPath,
+		concEx, err = mcorp.Concordance(
 			args.SubcPath,
 			args.Query,
 			args.Attrs,
@@ -199,12 +460,32 @@ func (w *Worker) concordance(args rdb.ConcordanceArgs) results.Concordance {
 			args.MaxItems,
 			args.MaxContext,
 			args.Shuffle,
+			mango.ConcSort{
+				Attr:       args.Sort.Attr,
+				Pos:        args.Sort.Pos,
+				Descending: args.Sort.Descending,
+				IgnoreCase: args.Sort.IgnoreCase,
+			},
 			args.ViewContextStruct,
+			importConcFilters(args.Filters),
+			importConcSample(args.Sample),
+			concFile,
+			abort,
 		)
 	}
+	if err == mango.ErrRowsRangeOutOfConc {
+		releaseConc(nil) // the concordance itself has been calculated
+
+	} else {
+		releaseConc(err)
+	}
 	if err == mango.ErrRowsRangeOutOfConc {
 		ans.Error = merror.InputError{Msg: "invalid rows range"}
 
+	} else if _, ok := err.(merror.CancelledError); ok {
+		ans.Error = err
+		return ans
+
 	} else if err != nil {
 		ans.Error = merror.InternalError{Msg: fmt.Sprintf("query %s: %s", args.AsDescription(), err.Error())}
 		return ans
@@ -221,18 +502,37 @@ func (w *Worker) concordance(args rdb.ConcordanceArgs) results.Concordance {
 	return ans
 }
 
-func (w *Worker) calcCollFreqData(args rdb.CalcCollFreqDataArgs) results.CollFreqData {
-	for _, attr := range args.Attrs {
-		err := mango.CompileSubcFreqs(args.CorpusPath, args.SubcPath, attr)
+// calcCollFreqData compiles frequencies of attributes and token coverage
+// of structures for a subcorpus. After each finished attribute (structure),
+// `onProgress` is called with a ratio of the finished steps.
+func (w *Worker) calcCollFreqData(
+	args rdb.CalcCollFreqDataArgs,
+	onProgress func(progress float64),
+) results.CollFreqData {
+	numSteps := len(args.Attrs) + len(args.Structs)
+	var stepsDone int
+	if len(args.Attrs) > 0 {
+		mcorp, err := w.corpusPool.Get(args.CorpusPath)
 		if err != nil {
 			return results.CollFreqData{Error: err}
 		}
+		defer w.corpusPool.Put(mcorp)
+		for _, attr := range args.Attrs {
+			err := mcorp.CompileSubcFreqs(args.SubcPath, attr)
+			if err != nil {
+				return results.CollFreqData{Error: err}
+			}
+			stepsDone++
+			onProgress(float64(stepsDone) / float64(numSteps))
+		}
 	}
 	for _, strct := range args.Structs {
 		err := w.tokenCoverage(args.MktokencovPath, args.SubcPath, args.CorpusPath, strct)
 		if err != nil {
 			return results.CollFreqData{Error: err}
 		}
+		stepsDone++
+		onProgress(float64(stepsDone) / float64(numSteps))
 	}
 	return results.CollFreqData{}
 }
@@ -247,7 +547,7 @@ func (w *Worker) textTypeNorms(args rdb.TextTypeNormsArgs) results.TextTypeNorms
 			Msg("norms cache hit")
 	} else {
 		var err error
-		norms, err = mango.GetTextTypesNorms(args.CorpusPath, args.StructAttr)
+		norms, err = w.textTypesNormsOf(args.CorpusPath, args.StructAttr)
 		if err != nil {
 			ans.Error = err
 			return ans
@@ -260,8 +560,13 @@ func (w *Worker) textTypeNorms(args rdb.TextTypeNormsArgs) results.TextTypeNorms
 
 func (w *Worker) tokenContext(args rdb.TokenContextArgs) results.TokenContext {
 	var ans results.TokenContext
-	res1, err := mango.GetCorpRegion(
-		args.CorpusPath,
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	res1, err := mcorp.CorpRegion(
 		int64(max(0, args.Idx-args.LeftCtx)),
 		int64(max(0, args.Idx)),
 		args.Structs,
@@ -277,8 +582,7 @@ func (w *Worker) tokenContext(args rdb.TokenContextArgs) results.TokenContext {
 		ans.Context = tmp[0]
 	}
 
-	res2, err := mango.GetCorpRegion(
-		args.CorpusPath,
+	res2, err := mcorp.CorpRegion(
 		int64(args.Idx),
 		int64(args.Idx+args.KWICLen),
 		args.Structs,
@@ -298,8 +602,7 @@ func (w *Worker) tokenContext(args rdb.TokenContextArgs) results.TokenContext {
 		ans.Context.Text = append(ans.Context.Text, tmp[0].Text...)
 	}
 
-	res3, err := mango.GetCorpRegion(
-		args.CorpusPath,
+	res3, err := mcorp.CorpRegion(
 		int64(args.Idx+args.KWICLen+1),
 		int64(args.Idx+args.RightCtx+args.KWICLen),
 		args.Structs,
@@ -320,7 +623,13 @@ func (w *Worker) tokenContext(args rdb.TokenContextArgs) results.TokenContext {
 
 func (w *Worker) textTypesAvailValues(args rdb.TextTypesAvailValuesArgs) results.TextTypesAvailValues {
 	var ans results.TextTypesAvailValues
-	values, err := mango.GetStructAttrValues(args.CorpusPath, args.MaxValueListSize)
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	values, err := mcorp.StructAttrValues(args.MaxValueListSize)
 	if err != nil {
 		ans.Error = err
 		return ans
@@ -333,3 +642,70 @@ func (w *Worker) textTypesAvailValues(args rdb.TextTypesAvailValuesArgs) results
 	}
 	return ans
 }
+
+// textTypesNormsOf calculates text type norms using
+// a corpus handle from the worker's corpus pool.
+func (w *Worker) textTypesNormsOf(corpusPath, attr string) (map[string]int64, error) {
+	mcorp, err := w.corpusPool.Get(corpusPath)
+	if err != nil {
+		return nil, err
+	}
+	defer w.corpusPool.Put(mcorp)
+	return mcorp.TextTypesNorms(attr)
+}
+
+func (w *Worker) wordlist(args rdb.WordlistArgs, abort *mango.AbortSignal) results.Wordlist {
+	var ans results.Wordlist
+	var sortBy mango.WordlistSortBy
+	switch args.SortBy {
+	case rdb.WordlistSortFreq, "":
+		sortBy = mango.WordlistSortFreq
+	case rdb.WordlistSortDocf:
+		sortBy = mango.WordlistSortDocf
+	case rdb.WordlistSortARF:
+		sortBy = mango.WordlistSortARF
+	default:
+		ans.Error = merror.InputError{Msg: fmt.Sprintf("invalid sorting %s", args.SortBy)}
+		return ans
+	}
+	if args.NgramSize < 1 || args.Limit <= 0 || args.Offset < 0 {
+		ans.Error = merror.InputError{Msg: "invalid n-gram size or page specification"}
+		return ans
+	}
+	if args.NgramSize > 1 && len(args.Values) > 0 {
+		ans.Error = merror.InputError{Msg: "values can be specified only for word lists"}
+		return ans
+	}
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	wlist, err := mcorp.Wordlist(
+		args.SubcPath,
+		args.Query,
+		args.Attr,
+		args.NgramSize,
+		mango.WordlistFilter{
+			Pattern:    args.Pattern,
+			IgnoreCase: args.IgnoreCase,
+			Values:     args.Values,
+			MinFreq:    args.MinFreq,
+			MaxFreq:    args.MaxFreq,
+		},
+		sortBy,
+		args.Offset,
+		args.Limit,
+		abort,
+	)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	ans.Items = wlist.Items
+	ans.Total = wlist.Total
+	ans.SearchSize = wlist.SearchSize
+	ans.IsApproximate = wlist.IsApproximate
+	return ans
+}
@@ -54,15 +54,16 @@ func CompileFreqResult(
 			norm = corpSize
 		}
 		if norm > 0 {
-			ans = append(
-				ans,
-				&results.FreqDistribItem{
-					Freq: freqs.Freqs[i],
-					Base: norm,
-					IPM:  float32(freqs.Freqs[i]) / float32(norm) * 1e6,
-					Word: freqs.Words[i],
-				},
-			)
+			item := &results.FreqDistribItem{
+				Freq: freqs.Freqs[i],
+				Base: norm,
+				IPM:  float32(freqs.Freqs[i]) / float32(norm) * 1e6,
+				Word: freqs.Words[i],
+			}
+			if i < len(freqs.Levels) && len(freqs.Levels[i]) > 1 {
+				item.Values = freqs.Levels[i]
+			}
+			ans = append(ans, item)
 			presentValues[freqs.Words[i]] = true
 		}
 	}
@@ -94,7 +95,7 @@ func extractAttrFromTTCrit(crit string) string {
 
 func wrapError(err error) error {
 	switch err.(type) {
-	case merror.InputError, merror.RecoveredError, merror.TimeoutError, *merror.InternalError:
+	case merror.InputError, merror.RecoveredError, merror.TimeoutError, merror.CancelledError, *merror.InternalError:
 		return err
 	default:
 		return merror.InternalError{Msg: err.Error()}
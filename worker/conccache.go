@@ -0,0 +1,242 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"mquery/mango"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	concCacheFileSuffix = ".conc"
+	concCacheTmpMarker  = ".tmp-"
+)
+
+type concCacheEntry struct {
+	key  string
+	size int64
+
+	// inUse is the number of queries currently reading the file.
+	// Such entries are not evicted.
+	inUse int
+}
+
+// ConcCache stores calculated concordances (in Manatee's native format)
+// in a local directory so repeated queries (e.g. paging of a concordance,
+// frequencies and collocations of the same query) do not have to evaluate
+// the query again. The total size of stored files is limited and the least
+// recently used files are removed first.
+type ConcCache struct {
+	dir       string
+	maxSize   int64
+	totalSize int64
+	entries   map[string]*list.Element
+	lru       *list.List
+	mu        sync.Mutex
+}
+
+func (cc *ConcCache) filePath(key string) string {
+	return filepath.Join(cc.dir, key+concCacheFileSuffix)
+}
+
+// mkKey creates a cache key for a query. The key is bound to
+// the state of the registry file and the subcorpus file so once
+// they change, previously stored concordances are not used anymore
+// (and they eventually get evicted).
+func (cc *ConcCache) mkKey(corp *mango.Corpus, subcPath, query string) (string, error) {
+	h := sha1.New()
+	h.Write([]byte(fmt.Sprintf("%s:%d;", corp.Path(), corp.ModTime().UnixNano())))
+	if subcPath != "" {
+		info, err := os.Stat(subcPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to determine subcorpus state: %w", err)
+		}
+		h.Write([]byte(fmt.Sprintf("%s:%d:%d;", subcPath, info.ModTime().UnixNano(), info.Size())))
+	}
+	h.Write([]byte(query))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Acquire returns a file specification for a concordance of the query.
+// In case the concordance is already stored, the file can be loaded.
+// Otherwise, the file specifies where the calculated concordance should
+// be saved. The returned function must be called once the calculation
+// is done (with its error, if any - a failed calculation is not stored).
+// In case the cache is disabled (nil), an empty ConcFile is returned.
+func (cc *ConcCache) Acquire(corp *mango.Corpus, subcPath, query string) (mango.ConcFile, func(err error)) {
+	if cc == nil {
+		return mango.ConcFile{}, func(err error) {}
+	}
+	key, err := cc.mkKey(corp, subcPath, query)
+	if err != nil {
+		log.Error().Err(err).Str("corpus", corp.Path()).Msg("failed to use concordance cache")
+		return mango.ConcFile{}, func(err error) {}
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if elm, ok := cc.entries[key]; ok {
+		entry := elm.Value.(*concCacheEntry)
+		entry.inUse++
+		cc.lru.MoveToFront(elm)
+		log.Debug().Str("corpus", corp.Path()).Str("key", key).Msg("concordance cache hit")
+		return mango.ConcFile{LoadPath: cc.filePath(key)}, func(err error) {
+			cc.release(entry)
+		}
+	}
+	tmpPath := fmt.Sprintf("%s%s%d", cc.filePath(key), concCacheTmpMarker, rand.Int63())
+	return mango.ConcFile{SavePath: tmpPath}, func(err error) {
+		cc.store(key, tmpPath, err)
+	}
+}
+
+func (cc *ConcCache) release(entry *concCacheEntry) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	entry.inUse--
+}
+
+func (cc *ConcCache) store(key, tmpPath string, err error) {
+	if err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to store concordance to cache")
+		return
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if _, ok := cc.entries[key]; ok {
+		// another query has stored the same concordance meanwhile
+		os.Remove(tmpPath)
+		return
+	}
+	if err := os.Rename(tmpPath, cc.filePath(key)); err != nil {
+		os.Remove(tmpPath)
+		log.Error().Err(err).Msg("failed to store concordance to cache")
+		return
+	}
+	cc.add(key, info.Size())
+	cc.evict()
+}
+
+// add registers a stored file. The caller is responsible for locking.
+func (cc *ConcCache) add(key string, size int64) {
+	cc.entries[key] = cc.lru.PushFront(&concCacheEntry{key: key, size: size})
+	cc.totalSize += size
+}
+
+// evict removes least recently used files until the total
+// size fits the limit. The caller is responsible for locking.
+func (cc *ConcCache) evict() {
+	elm := cc.lru.Back()
+	for cc.totalSize > cc.maxSize && elm != nil {
+		prev := elm.Prev()
+		entry := elm.Value.(*concCacheEntry)
+		if entry.inUse == 0 {
+			if err := os.Remove(cc.filePath(entry.key)); err != nil && !os.IsNotExist(err) {
+				log.Error().Err(err).Str("key", entry.key).Msg("failed to remove cached concordance")
+			}
+			cc.lru.Remove(elm)
+			delete(cc.entries, entry.key)
+			cc.totalSize -= entry.size
+		}
+		elm = prev
+	}
+}
+
+// load registers files already present in the cache directory
+// (e.g. from a previous run of the worker). Unfinished temporary
+// files are removed.
+func (cc *ConcCache) load() error {
+	items, err := os.ReadDir(cc.dir)
+	if err != nil {
+		return fmt.Errorf("failed to load concordance cache: %w", err)
+	}
+	type fileInfo struct {
+		key  string
+		info os.FileInfo
+	}
+	files := make([]fileInfo, 0, len(items))
+	for _, item := range items {
+		if item.IsDir() {
+			continue
+		}
+		if strings.Contains(item.Name(), concCacheTmpMarker) {
+			os.Remove(filepath.Join(cc.dir, item.Name()))
+			continue
+		}
+		if !strings.HasSuffix(item.Name(), concCacheFileSuffix) {
+			continue
+		}
+		info, err := item.Info()
+		if err != nil {
+			return fmt.Errorf("failed to load concordance cache: %w", err)
+		}
+		files = append(files, fileInfo{
+			key:  strings.TrimSuffix(item.Name(), concCacheFileSuffix),
+			info: info,
+		})
+	}
+	// the oldest files first so the most recent ones end up at the front
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].info.ModTime().Before(files[j].info.ModTime())
+	})
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for _, f := range files {
+		cc.add(f.key, f.info.Size())
+	}
+	cc.evict()
+	return nil
+}
+
+// NewConcCache creates a concordance cache. In case the cache
+// is disabled (see ConcCacheConf.Dir), nil is returned which is
+// still a valid (no-op) cache.
+func NewConcCache(conf ConcCacheConf) (*ConcCache, error) {
+	if conf.Dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(conf.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create concordance cache directory: %w", err)
+	}
+	cc := &ConcCache{
+		dir:     conf.Dir,
+		maxSize: int64(conf.MaxSizeMB) * 1024 * 1024,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if err := cc.load(); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
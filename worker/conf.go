@@ -0,0 +1,137 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+// This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltNormsCacheTTLSecs       = 7 * 24 * 3600
+	dfltNormsCacheMaxLocalItems = 100
+	dfltMaxIdleCorpusHandles    = 20
+	dfltConcCacheMaxSizeMB      = 2048
+)
+
+type NormsCacheConf struct {
+
+	// TTLSecs specifies how long are norms kept in the shared
+	// (Redis) cache
+	TTLSecs int `json:"ttlSecs"`
+
+	// MaxLocalItems limits number of norms (i.e. corpus + struct. attribute
+	// combinations) kept in the worker's memory.
+	MaxLocalItems int `json:"maxLocalItems"`
+
+	// WarmOnStart specifies whether norms for `ttOverviewAttrs`
+	// of configured corpora should be calculated on worker start.
+	WarmOnStart bool `json:"warmOnStart"`
+}
+
+type ConcCacheConf struct {
+
+	// Dir is a local directory where calculated concordances
+	// are stored. An empty value disables the cache.
+	Dir string `json:"dir"`
+
+	// MaxSizeMB limits the total size of stored concordances.
+	// Once exceeded, the least recently used ones are removed.
+	MaxSizeMB int `json:"maxSizeMB"`
+}
+
+// Conf is a worker specific configuration
+type Conf struct {
+	NormsCache NormsCacheConf `json:"normsCache"`
+
+	ConcCache ConcCacheConf `json:"concCache"`
+
+	// MaxNumConcurrentJobs specifies how many queries a single
+	// worker process can run in parallel.
+	MaxNumConcurrentJobs int `json:"maxNumConcurrentJobs"`
+
+	// JobTimeLimitSecs specifies the maximum processing time of
+	// a single query. Once exceeded, the query is aborted.
+	// Zero means no limit. Please note that only long-running functions
+	// (concordances, frequencies, collocations) can be aborted.
+	JobTimeLimitSecs int `json:"jobTimeLimitSecs"`
+
+	// JobMemoryLimitMB specifies how much memory a single running
+	// query can use. As Manatee's memory cannot be attributed to
+	// individual queries, the limit is applied to the whole process -
+	// i.e. memory used before the first query started plus the limit
+	// multiplied by the number of running queries. Once exceeded,
+	// the most recently started query is aborted. Zero means no limit.
+	JobMemoryLimitMB int `json:"jobMemoryLimitMB"`
+
+	// MaxIdleCorpusHandles specifies how many open corpora
+	// (not used by any running query) the worker keeps so repeated
+	// queries on the same corpus do not have to reopen it.
+	MaxIdleCorpusHandles int `json:"maxIdleCorpusHandles"`
+}
+
+func (conf *Conf) ValidateAndDefaults(confContext string) error {
+	if conf.NormsCache.TTLSecs < 0 {
+		return fmt.Errorf("`%s.normsCache.ttlSecs` must be a positive number", confContext)
+
+	} else if conf.NormsCache.TTLSecs == 0 {
+		conf.NormsCache.TTLSecs = dfltNormsCacheTTLSecs
+		log.Warn().
+			Int("value", conf.NormsCache.TTLSecs).
+			Msgf("`%s.normsCache.ttlSecs` not set, using default", confContext)
+	}
+	if conf.NormsCache.MaxLocalItems < 0 {
+		return fmt.Errorf("`%s.normsCache.maxLocalItems` must be a positive number", confContext)
+
+	} else if conf.NormsCache.MaxLocalItems == 0 {
+		conf.NormsCache.MaxLocalItems = dfltNormsCacheMaxLocalItems
+		log.Warn().
+			Int("value", conf.NormsCache.MaxLocalItems).
+			Msgf("`%s.normsCache.maxLocalItems` not set, using default", confContext)
+	}
+	if conf.ConcCache.MaxSizeMB < 0 {
+		return fmt.Errorf("`%s.concCache.maxSizeMB` must be a positive number", confContext)
+
+	} else if conf.ConcCache.Dir != "" && conf.ConcCache.MaxSizeMB == 0 {
+		conf.ConcCache.MaxSizeMB = dfltConcCacheMaxSizeMB
+		log.Warn().
+			Int("value", conf.ConcCache.MaxSizeMB).
+			Msgf("`%s.concCache.maxSizeMB` not set, using default", confContext)
+	}
+	if conf.MaxNumConcurrentJobs < 0 {
+		return fmt.Errorf("`%s.maxNumConcurrentJobs` must be a positive number", confContext)
+	}
+	if conf.JobTimeLimitSecs < 0 {
+		return fmt.Errorf("`%s.jobTimeLimitSecs` must be a positive number or zero", confContext)
+	}
+	if conf.JobMemoryLimitMB < 0 {
+		return fmt.Errorf("`%s.jobMemoryLimitMB` must be a positive number or zero", confContext)
+	}
+	if conf.MaxIdleCorpusHandles < 0 {
+		return fmt.Errorf("`%s.maxIdleCorpusHandles` must be a positive number", confContext)
+
+	} else if conf.MaxIdleCorpusHandles == 0 {
+		conf.MaxIdleCorpusHandles = dfltMaxIdleCorpusHandles
+		log.Warn().
+			Int("value", conf.MaxIdleCorpusHandles).
+			Msgf("`%s.maxIdleCorpusHandles` not set, using default", confContext)
+	}
+	return nil
+}
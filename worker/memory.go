@@ -0,0 +1,105 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"mquery/merror"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultMemoryCheckInterval = 2 * time.Second
+)
+
+// processRSS returns the resident set size of the current process
+// in bytes. Unlike Go runtime statistics, the value includes memory
+// allocated by Manatee.
+func processRSS() (int64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine process memory: %w", err)
+	}
+	items := strings.Fields(string(data))
+	if len(items) < 2 {
+		return 0, fmt.Errorf("failed to determine process memory: unexpected statm format")
+	}
+	pages, err := strconv.ParseInt(items[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine process memory: %w", err)
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
+
+// runMemoryWatchdog regularly checks memory used by the process
+// and aborts running queries in case it exceeds the limit
+// (see Conf.JobMemoryLimitMB).
+func (w *Worker) runMemoryWatchdog(ctx context.Context, baseline int64) {
+	ticker := time.NewTicker(DefaultMemoryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.checkMemory(baseline)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Worker) checkMemory(baseline int64) {
+	rss, err := processRSS()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to check worker memory")
+		return
+	}
+	w.runningMu.Lock()
+	defer w.runningMu.Unlock()
+	var youngest *runningJob
+	var numActive int64
+	for job := range w.running {
+		if job.abort.IsAborted() {
+			continue // its memory should be released soon
+		}
+		numActive++
+		if youngest == nil || job.started.After(youngest.started) {
+			youngest = job
+		}
+	}
+	limit := baseline + numActive*int64(w.conf.JobMemoryLimitMB)*1024*1024
+	if youngest == nil || rss <= limit {
+		return
+	}
+	log.Warn().
+		Str("workerId", w.ID).
+		Str("channel", youngest.query.Channel).
+		Str("func", youngest.query.Func).
+		Int64("rssMB", rss/1024/1024).
+		Int64("limitMB", limit/1024/1024).
+		Msg("worker memory limit exceeded, aborting query")
+	youngest.abort.AbortWithReason(merror.InternalError{
+		Msg: "query aborted: worker memory limit exceeded",
+	})
+}
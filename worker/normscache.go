@@ -18,36 +18,171 @@
 
 package worker
 
-import "fmt"
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"mquery/rdb"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/czcorpus/rexplorer/parser"
+	"github.com/rs/zerolog/log"
+)
+
+type normsCacheItem struct {
+	key    string
+	values map[string]int64
+}
+
+// NormsCache stores text type norms (sizes of structural attribute
+// values). It combines a small in-memory LRU cache with a cache
+// shared by all the workers (Redis). Each item is bound to a fingerprint
+// of the corpus data so once the data change, the old norms are not used
+// anymore (and they eventually expire from the shared cache).
 type NormsCache struct {
-	data map[string]map[string]int64
+	radapter rdb.NormsStore
+	conf     NormsCacheConf
+	items    map[string]*list.Element
+	lru      *list.List
+
+	// dataPaths caches corpora data directories (registry path => data path)
+	dataPaths map[string]string
+	mu        sync.Mutex
 }
 
-func (nc *NormsCache) mkKey(corp, sattr string) string {
-	return fmt.Sprintf("%s#%s", corp, sattr)
+func (nc *NormsCache) corpusDataPath(corp string) (string, error) {
+	nc.mu.Lock()
+	dataPath, ok := nc.dataPaths[corp]
+	nc.mu.Unlock()
+	if ok {
+		return dataPath, nil
+	}
+	regBytes, err := os.ReadFile(corp)
+	if err != nil {
+		return "", fmt.Errorf("failed to read registry file: %w", err)
+	}
+	reg, err := parser.ParseRegistryBytes(filepath.Base(corp), regBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse registry file: %w", err)
+	}
+	dataPath = reg.Entries.Get("PATH").Value()
+	nc.mu.Lock()
+	nc.dataPaths[corp] = dataPath
+	nc.mu.Unlock()
+	return dataPath, nil
 }
 
-func (nc *NormsCache) Get(corp, sattr string) (map[string]int64, bool) {
-	v, ok := nc.data[nc.mkKey(corp, sattr)]
+// fingerprint identifies a state of corpus data relevant for
+// norms of the `sattr` attribute. It is based on modification times
+// of the registry file and of the respective structure data.
+func (nc *NormsCache) fingerprint(corp, sattr string) (string, error) {
+	dataPath, err := nc.corpusDataPath(corp)
+	if err != nil {
+		return "", err
+	}
+	strct := strings.Split(sattr, ".")[0]
+	h := sha1.New()
+	for _, path := range []string{
+		corp,
+		filepath.Join(dataPath, strct+".rng"),
+		filepath.Join(dataPath, sattr+".lex"),
+	} {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+
+		} else if err != nil {
+			return "", fmt.Errorf("failed to determine corpus data state: %w", err)
+		}
+		h.Write([]byte(fmt.Sprintf("%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (nc *NormsCache) mkKey(corp, sattr string) (string, error) {
+	fp, err := nc.fingerprint(corp, sattr)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s#%s#%s", corp, sattr, fp), nil
+}
+
+func (nc *NormsCache) setLocal(key string, values map[string]int64) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if elm, ok := nc.items[key]; ok {
+		elm.Value.(*normsCacheItem).values = values
+		nc.lru.MoveToFront(elm)
+		return
+	}
+	nc.items[key] = nc.lru.PushFront(&normsCacheItem{key: key, values: values})
+	for nc.lru.Len() > nc.conf.MaxLocalItems {
+		oldest := nc.lru.Back()
+		nc.lru.Remove(oldest)
+		delete(nc.items, oldest.Value.(*normsCacheItem).key)
+	}
+}
+
+func (nc *NormsCache) getLocal(key string) (map[string]int64, bool) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	elm, ok := nc.items[key]
 	if !ok {
+		return nil, false
+	}
+	nc.lru.MoveToFront(elm)
+	return elm.Value.(*normsCacheItem).values, true
+}
+
+// Get returns norms for a corpus and a structural attribute.
+// Any problem with the cache is logged and reported as a cache miss.
+func (nc *NormsCache) Get(corp, sattr string) (map[string]int64, bool) {
+	key, err := nc.mkKey(corp, sattr)
+	if err != nil {
+		log.Error().Err(err).Str("corp", corp).Msg("failed to get norms from cache")
 		return map[string]int64{}, false
 	}
-	return v, true
+	if v, ok := nc.getLocal(key); ok {
+		return v, true
+	}
+	v, ok, err := nc.radapter.GetTextTypeNorms(key)
+	if err != nil {
+		log.Error().Err(err).Str("corp", corp).Msg("failed to get norms from cache")
+		return map[string]int64{}, false
+	}
+	if ok {
+		nc.setLocal(key, v)
+	}
+	return v, ok
 }
 
 func (nc *NormsCache) Set(corp, sattr string, values map[string]int64) {
-	_, ok := nc.data[nc.mkKey(corp, sattr)]
-	if !ok && values == nil {
-		nc.data[nc.mkKey(corp, sattr)] = make(map[string]int64)
-
-	} else {
-		nc.data[nc.mkKey(corp, sattr)] = values
+	if values == nil {
+		values = make(map[string]int64)
+	}
+	key, err := nc.mkKey(corp, sattr)
+	if err != nil {
+		log.Error().Err(err).Str("corp", corp).Msg("failed to store norms to cache")
+		return
+	}
+	nc.setLocal(key, values)
+	ttl := time.Duration(nc.conf.TTLSecs) * time.Second
+	if err := nc.radapter.SetTextTypeNorms(key, values, ttl); err != nil {
+		log.Error().Err(err).Str("corp", corp).Msg("failed to store norms to cache")
 	}
 }
 
-func NewNormsCache() *NormsCache {
+func NewNormsCache(radapter rdb.NormsStore, conf NormsCacheConf) *NormsCache {
 	return &NormsCache{
-		data: make(map[string]map[string]int64),
+		radapter:  radapter,
+		conf:      conf,
+		items:     make(map[string]*list.Element),
+		lru:       list.New(),
+		dataPaths: make(map[string]string),
 	}
 }
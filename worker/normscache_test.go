@@ -0,0 +1,102 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"fmt"
+	"mquery/rdb"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nullStatusWriter struct{}
+
+func (sw nullStatusWriter) Write(rec rdb.JobLog) {}
+
+// createTestCorpus creates a registry file along with
+// data files relevant for norms of `doc.txtype`
+func createTestCorpus(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data")
+	assert.NoError(t, os.MkdirAll(dataPath, 0755))
+	regPath := filepath.Join(dir, "testcorp")
+	assert.NoError(
+		t,
+		os.WriteFile(regPath, []byte(fmt.Sprintf("PATH \"%s/\"\n", dataPath)), 0644),
+	)
+	for _, f := range []string{"doc.rng", "doc.txtype.lex"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dataPath, f), []byte("data"), 0644))
+	}
+	return regPath, dataPath
+}
+
+func newTestNormsStore() rdb.NormsStore {
+	return rdb.NewInProcBroker(&rdb.Conf{QueryAnswerTimeoutSecs: 10}, nullStatusWriter{})
+}
+
+func TestNormsCacheSetGet(t *testing.T) {
+	regPath, _ := createTestCorpus(t)
+	nc := NewNormsCache(newTestNormsStore(), NormsCacheConf{TTLSecs: 60, MaxLocalItems: 10})
+	_, ok := nc.Get(regPath, "doc.txtype")
+	assert.False(t, ok)
+	nc.Set(regPath, "doc.txtype", map[string]int64{"FIC": 10, "NMG": 20})
+	v, ok := nc.Get(regPath, "doc.txtype")
+	assert.True(t, ok)
+	assert.Equal(t, int64(20), v["NMG"])
+	_, ok = nc.Get(regPath, "doc.genre")
+	assert.False(t, ok)
+}
+
+func TestNormsCacheShared(t *testing.T) {
+	regPath, _ := createTestCorpus(t)
+	store := newTestNormsStore()
+	nc1 := NewNormsCache(store, NormsCacheConf{TTLSecs: 60, MaxLocalItems: 10})
+	nc2 := NewNormsCache(store, NormsCacheConf{TTLSecs: 60, MaxLocalItems: 10})
+	nc1.Set(regPath, "doc.txtype", map[string]int64{"FIC": 10})
+	v, ok := nc2.Get(regPath, "doc.txtype")
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), v["FIC"])
+}
+
+func TestNormsCacheBoundedLocally(t *testing.T) {
+	regPath, _ := createTestCorpus(t)
+	nc := NewNormsCache(newTestNormsStore(), NormsCacheConf{TTLSecs: 60, MaxLocalItems: 1})
+	nc.Set(regPath, "doc.txtype", map[string]int64{"FIC": 10})
+	nc.Set(regPath, "doc.genre", map[string]int64{"prose": 5})
+	assert.Equal(t, 1, nc.lru.Len())
+	// evicted from the local cache but still available in the shared one
+	v, ok := nc.Get(regPath, "doc.txtype")
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), v["FIC"])
+	assert.Equal(t, 1, nc.lru.Len())
+}
+
+func TestNormsCacheInvalidatedByDataChange(t *testing.T) {
+	regPath, dataPath := createTestCorpus(t)
+	nc := NewNormsCache(newTestNormsStore(), NormsCacheConf{TTLSecs: 60, MaxLocalItems: 10})
+	nc.Set(regPath, "doc.txtype", map[string]int64{"FIC": 10})
+	future := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dataPath, "doc.rng"), future, future))
+	_, ok := nc.Get(regPath, "doc.txtype")
+	assert.False(t, ok)
+}
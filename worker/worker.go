@@ -22,13 +22,15 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"mquery/corpus"
+	"mquery/mango"
 	"mquery/merror"
 	"mquery/rdb"
 	"mquery/rdb/results"
 	"os/exec"
+	"sync"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 )
 
@@ -36,35 +38,160 @@ const (
 	DefaultTickerInterval = 2 * time.Second
 )
 
+// runningJob is a query currently processed by one of worker's slots
+type runningJob struct {
+	query   rdb.Query
+	abort   *mango.AbortSignal
+	started time.Time
+}
+
 type Worker struct {
-	ID         string
-	messages   <-chan *redis.Message
-	radapter   *rdb.Adapter
-	ticker     time.Ticker
-	normsCache *NormsCache
+	ID           string
+	messages     <-chan string
+	radapter     rdb.QueryConsumer
+	ticker       time.Ticker
+	normsCache   *NormsCache
+	corpusPool   *mango.CorpusPool
+	concCache    *ConcCache
+	relMarginals *relMarginalsCache
+	conf         *Conf
+	corporaSetup *corpus.CorporaSetup
+
+	// slots limits the number of queries processed in parallel
+	slots chan struct{}
+
+	// slotReleased notifies the main loop that another
+	// query can be processed
+	slotReleased chan struct{}
+
+	running   map[*runningJob]struct{}
+	runningMu sync.Mutex
+	wg        sync.WaitGroup
+
+	// stopping is set once Stop is called so no other
+	// queries are taken (guarded by runningMu)
+	stopping bool
 }
 
 func (w *Worker) Start(ctx context.Context) {
+	// queries left by a previous instance with the same ID
+	// (e.g. after a crash) must be handled before we start
+	// to report heartbeats
+	if err := w.radapter.RecoverWorkerQueries(w.ID); err != nil {
+		log.Error().Err(err).Str("workerId", w.ID).Msg("failed to recover unfinished queries")
+	}
+	go w.runHeartbeat(ctx)
+	if w.conf.JobMemoryLimitMB > 0 {
+		baseline, err := processRSS()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to determine worker memory, memory limit disabled")
+
+		} else {
+			go w.runMemoryWatchdog(ctx, baseline)
+		}
+	}
+	log.Info().
+		Str("workerId", w.ID).
+		Int("maxNumConcurrentJobs", cap(w.slots)).
+		Msg("starting worker")
 	go func() {
+		if w.conf.NormsCache.WarmOnStart {
+			// note: we run this before any query is processed
+			// so the warming does not compete with queries
+			w.warmNormsCache(ctx)
+		}
 		for {
 			select {
 			case <-w.ticker.C:
-				w.tryNextQuery()
+				w.tryNextQueries()
 			case <-ctx.Done():
 				log.Info().Msg("about to close MQuery worker")
 				return
 			case msg := <-w.messages:
-				if msg.Payload == rdb.MsgNewQuery {
-					w.tryNextQuery()
+				if msg == rdb.MsgNewQuery {
+					w.tryNextQueries()
 				}
+			case <-w.slotReleased:
+				w.tryNextQueries()
 			}
 		}
 	}()
 }
 
+func (w *Worker) runHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(rdb.DefaultHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.radapter.Heartbeat(w.ID); err != nil {
+			log.Error().Err(err).Str("workerId", w.ID).Msg("failed to report heartbeat")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// warmNormsCache makes sure text type norms for `ttOverviewAttrs`
+// of all the configured corpora are available in the norms cache.
+func (w *Worker) warmNormsCache(ctx context.Context) {
+	if w.corporaSetup.ZeroConfCorpora {
+		log.Warn().Msg("zero-conf corpora enabled, norms cache warming skipped")
+		return
+	}
+	t0 := time.Now()
+	var numCalc int
+	for _, corpConf := range w.corporaSetup.GetAllCorpora("") {
+		corpusPath := w.corporaSetup.GetRegistryPath(corpConf.ID)
+		for _, attr := range corpConf.TextProperties.ListOverviewProps() {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			if _, ok := w.normsCache.Get(corpusPath, string(attr)); ok {
+				continue
+			}
+			norms, err := w.textTypesNormsOf(corpusPath, string(attr))
+			if err != nil {
+				log.Error().
+					Err(err).
+					Str("corpus", corpConf.ID).
+					Str("attr", string(attr)).
+					Msg("failed to calculate text type norms")
+				continue
+			}
+			w.normsCache.Set(corpusPath, string(attr), norms)
+			numCalc++
+		}
+	}
+	log.Info().
+		Int("numCalculated", numCalc).
+		Dur("duration", time.Since(t0)).
+		Msg("norms cache warmed")
+}
+
+// Stop waits for running queries to finish. Queries not finished
+// in time (given by `ctx`) will be recovered (see rdb.Adapter.RecoverWorkerQueries).
+// Corpus handles are closed only after all the running queries return.
 func (w *Worker) Stop(ctx context.Context) error {
 	log.Warn().Str("workerId", w.ID).Msg("shutting down MQuery worker")
-	return nil
+	w.runningMu.Lock()
+	w.stopping = true
+	w.runningMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		w.corpusPool.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("running queries not finished in time")
+	}
 }
 
 func (w *Worker) publishResult(
@@ -72,14 +199,38 @@ func (w *Worker) publishResult(
 	query rdb.Query,
 	t0 time.Time,
 ) error {
-	return w.radapter.PublishResult(
-		query.Channel,
-		rdb.WorkerResult{
-			ID:        w.ID,
-			Value:     res,
-			ProcBegin: t0,
-			ProcEnd:   time.Now(),
-		})
+	wr := rdb.WorkerResult{
+		ID:        w.ID,
+		Value:     res,
+		ProcBegin: t0,
+		ProcEnd:   time.Now(),
+	}
+	if query.JobID != "" {
+		return w.radapter.FinishJob(query.JobID, wr)
+	}
+	return w.radapter.PublishResult(query, wr)
+}
+
+// clientWaits tests whether a client still waits for a result
+// of the query. In case of doubt, true is returned.
+func (w *Worker) clientWaits(query rdb.Query) bool {
+	ans, err := w.radapter.SomeoneListens(query.Channel)
+	if err != nil {
+		log.Error().Err(err).Str("channel", query.Channel).Msg("failed to test channel listeners")
+		return true
+	}
+	return ans
+}
+
+// reportProgress stores progress of an asynchronous job.
+// For other queries (nobody could read the progress), nothing is done.
+func (w *Worker) reportProgress(query rdb.Query, progress float64) {
+	if query.JobID == "" {
+		return
+	}
+	if err := w.radapter.SetJobProgress(query.JobID, progress); err != nil {
+		log.Error().Err(err).Str("jobId", query.JobID).Msg("failed to report job progress")
+	}
 }
 
 // runQueryProtected runs required function (query)
@@ -91,7 +242,9 @@ func (w *Worker) publishResult(
 // This may happen in the following cases:
 // 1) the called backend function panics
 // 2) the function is unable to publish its result or error
-func (w *Worker) runQueryProtected(query rdb.Query) (ansErr error) {
+// The `abort` signal is passed to long-running functions so they
+// can be stopped once the query is cancelled.
+func (w *Worker) runQueryProtected(query rdb.Query, abort *mango.AbortSignal) (ansErr error) {
 	defer func() {
 		if r := recover(); r != nil {
 			ansErr = merror.PanicValueToErr(r)
@@ -110,7 +263,7 @@ func (w *Worker) runQueryProtected(query rdb.Query) (ansErr error) {
 			return
 		}
 	case rdb.FreqDistribArgs:
-		ans := w.freqDistrib(tArgs)
+		ans := w.freqDistrib(tArgs, abort)
 		if ans.Error != nil {
 			ans.Error = wrapError(ans.Error)
 		}
@@ -119,7 +272,7 @@ func (w *Worker) runQueryProtected(query rdb.Query) (ansErr error) {
 			return
 		}
 	case rdb.TermFrequencyArgs:
-		ans := w.concSize(rdb.ConcordanceArgs(tArgs))
+		ans := w.concSize(rdb.ConcordanceArgs(tArgs), abort)
 		if ans.Error != nil {
 			ans.Error = wrapError(ans.Error)
 		}
@@ -128,7 +281,7 @@ func (w *Worker) runQueryProtected(query rdb.Query) (ansErr error) {
 			return
 		}
 	case rdb.ConcordanceArgs:
-		ans := w.concordance(tArgs)
+		ans := w.concordance(tArgs, abort)
 		if ans.Error != nil {
 			ans.Error = wrapError(ans.Error)
 		}
@@ -137,7 +290,7 @@ func (w *Worker) runQueryProtected(query rdb.Query) (ansErr error) {
 			return
 		}
 	case rdb.CollocationsArgs:
-		ans := w.collocations(tArgs)
+		ans := w.collocations(tArgs, abort)
 		if ans.Error != nil {
 			ans.Error = wrapError(ans.Error)
 		}
@@ -145,8 +298,19 @@ func (w *Worker) runQueryProtected(query rdb.Query) (ansErr error) {
 			ansErr = w.publishResult(results.Collocations{Error: err}, query, t0)
 			return
 		}
+	case rdb.CollocationCountsArgs:
+		ans := w.collocationCounts(tArgs, abort)
+		if ans.Error != nil {
+			ans.Error = wrapError(ans.Error)
+		}
+		if err := w.publishResult(ans, query, t0); err != nil {
+			ansErr = w.publishResult(results.CollCounts{Error: err}, query, t0)
+			return
+		}
 	case rdb.CalcCollFreqDataArgs:
-		ans := w.calcCollFreqData(tArgs)
+		ans := w.calcCollFreqData(tArgs, func(progress float64) {
+			w.reportProgress(query, progress)
+		})
 		if ans.Error != nil {
 			ans.Error = wrapError(ans.Error)
 		}
@@ -181,6 +345,57 @@ func (w *Worker) runQueryProtected(query rdb.Query) (ansErr error) {
 			ansErr = w.publishResult(results.TextTypesAvailValues{Error: err}, query, t0)
 			return
 		}
+	case rdb.WordSketchArgs:
+		ans := w.wordSketch(tArgs, abort)
+		if ans.Error != nil {
+			ans.Error = wrapError(ans.Error)
+		}
+		if err := w.publishResult(ans, query, t0); err != nil {
+			ansErr = w.publishResult(results.WordSketch{Error: err}, query, t0)
+			return
+		}
+	case rdb.ThesaurusArgs:
+		ans := w.thesaurus(tArgs, abort)
+		if ans.Error != nil {
+			ans.Error = wrapError(ans.Error)
+		}
+		if err := w.publishResult(ans, query, t0); err != nil {
+			ansErr = w.publishResult(results.Thesaurus{Error: err}, query, t0)
+			return
+		}
+	case rdb.WordlistArgs:
+		ans := w.wordlist(tArgs, abort)
+		if ans.Error != nil {
+			ans.Error = wrapError(ans.Error)
+		}
+		if err := w.publishResult(ans, query, t0); err != nil {
+			ansErr = w.publishResult(results.Wordlist{Error: err}, query, t0)
+			return
+		}
+	case rdb.DispersionArgs:
+		ans := w.dispersion(tArgs, abort)
+		if ans.Error != nil {
+			ans.Error = wrapError(ans.Error)
+		}
+		if err := w.publishResult(ans, query, t0); err != nil {
+			ansErr = w.publishResult(results.Dispersion{Error: err}, query, t0)
+			return
+		}
+	case rdb.CreateSubcorpusArgs:
+		ans := w.createSubcorpus(tArgs, abort)
+		if ans.Error == nil && !w.clientWaits(query) {
+			// the client has given up (cancelled or timed out) so nobody
+			// would complete the subcorpus by indexing it
+			ans.Error = merror.CancelledError{Msg: "subcorpus client not waiting anymore"}
+		}
+		if ans.Error != nil {
+			removeSubcorpus(tArgs.SubcPath)
+			ans.Error = wrapError(ans.Error)
+		}
+		if err := w.publishResult(ans, query, t0); err != nil {
+			ansErr = w.publishResult(results.Subcorpus{Error: err}, query, t0)
+			return
+		}
 	default:
 		ans := rdb.ErrorResult{
 			Error: merror.InternalError{
@@ -194,25 +409,81 @@ func (w *Worker) runQueryProtected(query rdb.Query) (ansErr error) {
 	return nil
 }
 
-func (w *Worker) tryNextQuery() {
+// tryNextQueries takes queued queries and processes them
+// in parallel as long as there are free slots.
+func (w *Worker) tryNextQueries() {
+	for {
+		select {
+		case w.slots <- struct{}{}:
+		default:
+			return // all slots are busy
+		}
+		w.runningMu.Lock()
+		if w.stopping {
+			w.runningMu.Unlock()
+			<-w.slots
+			return
+		}
+		// note: the Add must not race with Wait in Stop
+		w.wg.Add(1)
+		w.runningMu.Unlock()
+		query, ok := w.nextQuery()
+		if !ok {
+			<-w.slots
+			w.wg.Done()
+			return
+		}
+		go func() {
+			defer func() {
+				<-w.slots
+				w.wg.Done()
+				select {
+				case w.slotReleased <- struct{}{}:
+				default:
+				}
+			}()
+			w.processQuery(query)
+		}()
+	}
+}
 
+func (w *Worker) nextQuery() (rdb.Query, bool) {
 	time.Sleep(time.Duration(rand.Intn(40)) * time.Millisecond)
-	query, err := w.radapter.DequeueQuery()
+	query, err := w.radapter.DequeueQuery(w.ID)
 	if err == rdb.ErrorEmptyQueue {
-		return
+		return rdb.Query{}, false
 
 	} else if err != nil {
 		log.Error().Err(err).Msg("failed to fetch next job")
-		return
+		return rdb.Query{}, false
 	}
+	return query, true
+}
+
+func (w *Worker) processQuery(query rdb.Query) {
+	defer func() {
+		if err := w.radapter.AckQuery(w.ID, query); err != nil {
+			log.Error().Err(err).Str("channel", query.Channel).Msg("failed to remove processed query")
+		}
+	}()
 	log.Info().
 		Str("workerId", w.ID).
 		Str("channel", query.Channel).
 		Str("func", query.Func).
+		Int("attempt", query.Attempt).
 		Any("args", query.Args).
 		Msg("received query")
 
-	isActive, err := w.radapter.SomeoneListens(query.Channel)
+	var isActive bool
+	var err error
+	if query.JobID != "" {
+		// for asynchronous jobs, nobody listens on the channel,
+		// so we rather test whether the job still exists
+		isActive, err = w.radapter.StartJob(query.JobID, w.ID)
+
+	} else {
+		isActive, err = w.radapter.SomeoneListens(query.Channel)
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("failed to test channel listeners")
 		return
@@ -221,12 +492,51 @@ func (w *Worker) tryNextQuery() {
 		log.Warn().
 			Str("func", query.Func).
 			Str("channel", query.Channel).
+			Str("jobId", query.JobID).
 			Any("args", query.Args).
 			Msg("worker found an inactive query")
 		return
 	}
 
-	if err := w.runQueryProtected(query); err != nil {
+	abort := mango.NewAbortSignal()
+	defer abort.Close()
+	stopWatching := w.radapter.WatchCancellation(query.Channel, func() {
+		log.Warn().
+			Str("workerId", w.ID).
+			Str("channel", query.Channel).
+			Str("func", query.Func).
+			Msg("query cancelled, aborting")
+		abort.Abort()
+	})
+	defer stopWatching()
+	if abort.IsAborted() {
+		return
+	}
+	if w.conf.JobTimeLimitSecs > 0 {
+		limit := time.Duration(w.conf.JobTimeLimitSecs) * time.Second
+		tmr := time.AfterFunc(limit, func() {
+			log.Warn().
+				Str("workerId", w.ID).
+				Str("channel", query.Channel).
+				Str("func", query.Func).
+				Msg("query time limit exceeded, aborting")
+			abort.AbortWithReason(merror.TimeoutError{
+				Msg: fmt.Sprintf("query processing time limit exceeded (limit: %v)", limit),
+			})
+		})
+		defer tmr.Stop()
+	}
+	job := &runningJob{query: query, abort: abort, started: time.Now()}
+	w.runningMu.Lock()
+	w.running[job] = struct{}{}
+	w.runningMu.Unlock()
+	defer func() {
+		w.runningMu.Lock()
+		delete(w.running, job)
+		w.runningMu.Unlock()
+	}()
+
+	if err := w.runQueryProtected(query, abort); err != nil {
 		// if we're here, a more serious error likely occured,
 		// but we still try to publish the result (even if the
 		// publishing might have been the cause of the problem)
@@ -250,14 +560,28 @@ func (w *Worker) tokenCoverage(mktokencovPath, subcPath, corpusPath, structure s
 
 func NewWorker(
 	workerID string,
-	radapter *rdb.Adapter,
-	messages <-chan *redis.Message,
+	radapter rdb.QueryConsumer,
+	messages <-chan string,
+	conf *Conf,
+	corporaSetup *corpus.CorporaSetup,
 ) *Worker {
+	concCache, err := NewConcCache(conf.ConcCache)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to initialize concordance cache, cache disabled")
+	}
 	return &Worker{
-		ID:         workerID,
-		radapter:   radapter,
-		messages:   messages,
-		ticker:     *time.NewTicker(DefaultTickerInterval),
-		normsCache: NewNormsCache(),
+		ID:           workerID,
+		radapter:     radapter,
+		messages:     messages,
+		ticker:       *time.NewTicker(DefaultTickerInterval),
+		normsCache:   NewNormsCache(radapter, conf.NormsCache),
+		corpusPool:   mango.NewCorpusPool(conf.MaxIdleCorpusHandles),
+		concCache:    concCache,
+		relMarginals: newRelMarginalsCache(),
+		conf:         conf,
+		corporaSetup: corporaSetup,
+		slots:        make(chan struct{}, max(conf.MaxNumConcurrentJobs, 1)),
+		slotReleased: make(chan struct{}, 1),
+		running:      make(map[*runningJob]struct{}),
 	}
 }
@@ -0,0 +1,67 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"mquery/rdb"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestWorker() (*Worker, *rdb.InProcBroker) {
+	broker := rdb.NewInProcBroker(&rdb.Conf{QueryAnswerTimeoutSecs: 10}, nullStatusWriter{})
+	return NewWorker("w1", broker, broker.Subscribe(), &Conf{MaxNumConcurrentJobs: 2}, nil), broker
+}
+
+func TestStopWaitsForRunningQueries(t *testing.T) {
+	w, _ := newTestWorker()
+	// simulates a running query
+	w.wg.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, w.Stop(ctx))
+
+	finished := make(chan error)
+	go func() {
+		finished <- w.Stop(context.Background())
+	}()
+	select {
+	case <-finished:
+		t.Fatal("Stop returned while a query is still running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	w.wg.Done()
+	assert.NoError(t, <-finished)
+}
+
+func TestStoppedWorkerTakesNoQueries(t *testing.T) {
+	w, broker := newTestWorker()
+	assert.NoError(t, w.Stop(context.Background()))
+	_, err := broker.PublishQuery(context.Background(), rdb.Query{Func: "concordance"}, 0)
+	assert.NoError(t, err)
+	w.tryNextQueries()
+	query, err := broker.DequeueQuery("w2")
+	assert.NoError(t, err)
+	assert.Equal(t, "concordance", query.Func)
+	assert.Len(t, w.slots, 0)
+}
@@ -0,0 +1,425 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"mquery/corpus/wsketch"
+	"mquery/mango"
+	"mquery/merror"
+	"mquery/rdb"
+	"mquery/rdb/results"
+	"slices"
+	"sync"
+
+	"github.com/czcorpus/cnc-gokit/maths"
+)
+
+const (
+	// maxCachedRelMarginals is the maximum number of relations
+	// with marginal frequencies kept in memory
+	maxCachedRelMarginals = 200
+)
+
+// wsContext is a (relation, collocate) pair of a headword
+type wsContext struct {
+	relation *wsketch.Relation
+	word     string
+	score    float64
+}
+
+// relMarginals contains relation-level frequencies of a grammatical
+// relation R - i.e. f(*, R, c) for collocates and f(h, R, *) for headwords.
+type relMarginals struct {
+	colls map[string]int64
+	heads map[string]int64
+}
+
+// relMarginalsCache keeps marginal frequencies of relations as their
+// calculation requires the relation patterns to be evaluated on the
+// whole corpus (with no headword specified). The values do not depend
+// on a headword so they can be reused by all the word sketch queries.
+type relMarginalsCache struct {
+	mu    sync.Mutex
+	items map[string]*relMarginals
+	order []string
+}
+
+func (rmc *relMarginalsCache) get(key string) (*relMarginals, bool) {
+	rmc.mu.Lock()
+	defer rmc.mu.Unlock()
+	v, ok := rmc.items[key]
+	return v, ok
+}
+
+func (rmc *relMarginalsCache) set(key string, value *relMarginals) {
+	rmc.mu.Lock()
+	defer rmc.mu.Unlock()
+	if _, ok := rmc.items[key]; !ok {
+		rmc.order = append(rmc.order, key)
+	}
+	rmc.items[key] = value
+	for len(rmc.order) > maxCachedRelMarginals {
+		delete(rmc.items, rmc.order[0])
+		rmc.order = rmc.order[1:]
+	}
+}
+
+func newRelMarginalsCache() *relMarginalsCache {
+	return &relMarginalsCache{items: make(map[string]*relMarginals)}
+}
+
+func logDice(fAB, fA, fB int64) float64 {
+	score, _ := mango.CollScore('d', float64(fAB), float64(fA), float64(fB), 0)
+	return score
+}
+
+func (w *Worker) loadSketchGrammar(mcorp *mango.Corpus, wsDefPath string) (*wsketch.Grammar, string, error) {
+	if wsDefPath == "" {
+		var err error
+		wsDefPath, err = mcorp.Conf("WSDEF")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to determine sketch grammar: %w", err)
+		}
+	}
+	if wsDefPath == "" {
+		return nil, "", merror.InputError{Msg: "no sketch grammar available for the corpus"}
+	}
+	grammar, err := wsketch.LoadGrammar(wsDefPath)
+	return grammar, wsDefPath, err
+}
+
+// freqsByPatterns calculates frequencies of values found at positions
+// given by `fcrit` for all the queries of a relation and merges them.
+// The `minFreq` is applied to the merged frequencies. The total frequency
+// of the relation (including values below `minFreq`) is returned as well.
+// Concordances are not stored to the concordance cache as the queries
+// are specific for a single headword (or collocate).
+func (w *Worker) freqsByPatterns(
+	mcorp *mango.Corpus,
+	rel *wsketch.Relation,
+	mkQuery func(p wsketch.Pattern) (string, error),
+	mkFcrit func(p wsketch.Pattern) string,
+	minFreq int,
+	abort *mango.AbortSignal,
+) (map[string]int64, int64, error) {
+	ans := make(map[string]int64)
+	var total int64
+	for _, pattern := range rel.Patterns {
+		query, err := mkQuery(pattern)
+		if err != nil {
+			return ans, 0, err
+		}
+		freqs, err := mcorp.FreqDist(
+			"", query, mkFcrit(pattern), 1, nil, mango.ConcSample{}, mango.ConcFile{}, abort)
+		if err != nil {
+			return ans, 0, err
+		}
+		for i, word := range freqs.Words {
+			if word != "" {
+				ans[word] += freqs.Freqs[i]
+				total += freqs.Freqs[i]
+			}
+		}
+	}
+	for word, freq := range ans {
+		if freq < int64(minFreq) {
+			delete(ans, word)
+		}
+	}
+	return ans, total, nil
+}
+
+// relationMarginals returns relation-level frequencies of collocates
+// and headwords of a relation (see relMarginals).
+func (w *Worker) relationMarginals(
+	mcorp *mango.Corpus,
+	wsDefPath string,
+	rel *wsketch.Relation,
+	attr string,
+	abort *mango.AbortSignal,
+) (*relMarginals, error) {
+	key := fmt.Sprintf(
+		"%s\t%d\t%s\t%s\t%s", mcorp.Path(), mcorp.ModTime().UnixNano(), wsDefPath, attr, rel.Name)
+	if v, ok := w.relMarginals.get(key); ok {
+		return v, nil
+	}
+	ans := &relMarginals{}
+	var err error
+	noConstraint := func(p wsketch.Pattern) (string, error) { return p.Query, nil }
+	ans.colls, _, err = w.freqsByPatterns(
+		mcorp, rel, noConstraint, func(p wsketch.Pattern) string { return p.CollFcrit(attr) }, 1, abort)
+	if err != nil {
+		return nil, err
+	}
+	ans.heads, _, err = w.freqsByPatterns(
+		mcorp, rel, noConstraint, func(p wsketch.Pattern) string { return p.HeadFcrit(attr) }, 1, abort)
+	if err != nil {
+		return nil, err
+	}
+	w.relMarginals.set(key, ans)
+	return ans, nil
+}
+
+// sketchRelations calculates collocates of the headword for all
+// the relations of the grammar. Collocates are sorted by their
+// logDice score and at most `maxItems` are returned per relation.
+// The logDice is calculated from relation-level frequencies -
+// i.e. f(w, R, *) for the headword and f(*, R, c) for a collocate.
+func (w *Worker) sketchRelations(
+	mcorp *mango.Corpus,
+	grammar *wsketch.Grammar,
+	wsDefPath string,
+	attr string,
+	headword string,
+	minFreq int,
+	maxItems int,
+	abort *mango.AbortSignal,
+) ([]*results.WordSketchRelation, error) {
+	ans := make([]*results.WordSketchRelation, 0, len(grammar.Relations))
+	for _, rel := range grammar.Relations {
+		collFreqs, total, err := w.freqsByPatterns(
+			mcorp,
+			rel,
+			func(p wsketch.Pattern) (string, error) { return p.HeadwordQuery(attr, headword) },
+			func(p wsketch.Pattern) string { return p.CollFcrit(attr) },
+			minFreq,
+			abort,
+		)
+		if err != nil {
+			return ans, fmt.Errorf("failed to process relation %s: %w", rel.Name, err)
+		}
+		item := &results.WordSketchRelation{
+			Name:       rel.Name,
+			Freq:       total,
+			Collocates: make([]*results.WordSketchCollocate, 0, len(collFreqs)),
+		}
+		if len(collFreqs) > 0 {
+			marginals, err := w.relationMarginals(mcorp, wsDefPath, rel, attr, abort)
+			if err != nil {
+				return ans, fmt.Errorf("failed to process relation %s: %w", rel.Name, err)
+			}
+			for word, freq := range collFreqs {
+				item.Collocates = append(
+					item.Collocates,
+					&results.WordSketchCollocate{
+						Word:  word,
+						Freq:  freq,
+						Score: maths.RoundToN(logDice(freq, total, marginals.colls[word]), 4),
+					},
+				)
+			}
+		}
+		slices.SortFunc(item.Collocates, func(a, b *results.WordSketchCollocate) int {
+			return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.Word, b.Word))
+		})
+		if len(item.Collocates) > maxItems {
+			item.Collocates = item.Collocates[:maxItems]
+		}
+		ans = append(ans, item)
+	}
+	return ans, nil
+}
+
+// precompiledWordSketch reads a word sketch from data compiled by Manatee
+func (w *Worker) precompiledWordSketch(mcorp *mango.Corpus, args rdb.WordSketchArgs) results.WordSketch {
+	ans := results.WordSketch{Headword: args.Headword}
+	data, err := mcorp.PrecompiledWordSketch(
+		args.WSBase, args.Attr, args.Headword, int64(args.MinFreq), args.MaxItems)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	ans.HeadwordFreq = data.HeadwordFreq
+	ans.Relations = make([]*results.WordSketchRelation, 0, 30)
+	var curr *results.WordSketchRelation
+	for _, item := range data.Items {
+		if curr == nil || curr.Name != item.Relation {
+			curr = &results.WordSketchRelation{
+				Name:       item.Relation,
+				Freq:       item.RelationFreq,
+				Collocates: make([]*results.WordSketchCollocate, 0, args.MaxItems),
+			}
+			ans.Relations = append(ans.Relations, curr)
+		}
+		curr.Collocates = append(
+			curr.Collocates,
+			&results.WordSketchCollocate{
+				Word:  item.Word,
+				Freq:  item.Freq,
+				Score: maths.RoundToN(item.Score, 4),
+			},
+		)
+	}
+	return ans
+}
+
+func (w *Worker) wordSketch(args rdb.WordSketchArgs, abort *mango.AbortSignal) results.WordSketch {
+	ans := results.WordSketch{Headword: args.Headword}
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	if args.WSBase != "" {
+		return w.precompiledWordSketch(mcorp, args)
+	}
+	grammar, wsDefPath, err := w.loadSketchGrammar(mcorp, args.WSDefPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	ans.HeadwordFreq, err = mcorp.AttrValueFreq(args.Attr, args.Headword)
+	if err != nil || ans.HeadwordFreq == 0 {
+		ans.Error = err
+		return ans
+	}
+	ans.Relations, err = w.sketchRelations(
+		mcorp, grammar, wsDefPath, args.Attr, args.Headword, args.MinFreq, args.MaxItems, abort)
+	if err != nil {
+		ans.Error = err
+	}
+	return ans
+}
+
+// precompiledThesaurus reads similar words from data compiled by Manatee
+func (w *Worker) precompiledThesaurus(mcorp *mango.Corpus, args rdb.ThesaurusArgs) results.Thesaurus {
+	ans := results.Thesaurus{Headword: args.Headword}
+	data, err := mcorp.PrecompiledThesaurus(args.WSThes, args.Attr, args.Headword, args.MaxItems)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	ans.HeadwordFreq = data.HeadwordFreq
+	ans.Items = make([]*results.ThesaurusItem, len(data.Items))
+	for i, item := range data.Items {
+		ans.Items[i] = &results.ThesaurusItem{
+			Word:           item.Word,
+			Score:          maths.RoundToN(item.Score, 4),
+			SharedContexts: int(item.Freq),
+		}
+	}
+	return ans
+}
+
+// thesaurus finds words similar to the headword based on shared
+// word sketch contexts (i.e. (relation, collocate) pairs). For each
+// of the headword's best contexts, words appearing in the same context
+// are searched and the similarity of a word is the sum of minimum scores
+// of shared contexts relative to the sum of the headword's context scores.
+// In case precompiled thesaurus data are available, they are used instead.
+func (w *Worker) thesaurus(args rdb.ThesaurusArgs, abort *mango.AbortSignal) results.Thesaurus {
+	ans := results.Thesaurus{Headword: args.Headword}
+	mcorp, err := w.corpusPool.Get(args.CorpusPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	defer w.corpusPool.Put(mcorp)
+	if args.WSThes != "" {
+		return w.precompiledThesaurus(mcorp, args)
+	}
+	grammar, wsDefPath, err := w.loadSketchGrammar(mcorp, args.WSDefPath)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	ans.HeadwordFreq, err = mcorp.AttrValueFreq(args.Attr, args.Headword)
+	if err != nil || ans.HeadwordFreq == 0 {
+		ans.Error = err
+		return ans
+	}
+	relations, err := w.sketchRelations(
+		mcorp, grammar, wsDefPath, args.Attr, args.Headword, args.MinFreq, args.MaxContexts, abort)
+	if err != nil {
+		ans.Error = err
+		return ans
+	}
+	contexts := make([]wsContext, 0, len(relations)*args.MaxContexts)
+	for i, rel := range relations {
+		for _, coll := range rel.Collocates {
+			if coll.Score > 0 {
+				contexts = append(
+					contexts,
+					wsContext{relation: grammar.Relations[i], word: coll.Word, score: coll.Score},
+				)
+			}
+		}
+	}
+	slices.SortFunc(contexts, func(a, b wsContext) int {
+		return cmp.Compare(b.score, a.score)
+	})
+	if len(contexts) > args.MaxContexts {
+		contexts = contexts[:args.MaxContexts]
+	}
+
+	var totalScore float64
+	similarities := make(map[string]*results.ThesaurusItem)
+	for _, wctx := range contexts {
+		totalScore += wctx.score
+		marginals, err := w.relationMarginals(mcorp, wsDefPath, wctx.relation, args.Attr, abort)
+		if err != nil {
+			ans.Error = fmt.Errorf("failed to process relation %s: %w", wctx.relation.Name, err)
+			return ans
+		}
+		headFreqs, _, err := w.freqsByPatterns(
+			mcorp,
+			wctx.relation,
+			func(p wsketch.Pattern) (string, error) { return p.CollocateQuery(args.Attr, wctx.word) },
+			func(p wsketch.Pattern) string { return p.HeadFcrit(args.Attr) },
+			args.MinFreq,
+			abort,
+		)
+		if err != nil {
+			ans.Error = fmt.Errorf("failed to process relation %s: %w", wctx.relation.Name, err)
+			return ans
+		}
+		for word, freq := range headFreqs {
+			if word == args.Headword {
+				continue
+			}
+			score := logDice(freq, marginals.heads[word], marginals.colls[wctx.word])
+			if score <= 0 {
+				continue
+			}
+			item, ok := similarities[word]
+			if !ok {
+				item = &results.ThesaurusItem{Word: word}
+				similarities[word] = item
+			}
+			item.Score += math.Min(score, wctx.score)
+			item.SharedContexts++
+		}
+	}
+	ans.Items = make([]*results.ThesaurusItem, 0, len(similarities))
+	for _, item := range similarities {
+		item.Score = maths.RoundToN(item.Score/totalScore, 4)
+		ans.Items = append(ans.Items, item)
+	}
+	slices.SortFunc(ans.Items, func(a, b *results.ThesaurusItem) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.Word, b.Word))
+	})
+	if len(ans.Items) > args.MaxItems {
+		ans.Items = ans.Items[:args.MaxItems]
+	}
+	return ans
+}
@@ -0,0 +1,49 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelMarginalsCacheEvictsOldest(t *testing.T) {
+	cache := newRelMarginalsCache()
+	for i := 0; i < maxCachedRelMarginals+5; i++ {
+		cache.set(fmt.Sprintf("rel%d", i), &relMarginals{colls: map[string]int64{"a": int64(i)}})
+	}
+	assert.Len(t, cache.items, maxCachedRelMarginals)
+	_, ok := cache.get("rel0")
+	assert.False(t, ok)
+	v, ok := cache.get(fmt.Sprintf("rel%d", maxCachedRelMarginals+4))
+	assert.True(t, ok)
+	assert.Equal(t, int64(maxCachedRelMarginals+4), v.colls["a"])
+}
+
+func TestRelMarginalsCacheOverwrite(t *testing.T) {
+	cache := newRelMarginalsCache()
+	cache.set("rel", &relMarginals{heads: map[string]int64{"a": 1}})
+	cache.set("rel", &relMarginals{heads: map[string]int64{"a": 2}})
+	assert.Len(t, cache.order, 1)
+	v, ok := cache.get("rel")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), v.heads["a"])
+}